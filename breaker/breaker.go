@@ -0,0 +1,288 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+/*
+Package breaker implements circuit breaker for clients of AWS services.
+The circuit opens when the rate of service failures exceeds the threshold,
+requests fail fast while the circuit is open. The circuit is half-open
+after cooldown, it closes when probe requests succeed. Only failures of
+the service are counted (e.g. server errors, throttling, timeouts),
+responses such as not found or failed conditions are not failures.
+
+	b := breaker.New()
+	b.OnStateChange = func(from, to breaker.State) { ... }
+
+	db := ddb.Must(ddb.New[Person]("ddb:///my-table", breaker.DynamoDB(client, b), nil))
+*/
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go"
+)
+
+// State of the circuit
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("state(%d)", int(s))
+	}
+}
+
+/*
+Breaker is the state of circuit shared by clients. Failures are counted
+within the window, the circuit opens if the failure rate is exceeded.
+*/
+type Breaker struct {
+	// Window of failure rate, counters are reset when window is over
+	Window time.Duration
+	// MinRequests within window required to open the circuit
+	MinRequests int
+	// FailureRate that opens the circuit
+	FailureRate float64
+	// Cooldown of open circuit before probes
+	Cooldown time.Duration
+	// Probes is number of successful requests that closes half-open circuit,
+	// it is also the limit of concurrent requests while circuit is half-open
+	Probes int
+	// OnStateChange is called on each transition of the circuit by
+	// the request that caused it
+	OnStateChange func(from, to State)
+	// Clock of the breaker
+	Clock func() time.Time
+
+	mu       sync.Mutex
+	changes  [][2]State
+	state    State
+	gen      uint64
+	since    time.Time
+	requests int
+	failures int
+	inflight int
+}
+
+/*
+New creates circuit breaker. The circuit opens if half of requests fail
+within 10 seconds (at least 10 requests), it is probed after 5 seconds.
+*/
+func New() *Breaker {
+	return &Breaker{
+		Window:      10 * time.Second,
+		MinRequests: 10,
+		FailureRate: 0.5,
+		Cooldown:    5 * time.Second,
+		Probes:      1,
+		Clock:       time.Now,
+	}
+}
+
+// State of the circuit
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && !b.Clock().Before(b.since.Add(b.Cooldown)) {
+		return HalfOpen
+	}
+	return b.state
+}
+
+// allow the request, it returns generation of circuit state
+func (b *Breaker) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.notify()
+
+	now := b.Clock()
+
+	switch b.state {
+	case Closed:
+		if !now.Before(b.since.Add(b.Window)) {
+			b.since, b.requests, b.failures = now, 0, 0
+		}
+	case Open:
+		retry := b.since.Add(b.Cooldown)
+		if now.Before(retry) {
+			return 0, errOpen(retry)
+		}
+		b.transit(HalfOpen, now)
+		fallthrough
+	case HalfOpen:
+		if b.inflight >= max(1, b.Probes) {
+			return 0, errOpen(now)
+		}
+		b.inflight++
+	}
+
+	return b.gen, nil
+}
+
+// outcome of request
+type outcome int
+
+const (
+	// success is any response of the service, including client errors
+	success outcome = iota
+	// failure of the service
+	failure
+	// ignored request did not get response, e.g. cancelled by the caller
+	ignored
+)
+
+// done records the outcome of request
+func (b *Breaker) done(gen uint64, result outcome) {
+	b.mu.Lock()
+	defer b.notify()
+
+	// Note: outcomes of requests issued in other state are stale
+	if gen != b.gen {
+		return
+	}
+
+	now := b.Clock()
+
+	switch b.state {
+	case Closed:
+		if result == ignored {
+			return
+		}
+		b.requests++
+		if result == failure {
+			b.failures++
+		}
+		if b.requests >= b.MinRequests && float64(b.failures) >= b.FailureRate*float64(b.requests) {
+			b.transit(Open, now)
+		}
+	case HalfOpen:
+		b.inflight--
+		switch result {
+		case ignored:
+			return
+		case failure:
+			b.transit(Open, now)
+			return
+		}
+		b.requests++
+		if b.requests >= max(1, b.Probes) {
+			b.transit(Closed, now)
+		}
+	}
+}
+
+func (b *Breaker) transit(to State, now time.Time) {
+	from := b.state
+	b.state = to
+	b.gen++
+	b.since, b.requests, b.failures, b.inflight = now, 0, 0, 0
+
+	if b.OnStateChange != nil {
+		b.changes = append(b.changes, [2]State{from, to})
+	}
+}
+
+// notify releases the lock and calls back transitions outside of the lock
+func (b *Breaker) notify() {
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+
+	for _, c := range changes {
+		b.OnStateChange(c[0], c[1])
+	}
+}
+
+// call the function through the circuit
+func call[T any](ctx context.Context, b *Breaker, f func() (T, error)) (T, error) {
+	gen, err := b.allow()
+	if err != nil {
+		var none T
+		return none, err
+	}
+
+	val, err := f()
+	b.done(gen, outcomeOf(ctx, err))
+
+	return val, err
+}
+
+// error codes of throttling, these are client errors that signal overload
+var throttling = map[string]bool{
+	"ThrottlingException":                    true,
+	"ProvisionedThroughputExceededException": true,
+	"RequestLimitExceeded":                   true,
+	"SlowDown":                               true,
+}
+
+// outcomeOf classifies errors, only failures of service are counted
+func outcomeOf(ctx context.Context, err error) outcome {
+	if err == nil {
+		return success
+	}
+
+	// Note: the request cancelled by caller tells nothing about the service
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		return ignored
+	}
+
+	// Note: the fault of errors without modeled shape is unknown, the status
+	// code of response defines it
+	var status interface{ HTTPStatusCode() int }
+	if errors.As(err, &status) && status.HTTPStatusCode() >= 500 {
+		return failure
+	}
+
+	var e smithy.APIError
+	if errors.As(err, &e) {
+		if e.ErrorFault() == smithy.FaultServer || throttling[e.ErrorCode()] {
+			return failure
+		}
+		return success
+	}
+
+	return failure
+}
+
+//-----------------------------------------------------------------------------
+//
+// Errors
+//
+//-----------------------------------------------------------------------------
+
+/*
+Opened is an error returned while the circuit is open, it returns the time
+when the circuit is probed.
+*/
+type Opened interface{ Opened() time.Time }
+
+type opened time.Time
+
+func (e opened) Error() string {
+	return fmt.Sprintf("circuit is open until %s", time.Time(e).Format(time.RFC3339))
+}
+
+func (e opened) Opened() time.Time { return time.Time(e) }
+
+func errOpen(retry time.Time) error { return opened(retry) }
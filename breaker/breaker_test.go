@@ -0,0 +1,301 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package breaker_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/fogfish/curie"
+	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/breaker"
+	"github.com/holmes89/dynamo/service/ddb"
+	ddbemu "github.com/holmes89/dynamo/service/ddb/emulator"
+	s3api "github.com/holmes89/dynamo/service/s3"
+	s3emu "github.com/holmes89/dynamo/service/s3/emulator"
+)
+
+type person struct {
+	Prefix curie.IRI `dynamodbav:"prefix,omitempty"`
+	Suffix curie.IRI `dynamodbav:"suffix,omitempty"`
+	Name   string    `dynamodbav:"name,omitempty"`
+}
+
+func (p person) HashKey() curie.IRI { return p.Prefix }
+func (p person) SortKey() curie.IRI { return p.Suffix }
+
+// brownout fails reads of objects with the status code of response
+type brownout struct {
+	dynamo.S3
+	mu     sync.Mutex
+	status int
+	calls  int
+}
+
+func (s *brownout) GetObject(ctx context.Context, input *s3.GetObjectInput, opts ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	s.mu.Lock()
+	s.calls++
+	status := s.status
+	s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if status != 0 {
+		return nil, errResponse(status)
+	}
+	return s.S3.GetObject(ctx, input, opts...)
+}
+
+// set the status code of responses, zero is healthy service
+func (s *brownout) set(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// errResponse is the error of SDK for responses without modeled shape,
+// the fault of these errors is unknown
+func errResponse(status int) error {
+	return &smithy.OperationError{
+		ServiceID:     "S3",
+		OperationName: "GetObject",
+		Err: &awshttp.ResponseError{
+			RequestID: "request",
+			ResponseError: &smithyhttp.ResponseError{
+				Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+				Err:      &smithy.GenericAPIError{Code: http.StatusText(status), Message: http.StatusText(status)},
+			},
+		},
+	}
+}
+
+type clock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+type transitions struct {
+	mu  sync.Mutex
+	seq []string
+}
+
+func (t *transitions) OnStateChange(from, to breaker.State) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq = append(t.seq, from.String()+">"+to.String())
+}
+
+func fixture() (*brownout, *breaker.Breaker, *clock, dynamo.KeyVal[person]) {
+	c := &clock{t: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	b := breaker.New()
+	b.MinRequests = 4
+	b.Clock = c.Now
+
+	emu := s3emu.New()
+	s3api.Must(s3api.New[person]("s3:///test", emu, nil)).
+		Put(context.Background(), person{Prefix: "person:a", Name: "a"})
+
+	s := &brownout{S3: emu}
+	db := s3api.Must(s3api.New[person]("s3:///test", breaker.S3(s, b), nil))
+
+	return s, b, c, db
+}
+
+var opened breaker.Opened
+
+func TestTrip(t *testing.T) {
+	s, b, c, db := fixture()
+	key := person{Prefix: "person:a"}
+
+	s.set(http.StatusServiceUnavailable)
+	for i := 0; i < 4; i++ {
+		_, err := db.Get(context.Background(), key)
+		it.Ok(t).
+			IfNotNil(err).
+			If(errors.As(err, &opened)).Equal(false)
+	}
+
+	it.Ok(t).If(b.State()).Equal(breaker.Open)
+
+	_, err := db.Get(context.Background(), key)
+	it.Ok(t).
+		If(errors.As(err, &opened)).Equal(true).
+		If(opened.Opened()).Equal(c.Now().Add(5 * time.Second)).
+		If(s.calls).Equal(4)
+}
+
+func TestNotFoundIsNotFailure(t *testing.T) {
+	_, b, _, db := fixture()
+
+	for i := 0; i < 10; i++ {
+		_, err := db.Get(context.Background(), person{Prefix: "person:x"})
+		var e interface{ NotFound() string }
+		it.Ok(t).If(errors.As(err, &e)).Equal(true)
+	}
+
+	it.Ok(t).If(b.State()).Equal(breaker.Closed)
+}
+
+func TestFailureRate(t *testing.T) {
+	s, b, c, db := fixture()
+	key := person{Prefix: "person:a"}
+
+	// Note: failure rate 1/3 is below the threshold
+	for i := 0; i < 9; i++ {
+		if i%3 == 2 {
+			s.set(http.StatusInternalServerError)
+		} else {
+			s.set(0)
+		}
+		db.Get(context.Background(), key)
+	}
+	it.Ok(t).If(b.State()).Equal(breaker.Closed)
+
+	// Note: counters are reset after window
+	c.Advance(10 * time.Second)
+	s.set(http.StatusInternalServerError)
+	for i := 0; i < 3; i++ {
+		db.Get(context.Background(), key)
+	}
+	it.Ok(t).If(b.State()).Equal(breaker.Closed)
+
+	db.Get(context.Background(), key)
+	it.Ok(t).If(b.State()).Equal(breaker.Open)
+}
+
+func TestHalfOpen(t *testing.T) {
+	s, b, c, db := fixture()
+	key := person{Prefix: "person:a"}
+	log := &transitions{}
+	b.OnStateChange = log.OnStateChange
+
+	s.set(http.StatusInternalServerError)
+	for i := 0; i < 4; i++ {
+		db.Get(context.Background(), key)
+	}
+
+	// Note: failed probe opens the circuit again
+	c.Advance(5 * time.Second)
+	it.Ok(t).If(b.State()).Equal(breaker.HalfOpen)
+	_, err := db.Get(context.Background(), key)
+	it.Ok(t).
+		IfNotNil(err).
+		If(errors.As(err, &opened)).Equal(false).
+		If(b.State()).Equal(breaker.Open)
+
+	c.Advance(5 * time.Second)
+	s.set(0)
+	val, err := db.Get(context.Background(), key)
+	it.Ok(t).
+		IfNil(err).
+		If(val.Name).Equal("a").
+		If(b.State()).Equal(breaker.Closed)
+
+	it.Ok(t).If(log.seq).Equal([]string{
+		"closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed",
+	})
+}
+
+func TestClientErrorIsNotFailure(t *testing.T) {
+	s, b, _, db := fixture()
+
+	s.set(http.StatusBadRequest)
+	for i := 0; i < 10; i++ {
+		_, err := db.Get(context.Background(), person{Prefix: "person:a"})
+		it.Ok(t).IfNotNil(err)
+	}
+
+	it.Ok(t).If(b.State()).Equal(breaker.Closed)
+}
+
+func TestBatchNotSupported(t *testing.T) {
+	emu := ddbemu.New(ddbemu.Table{Name: "test", HashKey: "prefix", SortKey: "suffix"})
+
+	// Note: the client implements batch api only if the service does
+	_, ok := breaker.DynamoDB(struct{ dynamo.DynamoDB }{emu}, breaker.New()).(dynamo.DynamoDBBatch)
+	it.Ok(t).IfFalse(ok)
+
+	_, ok = breaker.DynamoDB(emu, breaker.New()).(dynamo.DynamoDBBatch)
+	it.Ok(t).IfTrue(ok)
+}
+
+// Note: condition failures are responses of the service
+func TestConditionIsNotFailure(t *testing.T) {
+	b := breaker.New()
+	b.MinRequests = 1
+
+	emu := ddbemu.New(ddbemu.Table{Name: "test", HashKey: "prefix", SortKey: "suffix"})
+	db := ddb.Must(ddb.New[person]("ddb:///test", breaker.DynamoDB(emu, b), nil))
+	name := dynamo.Schema1[person, string]("Name")
+
+	for i := 0; i < 5; i++ {
+		err := db.Put(context.Background(), person{Prefix: "person:a"}, name.Eq("x"))
+		var e interface{ PreConditionFailed() bool }
+		it.Ok(t).If(errors.As(err, &e)).Equal(true)
+	}
+
+	it.Ok(t).If(b.State()).Equal(breaker.Closed)
+}
+
+func TestCancelIsIgnored(t *testing.T) {
+	s, b, c, db := fixture()
+	key := person{Prefix: "person:a"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Note: cancelled requests do not lower the failure rate
+	s.set(http.StatusInternalServerError)
+	for i := 0; i < 3; i++ {
+		db.Get(context.Background(), key)
+	}
+	for i := 0; i < 10; i++ {
+		db.Get(ctx, key)
+	}
+	it.Ok(t).If(b.State()).Equal(breaker.Closed)
+
+	db.Get(context.Background(), key)
+	it.Ok(t).If(b.State()).Equal(breaker.Open)
+
+	// Note: cancelled probe neither closes nor opens the circuit
+	c.Advance(5 * time.Second)
+	s.set(0)
+	_, err := db.Get(ctx, key)
+	it.Ok(t).
+		If(errors.Is(err, context.Canceled)).Equal(true).
+		If(b.State()).Equal(breaker.HalfOpen)
+
+	val, err := db.Get(context.Background(), key)
+	it.Ok(t).
+		IfNil(err).
+		If(val.Name).Equal("a").
+		If(b.State()).Equal(breaker.Closed)
+}
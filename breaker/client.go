@@ -0,0 +1,133 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file implements circuit breaker for clients of AWS services
+//
+
+package breaker
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/holmes89/dynamo"
+)
+
+/*
+DynamoDB client that calls the service through the circuit. The client
+implements batch api if the service does.
+*/
+func DynamoDB(service dynamo.DynamoDB, b *Breaker) dynamo.DynamoDB {
+	client := &ddbClient{service: service, breaker: b}
+
+	if batch, ok := service.(dynamo.DynamoDBBatch); ok {
+		return &ddbBatchClient{ddbClient: client, batch: batch}
+	}
+
+	return client
+}
+
+type ddbClient struct {
+	service dynamo.DynamoDB
+	breaker *Breaker
+}
+
+func (c *ddbClient) GetItem(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return call(ctx, c.breaker, func() (*dynamodb.GetItemOutput, error) {
+		return c.service.GetItem(ctx, input, opts...)
+	})
+}
+
+func (c *ddbClient) PutItem(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	return call(ctx, c.breaker, func() (*dynamodb.PutItemOutput, error) {
+		return c.service.PutItem(ctx, input, opts...)
+	})
+}
+
+func (c *ddbClient) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	return call(ctx, c.breaker, func() (*dynamodb.DeleteItemOutput, error) {
+		return c.service.DeleteItem(ctx, input, opts...)
+	})
+}
+
+func (c *ddbClient) UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	return call(ctx, c.breaker, func() (*dynamodb.UpdateItemOutput, error) {
+		return c.service.UpdateItem(ctx, input, opts...)
+	})
+}
+
+func (c *ddbClient) Query(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	return call(ctx, c.breaker, func() (*dynamodb.QueryOutput, error) {
+		return c.service.Query(ctx, input, opts...)
+	})
+}
+
+type ddbBatchClient struct {
+	*ddbClient
+	batch dynamo.DynamoDBBatch
+}
+
+func (c *ddbBatchClient) BatchGetItem(ctx context.Context, input *dynamodb.BatchGetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	return call(ctx, c.breaker, func() (*dynamodb.BatchGetItemOutput, error) {
+		return c.batch.BatchGetItem(ctx, input, opts...)
+	})
+}
+
+func (c *ddbBatchClient) BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	return call(ctx, c.breaker, func() (*dynamodb.BatchWriteItemOutput, error) {
+		return c.batch.BatchWriteItem(ctx, input, opts...)
+	})
+}
+
+func (c *ddbBatchClient) TransactGetItems(ctx context.Context, input *dynamodb.TransactGetItemsInput, opts ...func(*dynamodb.Options)) (*dynamodb.TransactGetItemsOutput, error) {
+	return call(ctx, c.breaker, func() (*dynamodb.TransactGetItemsOutput, error) {
+		return c.batch.TransactGetItems(ctx, input, opts...)
+	})
+}
+
+func (c *ddbBatchClient) TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, opts ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	return call(ctx, c.breaker, func() (*dynamodb.TransactWriteItemsOutput, error) {
+		return c.batch.TransactWriteItems(ctx, input, opts...)
+	})
+}
+
+// S3 client that calls the service through the circuit
+func S3(service dynamo.S3, b *Breaker) dynamo.S3 {
+	return &s3Client{service: service, breaker: b}
+}
+
+type s3Client struct {
+	service dynamo.S3
+	breaker *Breaker
+}
+
+func (c *s3Client) GetObject(ctx context.Context, input *s3.GetObjectInput, opts ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return call(ctx, c.breaker, func() (*s3.GetObjectOutput, error) {
+		return c.service.GetObject(ctx, input, opts...)
+	})
+}
+
+func (c *s3Client) PutObject(ctx context.Context, input *s3.PutObjectInput, opts ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return call(ctx, c.breaker, func() (*s3.PutObjectOutput, error) {
+		return c.service.PutObject(ctx, input, opts...)
+	})
+}
+
+func (c *s3Client) DeleteObject(ctx context.Context, input *s3.DeleteObjectInput, opts ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	return call(ctx, c.breaker, func() (*s3.DeleteObjectOutput, error) {
+		return c.service.DeleteObject(ctx, input, opts...)
+	})
+}
+
+func (c *s3Client) ListObjectsV2(ctx context.Context, input *s3.ListObjectsV2Input, opts ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	return call(ctx, c.breaker, func() (*s3.ListObjectsV2Output, error) {
+		return c.service.ListObjectsV2(ctx, input, opts...)
+	})
+}
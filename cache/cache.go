@@ -0,0 +1,300 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+/*
+Package cache implements read-through/write-through caching of key/value
+storage. Entities are cached with TTL, unknown entities are cached as
+negative entries so that repeated lookups of missing keys do not reach
+the storage. Concurrent misses of the same key are collapsed into single
+read. Writes through the cache update or invalidate entries, pattern
+matching is not cached.
+
+	db := cache.New(ddb.Must(ddb.New[Person]("ddb:///my-table", nil, nil)),
+	  cache.NewLRU[Person](10000),
+	)
+*/
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/holmes89/dynamo"
+	"golang.org/x/sync/singleflight"
+)
+
+/*
+Entry of the cache. The negative entry caches the absence of entity.
+*/
+type Entry[T any] struct {
+	Value    T         `json:"value,omitempty"`
+	NotFound bool      `json:"notFound,omitempty"`
+	Expires  time.Time `json:"expires"`
+}
+
+/*
+Cache is the pluggable storage of cache entries, e.g. process-local LRU or
+external cache. Errors of the cache are not fatal, the failed lookup is a
+miss. Implementations of external caches might use Expires of entries for
+its own eviction.
+*/
+type Cache[T any] interface {
+	Get(ctx context.Context, key string) (Entry[T], bool, error)
+	Set(ctx context.Context, key string, entry Entry[T]) error
+	Remove(ctx context.Context, key string) error
+}
+
+/*
+KeyVal is caching decorator of key/value storage. Values are shared by
+readers, entities with references (slices, maps, pointers) must not be
+mutated.
+*/
+type KeyVal[T dynamo.Thing] struct {
+	dynamo.KeyVal[T]
+	Cache Cache[T]
+
+	// TTL of cached entities
+	TTL time.Duration
+	// NegativeTTL of cached absence of entities, zero disables negative caching
+	NegativeTTL time.Duration
+	// Clock of the cache
+	Clock func() time.Time
+
+	group singleflight.Group
+	// slots of keys with operations in flight
+	mu        sync.Mutex
+	slots     map[string]*slot
+	undefined T
+}
+
+/*
+slot versions writes of the key. The version is incremented when the write
+starts and completes, the value read concurrently with writes is not cached.
+The cache entry is checked and updated holding the lock of slot, so that
+the stale value never overwrites the new one. The slot exists while
+operations over the key are in flight.
+*/
+type slot struct {
+	sync.Mutex
+	version atomic.Uint64
+	refs    int
+}
+
+/*
+New creates caching decorator of key/value storage. Entities are cached
+for 1 minute, absence of entities for 10 seconds.
+*/
+func New[T dynamo.Thing](keyval dynamo.KeyVal[T], cache Cache[T]) *KeyVal[T] {
+	return &KeyVal[T]{
+		KeyVal:      keyval,
+		Cache:       cache,
+		TTL:         1 * time.Minute,
+		NegativeTTL: 10 * time.Second,
+		Clock:       time.Now,
+	}
+}
+
+// key of cache entry
+func keyOf(thing dynamo.Thing) string {
+	sortKey := string(thing.SortKey())
+	if sortKey == "" {
+		sortKey = "_"
+	}
+
+	return string(thing.HashKey()) + "\x00" + sortKey
+}
+
+// Get item from cache, the storage is read on miss
+func (db *KeyVal[T]) Get(ctx context.Context, key T) (T, error) {
+	at := keyOf(key)
+
+	if entry, has, err := db.Cache.Get(ctx, at); err == nil && has {
+		switch {
+		case !db.Clock().Before(entry.Expires):
+			db.Cache.Remove(ctx, at)
+		case entry.NotFound:
+			return db.undefined, errNotFound(key)
+		default:
+			return entry.Value, nil
+		}
+	}
+
+	// Note: the read is shared by callers, it is not cancelled by any of them
+	ch := db.group.DoChan(at, func() (any, error) {
+		return db.load(context.WithoutCancel(ctx), at, key)
+	})
+
+	select {
+	case <-ctx.Done():
+		return db.undefined, ctx.Err()
+	case val := <-ch:
+		if val.Err != nil {
+			return db.undefined, val.Err
+		}
+		return val.Val.(T), nil
+	}
+}
+
+// acquire slot of the key
+func (db *KeyVal[T]) acquire(at string) *slot {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.slots == nil {
+		db.slots = map[string]*slot{}
+	}
+
+	s, has := db.slots[at]
+	if !has {
+		s = &slot{}
+		db.slots[at] = s
+	}
+	s.refs++
+
+	return s
+}
+
+// release slot of the key
+func (db *KeyVal[T]) release(at string, s *slot) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if s.refs--; s.refs == 0 {
+		delete(db.slots, at)
+	}
+}
+
+// load entity from storage into cache
+func (db *KeyVal[T]) load(ctx context.Context, at string, key T) (T, error) {
+	s := db.acquire(at)
+	defer db.release(at, s)
+
+	version := s.version.Load()
+
+	val, err := db.KeyVal.Get(ctx, key)
+	if err != nil && !recoverNotFound(err) {
+		return db.undefined, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.version.Load() != version {
+		return val, err
+	}
+
+	switch {
+	case err == nil && db.TTL > 0:
+		db.Cache.Set(ctx, at, Entry[T]{Value: val, Expires: db.Clock().Add(db.TTL)})
+	case err != nil && db.NegativeTTL > 0:
+		db.Cache.Set(ctx, at, Entry[T]{NotFound: true, Expires: db.Clock().Add(db.NegativeTTL)})
+	}
+
+	return val, err
+}
+
+// begin write of the key, it returns the version of write
+func (db *KeyVal[T]) begin(at string) (*slot, uint64) {
+	s := db.acquire(at)
+	return s, s.version.Add(1)
+}
+
+/*
+commit write of the key. The entity is cached unless the key is written
+concurrently, the entry is invalidated otherwise or if entity is nil.
+*/
+func (db *KeyVal[T]) commit(ctx context.Context, at string, s *slot, version uint64, entity *T) {
+	defer db.release(at, s)
+
+	s.Lock()
+	defer s.Unlock()
+
+	stale := s.version.Load() != version
+	s.version.Add(1)
+
+	if stale || entity == nil || db.TTL <= 0 {
+		db.Cache.Remove(ctx, at)
+		return
+	}
+
+	if err := db.Cache.Set(ctx, at, Entry[T]{Value: *entity, Expires: db.Clock().Add(db.TTL)}); err != nil {
+		db.Cache.Remove(ctx, at)
+	}
+}
+
+// Put writes entity to storage and cache
+func (db *KeyVal[T]) Put(ctx context.Context, entity T, config ...dynamo.Constraint[T]) error {
+	at := keyOf(entity)
+	s, version := db.begin(at)
+
+	if err := db.KeyVal.Put(ctx, entity, config...); err != nil {
+		db.commit(ctx, at, s, version, nil)
+		return err
+	}
+
+	db.commit(ctx, at, s, version, &entity)
+	return nil
+}
+
+// Remove discards the entity from storage and cache
+func (db *KeyVal[T]) Remove(ctx context.Context, key T, config ...dynamo.Constraint[T]) error {
+	at := keyOf(key)
+	s, version := db.begin(at)
+
+	err := db.KeyVal.Remove(ctx, key, config...)
+	db.commit(ctx, at, s, version, nil)
+
+	return err
+}
+
+// Update applies a partial patch to entity, new values are cached
+func (db *KeyVal[T]) Update(ctx context.Context, entity T, config ...dynamo.Constraint[T]) (T, error) {
+	at := keyOf(entity)
+	s, version := db.begin(at)
+
+	val, err := db.KeyVal.Update(ctx, entity, config...)
+	if err != nil {
+		db.commit(ctx, at, s, version, nil)
+		return db.undefined, err
+	}
+
+	db.commit(ctx, at, s, version, &val)
+	return val, nil
+}
+
+//-----------------------------------------------------------------------------
+//
+// Errors
+//
+//-----------------------------------------------------------------------------
+
+func recoverNotFound(err error) bool {
+	var e interface{ NotFound() string }
+
+	ok := errors.As(err, &e)
+	return ok && e.NotFound() != ""
+}
+
+// NotFound is an error to handle cached absence of elements
+func errNotFound(thing dynamo.Thing) error {
+	return &notFound{Thing: thing}
+}
+
+type notFound struct{ dynamo.Thing }
+
+func (e *notFound) Error() string {
+	return fmt.Sprintf("Not Found (%s, %s)", e.HashKey(), e.SortKey())
+}
+
+func (e *notFound) NotFound() string {
+	return e.HashKey().Safe() + " " + e.SortKey().Safe()
+}
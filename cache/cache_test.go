@@ -0,0 +1,304 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fogfish/curie"
+	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/cache"
+	"github.com/holmes89/dynamo/service/mem"
+)
+
+type person struct {
+	Prefix curie.IRI `dynamodbav:"prefix,omitempty"`
+	Suffix curie.IRI `dynamodbav:"suffix,omitempty"`
+	Name   string    `dynamodbav:"name,omitempty"`
+}
+
+func (p person) HashKey() curie.IRI { return p.Prefix }
+func (p person) SortKey() curie.IRI { return p.Suffix }
+
+// storage counts reads, the read is blocked until gate is closed
+type storage struct {
+	dynamo.KeyVal[person]
+	reads atomic.Int32
+	gate  chan struct{}
+}
+
+func (s *storage) Get(ctx context.Context, key person) (person, error) {
+	s.reads.Add(1)
+	if s.gate != nil {
+		<-s.gate
+	}
+	return s.KeyVal.Get(ctx, key)
+}
+
+type clock struct{ t time.Time }
+
+func (c *clock) Now() time.Time          { return c.t }
+func (c *clock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func fixture() (*storage, *cache.KeyVal[person], *clock) {
+	s := &storage{KeyVal: mem.Must(mem.New[person]("mem:///person", mem.NewTable()))}
+	s.KeyVal.Put(context.Background(), person{Prefix: "person:a", Name: "a"})
+
+	c := &clock{t: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	db := cache.New[person](s, cache.NewLRU[person](10))
+	db.Clock = c.Now
+
+	return s, db, c
+}
+
+var notFound interface{ NotFound() string }
+
+func TestReadThrough(t *testing.T) {
+	s, db, c := fixture()
+
+	for i := 0; i < 3; i++ {
+		val, err := db.Get(context.Background(), person{Prefix: "person:a"})
+		it.Ok(t).
+			IfNil(err).
+			If(val.Name).Equal("a")
+	}
+	it.Ok(t).If(s.reads.Load()).Equal(int32(1))
+
+	c.Advance(time.Minute)
+	db.Get(context.Background(), person{Prefix: "person:a"})
+	it.Ok(t).If(s.reads.Load()).Equal(int32(2))
+}
+
+func TestNegativeCaching(t *testing.T) {
+	s, db, c := fixture()
+
+	for i := 0; i < 3; i++ {
+		_, err := db.Get(context.Background(), person{Prefix: "person:x"})
+		it.Ok(t).If(errors.As(err, &notFound)).Equal(true)
+	}
+	it.Ok(t).If(s.reads.Load()).Equal(int32(1))
+
+	c.Advance(10 * time.Second)
+	db.Get(context.Background(), person{Prefix: "person:x"})
+	it.Ok(t).If(s.reads.Load()).Equal(int32(2))
+
+	db.NegativeTTL = 0
+	db.Get(context.Background(), person{Prefix: "person:y"})
+	db.Get(context.Background(), person{Prefix: "person:y"})
+	it.Ok(t).If(s.reads.Load()).Equal(int32(4))
+}
+
+func TestWriteThrough(t *testing.T) {
+	s, db, _ := fixture()
+	key := person{Prefix: "person:b"}
+
+	_, err := db.Get(context.Background(), key)
+	it.Ok(t).If(errors.As(err, &notFound)).Equal(true)
+
+	it.Ok(t).IfNil(db.Put(context.Background(), person{Prefix: "person:b", Name: "b"}))
+	val, err := db.Get(context.Background(), key)
+	it.Ok(t).
+		IfNil(err).
+		If(val.Name).Equal("b")
+
+	val, err = db.Update(context.Background(), person{Prefix: "person:b", Name: "c"})
+	it.Ok(t).
+		IfNil(err).
+		If(val.Name).Equal("c")
+
+	val, err = db.Get(context.Background(), key)
+	it.Ok(t).
+		IfNil(err).
+		If(val.Name).Equal("c")
+
+	it.Ok(t).IfNil(db.Remove(context.Background(), key))
+	_, err = db.Get(context.Background(), key)
+	it.Ok(t).
+		If(errors.As(err, &notFound)).Equal(true).
+		If(s.reads.Load()).Equal(int32(2))
+}
+
+func TestFailedWriteInvalidates(t *testing.T) {
+	s, db, _ := fixture()
+	name := dynamo.Schema1[person, string]("Name")
+	key := person{Prefix: "person:a"}
+
+	db.Get(context.Background(), key)
+	err := db.Put(context.Background(), person{Prefix: "person:a", Name: "x"}, name.Eq("x"))
+	it.Ok(t).IfNotNil(err)
+
+	val, err := db.Get(context.Background(), key)
+	it.Ok(t).
+		IfNil(err).
+		If(val.Name).Equal("a").
+		If(s.reads.Load()).Equal(int32(2))
+}
+
+func TestSingleFlight(t *testing.T) {
+	s, db, _ := fixture()
+	s.gate = make(chan struct{})
+
+	var wg sync.WaitGroup
+	vals := make(chan string, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, _ := db.Get(context.Background(), person{Prefix: "person:a"})
+			vals <- val.Name
+		}()
+	}
+
+	for s.reads.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(s.gate)
+	wg.Wait()
+	close(vals)
+
+	for val := range vals {
+		it.Ok(t).If(val).Equal("a")
+	}
+	it.Ok(t).If(s.reads.Load()).Equal(int32(1))
+}
+
+func TestWriteDuringRead(t *testing.T) {
+	s, db, c := fixture()
+
+	read := func(write func()) {
+		s.gate = make(chan struct{})
+		reads := s.reads.Load()
+
+		done := make(chan struct{})
+		go func() {
+			db.Get(context.Background(), person{Prefix: "person:a"})
+			close(done)
+		}()
+
+		for s.reads.Load() == reads {
+			time.Sleep(time.Millisecond)
+		}
+		write()
+		close(s.gate)
+		<-done
+		s.gate = nil
+	}
+
+	// Note: writes of other keys do not interfere with caching
+	read(func() { db.Remove(context.Background(), person{Prefix: "person:b"}) })
+	val, err := db.Get(context.Background(), person{Prefix: "person:a"})
+	it.Ok(t).
+		IfNil(err).
+		If(val.Name).Equal("a").
+		If(s.reads.Load()).Equal(int32(1))
+
+	// Note: the value read concurrently with write of the key is not cached
+	c.Advance(time.Minute)
+	read(func() { db.Put(context.Background(), person{Prefix: "person:a", Name: "b"}) })
+	val, err = db.Get(context.Background(), person{Prefix: "person:a"})
+	it.Ok(t).
+		IfNil(err).
+		If(val.Name).Equal("b").
+		If(s.reads.Load()).Equal(int32(2))
+}
+
+// lru blocks caching of the entity with the name until gate is closed
+type lru struct {
+	*cache.LRU[person]
+	name  string
+	entry chan struct{}
+	gate  chan struct{}
+}
+
+func (c *lru) Set(ctx context.Context, key string, entry cache.Entry[person]) error {
+	if entry.Value.Name == c.name {
+		close(c.entry)
+		<-c.gate
+	}
+	return c.LRU.Set(ctx, key, entry)
+}
+
+func TestWriteDuringCaching(t *testing.T) {
+	s, _, _ := fixture()
+	c := &lru{LRU: cache.NewLRU[person](10), name: "a", entry: make(chan struct{}), gate: make(chan struct{})}
+	db := cache.New[person](s, c)
+	key := person{Prefix: "person:a"}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		db.Get(context.Background(), key)
+	}()
+
+	// Note: the read value is being cached while the key is written
+	<-c.entry
+	go func() {
+		defer wg.Done()
+		db.Put(context.Background(), person{Prefix: "person:a", Name: "b"})
+	}()
+
+	for {
+		val, _ := s.KeyVal.Get(context.Background(), key)
+		if val.Name == "b" {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(c.gate)
+	wg.Wait()
+
+	val, err := db.Get(context.Background(), key)
+	it.Ok(t).
+		IfNil(err).
+		If(val.Name).Equal("b")
+}
+
+func TestCancel(t *testing.T) {
+	s, db, _ := fixture()
+	s.gate = make(chan struct{})
+	defer close(s.gate)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := db.Get(ctx, person{Prefix: "person:a"})
+	it.Ok(t).If(errors.Is(err, context.DeadlineExceeded)).Equal(true)
+}
+
+func TestLRU(t *testing.T) {
+	lru := cache.NewLRU[int](2)
+	ctx := context.Background()
+
+	lru.Set(ctx, "a", cache.Entry[int]{Value: 1})
+	lru.Set(ctx, "b", cache.Entry[int]{Value: 2})
+	lru.Get(ctx, "a")
+	lru.Set(ctx, "c", cache.Entry[int]{Value: 3})
+
+	_, hasA, _ := lru.Get(ctx, "a")
+	_, hasB, _ := lru.Get(ctx, "b")
+	c, hasC, _ := lru.Get(ctx, "c")
+	it.Ok(t).
+		If(hasA).Equal(true).
+		If(hasB).Equal(false).
+		If(hasC).Equal(true).
+		If(c.Value).Equal(3).
+		If(lru.Len()).Equal(2)
+
+	lru.Remove(ctx, "a")
+	it.Ok(t).If(lru.Len()).Equal(1)
+}
@@ -0,0 +1,105 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file implements process-local LRU cache
+//
+
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+/*
+LRU is process-local cache bounded by number of entries, the least
+recently used entry is evicted.
+*/
+type LRU[T any] struct {
+	mu    sync.Mutex
+	size  int
+	queue *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry[T any] struct {
+	key   string
+	entry Entry[T]
+}
+
+// NewLRU creates cache of given size
+func NewLRU[T any](size int) *LRU[T] {
+	if size < 1 {
+		size = 1
+	}
+
+	return &LRU[T]{
+		size:  size,
+		queue: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Get entry from cache
+func (lru *LRU[T]) Get(_ context.Context, key string) (Entry[T], bool, error) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	e, has := lru.items[key]
+	if !has {
+		return Entry[T]{}, false, nil
+	}
+
+	lru.queue.MoveToFront(e)
+	return e.Value.(*lruEntry[T]).entry, true, nil
+}
+
+// Set entry to cache
+func (lru *LRU[T]) Set(_ context.Context, key string, entry Entry[T]) error {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	if e, has := lru.items[key]; has {
+		e.Value.(*lruEntry[T]).entry = entry
+		lru.queue.MoveToFront(e)
+		return nil
+	}
+
+	lru.items[key] = lru.queue.PushFront(&lruEntry[T]{key: key, entry: entry})
+
+	for lru.queue.Len() > lru.size {
+		e := lru.queue.Back()
+		lru.queue.Remove(e)
+		delete(lru.items, e.Value.(*lruEntry[T]).key)
+	}
+
+	return nil
+}
+
+// Remove entry from cache
+func (lru *LRU[T]) Remove(_ context.Context, key string) error {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	if e, has := lru.items[key]; has {
+		lru.queue.Remove(e)
+		delete(lru.items, key)
+	}
+
+	return nil
+}
+
+// Len is number of entries in cache
+func (lru *LRU[T]) Len() int {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+
+	return lru.queue.Len()
+}
@@ -0,0 +1,341 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file declares functional combinators over sequences
+//
+
+package dynamo
+
+import (
+	"errors"
+	"iter"
+)
+
+//-----------------------------------------------------------------------------
+//
+// Lazy combinators
+//
+//-----------------------------------------------------------------------------
+
+/*
+Map lazily transforms elements of sequence
+
+	seq := dynamo.Map(db.Match(ctx, key), func(x Article) Category { ... })
+*/
+func Map[T, U Thing](seq Seq[T], f func(T) U) Seq[U] {
+	return newLazySeq(seq, func(x T) (U, bool, bool) { return f(x), true, false })
+}
+
+/*
+Filter lazily selects elements of sequence that satisfy the predicate
+*/
+func Filter[T Thing](seq Seq[T], f func(T) bool) Seq[T] {
+	return newLazySeq(seq, func(x T) (T, bool, bool) { return x, f(x), false })
+}
+
+/*
+TakeWhile lazily selects elements of sequence while they satisfy the predicate
+*/
+func TakeWhile[T Thing](seq Seq[T], f func(T) bool) Seq[T] {
+	return newLazySeq(seq, func(x T) (T, bool, bool) {
+		if f(x) {
+			return x, true, false
+		}
+		return x, false, true
+	})
+}
+
+/*
+Distinct lazily skips elements with duplicate identity
+*/
+func Distinct[T Thing](seq Seq[T]) Seq[T] {
+	type key struct{ hashKey, sortKey string }
+
+	seen := map[key]struct{}{}
+	return newLazySeq(seq, func(x T) (T, bool, bool) {
+		k := key{string(x.HashKey()), string(x.SortKey())}
+		if _, has := seen[k]; has {
+			return x, false, false
+		}
+		seen[k] = struct{}{}
+		return x, true, false
+	})
+}
+
+/*
+Chunk lazily splits elements of sequence into slices of n elements,
+the last chunk might be shorter. It fails if n is less than 1.
+
+	for chunk, err := range dynamo.Chunk(db.Match(ctx, key), 25) { ... }
+*/
+func Chunk[T Thing](seq Seq[T], n int) iter.Seq2[[]T, error] {
+	return func(yield func([]T, error) bool) {
+		if n < 1 {
+			yield(nil, errInvalidChunkSize)
+			return
+		}
+
+		chunk := make([]T, 0, n)
+		for x, err := range All(seq) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			chunk = append(chunk, x)
+			if len(chunk) >= n {
+				if !yield(chunk, nil) {
+					return
+				}
+				chunk = make([]T, 0, n)
+			}
+		}
+
+		if len(chunk) > 0 {
+			yield(chunk, nil)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+//
+// Strict combinators
+//
+//-----------------------------------------------------------------------------
+
+/*
+Fold elements of sequence into accumulator
+
+	sum, err := dynamo.Fold(db.Match(ctx, key), 0,
+	  func(acc int, x Person) int { return acc + x.Age },
+	)
+*/
+func Fold[T Thing, A any](seq Seq[T], acc A, f func(A, T) A) (A, error) {
+	for x, err := range All(seq) {
+		if err != nil {
+			return acc, err
+		}
+		acc = f(acc, x)
+	}
+
+	return acc, nil
+}
+
+/*
+Reduce elements of sequence using the first element as accumulator.
+It returns zero value for empty sequence.
+*/
+func Reduce[T Thing](seq Seq[T], f func(T, T) T) (T, error) {
+	var (
+		acc     T
+		isFirst = true
+	)
+
+	for x, err := range All(seq) {
+		if err != nil {
+			return acc, err
+		}
+
+		if isFirst {
+			acc, isFirst = x, false
+			continue
+		}
+		acc = f(acc, x)
+	}
+
+	return acc, nil
+}
+
+/*
+GroupBy elements of sequence by the key
+*/
+func GroupBy[T Thing, K comparable](seq Seq[T], f func(T) K) (map[K][]T, error) {
+	return Fold(seq, map[K][]T{},
+		func(acc map[K][]T, x T) map[K][]T {
+			k := f(x)
+			acc[k] = append(acc[k], x)
+			return acc
+		},
+	)
+}
+
+//-----------------------------------------------------------------------------
+//
+// Lazy sequence
+//
+//-----------------------------------------------------------------------------
+
+/*
+lazySeq applies step function over the sequence. The step function either
+emits an element, skips it or stops the sequence. The sequence retains
+the cursor of underlying one, limit is applied to underlying storage page.
+*/
+type lazySeq[T, U Thing] struct {
+	seq     Seq[T]
+	step    func(T) (U, bool, bool)
+	head    U
+	started bool
+	stopped bool
+	err     error
+}
+
+func newLazySeq[T, U Thing](seq Seq[T], step func(T) (U, bool, bool)) *lazySeq[T, U] {
+	return &lazySeq[T, U]{seq: seq, step: step}
+}
+
+var (
+	errEndOfSeq         = errors.New("end of sequence")
+	errInvalidChunkSize = errors.New("chunk size must be positive")
+)
+
+// next moves the sequence to next emitted element
+func (seq *lazySeq[T, U]) next() bool {
+	seq.started = true
+
+	for !seq.stopped && seq.err == nil && seq.seq.Tail() {
+		x, err := seq.seq.Head()
+		if err != nil {
+			seq.err = err
+			return false
+		}
+
+		y, emit, stop := seq.step(x)
+		if stop {
+			seq.stopped = true
+			return false
+		}
+
+		if emit {
+			seq.head = y
+			return true
+		}
+	}
+
+	return false
+}
+
+// Head selects the first element of sequence
+func (seq *lazySeq[T, U]) Head() (U, error) {
+	if !seq.started && !seq.next() {
+		var none U
+		if seq.err != nil {
+			return none, seq.err
+		}
+		return none, errEndOfSeq
+	}
+
+	return seq.head, nil
+}
+
+// Tail selects the all elements except the first one
+func (seq *lazySeq[T, U]) Tail() bool {
+	return seq.next()
+}
+
+// Error returns error of stream evaluation
+func (seq *lazySeq[T, U]) Error() error {
+	if seq.err != nil {
+		return seq.err
+	}
+	return seq.seq.Error()
+}
+
+// Cursor is the global position in the sequence
+func (seq *lazySeq[T, U]) Cursor() Thing {
+	return seq.seq.Cursor()
+}
+
+// Limit sequence size to N elements of underlying storage
+func (seq *lazySeq[T, U]) Limit(n int) Seq[U] {
+	seq.seq.Limit(n)
+	return seq
+}
+
+// Continue limited sequence from the cursor
+func (seq *lazySeq[T, U]) Continue(cursor Thing) Seq[U] {
+	seq.seq.Continue(cursor)
+	return seq
+}
+
+// Reverse order of sequence
+func (seq *lazySeq[T, U]) Reverse() Seq[U] {
+	seq.seq.Reverse()
+	return seq
+}
+
+// FMap transforms sequence
+func (seq *lazySeq[T, U]) FMap(f func(U) error) error {
+	for x, err := range All(seq) {
+		if err != nil {
+			return err
+		}
+
+		if err := f(x); err != nil {
+			return errProcessEntity(err, x)
+		}
+	}
+
+	return nil
+}
+
+// All iterates over elements of sequence
+func (seq *lazySeq[T, U]) All() iter.Seq2[U, error] {
+	return func(yield func(U, error) bool) {
+		for page, err := range seq.Pages() {
+			if err != nil {
+				var none U
+				yield(none, err)
+				return
+			}
+
+			for _, x := range page.Items {
+				if !yield(x, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Pages iterates over pages of sequence
+func (seq *lazySeq[T, U]) Pages() iter.Seq2[Page[U], error] {
+	return func(yield func(Page[U], error) bool) {
+		for page, err := range Pages(seq.seq) {
+			if err != nil {
+				yield(Page[U]{}, err)
+				return
+			}
+
+			items := make([]U, 0, len(page.Items))
+			for _, x := range page.Items {
+				y, emit, stop := seq.step(x)
+				if stop {
+					seq.stopped = true
+					break
+				}
+
+				if emit {
+					items = append(items, y)
+				}
+			}
+
+			next := Page[U]{
+				Items:        items,
+				Count:        len(items),
+				ScannedCount: page.ScannedCount,
+				Capacity:     page.Capacity,
+				Cursor:       page.Cursor,
+			}
+
+			if !yield(next, nil) || seq.stopped {
+				return
+			}
+		}
+	}
+}
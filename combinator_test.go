@@ -0,0 +1,151 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package dynamo_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/fogfish/curie"
+	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb/ddbtest"
+	"github.com/holmes89/dynamo/internal/dynamotest"
+)
+
+type age struct{ dynamotest.Person }
+
+func (x age) SortKey() curie.IRI { return curie.New("age:%d", x.Age) }
+
+func ages(seq dynamo.Seq[dynamotest.Person]) ([]int, error) {
+	return dynamo.Fold(seq, []int{},
+		func(acc []int, x dynamotest.Person) []int { return append(acc, x.Age) },
+	)
+}
+
+func TestMap(t *testing.T) {
+	ctx := context.Background()
+	seq := dynamo.Map(fixtureSeq(ctx, 2, 2),
+		func(x dynamotest.Person) age { return age{x} },
+	)
+
+	keys := []curie.IRI{}
+	for seq.Tail() {
+		x, err := seq.Head()
+		it.Ok(t).If(err).Should().Equal(nil)
+		keys = append(keys, x.SortKey())
+	}
+
+	it.Ok(t).
+		If(seq.Error()).Should().Equal(nil).
+		If(fmt.Sprint(keys)).Should().Equal("[age:0 age:1 age:2 age:3]")
+}
+
+func TestFilter(t *testing.T) {
+	ctx := context.Background()
+	seq := dynamo.Filter(fixtureSeq(ctx, 3, 2),
+		func(x dynamotest.Person) bool { return x.Age%2 == 0 },
+	)
+
+	val, err := ages(seq)
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(fmt.Sprint(val)).Should().Equal("[0 2 4]")
+}
+
+func TestTakeWhile(t *testing.T) {
+	ctx := context.Background()
+	seq := dynamo.TakeWhile(fixtureSeq(ctx, 3, 2),
+		func(x dynamotest.Person) bool { return x.Age < 3 },
+	)
+
+	val, err := ages(seq)
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(fmt.Sprint(val)).Should().Equal("[0 1 2]")
+}
+
+func TestTakeWhileHead(t *testing.T) {
+	ctx := context.Background()
+	seq := dynamo.TakeWhile(fixtureSeq(ctx, 3, 2),
+		func(x dynamotest.Person) bool { return x.Age < 1 },
+	)
+
+	head, err := seq.Head()
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(head.Age).Should().Equal(0).
+		IfFalse(seq.Tail())
+}
+
+func TestDistinct(t *testing.T) {
+	item, _ := attributevalue.MarshalMap(dynamotest.Person{Prefix: "a", Suffix: "1"})
+	page := []map[string]types.AttributeValue{item, item}
+	db := ddbtest.QueryPages[dynamotest.Person](page)
+
+	seq := dynamo.Distinct(db.Match(context.Background(), dynamotest.Person{Prefix: "a"}))
+
+	var val dynamo.Things[dynamotest.Person]
+	err := seq.FMap(val.Join)
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(len(val)).Should().Equal(1)
+}
+
+func TestChunk(t *testing.T) {
+	ctx := context.Background()
+
+	chunks := []int{}
+	for chunk, err := range dynamo.Chunk(fixtureSeq(ctx, 3, 2), 4) {
+		it.Ok(t).If(err).Should().Equal(nil)
+		chunks = append(chunks, len(chunk))
+	}
+
+	it.Ok(t).If(fmt.Sprint(chunks)).Should().Equal("[4 2]")
+
+	for _, n := range []int{0, -1} {
+		errs := 0
+		for chunk, err := range dynamo.Chunk(fixtureSeq(ctx, 3, 2), n) {
+			it.Ok(t).If(len(chunk)).Should().Equal(0).IfNotNil(err)
+			errs++
+		}
+		it.Ok(t).If(errs).Should().Equal(1)
+	}
+}
+
+func TestReduce(t *testing.T) {
+	ctx := context.Background()
+
+	val, err := dynamo.Reduce(fixtureSeq(ctx, 3, 2),
+		func(a, b dynamotest.Person) dynamotest.Person {
+			a.Age += b.Age
+			return a
+		},
+	)
+
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(val.Age).Should().Equal(15)
+}
+
+func TestGroupBy(t *testing.T) {
+	ctx := context.Background()
+
+	val, err := dynamo.GroupBy(fixtureSeq(ctx, 3, 2),
+		func(x dynamotest.Person) bool { return x.Age%2 == 0 },
+	)
+
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(len(val[true])).Should().Equal(3).
+		If(len(val[false])).Should().Equal(3)
+}
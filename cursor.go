@@ -0,0 +1,151 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file declares serializable cursor of the sequence
+//
+
+package dynamo
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fogfish/curie"
+)
+
+/*
+Cursor is the global position in the sequence. Besides the identity of
+the last element, the cursor carries an opaque storage specific state
+(e.g. complete LastEvaluatedKey of DynamoDB including index attributes or
+continuation token of S3). The state is required to continue sequences
+over secondary indexes.
+
+The cursor is serializable into URL-safe token, which is optionally signed
+with HMAC so that it can be handed over to untrusted clients.
+
+	token := seq.Cursor().(*dynamo.Cursor).Encode(secret)
+
+	cursor, err := dynamo.DecodeCursor(token, secret)
+	seq := db.Match(ctx, key).Limit(25).Continue(cursor)
+*/
+type Cursor struct {
+	hashKey curie.IRI
+	sortKey curie.IRI
+	state   []byte
+}
+
+/*
+NewCursor creates a cursor from the key of the last element and
+the storage specific state.
+*/
+func NewCursor(hashKey, sortKey curie.IRI, state []byte) *Cursor {
+	return &Cursor{hashKey: hashKey, sortKey: sortKey, state: state}
+}
+
+// HashKey of the last element
+func (c *Cursor) HashKey() curie.IRI { return c.hashKey }
+
+// SortKey of the last element
+func (c *Cursor) SortKey() curie.IRI { return c.sortKey }
+
+// State is an opaque storage specific position
+func (c *Cursor) State() []byte { return c.state }
+
+// wire format of cursor
+type cursorJSON struct {
+	HashKey string `json:"h,omitempty"`
+	SortKey string `json:"s,omitempty"`
+	State   []byte `json:"x,omitempty"`
+}
+
+/*
+Encode cursor to URL-safe token. The token is signed with HMAC-SHA256
+if secret is defined.
+*/
+func (c *Cursor) Encode(secret []byte) string {
+	// Note: json.Marshal fails only on unsupported types
+	payload, _ := json.Marshal(cursorJSON{
+		HashKey: string(c.hashKey),
+		SortKey: string(c.sortKey),
+		State:   c.state,
+	})
+
+	token := base64.RawURLEncoding.EncodeToString(payload)
+	if len(secret) == 0 {
+		return token
+	}
+
+	return token + "." + base64.RawURLEncoding.EncodeToString(sign(secret, token))
+}
+
+/*
+DecodeCursor parses the token produced by Cursor.Encode. The signature is
+verified if secret is defined, the token without valid signature is rejected.
+*/
+func DecodeCursor(token string, secret []byte) (*Cursor, error) {
+	payload, signature, isSigned := strings.Cut(token, ".")
+
+	if len(secret) != 0 {
+		if !isSigned {
+			return nil, errInvalidCursor(errors.New("signature is missing"))
+		}
+
+		mac, err := base64.RawURLEncoding.DecodeString(signature)
+		if err != nil {
+			return nil, errInvalidCursor(err)
+		}
+
+		if !hmac.Equal(mac, sign(secret, payload)) {
+			return nil, errInvalidCursor(errors.New("signature mismatch"))
+		}
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errInvalidCursor(err)
+	}
+
+	var val cursorJSON
+	if err := json.Unmarshal(raw, &val); err != nil {
+		return nil, errInvalidCursor(err)
+	}
+
+	return NewCursor(curie.IRI(val.HashKey), curie.IRI(val.SortKey), val.State), nil
+}
+
+// MarshalText encodes cursor to unsigned token
+func (c *Cursor) MarshalText() ([]byte, error) {
+	return []byte(c.Encode(nil)), nil
+}
+
+// UnmarshalText decodes cursor from unsigned token
+func (c *Cursor) UnmarshalText(b []byte) error {
+	val, err := DecodeCursor(string(b), nil)
+	if err != nil {
+		return err
+	}
+
+	*c = *val
+	return nil
+}
+
+func sign(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func errInvalidCursor(err error) error {
+	return fmt.Errorf("invalid cursor: %w", err)
+}
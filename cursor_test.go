@@ -0,0 +1,59 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package dynamo_test
+
+import (
+	"testing"
+
+	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
+)
+
+func TestCursorEncode(t *testing.T) {
+	cursor := dynamo.NewCursor("dead:beef", "1", []byte(`{"year":{"N":"1950"}}`))
+
+	val, err := dynamo.DecodeCursor(cursor.Encode(nil), nil)
+
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(val).Should().Equal(cursor)
+}
+
+func TestCursorSigned(t *testing.T) {
+	secret := []byte("secret")
+	cursor := dynamo.NewCursor("dead:beef", "1", []byte("state"))
+	token := cursor.Encode(secret)
+
+	val, err := dynamo.DecodeCursor(token, secret)
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(val).Should().Equal(cursor)
+
+	_, err = dynamo.DecodeCursor(cursor.Encode(nil), secret)
+	it.Ok(t).If(err).ShouldNot().Equal(nil)
+
+	_, err = dynamo.DecodeCursor(token, []byte("other"))
+	it.Ok(t).If(err).ShouldNot().Equal(nil)
+
+	forged := dynamo.NewCursor("dead:beef", "2", []byte("state")).Encode(nil)
+	_, err = dynamo.DecodeCursor(forged+token[len(cursor.Encode(nil)):], secret)
+	it.Ok(t).If(err).ShouldNot().Equal(nil)
+}
+
+func TestCursorText(t *testing.T) {
+	cursor := dynamo.NewCursor("dead:beef", "1", nil)
+	text, err := cursor.MarshalText()
+	it.Ok(t).If(err).Should().Equal(nil)
+
+	var val dynamo.Cursor
+	err = val.UnmarshalText(text)
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(&val).Should().Equal(cursor)
+}
@@ -0,0 +1,320 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+/*
+Package dump exports sequences of things to NDJSON, DynamoDB JSON or CSV
+and imports them back to the storage.
+
+	w, err := dump.NewWriter[Article](os.Stdout, dump.CSV, "ddb:///my-table")
+	n, err := dump.Export(w, db.Match(ctx, key))
+
+	r, err := dump.NewReader[Article](os.Stdin, dump.CSV, "ddb:///my-table")
+	n, err := dump.NewImporter(db).Import(ctx, r, 0)
+*/
+package dump
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/fogfish/curie"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+)
+
+/*
+Export writes the sequence to the writer, it returns number of
+exported things.
+*/
+func Export[T dynamo.Thing](w Writer[T], seq dynamo.Seq[T]) (int, error) {
+	n := 0
+	for x, err := range dynamo.All(seq) {
+		if err != nil {
+			return n, err
+		}
+
+		if err := w.Write(x); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, w.Flush()
+}
+
+/*
+Importer writes things read from dump to the storage. Things are written
+in batches, the rate of writes is limited. Batches are sent as BatchWriteItem
+requests if the storage is DynamoDB table and its client implements batch
+api, unprocessed items are retried. Otherwise things are written with Put
+one by one. The offset of imported records is checkpointed after each batch
+so that the import is resumed after failure.
+*/
+type Importer[T dynamo.Thing] struct {
+	Writer dynamo.KeyValWriter[T]
+	// BatchSize is number of things in batch, the batch is split into
+	// BatchWriteItem requests of 25 items
+	BatchSize int
+	// Rate is number of writes per second, zero is unlimited
+	Rate int
+	// Checkpoint is called with offset of imported records after each batch
+	Checkpoint func(offset int) error
+}
+
+// NewImporter creates importer to the storage
+func NewImporter[T dynamo.Thing](writer dynamo.KeyValWriter[T]) *Importer[T] {
+	return &Importer[T]{
+		Writer:    writer,
+		BatchSize: 25,
+	}
+}
+
+/*
+Import records of the dump, the records before offset are skipped. It returns
+the offset of imported records, which is the checkpoint to resume the import.
+*/
+func (im *Importer[T]) Import(ctx context.Context, r Reader[T], offset int) (int, error) {
+	size := im.BatchSize
+	if size < 1 {
+		size = 1
+	}
+
+	at := 0
+	for ; at < offset; at++ {
+		if _, err := r.Read(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return at, nil
+			}
+			return at, err
+		}
+	}
+
+	var (
+		batch = make([]T, 0, size)
+		start = time.Now()
+		count = 0
+	)
+
+	for {
+		x, err := r.Read()
+		isEOF := errors.Is(err, io.EOF)
+		if err != nil && !isEOF {
+			return at, err
+		}
+
+		if !isEOF {
+			batch = append(batch, x)
+		}
+
+		if len(batch) == size || (isEOF && len(batch) > 0) {
+			if err := im.throttle(ctx, start, count); err != nil {
+				return at, err
+			}
+
+			if err := im.write(ctx, batch); err != nil {
+				return at, err
+			}
+
+			at += len(batch)
+			count += len(batch)
+			batch = batch[:0]
+
+			if im.Checkpoint != nil {
+				if err := im.Checkpoint(at); err != nil {
+					return at, err
+				}
+			}
+		}
+
+		if isEOF {
+			return at, nil
+		}
+	}
+}
+
+// throttle delays the batch until n written things fit the rate of writes
+func (im *Importer[T]) throttle(ctx context.Context, start time.Time, n int) error {
+	if im.Rate <= 0 {
+		return nil
+	}
+
+	due := start.Add(time.Duration(n) * time.Second / time.Duration(im.Rate))
+	wait := time.Until(due)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// limits of BatchWriteItem
+const (
+	maxBatchWrite   = 25
+	maxBatchRetries = 8
+	batchBackoff    = 20 * time.Millisecond
+)
+
+// write batch, the batch fails if any write fails
+func (im *Importer[T]) write(ctx context.Context, batch []T) error {
+	if db, ok := im.Writer.(*ddb.Storage[T]); ok {
+		if service, ok := db.Service.(dynamo.DynamoDBBatch); ok {
+			return batchWrite(ctx, db, service, batch)
+		}
+	}
+
+	for _, x := range batch {
+		if err := im.Writer.Put(ctx, x); err != nil {
+			return errProcessEntity(err, x)
+		}
+	}
+
+	return nil
+}
+
+// batchWrite sends the batch as BatchWriteItem chunks, unprocessed items
+// are retried with backoff
+func batchWrite[T dynamo.Thing](ctx context.Context, db *ddb.Storage[T], service dynamo.DynamoDBBatch, batch []T) error {
+	// Note: BatchWriteItem rejects duplicate keys, the last write wins
+	reqs := make([]types.WriteRequest, 0, len(batch))
+	index := map[[2]curie.IRI]int{}
+	for _, x := range batch {
+		gen, err := db.Codec.Encode(x)
+		if err != nil {
+			return errInvalidEntity(err, x)
+		}
+
+		req := types.WriteRequest{PutRequest: &types.PutRequest{Item: gen}}
+		key := [2]curie.IRI{x.HashKey(), x.SortKey()}
+		if at, has := index[key]; has {
+			reqs[at] = req
+			continue
+		}
+		index[key] = len(reqs)
+		reqs = append(reqs, req)
+	}
+
+	for len(reqs) > 0 {
+		chunk := reqs[:min(maxBatchWrite, len(reqs))]
+		reqs = reqs[len(chunk):]
+
+		if err := batchWriteChunk(ctx, db, service, chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func batchWriteChunk[T dynamo.Thing](ctx context.Context, db *ddb.Storage[T], service dynamo.DynamoDBBatch, chunk []types.WriteRequest) error {
+	req := &dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]types.WriteRequest{*db.Table: chunk},
+	}
+
+	backoff := batchBackoff
+	for attempt := 0; ; attempt++ {
+		val, err := service.BatchWriteItem(ctx, req)
+		if err != nil {
+			return errProcessBatch(err, len(chunk))
+		}
+
+		unprocessed := val.UnprocessedItems[*db.Table]
+		if len(unprocessed) == 0 {
+			return nil
+		}
+
+		if attempt == maxBatchRetries {
+			return errProcessBatch(errors.New("items are not processed by BatchWriteItem"), len(unprocessed))
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+
+		req.RequestItems = map[string][]types.WriteRequest{*db.Table: unprocessed}
+	}
+}
+
+//-----------------------------------------------------------------------------
+//
+// Errors
+//
+//-----------------------------------------------------------------------------
+
+func errUnknownFormat(format Format) error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] unknown dump format %s", name, format)
+}
+
+func errInvalidConnectorURL(url string) error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] invalid connector url: %s", name, url)
+}
+
+func errInvalidEntity(err error, thing dynamo.Thing) error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] invalid entity (%s, %s) : %w", name, thing.HashKey(), thing.SortKey(), err)
+}
+
+func errInvalidRecord(err error) error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] invalid record : %w", name, err)
+}
+
+func errProcessEntity(err error, thing dynamo.Thing) error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] can't process (%s, %s) : %w", name, thing.HashKey(), thing.SortKey(), err)
+}
+
+func errProcessBatch(err error, n int) error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] can't process batch of %d items : %w", name, n, err)
+}
@@ -0,0 +1,322 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package dump_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/fogfish/curie"
+	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/dump"
+	"github.com/holmes89/dynamo/service/ddb"
+	"github.com/holmes89/dynamo/service/ddb/emulator"
+)
+
+type address struct {
+	City string `dynamodbav:"city,omitempty" json:"city,omitempty"`
+}
+
+type article struct {
+	Author   curie.IRI `dynamodbav:"prefix,omitempty" json:"author,omitempty"`
+	ID       curie.IRI `dynamodbav:"suffix,omitempty" json:"id,omitempty"`
+	Title    string    `dynamodbav:"title,omitempty" json:"title,omitempty"`
+	Pages    int       `dynamodbav:"pages,omitempty" json:"pages,omitempty"`
+	Draft    bool      `dynamodbav:"draft,omitempty" json:"draft,omitempty"`
+	Keywords []string  `dynamodbav:"keywords,omitempty" json:"keywords,omitempty"`
+	Address  *address  `dynamodbav:"address,omitempty" json:"address,omitempty"`
+	Secret   string    `dynamodbav:"-" json:"-"`
+}
+
+func (a article) HashKey() curie.IRI { return a.Author }
+func (a article) SortKey() curie.IRI { return a.ID }
+
+func fixtureArticles() []article {
+	seq := make([]article, 5)
+	for i := range seq {
+		seq[i] = article{
+			Author:   "author:neumann",
+			ID:       curie.New("article:%d", i),
+			Title:    fmt.Sprintf("Title, \"%d\"", i),
+			Pages:    i * 10,
+			Draft:    i%2 == 0,
+			Keywords: []string{"a", "b"},
+			Address:  &address{City: "Berne"},
+		}
+	}
+	return seq
+}
+
+func fixtureDB() dynamo.KeyVal[article] {
+	return ddb.Must(ddb.New[article]("ddb:///test", emulator.New(emulator.Table{Name: "test", HashKey: "prefix", SortKey: "suffix"}), nil))
+}
+
+func TestExportImport(t *testing.T) {
+	for _, format := range []dump.Format{dump.NDJSON, dump.DynamoJSON, dump.CSV} {
+		source := fixtureDB()
+		for _, x := range fixtureArticles() {
+			it.Ok(t).IfNil(source.Put(context.Background(), x))
+		}
+
+		buf := &bytes.Buffer{}
+		w, err := dump.NewWriter[article](buf, format, "ddb:///test")
+		it.Ok(t).IfNil(err)
+
+		n, err := dump.Export(w, source.Match(context.Background(), article{Author: "author:neumann"}))
+		it.Ok(t).
+			IfNil(err).
+			If(n).Equal(5)
+
+		target := fixtureDB()
+		r, err := dump.NewReader[article](buf, format, "ddb:///test")
+		it.Ok(t).IfNil(err)
+
+		n, err = dump.NewImporter(target).Import(context.Background(), r, 0)
+		it.Ok(t).
+			IfNil(err).
+			If(n).Equal(5)
+
+		for _, x := range fixtureArticles() {
+			y, err := target.Get(context.Background(), article{Author: x.Author, ID: x.ID})
+			it.Ok(t).
+				IfNil(err).
+				If(y).Equal(x)
+		}
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, _ := dump.NewWriter[article](buf, dump.CSV, "ddb:///test")
+
+	it.Ok(t).
+		IfNil(w.Write(fixtureArticles()[1])).
+		IfNil(w.Flush()).
+		If(buf.String()).Equal(
+		"prefix,suffix,title,pages,draft,keywords,address\n" +
+			"author:neumann,article:1,\"Title, \"\"1\"\"\",10,,\"{\"\"L\"\":[{\"\"S\"\":\"\"a\"\"},{\"\"S\"\":\"\"b\"\"}]}\",\"{\"\"M\"\":{\"\"city\"\":{\"\"S\"\":\"\"Berne\"\"}}}\"\n",
+	)
+}
+
+func TestExportDynamoJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, _ := dump.NewWriter[article](buf, dump.DynamoJSON, "ddb:///test")
+
+	it.Ok(t).
+		IfNil(w.Write(article{Author: "author:neumann", ID: "article:1", Pages: 10})).
+		IfNil(w.Flush()).
+		If(buf.String()).Equal(
+		`{"Item":{"pages":{"N":"10"},"prefix":{"S":"author:neumann"},"suffix":{"S":"article:1"}}}` + "\n",
+	)
+}
+
+type failing struct {
+	dynamo.KeyVal[article]
+	at int
+}
+
+func (f *failing) Put(ctx context.Context, x article, c ...dynamo.Constraint[article]) error {
+	if x.ID == curie.New("article:%d", f.at) {
+		return errors.New("failed")
+	}
+	return f.KeyVal.Put(ctx, x, c...)
+}
+
+func TestImportResume(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, _ := dump.NewWriter[article](buf, dump.NDJSON, "ddb:///test")
+	for _, x := range fixtureArticles() {
+		it.Ok(t).IfNil(w.Write(x))
+	}
+	it.Ok(t).IfNil(w.Flush())
+	data := buf.Bytes()
+
+	db := &failing{KeyVal: fixtureDB(), at: 3}
+	checkpoints := []int{}
+	im := dump.NewImporter[article](db)
+	im.BatchSize = 2
+	im.Checkpoint = func(offset int) error {
+		checkpoints = append(checkpoints, offset)
+		return nil
+	}
+
+	r, _ := dump.NewReader[article](bytes.NewReader(data), dump.NDJSON, "ddb:///test")
+	n, err := im.Import(context.Background(), r, 0)
+	it.Ok(t).
+		IfNotNil(err).
+		If(n).Equal(2).
+		If(checkpoints).Equal([]int{2})
+
+	db.at = -1
+	r, _ = dump.NewReader[article](bytes.NewReader(data), dump.NDJSON, "ddb:///test")
+	n, err = im.Import(context.Background(), r, n)
+	it.Ok(t).
+		IfNil(err).
+		If(n).Equal(5).
+		If(checkpoints).Equal([]int{2, 4, 5})
+}
+
+func TestImportRate(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, _ := dump.NewWriter[article](buf, dump.NDJSON, "ddb:///test")
+	for _, x := range fixtureArticles() {
+		it.Ok(t).IfNil(w.Write(x))
+	}
+	it.Ok(t).IfNil(w.Flush())
+
+	im := dump.NewImporter(fixtureDB())
+	im.BatchSize = 1
+	im.Rate = 100
+
+	r, _ := dump.NewReader[article](buf, dump.NDJSON, "ddb:///test")
+	t0 := time.Now()
+	n, err := im.Import(context.Background(), r, 0)
+	it.Ok(t).
+		IfNil(err).
+		If(n).Equal(5).
+		If(time.Since(t0) >= 40*time.Millisecond).Equal(true)
+}
+
+// batchClient counts requests, the first BatchWriteItem leaves items unprocessed
+type batchClient struct {
+	*emulator.DynamoDB
+	puts, batches int
+}
+
+func (c *batchClient) PutItem(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	c.puts++
+	return c.DynamoDB.PutItem(ctx, input, opts...)
+}
+
+func (c *batchClient) BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	c.batches++
+	if c.batches > 1 {
+		return c.DynamoDB.BatchWriteItem(ctx, input, opts...)
+	}
+
+	reqs := input.RequestItems["test"]
+	val, err := c.DynamoDB.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]types.WriteRequest{"test": reqs[:1]},
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	val.UnprocessedItems = map[string][]types.WriteRequest{"test": reqs[1:]}
+	return val, nil
+}
+
+// putClient is the client without batch api
+type putClient struct{ dynamo.DynamoDB }
+
+func TestImportBatch(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, _ := dump.NewWriter[article](buf, dump.NDJSON, "ddb:///test")
+	for i := 0; i < 30; i++ {
+		it.Ok(t).IfNil(w.Write(article{Author: "author:neumann", ID: curie.New("article:%d", i)}))
+	}
+	// Note: BatchWriteItem rejects duplicate keys, the last write wins
+	it.Ok(t).IfNil(w.Write(article{Author: "author:neumann", ID: "article:0", Title: "last"}))
+	it.Ok(t).IfNil(w.Flush())
+	data := buf.Bytes()
+
+	client := &batchClient{DynamoDB: emulator.New(emulator.Table{Name: "test", HashKey: "prefix", SortKey: "suffix"})}
+	db := ddb.Must(ddb.New[article]("ddb:///test", client, nil))
+	im := dump.NewImporter(db)
+	im.BatchSize = 100
+
+	r, _ := dump.NewReader[article](bytes.NewReader(data), dump.NDJSON, "ddb:///test")
+	n, err := im.Import(context.Background(), r, 0)
+	it.Ok(t).
+		IfNil(err).
+		If(n).Equal(31).
+		If(client.puts).Equal(0).
+		If(client.batches).Equal(3)
+
+	x, err := db.Get(context.Background(), article{Author: "author:neumann", ID: "article:0"})
+	it.Ok(t).
+		IfNil(err).
+		If(x.Title).Equal("last")
+
+	seq := dynamo.Things[article]{}
+	it.Ok(t).
+		IfNil(db.Match(context.Background(), article{Author: "author:neumann"}).FMap(seq.Join)).
+		If(len(seq)).Equal(30)
+
+	// Note: client without batch api writes things one by one
+	client = &batchClient{DynamoDB: emulator.New(emulator.Table{Name: "test", HashKey: "prefix", SortKey: "suffix"})}
+	db = ddb.Must(ddb.New[article]("ddb:///test", putClient{client}, nil))
+
+	r, _ = dump.NewReader[article](bytes.NewReader(data), dump.NDJSON, "ddb:///test")
+	n, err = dump.NewImporter(db).Import(context.Background(), r, 0)
+	it.Ok(t).
+		IfNil(err).
+		If(n).Equal(31).
+		If(client.puts).Equal(31).
+		If(client.batches).Equal(0)
+}
+
+type author struct {
+	ID   curie.IRI `dynamodbav:"pk,omitempty"`
+	Name string    `dynamodbav:"name,omitempty"`
+}
+
+func (a author) HashKey() curie.IRI { return a.ID }
+func (a author) SortKey() curie.IRI { return "" }
+
+func TestExportKeys(t *testing.T) {
+	x := author{ID: "author:neumann", Name: "John"}
+
+	buf := &bytes.Buffer{}
+	w, _ := dump.NewWriter[author](buf, dump.DynamoJSON, "ddb:///test?prefix=pk&suffix=sk")
+	it.Ok(t).
+		IfNil(w.Write(x)).
+		IfNil(w.Flush()).
+		If(buf.String()).Equal(
+		`{"Item":{"name":{"S":"John"},"pk":{"S":"author:neumann"},"sk":{"S":"_"}}}` + "\n",
+	)
+
+	r, _ := dump.NewReader[author](buf, dump.DynamoJSON, "ddb:///test?prefix=pk&suffix=sk")
+	y, err := r.Read()
+	it.Ok(t).IfNil(err).If(y).Equal(x)
+
+	buf = &bytes.Buffer{}
+	w, _ = dump.NewWriter[author](buf, dump.CSV, "ddb:///test?prefix=pk&suffix=sk")
+	it.Ok(t).
+		IfNil(w.Write(x)).
+		IfNil(w.Flush()).
+		If(buf.String()).Equal("pk,name,sk\nauthor:neumann,John,_\n")
+
+	r, _ = dump.NewReader[author](buf, dump.CSV, "ddb:///test?prefix=pk&suffix=sk")
+	y, err = r.Read()
+	it.Ok(t).IfNil(err).If(y).Equal(x)
+}
+
+func TestImportCSVInvalidBool(t *testing.T) {
+	buf := bytes.NewBufferString("prefix,suffix,draft\nauthor:neumann,article:1,yes\n")
+	r, _ := dump.NewReader[article](buf, dump.CSV, "ddb:///test")
+
+	_, err := r.Read()
+	it.Ok(t).IfNotNil(err)
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := dump.NewWriter[article](&bytes.Buffer{}, "xml", "ddb:///test")
+	it.Ok(t).IfNotNil(err)
+
+	_, err = dump.NewReader[article](&bytes.Buffer{}, "xml", "ddb:///test")
+	it.Ok(t).IfNotNil(err)
+}
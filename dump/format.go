@@ -0,0 +1,465 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file implements writers and readers of dump formats
+//
+
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+)
+
+/*
+Format of dump
+*/
+type Format string
+
+const (
+	// NDJSON is JSON document per line, the document is encoded using json tags
+	NDJSON Format = "ndjson"
+	// DynamoJSON is DynamoDB JSON wire format per line, as produced by
+	// DynamoDB export to S3: {"Item": {"name": {"S": "..."}}}
+	DynamoJSON Format = "ddbjson"
+	// CSV with header, columns are top-level attributes declared by
+	// dynamodbav struct tags
+	CSV Format = "csv"
+)
+
+/*
+Writer encodes things to dump
+*/
+type Writer[T dynamo.Thing] interface {
+	Write(T) error
+	Flush() error
+}
+
+/*
+Reader decodes things from dump, it returns io.EOF at the end of dump
+*/
+type Reader[T dynamo.Thing] interface {
+	Read() (T, error)
+}
+
+/*
+NewWriter creates writer of the format. The connector defines names of key
+attributes using same notation as ddb storage does, e.g.
+ddb:///my-table?prefix=pk&suffix=sk, so that DynamoDB JSON and CSV items
+match the items of the table.
+*/
+func NewWriter[T dynamo.Thing](w io.Writer, format Format, connector string) (Writer[T], error) {
+	codec, err := newCodec[T](connector)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case NDJSON:
+		return &jsonWriter[T]{w: bufio.NewWriter(w)}, nil
+	case DynamoJSON:
+		return &wireWriter[T]{w: bufio.NewWriter(w), codec: codec}, nil
+	case CSV:
+		return &csvWriter[T]{w: csv.NewWriter(w), codec: codec, columns: columnsOf[T](connector)}, nil
+	default:
+		return nil, errUnknownFormat(format)
+	}
+}
+
+// NewReader creates reader of the format, the connector is same as writer uses
+func NewReader[T dynamo.Thing](r io.Reader, format Format, connector string) (Reader[T], error) {
+	codec, err := newCodec[T](connector)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case NDJSON:
+		return &jsonReader[T]{r: newLineReader(r)}, nil
+	case DynamoJSON:
+		return &wireReader[T]{r: newLineReader(r), codec: codec}, nil
+	case CSV:
+		return &csvReader[T]{r: csv.NewReader(r), codec: codec, columns: columnsOf[T](connector)}, nil
+	default:
+		return nil, errUnknownFormat(format)
+	}
+}
+
+func newCodec[T dynamo.Thing](connector string) (*ddb.Codec[T], error) {
+	uri, err := url.Parse(connector)
+	if err != nil {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	return ddb.NewCodec[T]((*dynamo.URL)(uri)), nil
+}
+
+func newLineReader(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	return scanner
+}
+
+// scan reads the next non-empty line
+func scan(r *bufio.Scanner) ([]byte, error) {
+	for r.Scan() {
+		line := bytes.TrimSpace(r.Bytes())
+		if len(line) != 0 {
+			return line, nil
+		}
+	}
+
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+//-----------------------------------------------------------------------------
+//
+// NDJSON
+//
+//-----------------------------------------------------------------------------
+
+type jsonWriter[T dynamo.Thing] struct{ w *bufio.Writer }
+
+func (w *jsonWriter[T]) Write(x T) error {
+	b, err := json.Marshal(x)
+	if err != nil {
+		return errInvalidEntity(err, x)
+	}
+
+	if _, err := w.w.Write(b); err != nil {
+		return err
+	}
+	return w.w.WriteByte('\n')
+}
+
+func (w *jsonWriter[T]) Flush() error { return w.w.Flush() }
+
+type jsonReader[T dynamo.Thing] struct{ r *bufio.Scanner }
+
+func (r *jsonReader[T]) Read() (T, error) {
+	var x T
+
+	line, err := scan(r.r)
+	if err != nil {
+		return x, err
+	}
+
+	if err := json.Unmarshal(line, &x); err != nil {
+		return x, errInvalidRecord(err)
+	}
+	return x, nil
+}
+
+//-----------------------------------------------------------------------------
+//
+// DynamoDB JSON
+//
+//-----------------------------------------------------------------------------
+
+type wireWriter[T dynamo.Thing] struct {
+	w     *bufio.Writer
+	codec *ddb.Codec[T]
+}
+
+func (w *wireWriter[T]) Write(x T) error {
+	item, err := w.codec.Encode(x)
+	if err != nil {
+		return errInvalidEntity(err, x)
+	}
+
+	gen, err := toWireMap(item)
+	if err != nil {
+		return errInvalidEntity(err, x)
+	}
+
+	b, err := json.Marshal(map[string]any{"Item": gen})
+	if err != nil {
+		return errInvalidEntity(err, x)
+	}
+
+	if _, err := w.w.Write(b); err != nil {
+		return err
+	}
+	return w.w.WriteByte('\n')
+}
+
+func (w *wireWriter[T]) Flush() error { return w.w.Flush() }
+
+type wireReader[T dynamo.Thing] struct {
+	r     *bufio.Scanner
+	codec *ddb.Codec[T]
+}
+
+func (r *wireReader[T]) Read() (T, error) {
+	var x T
+
+	line, err := scan(r.r)
+	if err != nil {
+		return x, err
+	}
+
+	var gen struct {
+		Item json.RawMessage `json:"Item"`
+	}
+	if err := json.Unmarshal(line, &gen); err != nil {
+		return x, errInvalidRecord(err)
+	}
+
+	item, err := fromWireMap(gen.Item)
+	if err != nil {
+		return x, errInvalidRecord(err)
+	}
+
+	x, err = r.codec.Decode(item)
+	if err != nil {
+		return x, errInvalidRecord(err)
+	}
+	return x, nil
+}
+
+//-----------------------------------------------------------------------------
+//
+// CSV
+//
+//-----------------------------------------------------------------------------
+
+// column of csv is top-level attribute of the struct
+type column struct {
+	name string
+	kind reflect.Kind
+}
+
+// columnsOf derives columns from dynamodbav struct tags, key attributes
+// of the connector are appended if the struct does not declare them
+func columnsOf[T any](connector string) []column {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+
+	seq := columnsOfStruct(typ)
+
+	// Note: connector is validated by codec
+	uri, _ := url.Parse(connector)
+	for _, key := range []string{
+		(*dynamo.URL)(uri).Query("prefix", "prefix"),
+		(*dynamo.URL)(uri).Query("suffix", "suffix"),
+	} {
+		if !hasColumn(seq, key) {
+			seq = append(seq, column{name: key, kind: reflect.String})
+		}
+	}
+
+	return seq
+}
+
+func hasColumn(seq []column, name string) bool {
+	for _, c := range seq {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func columnsOfStruct(typ reflect.Type) []column {
+	seq := make([]column, 0, typ.NumField())
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+
+		tag, _, _ := strings.Cut(field.Tag.Get("dynamodbav"), ",")
+		if tag == "-" {
+			continue
+		}
+
+		ft := field.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+
+		if field.Anonymous && tag == "" && ft.Kind() == reflect.Struct {
+			seq = append(seq, columnsOfStruct(ft)...)
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		name := tag
+		if name == "" {
+			name = field.Name
+		}
+		seq = append(seq, column{name: name, kind: ft.Kind()})
+	}
+
+	return seq
+}
+
+type csvWriter[T dynamo.Thing] struct {
+	w        *csv.Writer
+	codec    *ddb.Codec[T]
+	columns  []column
+	isHeader bool
+}
+
+func (w *csvWriter[T]) header() error {
+	if w.isHeader {
+		return nil
+	}
+	w.isHeader = true
+
+	seq := make([]string, len(w.columns))
+	for i, c := range w.columns {
+		seq[i] = c.name
+	}
+	return w.w.Write(seq)
+}
+
+func (w *csvWriter[T]) Write(x T) error {
+	if err := w.header(); err != nil {
+		return err
+	}
+
+	item, err := w.codec.Encode(x)
+	if err != nil {
+		return errInvalidEntity(err, x)
+	}
+
+	seq := make([]string, len(w.columns))
+	for i, c := range w.columns {
+		switch v := item[c.name].(type) {
+		case nil, *types.AttributeValueMemberNULL:
+			seq[i] = ""
+		case *types.AttributeValueMemberS:
+			seq[i] = v.Value
+		case *types.AttributeValueMemberN:
+			seq[i] = v.Value
+		case *types.AttributeValueMemberBOOL:
+			seq[i] = fmt.Sprint(v.Value)
+		default:
+			// Note: complex attributes are written using DynamoDB JSON
+			gen, err := toWire(v)
+			if err != nil {
+				return errInvalidEntity(err, x)
+			}
+			b, err := json.Marshal(gen)
+			if err != nil {
+				return errInvalidEntity(err, x)
+			}
+			seq[i] = string(b)
+		}
+	}
+
+	return w.w.Write(seq)
+}
+
+func (w *csvWriter[T]) Flush() error {
+	if err := w.header(); err != nil {
+		return err
+	}
+
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type csvReader[T dynamo.Thing] struct {
+	r       *csv.Reader
+	codec   *ddb.Codec[T]
+	columns []column
+	header  []*column
+}
+
+func (r *csvReader[T]) Read() (T, error) {
+	var x T
+
+	if r.header == nil {
+		seq, err := r.r.Read()
+		if err != nil {
+			return x, err
+		}
+
+		r.header = make([]*column, len(seq))
+		for i, name := range seq {
+			for k := range r.columns {
+				if r.columns[k].name == name {
+					r.header[i] = &r.columns[k]
+				}
+			}
+		}
+	}
+
+	seq, err := r.r.Read()
+	if err != nil {
+		return x, err
+	}
+
+	item := map[string]types.AttributeValue{}
+	for i, cell := range seq {
+		if i >= len(r.header) || r.header[i] == nil || cell == "" {
+			continue
+		}
+
+		val, err := fromCell(r.header[i].kind, cell)
+		if err != nil {
+			return x, errInvalidRecord(err)
+		}
+		item[r.header[i].name] = val
+	}
+
+	x, err = r.codec.Decode(item)
+	if err != nil {
+		return x, errInvalidRecord(err)
+	}
+	return x, nil
+}
+
+func fromCell(kind reflect.Kind, cell string) (types.AttributeValue, error) {
+	switch kind {
+	case reflect.String:
+		return &types.AttributeValueMemberS{Value: cell}, nil
+	case reflect.Bool:
+		val, err := strconv.ParseBool(cell)
+		if err != nil {
+			return nil, err
+		}
+		return &types.AttributeValueMemberBOOL{Value: val}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return &types.AttributeValueMemberN{Value: cell}, nil
+	}
+
+	if strings.HasPrefix(cell, "{") {
+		if val, err := fromWire(json.RawMessage(cell)); err == nil {
+			return val, nil
+		}
+	}
+
+	return &types.AttributeValueMemberS{Value: cell}, nil
+}
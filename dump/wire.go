@@ -0,0 +1,153 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file implements DynamoDB JSON wire format of attribute values
+//
+
+package dump
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// toWire converts attribute value to DynamoDB JSON
+func toWire(val types.AttributeValue) (any, error) {
+	switch v := val.(type) {
+	case *types.AttributeValueMemberS:
+		return map[string]any{"S": v.Value}, nil
+	case *types.AttributeValueMemberN:
+		return map[string]any{"N": v.Value}, nil
+	case *types.AttributeValueMemberB:
+		return map[string]any{"B": v.Value}, nil
+	case *types.AttributeValueMemberBOOL:
+		return map[string]any{"BOOL": v.Value}, nil
+	case *types.AttributeValueMemberNULL:
+		return map[string]any{"NULL": true}, nil
+	case *types.AttributeValueMemberSS:
+		return map[string]any{"SS": v.Value}, nil
+	case *types.AttributeValueMemberNS:
+		return map[string]any{"NS": v.Value}, nil
+	case *types.AttributeValueMemberBS:
+		return map[string]any{"BS": v.Value}, nil
+	case *types.AttributeValueMemberL:
+		seq := make([]any, len(v.Value))
+		for i, x := range v.Value {
+			y, err := toWire(x)
+			if err != nil {
+				return nil, err
+			}
+			seq[i] = y
+		}
+		return map[string]any{"L": seq}, nil
+	case *types.AttributeValueMemberM:
+		gen, err := toWireMap(v.Value)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"M": gen}, nil
+	default:
+		return nil, fmt.Errorf("unsupported attribute of type %T", val)
+	}
+}
+
+func toWireMap(item map[string]types.AttributeValue) (map[string]any, error) {
+	gen := make(map[string]any, len(item))
+	for k, v := range item {
+		x, err := toWire(v)
+		if err != nil {
+			return nil, err
+		}
+		gen[k] = x
+	}
+	return gen, nil
+}
+
+// fromWire converts DynamoDB JSON to attribute value
+func fromWire(raw json.RawMessage) (types.AttributeValue, error) {
+	var gen map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &gen); err != nil {
+		return nil, err
+	}
+
+	if len(gen) != 1 {
+		return nil, fmt.Errorf("invalid attribute %s", raw)
+	}
+
+	for kind, val := range gen {
+		switch kind {
+		case "S":
+			v := &types.AttributeValueMemberS{}
+			return v, json.Unmarshal(val, &v.Value)
+		case "N":
+			v := &types.AttributeValueMemberN{}
+			return v, json.Unmarshal(val, &v.Value)
+		case "B":
+			v := &types.AttributeValueMemberB{}
+			return v, json.Unmarshal(val, &v.Value)
+		case "BOOL":
+			v := &types.AttributeValueMemberBOOL{}
+			return v, json.Unmarshal(val, &v.Value)
+		case "NULL":
+			return &types.AttributeValueMemberNULL{Value: true}, nil
+		case "SS":
+			v := &types.AttributeValueMemberSS{}
+			return v, json.Unmarshal(val, &v.Value)
+		case "NS":
+			v := &types.AttributeValueMemberNS{}
+			return v, json.Unmarshal(val, &v.Value)
+		case "BS":
+			v := &types.AttributeValueMemberBS{}
+			return v, json.Unmarshal(val, &v.Value)
+		case "L":
+			var seq []json.RawMessage
+			if err := json.Unmarshal(val, &seq); err != nil {
+				return nil, err
+			}
+			v := &types.AttributeValueMemberL{Value: make([]types.AttributeValue, len(seq))}
+			for i, x := range seq {
+				y, err := fromWire(x)
+				if err != nil {
+					return nil, err
+				}
+				v.Value[i] = y
+			}
+			return v, nil
+		case "M":
+			item, err := fromWireMap(val)
+			if err != nil {
+				return nil, err
+			}
+			return &types.AttributeValueMemberM{Value: item}, nil
+		default:
+			return nil, fmt.Errorf("unsupported attribute type %s", kind)
+		}
+	}
+
+	return nil, fmt.Errorf("invalid attribute %s", raw)
+}
+
+func fromWireMap(raw json.RawMessage) (map[string]types.AttributeValue, error) {
+	var gen map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &gen); err != nil {
+		return nil, err
+	}
+
+	item := make(map[string]types.AttributeValue, len(gen))
+	for k, v := range gen {
+		x, err := fromWire(v)
+		if err != nil {
+			return nil, err
+		}
+		item[k] = x
+	}
+	return item, nil
+}
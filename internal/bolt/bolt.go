@@ -0,0 +1,364 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file declares key/value interface for bbolt
+//
+
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+	"github.com/holmes89/dynamo/internal/mem"
+	"go.etcd.io/bbolt"
+)
+
+/*
+Storage is bbolt handler of key/value I/O. The bucket is the table, each
+entity is JSON value at the composite key hashkey\x00sortkey. Constraints
+are evaluated over the DynamoDB representation of entities inside the
+write transaction, as the in-memory storage does.
+*/
+type Storage[T dynamo.Thing] struct {
+	DB        *bbolt.DB
+	Bucket    []byte
+	Codec     *ddb.Codec[T]
+	undefined T
+}
+
+//-----------------------------------------------------------------------------
+//
+// Layout
+//
+//-----------------------------------------------------------------------------
+
+func keyOf(thing dynamo.Thing) (string, string) {
+	sortKey := string(thing.SortKey())
+	if sortKey == "" {
+		sortKey = "_"
+	}
+
+	return string(thing.HashKey()), sortKey
+}
+
+// composite key of entity
+func compositeKey(hashKey, sortKey string) []byte {
+	return []byte(hashKey + "\x00" + sortKey)
+}
+
+// read entity at key, nil is returned if key does not exist
+func (db *Storage[T]) read(bucket *bbolt.Bucket, key []byte) (*T, error) {
+	buf := bucket.Get(key)
+	if buf == nil {
+		return nil, nil
+	}
+
+	var entity T
+	if err := json.Unmarshal(buf, &entity); err != nil {
+		return nil, errInvalidEntity(err)
+	}
+
+	return &entity, nil
+}
+
+// write entity at key
+func (db *Storage[T]) write(bucket *bbolt.Bucket, key []byte, entity T) error {
+	buf, err := json.Marshal(entity)
+	if err != nil {
+		return errInvalidEntity(err)
+	}
+
+	if err := bucket.Put(key, buf); err != nil {
+		return errServiceIO(err)
+	}
+
+	return nil
+}
+
+// check constraints over the entity at key, it returns attributes of the entity
+func (db *Storage[T]) check(
+	bucket *bbolt.Bucket,
+	key []byte,
+	thing T,
+	config []dynamo.Constraint[T],
+) (map[string]types.AttributeValue, error) {
+	val, err := db.read(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var gen map[string]types.AttributeValue
+	if val != nil {
+		gen, err = db.Codec.Encode(*val)
+		if err != nil {
+			return nil, errInvalidEntity(err)
+		}
+	}
+
+	if c := mem.Check(gen, config); c != nil {
+		return nil, mem.PreCondition(thing, c)
+	}
+
+	return gen, nil
+}
+
+/*
+query entities of partition with sort key prefix, ordered by sort key.
+Entities after the exclusive start key are returned, limit 0 is unbound.
+It returns the sort key of last entity if more entities remains.
+*/
+func (db *Storage[T]) query(
+	hashKey, prefix string,
+	start *string,
+	reverse bool,
+	limit int,
+) ([]T, *string, error) {
+	var last *string
+	seq := make([]T, 0)
+	sortKeys := make([]string, 0)
+	head := compositeKey(hashKey, "")
+	pattern := compositeKey(hashKey, prefix)
+
+	err := db.DB.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(db.Bucket).Cursor()
+
+		var k, v []byte
+		switch {
+		case !reverse && start == nil:
+			k, v = c.Seek(pattern)
+		case !reverse:
+			at := compositeKey(hashKey, *start)
+			k, v = c.Seek(at)
+			if bytes.Equal(k, at) {
+				k, v = c.Next()
+			}
+		default:
+			// Note: utf-8 strings never contain 0xff, the key is after any key with prefix
+			at := compositeKey(hashKey, prefix+"\xff")
+			if start != nil {
+				at = compositeKey(hashKey, *start)
+			}
+			if k, _ = c.Seek(at); k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		}
+
+		for k != nil && bytes.HasPrefix(k, pattern) {
+			if limit > 0 && len(seq) == limit {
+				last = &sortKeys[limit-1]
+				return nil
+			}
+
+			var entity T
+			if err := json.Unmarshal(v, &entity); err != nil {
+				return errInvalidEntity(err)
+			}
+			seq = append(seq, entity)
+			sortKeys = append(sortKeys, string(k[len(head):]))
+
+			if reverse {
+				k, v = c.Prev()
+			} else {
+				k, v = c.Next()
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return seq, last, nil
+}
+
+//-----------------------------------------------------------------------------
+//
+// Key Value
+//
+//-----------------------------------------------------------------------------
+
+// Get item from storage
+func (db *Storage[T]) Get(ctx context.Context, key T) (T, error) {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return db.undefined, errInvalidKey(err)
+	}
+
+	var val *T
+	err := db.DB.View(func(tx *bbolt.Tx) (err error) {
+		val, err = db.read(tx.Bucket(db.Bucket), compositeKey(keyOf(key)))
+		return
+	})
+	if err != nil {
+		return db.undefined, err
+	}
+
+	if val == nil {
+		return db.undefined, errNotFound(nil, key)
+	}
+
+	return *val, nil
+}
+
+// Put writes entity
+func (db *Storage[T]) Put(ctx context.Context, entity T, config ...dynamo.Constraint[T]) error {
+	if _, err := db.Codec.EncodeKey(entity); err != nil {
+		return errInvalidKey(err)
+	}
+
+	if err := mem.Supported(config); err != nil {
+		return errInvalidEntity(err)
+	}
+
+	key := compositeKey(keyOf(entity))
+
+	return db.DB.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(db.Bucket)
+
+		if len(config) != 0 {
+			if _, err := db.check(bucket, key, entity, config); err != nil {
+				return err
+			}
+		}
+
+		return db.write(bucket, key, entity)
+	})
+}
+
+// Remove discards the entity from the table
+func (db *Storage[T]) Remove(ctx context.Context, key T, config ...dynamo.Constraint[T]) error {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return errInvalidKey(err)
+	}
+
+	if err := mem.Supported(config); err != nil {
+		return errInvalidEntity(err)
+	}
+
+	at := compositeKey(keyOf(key))
+
+	return db.DB.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(db.Bucket)
+
+		if len(config) != 0 {
+			if _, err := db.check(bucket, at, key, config); err != nil {
+				return err
+			}
+		}
+
+		if err := bucket.Delete(at); err != nil {
+			return errServiceIO(err)
+		}
+
+		return nil
+	})
+}
+
+// Update applies a partial patch to entity and returns new values
+func (db *Storage[T]) Update(ctx context.Context, entity T, config ...dynamo.Constraint[T]) (T, error) {
+	if _, err := db.Codec.EncodeKey(entity); err != nil {
+		return db.undefined, errInvalidKey(err)
+	}
+
+	if err := mem.Supported(config); err != nil {
+		return db.undefined, errInvalidEntity(err)
+	}
+
+	gen, err := db.Codec.Encode(entity)
+	if err != nil {
+		return db.undefined, errInvalidEntity(err)
+	}
+
+	key := compositeKey(keyOf(entity))
+
+	var obj T
+	err = db.DB.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(db.Bucket)
+
+		item, err := db.check(bucket, key, entity, config)
+		if err != nil {
+			return err
+		}
+
+		if item == nil {
+			item = map[string]types.AttributeValue{}
+		}
+		for k, v := range gen {
+			item[k] = v
+		}
+
+		obj, err = db.Codec.Decode(item)
+		if err != nil {
+			return errInvalidEntity(err)
+		}
+
+		return db.write(bucket, key, obj)
+	})
+	if err != nil {
+		return db.undefined, err
+	}
+
+	return obj, nil
+}
+
+// Match applies a pattern matching to elements in the table
+func (db *Storage[T]) Match(ctx context.Context, key T) dynamo.Seq[T] {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return newSeq(ctx, db, "", "", errInvalidKey(err))
+	}
+
+	hashKey, prefix := keyOf(key)
+	if prefix == "_" {
+		prefix = ""
+	}
+
+	return newSeq(ctx, db, hashKey, prefix, nil)
+}
+
+// Count number of elements matching the pattern and filters
+func (db *Storage[T]) Count(ctx context.Context, key T, filters ...dynamo.Constraint[T]) (int, error) {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return 0, errInvalidKey(err)
+	}
+
+	if err := mem.Supported(filters); err != nil {
+		return 0, errInvalidEntity(err)
+	}
+
+	hashKey, prefix := keyOf(key)
+	if prefix == "_" {
+		prefix = ""
+	}
+
+	seq, _, err := db.query(hashKey, prefix, nil, false, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, entity := range seq {
+		gen, err := db.Codec.Encode(entity)
+		if err != nil {
+			return 0, errInvalidEntity(err)
+		}
+
+		if mem.Check(gen, filters) == nil {
+			count++
+		}
+	}
+
+	return count, nil
+}
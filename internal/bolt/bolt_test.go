@@ -0,0 +1,65 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package bolt_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/dynamotest"
+	"github.com/holmes89/dynamo/service/bolt"
+)
+
+func open(t *testing.T) *bolt.DB {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestStorage(t *testing.T) {
+	dynamotest.TestStorage(t, func() dynamo.KeyVal[dynamotest.Person] {
+		return bolt.Must(bolt.New[dynamotest.Person]("bolt:///test", open(t)))
+	})
+}
+
+func TestConstraintsConjunction(t *testing.T) {
+	dynamotest.TestConstraints(t, func() dynamo.KeyVal[dynamotest.Person] {
+		return bolt.Must(bolt.New[dynamotest.Person]("bolt:///test", open(t)))
+	})
+}
+
+func TestBuckets(t *testing.T) {
+	db := open(t)
+	a := bolt.Must(bolt.New[dynamotest.Person]("bolt:///a", db))
+	b := bolt.Must(bolt.New[dynamotest.Person]("bolt:///b", db))
+
+	it.Ok(t).IfNil(a.Put(context.Background(), dynamotest.Person{Prefix: "org:a", Name: "a"}))
+
+	_, err := b.Get(context.Background(), dynamotest.Person{Prefix: "org:a"})
+	it.Ok(t).IfNotNil(err)
+
+	// Note: the partition is not matched by other partitions sharing its prefix
+	it.Ok(t).
+		IfNil(a.Put(context.Background(), dynamotest.Person{Prefix: "org:a", Suffix: "person:0"})).
+		IfNil(a.Put(context.Background(), dynamotest.Person{Prefix: "org:ab", Suffix: "person:1"})).
+		If(dynamotest.SortKeys(a.Match(context.Background(), dynamotest.Person{Prefix: "org:a", Suffix: "person:"}))).Equal("[person:0]").
+		If(dynamotest.SortKeys(a.Match(context.Background(), dynamotest.Person{Prefix: "org:a", Suffix: "person:"}).Reverse())).Equal("[person:0]")
+
+	_, err = bolt.New[dynamotest.Person]("bolt://", db)
+	it.Ok(t).IfNotNil(err)
+
+	_, err = bolt.New[dynamotest.Person]("bolt:///test", nil)
+	it.Ok(t).IfNotNil(err)
+}
@@ -0,0 +1,112 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file implements decoding of captured item changes
+//
+
+package ddb
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/fogfish/curie"
+	"github.com/holmes89/dynamo"
+)
+
+/*
+ChangeCodec decodes captured changes of items (e.g. records of streams)
+into typed changes. The item belongs to T if its key is reproduced by
+decoded value and matches one of key prefix rules, if any.
+*/
+type ChangeCodec[T dynamo.Thing] struct {
+	Codec *Codec[T]
+	Rules []dynamo.KeyPrefix
+}
+
+// key is a thing build from raw key attributes
+type key struct{ hashKey, sortKey curie.IRI }
+
+func (k key) HashKey() curie.IRI { return k.hashKey }
+func (k key) SortKey() curie.IRI { return k.sortKey }
+
+/*
+Decode captured change of the item, it returns the key of changed item or
+nil if the item does not belong to type T.
+*/
+func (c ChangeCodec[T]) Decode(
+	kind, sequence string,
+	keys, old, new map[string]types.AttributeValue,
+) (dynamo.Change[T], dynamo.Thing, error) {
+	change := dynamo.Change[T]{Kind: dynamo.ChangeKind(kind), Sequence: sequence}
+
+	thing, err := c.Codec.Decode(keys)
+	if err != nil {
+		return change, nil, nil
+	}
+
+	k, isT := c.keyOf(keys, thing)
+	if !isT {
+		return change, nil, nil
+	}
+
+	change.Old, err = c.decodeImage(old)
+	if err != nil {
+		return change, nil, errInvalidEntity(err)
+	}
+
+	change.New, err = c.decodeImage(new)
+	if err != nil {
+		return change, nil, errInvalidEntity(err)
+	}
+
+	return change, k, nil
+}
+
+func (c ChangeCodec[T]) decodeImage(image map[string]types.AttributeValue) (T, error) {
+	if image == nil {
+		return c.Codec.undefined, nil
+	}
+
+	return c.Codec.Decode(image)
+}
+
+// keyOf item, it checks that the item belongs to type
+func (c ChangeCodec[T]) keyOf(keys map[string]types.AttributeValue, thing T) (dynamo.Thing, bool) {
+	gen, err := c.Codec.EncodeKey(thing)
+	if err != nil {
+		return nil, false
+	}
+
+	hashKey, isHashKey := keys[c.Codec.pkPrefix].(*types.AttributeValueMemberS)
+	sortKey, isSortKey := keys[c.Codec.skSuffix].(*types.AttributeValueMemberS)
+	if !isHashKey || !isSortKey {
+		return nil, false
+	}
+
+	if !equalS(gen[c.Codec.pkPrefix], hashKey.Value) || !equalS(gen[c.Codec.skSuffix], sortKey.Value) {
+		return nil, false
+	}
+
+	k := key{hashKey: curie.IRI(hashKey.Value), sortKey: curie.IRI(sortKey.Value)}
+	if len(c.Rules) == 0 {
+		return k, true
+	}
+
+	for _, rule := range c.Rules {
+		if rule.Match(k) {
+			return k, true
+		}
+	}
+
+	return nil, false
+}
+
+func equalS(val types.AttributeValue, s string) bool {
+	v, ok := val.(*types.AttributeValueMemberS)
+	return ok && v.Value == s
+}
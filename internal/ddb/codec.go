@@ -23,6 +23,7 @@ Codec is utility to encode/decode objects to dynamo representation
 type Codec[T dynamo.Thing] struct {
 	pkPrefix  string
 	skSuffix  string
+	variants  Variants
 	undefined T
 }
 
@@ -73,6 +74,12 @@ func (codec Codec[T]) Encode(entity T) (map[string]types.AttributeValue, error)
 		gen[codec.skSuffix] = &types.AttributeValueMemberS{Value: "_"}
 	}
 
+	if codec.variants != nil {
+		if err := codec.variants.encode(codec.pkPrefix, codec.skSuffix, entity, gen); err != nil {
+			return nil, err
+		}
+	}
+
 	return gen, nil
 }
 
@@ -84,6 +91,14 @@ func (codec Codec[T]) Decode(gen map[string]types.AttributeValue) (T, error) {
 		return codec.undefined, errors.New("invalid DDB schema")
 	}
 
+	if codec.variants != nil {
+		entity, err := codec.variants.decode(codec.pkPrefix, codec.skSuffix, gen)
+		if err != nil {
+			return codec.undefined, err
+		}
+		return entity.(T), nil
+	}
+
 	var entity T
 	if err := attributevalue.UnmarshalMap(gen, &entity); err != nil {
 		return codec.undefined, err
@@ -13,6 +13,9 @@
 package ddb
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
@@ -21,7 +24,8 @@ import (
 )
 
 /*
-Internal implementation of conditional expressions for dynamo db
+Internal implementation of conditional expressions for dynamo db. Constraints
+are joined with logical and.
 */
 func maybeConditionExpression[T dynamo.Thing](
 	conditionExpression **string,
@@ -29,24 +33,19 @@ func maybeConditionExpression[T dynamo.Thing](
 ) (
 	expressionAttributeNames map[string]string,
 	expressionAttributeValues map[string]types.AttributeValue,
+	err error,
 ) {
 	if len(config) > 0 {
 		expressionAttributeNames = map[string]string{}
 		expressionAttributeValues = map[string]types.AttributeValue{}
 
-		switch op := config[0].(type) {
-		case *constrain.Dyadic[T]:
-			dyadic(op,
-				conditionExpression,
-				expressionAttributeNames,
-				expressionAttributeValues,
-			)
-		case *constrain.Unary[T]:
-			unary(op,
-				conditionExpression,
-				expressionAttributeNames,
-				expressionAttributeValues,
-			)
+		expr, err := conjunction(config, expressionAttributeNames, expressionAttributeValues, placeholder)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if expr != "" {
+			*conditionExpression = aws.String(expr)
 		}
 
 		// Unfortunately empty maps are not accepted by DynamoDB
@@ -69,65 +68,118 @@ func maybeUpdateConditionExpression[T dynamo.Thing](
 	expressionAttributeNames map[string]string,
 	expressionAttributeValues map[string]types.AttributeValue,
 	config []dynamo.Constraint[T],
-) {
+) error {
 	if len(config) > 0 {
-		switch op := config[0].(type) {
-		case *constrain.Dyadic[T]:
-			dyadic(op,
-				conditionExpression,
-				expressionAttributeNames,
-				expressionAttributeValues,
-			)
-		case *constrain.Unary[T]:
-			unary(op,
-				conditionExpression,
-				expressionAttributeNames,
-				expressionAttributeValues,
-			)
+		expr, err := conjunction(config, expressionAttributeNames, expressionAttributeValues, placeholder)
+		if err != nil {
+			return err
+		}
+
+		if expr != "" {
+			*conditionExpression = aws.String(expr)
 		}
 	}
+	return nil
+}
+
+// placeholder of the value of i-th constraint
+func placeholder(key string, i int) string {
+	if i == 0 {
+		return ":__" + key + "__"
+	}
+	return fmt.Sprintf(":__%s_%d__", key, i)
 }
 
 /*
-dyadic translate expression to dynamo format
+Internal implementation of filter expressions for dynamo db. Constraints
+are joined with logical and.
 */
-func dyadic[T dynamo.Thing](
-	op *constrain.Dyadic[T],
-	conditionExpression **string,
-	expressionAttributeNames map[string]string,
+func maybeFilterExpression[T dynamo.Thing](
+	filterExpression **string,
+	expressionAttributeNames *map[string]string,
 	expressionAttributeValues map[string]types.AttributeValue,
-) {
-	if op.Key == "" {
-		return
+	config []dynamo.Constraint[T],
+) error {
+	names := map[string]string{}
+	expr, err := conjunction(config, names, expressionAttributeValues,
+		func(key string, i int) string { return fmt.Sprintf(":__%s_%d__", key, i) },
+	)
+	if err != nil {
+		return err
 	}
 
-	lit, err := attributevalue.Marshal(op.Val)
-	if err != nil {
-		return
+	for k, v := range names {
+		setAttributeName(expressionAttributeNames, k, v)
 	}
 
-	key := "#__" + op.Key + "__"
-	let := ":__" + op.Key + "__"
-	expressionAttributeValues[let] = lit
-	expressionAttributeNames[key] = op.Key
-	*conditionExpression = aws.String(key + " " + op.Op + " " + let)
+	if expr != "" {
+		*filterExpression = aws.String(expr)
+	}
+
+	return nil
 }
 
+// comparators and functions of dynamo db expressions
+var (
+	comparators = map[string]struct{}{"=": {}, "<>": {}, "<": {}, "<=": {}, ">": {}, ">=": {}}
+	functions   = map[string]struct{}{"attribute_exists": {}, "attribute_not_exists": {}}
+)
+
 /*
-unary translate expression to dynamo format
+conjunction translates constraints to dynamo format joined with logical and,
+the placeholder names values of constraints. It fails if constraint is not
+supported by dynamo db (e.g. http headers).
 */
-func unary[T dynamo.Thing](
-	op *constrain.Unary[T],
-	conditionExpression **string,
+func conjunction[T dynamo.Thing](
+	config []dynamo.Constraint[T],
 	expressionAttributeNames map[string]string,
 	expressionAttributeValues map[string]types.AttributeValue,
-) {
-	if op.Key == "" {
-		return
+	placeholder func(string, int) string,
+) (string, error) {
+	seq := make([]string, 0, len(config))
+
+	for i, c := range config {
+		switch op := c.(type) {
+		case *constrain.Dyadic[T]:
+			if op.Key == "" {
+				continue
+			}
+
+			if _, has := comparators[op.Op]; !has {
+				return "", fmt.Errorf("unsupported constraint %s %s", op.Key, op.Op)
+			}
+
+			lit, err := attributevalue.Marshal(op.Val)
+			if err != nil {
+				return "", err
+			}
+
+			key := "#__" + op.Key + "__"
+			let := placeholder(op.Key, i)
+			expressionAttributeValues[let] = lit
+			expressionAttributeNames[key] = op.Key
+			seq = append(seq, key+" "+op.Op+" "+let)
+		case *constrain.Unary[T]:
+			if op.Key == "" {
+				continue
+			}
+
+			if _, has := functions[op.Op]; !has {
+				return "", fmt.Errorf("unsupported constraint %s(%s)", op.Op, op.Key)
+			}
+
+			key := "#__" + op.Key + "__"
+			expressionAttributeNames[key] = op.Key
+			seq = append(seq, op.Op+"("+key+")")
+		}
 	}
 
-	key := "#__" + op.Key + "__"
-	expressionAttributeNames[key] = op.Key
+	return strings.Join(seq, " and "), nil
+}
 
-	*conditionExpression = aws.String(op.Op + "(" + key + ")")
+func setAttributeName(names *map[string]string, key, val string) {
+	if *names == nil {
+		*names = map[string]string{}
+	}
+	(*names)[key] = val
 }
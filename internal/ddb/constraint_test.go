@@ -9,6 +9,7 @@
 package ddb
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
@@ -16,6 +17,7 @@ import (
 	"github.com/fogfish/curie"
 	"github.com/fogfish/it"
 	"github.com/holmes89/dynamo"
+	constrain "github.com/holmes89/dynamo/internal/constraint"
 )
 
 type tConstrain struct {
@@ -43,7 +45,7 @@ func TestConditionExpression(t *testing.T) {
 
 	for op, fn := range spec {
 		config := []dynamo.Constraint[tConstrain]{fn("abc")}
-		name, vals := maybeConditionExpression(&expr, config)
+		name, vals, _ := maybeConditionExpression(&expr, config)
 
 		expectExpr := fmt.Sprintf("#__anothername__ %s :__anothername__", op)
 		expectName := "anothername"
@@ -62,7 +64,7 @@ func TestExists(t *testing.T) {
 	)
 
 	config := []dynamo.Constraint[tConstrain]{Name.Exists()}
-	name, vals := maybeConditionExpression(&expr, config)
+	name, vals, _ := maybeConditionExpression(&expr, config)
 
 	expectExpr := "attribute_exists(#__anothername__)"
 	expectName := map[string]string{"#__anothername__": "anothername"}
@@ -79,7 +81,7 @@ func TestNotExists(t *testing.T) {
 	)
 
 	config := []dynamo.Constraint[tConstrain]{Name.NotExists()}
-	name, vals := maybeConditionExpression(&expr, config)
+	name, vals, _ := maybeConditionExpression(&expr, config)
 
 	expectExpr := "attribute_not_exists(#__anothername__)"
 	expectName := map[string]string{"#__anothername__": "anothername"}
@@ -96,7 +98,7 @@ func TestIs(t *testing.T) {
 	)
 
 	config := []dynamo.Constraint[tConstrain]{Name.Is("_")}
-	name, vals := maybeConditionExpression(&expr, config)
+	name, vals, _ := maybeConditionExpression(&expr, config)
 
 	expectExpr := "attribute_not_exists(#__anothername__)"
 	expectName := map[string]string{"#__anothername__": "anothername"}
@@ -108,7 +110,7 @@ func TestIs(t *testing.T) {
 
 	//
 	config = []dynamo.Constraint[tConstrain]{Name.Is("abc")}
-	name, vals = maybeConditionExpression(&expr, config)
+	name, vals, _ = maybeConditionExpression(&expr, config)
 
 	expectExpr = "#__anothername__ = :__anothername__"
 	expectVals := map[string]types.AttributeValue{
@@ -120,3 +122,62 @@ func TestIs(t *testing.T) {
 		If(vals).Should().Equal(expectVals).
 		If(name).Should().Equal(expectName)
 }
+
+func TestFilterExpression(t *testing.T) {
+	var (
+		expr  *string
+		names map[string]string
+		vals  = map[string]types.AttributeValue{}
+	)
+
+	config := []dynamo.Constraint[tConstrain]{Name.Ge("a"), Name.Lt("b"), Name.Exists()}
+	err := maybeFilterExpression(&expr, &names, vals, config)
+
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(*expr).Should().Equal("#__anothername__ >= :__anothername_0__ and #__anothername__ < :__anothername_1__ and attribute_exists(#__anothername__)").
+		If(vals[":__anothername_0__"]).Should().Equal(&types.AttributeValueMemberS{Value: "a"}).
+		If(vals[":__anothername_1__"]).Should().Equal(&types.AttributeValueMemberS{Value: "b"}).
+		If(names["#__anothername__"]).Should().Equal("anothername")
+}
+
+func TestConditionExpressionConjunction(t *testing.T) {
+	var (
+		expr *string = nil
+	)
+
+	config := []dynamo.Constraint[tConstrain]{Name.Exists(), Name.Ne("a"), Name.Ne("b")}
+	name, vals, err := maybeConditionExpression(&expr, config)
+
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(*expr).Should().Equal("attribute_exists(#__anothername__) and #__anothername__ <> :__anothername_1__ and #__anothername__ <> :__anothername_2__").
+		If(vals[":__anothername_1__"]).Should().Equal(&types.AttributeValueMemberS{Value: "a"}).
+		If(vals[":__anothername_2__"]).Should().Equal(&types.AttributeValueMemberS{Value: "b"}).
+		If(name["#__anothername__"]).Should().Equal("anothername")
+}
+
+// faulty value fails marshalling
+type faulty struct{}
+
+func (faulty) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	return nil, errors.New("faulty")
+}
+
+func TestFilterExpressionUnsupported(t *testing.T) {
+	var (
+		expr  *string
+		names map[string]string
+		vals  = map[string]types.AttributeValue{}
+	)
+
+	config := []dynamo.Constraint[tConstrain]{Name.Ge("a"), &constrain.Dyadic[tConstrain]{Op: "http", Key: "x", Val: "y"}}
+	err := maybeFilterExpression(&expr, &names, vals, config)
+	it.Ok(t).
+		If(err).ShouldNot().Equal(nil).
+		IfTrue(expr == nil)
+
+	config = []dynamo.Constraint[tConstrain]{&constrain.Dyadic[tConstrain]{Op: "=", Key: "x", Val: faulty{}}}
+	err = maybeFilterExpression(&expr, &names, vals, config)
+	it.Ok(t).If(err).ShouldNot().Equal(nil)
+}
@@ -0,0 +1,71 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file implements serialization of LastEvaluatedKey into cursor
+//
+
+package ddb
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// key attribute in DynamoDB JSON format, keys are either S, N or B
+type keyAttr struct {
+	S *string `json:"S,omitempty"`
+	N *string `json:"N,omitempty"`
+	B []byte  `json:"B,omitempty"`
+}
+
+// encodeCursorState serializes LastEvaluatedKey
+func encodeCursorState(key map[string]types.AttributeValue) ([]byte, error) {
+	gen := make(map[string]keyAttr, len(key))
+
+	for k, v := range key {
+		switch v := v.(type) {
+		case *types.AttributeValueMemberS:
+			gen[k] = keyAttr{S: &v.Value}
+		case *types.AttributeValueMemberN:
+			gen[k] = keyAttr{N: &v.Value}
+		case *types.AttributeValueMemberB:
+			gen[k] = keyAttr{B: v.Value}
+		default:
+			return nil, fmt.Errorf("unsupported key attribute %s of type %T", k, v)
+		}
+	}
+
+	return json.Marshal(gen)
+}
+
+// decodeCursorState deserializes LastEvaluatedKey
+func decodeCursorState(state []byte) (map[string]types.AttributeValue, error) {
+	var gen map[string]keyAttr
+	if err := json.Unmarshal(state, &gen); err != nil {
+		return nil, err
+	}
+
+	key := make(map[string]types.AttributeValue, len(gen))
+	for k, v := range gen {
+		switch {
+		case v.S != nil:
+			key[k] = &types.AttributeValueMemberS{Value: *v.S}
+		case v.N != nil:
+			key[k] = &types.AttributeValueMemberN{Value: *v.N}
+		case v.B != nil:
+			key[k] = &types.AttributeValueMemberB{Value: v.B}
+		default:
+			return nil, fmt.Errorf("undefined key attribute %s", k)
+		}
+	}
+
+	return key, nil
+}
@@ -83,7 +83,10 @@ func (db *Storage[T]) Put(ctx context.Context, entity T, config ...dynamo.Constr
 		TableName: db.Table,
 	}
 
-	names, values := maybeConditionExpression(&req.ConditionExpression, config)
+	names, values, err := maybeConditionExpression(&req.ConditionExpression, config)
+	if err != nil {
+		return errInvalidEntity(err)
+	}
 	req.ExpressionAttributeValues = values
 	req.ExpressionAttributeNames = names
 
@@ -112,7 +115,10 @@ func (db *Storage[T]) Remove(ctx context.Context, key T, config ...dynamo.Constr
 		Key:       gen,
 		TableName: db.Table,
 	}
-	names, values := maybeConditionExpression(&req.ConditionExpression, config)
+	names, values, err := maybeConditionExpression(&req.ConditionExpression, config)
+	if err != nil {
+		return errInvalidEntity(err)
+	}
 	req.ExpressionAttributeValues = values
 	req.ExpressionAttributeNames = names
 
@@ -158,12 +164,15 @@ func (db *Storage[T]) Update(ctx context.Context, entity T, config ...dynamo.Con
 		ReturnValues:              "ALL_NEW",
 	}
 
-	maybeUpdateConditionExpression(
+	err = maybeUpdateConditionExpression(
 		&req.ConditionExpression,
 		req.ExpressionAttributeNames,
 		req.ExpressionAttributeValues,
 		config,
 	)
+	if err != nil {
+		return db.undefined, errInvalidEntity(err)
+	}
 
 	val, err := db.Service.UpdateItem(ctx, req)
 	if err != nil {
@@ -186,9 +195,51 @@ func (db *Storage[T]) Update(ctx context.Context, entity T, config ...dynamo.Con
 
 // Match applies a pattern matching to elements in the table
 func (db *Storage[T]) Match(ctx context.Context, key T) dynamo.Seq[T] {
+	q, err := db.query(key)
+	if err != nil {
+		return newSeq(ctx, db, &dynamodb.QueryInput{}, err)
+	}
+
+	q.ProjectionExpression = db.Schema.Projection
+	q.ExpressionAttributeNames = db.Schema.ExpectedAttributeNames
+	q.ReturnConsumedCapacity = types.ReturnConsumedCapacityTotal
+
+	return newSeq(ctx, db, q, nil)
+}
+
+// Count number of elements matching the pattern and filters
+func (db *Storage[T]) Count(ctx context.Context, key T, filters ...dynamo.Constraint[T]) (int, error) {
+	q, err := db.query(key)
+	if err != nil {
+		return 0, err
+	}
+
+	q.Select = types.SelectCount
+	err = maybeFilterExpression(&q.FilterExpression, &q.ExpressionAttributeNames, q.ExpressionAttributeValues, filters)
+	if err != nil {
+		return 0, errInvalidEntity(err)
+	}
+
+	count := 0
+	for {
+		val, err := db.Service.Query(ctx, q)
+		if err != nil {
+			return 0, errServiceIO(err)
+		}
+
+		count += int(val.Count)
+		if val.LastEvaluatedKey == nil {
+			return count, nil
+		}
+		q.ExclusiveStartKey = val.LastEvaluatedKey
+	}
+}
+
+// query builds key condition expression for the pattern
+func (db *Storage[T]) query(key T) (*dynamodb.QueryInput, error) {
 	gen, err := db.Codec.EncodeKey(key)
 	if err != nil {
-		return newSeq[T](ctx, nil, nil, errInvalidKey(err))
+		return nil, errInvalidKey(err)
 	}
 
 	suffix, isSuffix := gen[db.Codec.skSuffix]
@@ -205,16 +256,12 @@ func (db *Storage[T]) Match(ctx context.Context, key T) dynamo.Seq[T] {
 		expr = expr + " and begins_with(" + db.Codec.skSuffix + ", :__" + db.Codec.skSuffix + "__)"
 	}
 
-	q := &dynamodb.QueryInput{
+	return &dynamodb.QueryInput{
 		KeyConditionExpression:    aws.String(expr),
 		ExpressionAttributeValues: exprOf(gen),
-		ProjectionExpression:      db.Schema.Projection,
-		ExpressionAttributeNames:  db.Schema.ExpectedAttributeNames,
 		TableName:                 db.Table,
 		IndexName:                 db.Index,
-	}
-
-	return newSeq(ctx, db, q, err)
+	}, nil
 }
 
 func exprOf(gen map[string]types.AttributeValue) (val map[string]types.AttributeValue) {
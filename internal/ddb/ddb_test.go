@@ -10,15 +10,26 @@ package ddb_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/fogfish/curie"
 	"github.com/fogfish/it"
 	"github.com/holmes89/dynamo"
 	"github.com/holmes89/dynamo/internal/ddb/ddbtest"
 	"github.com/holmes89/dynamo/internal/dynamotest"
+	ddbapi "github.com/holmes89/dynamo/service/ddb"
+	"github.com/holmes89/dynamo/service/ddb/emulator"
 )
 
 type person struct {
@@ -64,6 +75,12 @@ func TestDynamoDB(t *testing.T) {
 	dynamotest.TestMatch(t, codec, ddbtest.Query[dynamotest.Person])
 }
 
+func TestConstraintsConjunction(t *testing.T) {
+	dynamotest.TestConstraints(t, func() dynamo.KeyVal[dynamotest.Person] {
+		return ddbapi.Must(ddbapi.New[dynamotest.Person]("ddb:///test", emulator.New(emulator.Table{Name: "test", HashKey: "prefix", SortKey: "suffix"}), nil))
+	})
+}
+
 func TestDdbPutWithConstrain(t *testing.T) {
 	name := dynamo.Schema1[person, string]("Name")
 	ddb := ddbtest.Constrains[person](nil)
@@ -107,3 +124,568 @@ func TestDdbUpdateWithConstrain(t *testing.T) {
 		If(success).Should().Equal(nil).
 		IfTrue(ispcf)
 }
+
+type ddbQueryIndex struct {
+	dynamo.DynamoDB
+	lastKey  map[string]types.AttributeValue
+	startKey map[string]types.AttributeValue
+}
+
+func (mock *ddbQueryIndex) Query(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	mock.startKey = input.ExclusiveStartKey
+
+	return &dynamodb.QueryOutput{
+		Count:            1,
+		Items:            []map[string]types.AttributeValue{entityDynamo()},
+		LastEvaluatedKey: mock.lastKey,
+	}, nil
+}
+
+func TestDdbCursorWithIndex(t *testing.T) {
+	lastKey := map[string]types.AttributeValue{
+		"prefix":   &types.AttributeValueMemberS{Value: "dead:beef"},
+		"suffix":   &types.AttributeValueMemberS{Value: "1"},
+		"category": &types.AttributeValueMemberS{Value: "Math"},
+		"year":     &types.AttributeValueMemberN{Value: "1950"},
+	}
+	mock := &ddbQueryIndex{lastKey: lastKey}
+	ddb := ddbapi.Must(
+		ddbapi.New[person]("ddb:///test/index?prefix=category&suffix=year", mock, nil),
+	)
+
+	seq := ddb.Match(context.TODO(), person{Prefix: "Math"}).Limit(1)
+	seq.Tail()
+
+	cursor, ok := seq.Cursor().(*dynamo.Cursor)
+	it.Ok(t).
+		IfTrue(ok).
+		If(cursor.HashKey()).Should().Equal(curie.IRI("Math"))
+
+	secret := []byte("secret")
+	token := cursor.Encode(secret)
+	next, err := dynamo.DecodeCursor(token, secret)
+	it.Ok(t).If(err).Should().Equal(nil)
+
+	seq = ddb.Match(context.TODO(), person{Prefix: "Math"}).Continue(next)
+	seq.Tail()
+
+	it.Ok(t).
+		IfTrue(reflect.DeepEqual(mock.startKey, lastKey))
+}
+
+func TestDdbMatchInvalidKey(t *testing.T) {
+	ddb := ddbapi.Must(ddbapi.New[person]("ddb:///test", &ddbQueryIndex{}, nil))
+	seq := ddb.Match(context.TODO(), person{})
+
+	var errs []error
+	for _, err := range dynamo.All(seq) {
+		errs = append(errs, err)
+	}
+
+	_, err := seq.Head()
+	it.Ok(t).
+		If(len(errs)).Should().Equal(1).
+		IfNotNil(errs[0]).
+		IfNotNil(err).
+		If(seq.Tail()).Should().Equal(false)
+}
+
+func TestDdbCount(t *testing.T) {
+	pages := make([][]map[string]types.AttributeValue, 3)
+	for i := range pages {
+		for j := 0; j < 2; j++ {
+			item := entityDynamo()
+			item["suffix"] = &types.AttributeValueMemberS{Value: fmt.Sprintf("%d", i*2+j)}
+			pages[i] = append(pages[i], item)
+		}
+	}
+	ddb := ddbtest.QueryPages[person](pages...)
+
+	n, err := ddb.(dynamo.KeyValCounter[person]).Count(context.TODO(), person{Prefix: "dead:beef"})
+
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(n).Should().Equal(6)
+}
+
+// ddbBatchGet counts batches, the first batch leaves unprocessed keys
+type ddbBatchGet struct {
+	*emulator.DynamoDB
+	batches     atomic.Int32
+	keys        atomic.Int32
+	unprocessed bool
+}
+
+func (mock *ddbBatchGet) BatchGetItem(ctx context.Context, input *dynamodb.BatchGetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	mock.batches.Add(1)
+	for _, req := range input.RequestItems {
+		mock.keys.Add(int32(len(req.Keys)))
+	}
+
+	if mock.unprocessed && mock.batches.Load() == 1 {
+		req := input.RequestItems["test"]
+		head, tail := req.Keys[:1], req.Keys[1:]
+		req.Keys = head
+
+		val, err := mock.DynamoDB.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+			RequestItems: map[string]types.KeysAndAttributes{"test": req},
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		val.UnprocessedKeys = map[string]types.KeysAndAttributes{
+			"test": {Keys: tail, ProjectionExpression: req.ProjectionExpression, ExpressionAttributeNames: req.ExpressionAttributeNames},
+		}
+		return val, nil
+	}
+
+	return mock.DynamoDB.BatchGetItem(ctx, input, opts...)
+}
+
+func loaderFixture(connector string, unprocessed bool) (*ddbBatchGet, dynamo.KeyValGetter[person]) {
+	emu := emulator.New(emulator.Table{Name: "test", HashKey: "prefix", SortKey: "suffix"})
+	db := ddbapi.Must(ddbapi.New[person]("ddb:///test", emu, nil))
+	for i := 0; i < 10; i++ {
+		db.Put(context.TODO(), person{Prefix: "org:a", Suffix: curie.New("person:%d", i), Age: i})
+	}
+
+	mock := &ddbBatchGet{DynamoDB: emu, unprocessed: unprocessed}
+	loader, err := ddbapi.NewLoader[person](connector, mock)
+	if err != nil {
+		panic(err)
+	}
+
+	return mock, loader
+}
+
+func TestLoader(t *testing.T) {
+	mock, loader := loaderFixture("ddb:///test?window=10ms", false)
+
+	var wg sync.WaitGroup
+	ages := make([]int, 20)
+	errs := make([]error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Note: keys are requested twice
+			val, err := loader.Get(context.TODO(), person{Prefix: "org:a", Suffix: curie.New("person:%d", i%10)})
+			ages[i], errs[i] = val.Age, err
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 20; i++ {
+		it.Ok(t).
+			If(errs[i]).Should().Equal(nil).
+			If(ages[i]).Should().Equal(i % 10)
+	}
+
+	it.Ok(t).
+		If(mock.batches.Load()).Should().Equal(int32(1)).
+		If(mock.keys.Load()).Should().Equal(int32(10))
+}
+
+func TestLoaderBatchSize(t *testing.T) {
+	mock, loader := loaderFixture("ddb:///test?window=1h&batch=5", false)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			loader.Get(context.TODO(), person{Prefix: "org:a", Suffix: curie.New("person:%d", i)})
+		}(i)
+	}
+	wg.Wait()
+
+	it.Ok(t).If(mock.batches.Load()).Should().Equal(int32(2))
+}
+
+func TestLoaderNotFound(t *testing.T) {
+	_, loader := loaderFixture("ddb:///test", false)
+
+	_, err := loader.Get(context.TODO(), person{Prefix: "org:a", Suffix: "person:x"})
+
+	var e interface{ NotFound() string }
+	it.Ok(t).IfTrue(errors.As(err, &e))
+
+	_, err = loader.Get(context.TODO(), person{})
+	it.Ok(t).IfFalse(err == nil)
+}
+
+func TestLoaderUnprocessedKeys(t *testing.T) {
+	mock, loader := loaderFixture("ddb:///test?window=10ms", true)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = loader.Get(context.TODO(), person{Prefix: "org:a", Suffix: curie.New("person:%d", i)})
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		it.Ok(t).If(err).Should().Equal(nil)
+	}
+	it.Ok(t).If(mock.batches.Load()).Should().Equal(int32(2))
+}
+
+func TestLoaderNotSupported(t *testing.T) {
+	// Note: the client does not implement batch api
+	client := struct{ dynamo.DynamoDB }{emulator.New()}
+
+	_, err := ddbapi.NewLoader[person]("ddb:///test", client)
+	it.Ok(t).IfTrue(strings.Contains(err.Error(), "not supported"))
+
+	_, err = ddbapi.NewWriter[person]("ddb:///test", client, nil)
+	it.Ok(t).IfTrue(strings.Contains(err.Error(), "not supported"))
+
+	// Note: the limiter implements batch api only if the client does
+	limiter, _ := ddbapi.NewLimiter(client, nil, 100, 100)
+	_, ok := limiter.(dynamo.DynamoDBBatch)
+	it.Ok(t).IfFalse(ok)
+
+	limiter, _ = ddbapi.NewLimiter(emulator.New(), nil, 100, 100)
+	_, ok = limiter.(dynamo.DynamoDBBatch)
+	it.Ok(t).IfTrue(ok)
+}
+
+func TestLoaderConnector(t *testing.T) {
+	for _, connector := range []string{
+		"ddb:///test/index",
+		"ddb:///test?window=x",
+		"ddb:///test?batch=101",
+	} {
+		_, err := ddbapi.NewLoader[person](connector, &ddbBatchGet{})
+		it.Ok(t).IfFalse(err == nil)
+	}
+}
+
+// ddbBatchWrite counts batches, it fails or leaves unprocessed items on demand
+type ddbBatchWrite struct {
+	*emulator.DynamoDB
+	batches     atomic.Int32
+	unprocessed bool
+	err         error
+	gate        chan struct{}
+}
+
+func (mock *ddbBatchWrite) BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	n := mock.batches.Add(1)
+	if mock.gate != nil {
+		<-mock.gate
+	}
+
+	if mock.err != nil {
+		return nil, mock.err
+	}
+
+	if mock.unprocessed && n == 1 {
+		reqs := input.RequestItems["test"]
+		val, err := mock.DynamoDB.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{"test": reqs[:1]},
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		val.UnprocessedItems = map[string][]types.WriteRequest{"test": reqs[1:]}
+		return val, nil
+	}
+
+	return mock.DynamoDB.BatchWriteItem(ctx, input, opts...)
+}
+
+func writerFixture(connector string, mock *ddbBatchWrite, failure func(person, error)) (dynamo.KeyVal[person], ddbapi.Writer[person]) {
+	emu := emulator.New(emulator.Table{Name: "test", HashKey: "prefix", SortKey: "suffix"})
+	mock.DynamoDB = emu
+
+	w, err := ddbapi.NewWriter[person](connector, mock, failure)
+	if err != nil {
+		panic(err)
+	}
+
+	return ddbapi.Must(ddbapi.New[person]("ddb:///test", emu, nil)), w
+}
+
+func TestWriter(t *testing.T) {
+	mock := &ddbBatchWrite{}
+	db, w := writerFixture("ddb:///test?interval=1h", mock, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 60; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w.Put(context.TODO(), person{Prefix: "org:a", Suffix: curie.New("person:%d", i)})
+		}(i)
+	}
+	wg.Wait()
+
+	it.Ok(t).If(w.Flush(context.TODO())).Should().Equal(nil)
+
+	n, err := db.(dynamo.KeyValCounter[person]).Count(context.TODO(), person{Prefix: "org:a"})
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(n).Should().Equal(60).
+		If(mock.batches.Load()).Should().Equal(int32(3))
+}
+
+func TestWriterLastWriteWins(t *testing.T) {
+	mock := &ddbBatchWrite{}
+	db, w := writerFixture("ddb:///test?interval=1h", mock, nil)
+
+	w.Put(context.TODO(), person{Prefix: "org:a", Suffix: "person:1", Age: 1})
+	w.Put(context.TODO(), person{Prefix: "org:a", Suffix: "person:1", Age: 2})
+	w.Put(context.TODO(), person{Prefix: "org:a", Suffix: "person:2"})
+	w.Remove(context.TODO(), person{Prefix: "org:a", Suffix: "person:2"})
+	w.Flush(context.TODO())
+
+	val, err := db.Get(context.TODO(), person{Prefix: "org:a", Suffix: "person:1"})
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(val.Age).Should().Equal(2)
+
+	_, err = db.Get(context.TODO(), person{Prefix: "org:a", Suffix: "person:2"})
+	it.Ok(t).
+		IfFalse(err == nil).
+		If(mock.batches.Load()).Should().Equal(int32(1))
+}
+
+func TestWriterUnprocessedItems(t *testing.T) {
+	mock := &ddbBatchWrite{unprocessed: true}
+	db, w := writerFixture("ddb:///test?interval=1h", mock, nil)
+
+	for i := 0; i < 3; i++ {
+		w.Put(context.TODO(), person{Prefix: "org:a", Suffix: curie.New("person:%d", i)})
+	}
+	w.Flush(context.TODO())
+
+	n, _ := db.(dynamo.KeyValCounter[person]).Count(context.TODO(), person{Prefix: "org:a"})
+	it.Ok(t).
+		If(n).Should().Equal(3).
+		If(mock.batches.Load()).Should().Equal(int32(2))
+}
+
+func TestWriterFailure(t *testing.T) {
+	var mu sync.Mutex
+	failed := []string{}
+	mock := &ddbBatchWrite{err: errors.New("boom")}
+	_, w := writerFixture("ddb:///test?interval=1h", mock, func(p person, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, string(p.Suffix))
+	})
+
+	w.Put(context.TODO(), person{Prefix: "org:a", Suffix: "person:1"})
+	w.Remove(context.TODO(), person{Prefix: "org:a", Suffix: "person:2"})
+	w.Flush(context.TODO())
+
+	it.Ok(t).If(len(failed)).Should().Equal(2)
+}
+
+func TestWriterBackpressure(t *testing.T) {
+	mock := &ddbBatchWrite{gate: make(chan struct{})}
+	_, w := writerFixture("ddb:///test?interval=1h&buffer=1&batch=1", mock, nil)
+
+	// Note: the first write blocks the writer, the second fills the buffer
+	w.Put(context.TODO(), person{Prefix: "org:a", Suffix: "person:1"})
+	for mock.batches.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	w.Put(context.TODO(), person{Prefix: "org:a", Suffix: "person:2"})
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+
+	err := w.Put(ctx, person{Prefix: "org:a", Suffix: "person:3"})
+	it.Ok(t).IfTrue(errors.Is(err, context.DeadlineExceeded))
+
+	close(mock.gate)
+	it.Ok(t).If(w.Close(context.TODO())).Should().Equal(nil)
+}
+
+func TestWriterClose(t *testing.T) {
+	mock := &ddbBatchWrite{}
+	db, w := writerFixture("ddb:///test?interval=1h", mock, nil)
+
+	w.Put(context.TODO(), person{Prefix: "org:a", Suffix: "person:1"})
+	it.Ok(t).If(w.Close(context.TODO())).Should().Equal(nil)
+
+	_, err := db.Get(context.TODO(), person{Prefix: "org:a", Suffix: "person:1"})
+	it.Ok(t).If(err).Should().Equal(nil)
+
+	err = w.Put(context.TODO(), person{Prefix: "org:a", Suffix: "person:2"})
+	it.Ok(t).
+		IfFalse(err == nil).
+		If(w.Close(context.TODO())).Should().Equal(nil)
+}
+
+// clock advances on each wait, the wait is blocked if clock is stopped
+type clock struct {
+	mu      sync.Mutex
+	t       time.Time
+	waited  time.Duration
+	stopped bool
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopped {
+		return nil
+	}
+
+	c.t = c.t.Add(d)
+	c.waited += d
+
+	ch := make(chan time.Time, 1)
+	ch <- c.t
+	return ch
+}
+
+func TestLimiterWrites(t *testing.T) {
+	emu := emulator.New(emulator.Table{Name: "test", HashKey: "prefix", SortKey: "suffix"})
+	c := &clock{t: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	client, _ := ddbapi.NewLimiter(emu, c, 0, 200)
+
+	// Note: storages share the budget of the client
+	a := ddbapi.Must(ddbapi.New[person]("ddb:///test", client, nil))
+	b := ddbapi.Must(ddbapi.New[person]("ddb:///test", client, nil))
+
+	for i := 0; i < 130; i++ {
+		it.Ok(t).
+			If(a.Put(context.TODO(), person{Prefix: "org:a", Suffix: curie.New("person:%d", i)})).Should().Equal(nil).
+			If(b.Put(context.TODO(), person{Prefix: "org:b", Suffix: curie.New("person:%d", i)})).Should().Equal(nil)
+	}
+
+	// Note: 260 units of 200 WCU burst, 60 units are refilled in 300ms
+	it.Ok(t).
+		IfTrue(c.waited >= 295*time.Millisecond).
+		IfTrue(c.waited <= 305*time.Millisecond)
+}
+
+func TestLimiterAdapts(t *testing.T) {
+	emu := emulator.New(emulator.Table{Name: "test", HashKey: "prefix", SortKey: "suffix"})
+	c := &clock{t: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}
+	client, _ := ddbapi.NewLimiter(emu, c, 100, 0)
+	db := ddbapi.Must(ddbapi.New[person]("ddb:///test", client, nil))
+
+	// Note: reads of the item consume 12.5 units, the estimate is 0.5 unit
+	key := person{Prefix: "org:a", Suffix: "person:1"}
+	db.Put(context.TODO(), person{Prefix: "org:a", Suffix: "person:1", Address: strings.Repeat("x", 100000)})
+
+	for i := 0; i < 10; i++ {
+		_, err := db.Get(context.TODO(), key)
+		it.Ok(t).If(err).Should().Equal(nil)
+	}
+
+	it.Ok(t).IfTrue(c.waited >= 150*time.Millisecond)
+
+	// Note: the reservation is cancelled with the context while clock is stopped
+	c.stopped = true
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	_, err := db.Get(ctx, key)
+	it.Ok(t).IfTrue(errors.Is(err, context.Canceled))
+}
+
+func TestPolymorphicKeyPrefix(t *testing.T) {
+	emu := emulator.New(emulator.Table{Name: "test", HashKey: "prefix", SortKey: "suffix"})
+	db := ddbapi.Must(ddbapi.NewPolymorphic("ddb:///test", emu, nil,
+		ddbapi.KeyPrefix[author]("author:", "_"),
+		ddbapi.KeyPrefix[article]("author:", "article:"),
+	))
+
+	a := author{ID: "author:neumann", Name: "John von Neumann"}
+	b := article{Author: "author:neumann", ID: "article:automata", Title: "Theory of Automata"}
+	c := article{Author: "author:neumann", ID: "article:computer", Title: "The Computer and the Brain"}
+
+	for _, x := range []dynamo.Thing{a, b, c} {
+		it.Ok(t).If(db.Put(context.TODO(), x)).Should().Equal(nil)
+	}
+
+	seq := make([]dynamo.Thing, 0)
+	for x, err := range dynamo.All(db.Match(context.TODO(), author{ID: "author:neumann"})) {
+		it.Ok(t).If(err).Should().Equal(nil)
+		seq = append(seq, x)
+	}
+	it.Ok(t).If(seq).Equal([]dynamo.Thing{a, b, c})
+
+	x, err := db.Get(context.TODO(), article{Author: "author:neumann", ID: "article:automata"})
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(x).Equal(b)
+
+	y, err := db.Update(context.TODO(), author{ID: "author:neumann", Name: "J. von Neumann"})
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(y).Equal(author{ID: "author:neumann", Name: "J. von Neumann"})
+}
+
+func TestPolymorphicKind(t *testing.T) {
+	emu := emulator.New(emulator.Table{Name: "test", HashKey: "prefix", SortKey: "suffix"})
+	db := ddbapi.Must(ddbapi.NewPolymorphic("ddb:///test", emu, nil,
+		ddbapi.Kind[author]("kind", "author"),
+		ddbapi.Kind[article]("kind", "article"),
+	))
+
+	// Note: key prefixes do not define the type of items
+	a := author{ID: "org:neumann", Name: "John von Neumann"}
+	b := article{Author: "org:neumann", ID: "automata", Title: "Theory of Automata"}
+	it.Ok(t).
+		If(db.Put(context.TODO(), a)).Should().Equal(nil).
+		If(db.Put(context.TODO(), b)).Should().Equal(nil)
+
+	val, _ := emu.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: aws.String("test"),
+		Key: map[string]types.AttributeValue{
+			"prefix": &types.AttributeValueMemberS{Value: "org:neumann"},
+			"suffix": &types.AttributeValueMemberS{Value: "automata"},
+		},
+	})
+	it.Ok(t).If(val.Item["kind"]).Equal(&types.AttributeValueMemberS{Value: "article"})
+
+	seq := dynamo.Things[dynamo.Thing]{}
+	err := db.Match(context.TODO(), author{ID: "org:neumann"}).FMap(seq.Join)
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(seq).Equal(dynamo.Things[dynamo.Thing]{a, b})
+}
+
+func TestPolymorphicUnknown(t *testing.T) {
+	emu := emulator.New(emulator.Table{Name: "test", HashKey: "prefix", SortKey: "suffix"})
+	db := ddbapi.Must(ddbapi.NewPolymorphic("ddb:///test", emu, nil,
+		ddbapi.KeyPrefix[author]("author:", "_"),
+	))
+
+	// Note: the type is not registered
+	err := db.Put(context.TODO(), article{Author: "author:neumann", ID: "article:automata"})
+	it.Ok(t).IfTrue(strings.Contains(err.Error(), "is not registered"))
+
+	// Note: the item would be decoded as other type
+	err = db.Put(context.TODO(), author{ID: "keyword:automata"})
+	it.Ok(t).IfTrue(strings.Contains(err.Error(), "does not match variant"))
+
+	ddbapi.Must(ddbapi.New[article]("ddb:///test", emu, nil)).
+		Put(context.TODO(), article{Author: "author:neumann", ID: "article:automata"})
+
+	_, err = db.Get(context.TODO(), article{Author: "author:neumann", ID: "article:automata"})
+	it.Ok(t).IfTrue(strings.Contains(err.Error(), "does not match any variant"))
+
+	_, err = ddbapi.NewPolymorphic("ddb:///test", emu, nil)
+	it.Ok(t).If(err).ShouldNot().Equal(nil)
+}
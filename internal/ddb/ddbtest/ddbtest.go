@@ -15,10 +15,14 @@ package ddbtest
 import (
 	"context"
 	"errors"
+	"fmt"
 	"reflect"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
 
 	"github.com/fogfish/curie"
 	"github.com/holmes89/dynamo"
@@ -251,3 +255,170 @@ func (mock ddbConstrains) UpdateItem(ctx context.Context, input *dynamodb.Update
 		Attributes: mock.returnVal,
 	}, nil
 }
+
+/*
+QueryPages mock returns the sequence of pages, the cursor is
+the key of the last item at the page.
+*/
+func QueryPages[T dynamo.Thing](
+	pages ...[]map[string]types.AttributeValue,
+) dynamo.KeyVal[T] {
+	return mock[T](&ddbQueryPages{pages: pages})
+}
+
+type ddbQueryPages struct {
+	dynamo.DynamoDB
+	pages [][]map[string]types.AttributeValue
+}
+
+func (mock *ddbQueryPages) Query(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	at := 0
+	if input.ExclusiveStartKey != nil {
+		at = len(mock.pages)
+		for i, page := range mock.pages {
+			if len(page) > 0 && reflect.DeepEqual(lastKeyOf(page), input.ExclusiveStartKey) {
+				at = i + 1
+			}
+		}
+	}
+
+	if at >= len(mock.pages) {
+		return &dynamodb.QueryOutput{}, nil
+	}
+
+	page := mock.pages[at]
+	if input.Select == types.SelectCount {
+		if input.ProjectionExpression != nil {
+			return nil, errors.New("projection is not allowed with count")
+		}
+		page = nil
+	}
+
+	var lastEvaluatedKey map[string]types.AttributeValue
+	if at < len(mock.pages)-1 && len(mock.pages[at]) > 0 {
+		lastEvaluatedKey = lastKeyOf(mock.pages[at])
+	}
+
+	return &dynamodb.QueryOutput{
+		Count:            int32(len(mock.pages[at])),
+		ScannedCount:     int32(len(mock.pages[at])),
+		Items:            page,
+		LastEvaluatedKey: lastEvaluatedKey,
+		ConsumedCapacity: &types.ConsumedCapacity{
+			CapacityUnits: aws.Float64(float64(len(page)) / 2),
+		},
+	}, nil
+}
+
+func lastKeyOf(page []map[string]types.AttributeValue) map[string]types.AttributeValue {
+	last := page[len(page)-1]
+	return map[string]types.AttributeValue{
+		"prefix": last["prefix"],
+		"suffix": last["suffix"],
+	}
+}
+
+/*
+Streams mock serves records of closed shards
+*/
+type Streams struct {
+	// Shards in the order of lineage, parent is the previous shard
+	Shards [][]streamtypes.Record
+	// Expire iterator once per shard
+	Expire bool
+
+	expired map[string]bool
+}
+
+func (mock *Streams) ListStreams(ctx context.Context, input *dynamodbstreams.ListStreamsInput, opts ...func(*dynamodbstreams.Options)) (*dynamodbstreams.ListStreamsOutput, error) {
+	return &dynamodbstreams.ListStreamsOutput{
+		Streams: []streamtypes.Stream{
+			{StreamArn: aws.String("arn:old"), StreamLabel: aws.String("2022-01-01T00:00:00.000"), TableName: input.TableName},
+			{StreamArn: aws.String("arn:test"), StreamLabel: aws.String("2022-12-01T00:00:00.000"), TableName: input.TableName},
+		},
+	}, nil
+}
+
+func (mock *Streams) DescribeStream(ctx context.Context, input *dynamodbstreams.DescribeStreamInput, opts ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error) {
+	if aws.ToString(input.StreamArn) != "arn:test" {
+		return nil, errors.New("unexpected stream")
+	}
+
+	shards := make([]streamtypes.Shard, len(mock.Shards))
+	for i := range mock.Shards {
+		shards[i] = streamtypes.Shard{
+			ShardId: aws.String(fmt.Sprintf("shard-%d", i)),
+			SequenceNumberRange: &streamtypes.SequenceNumberRange{
+				StartingSequenceNumber: aws.String("0"),
+				EndingSequenceNumber:   aws.String("1"),
+			},
+		}
+		if i > 0 {
+			shards[i].ParentShardId = aws.String(fmt.Sprintf("shard-%d", i-1))
+		}
+	}
+
+	// Note: shards are listed in reverse order to ensure lineage handling
+	for i, j := 0, len(shards)-1; i < j; i, j = i+1, j-1 {
+		shards[i], shards[j] = shards[j], shards[i]
+	}
+
+	return &dynamodbstreams.DescribeStreamOutput{
+		StreamDescription: &streamtypes.StreamDescription{
+			StreamArn: input.StreamArn,
+			Shards:    shards,
+		},
+	}, nil
+}
+
+func (mock *Streams) GetShardIterator(ctx context.Context, input *dynamodbstreams.GetShardIteratorInput, opts ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	var shard int
+	if _, err := fmt.Sscanf(aws.ToString(input.ShardId), "shard-%d", &shard); err != nil {
+		return nil, err
+	}
+
+	at := 0
+	if input.ShardIteratorType == streamtypes.ShardIteratorTypeAfterSequenceNumber {
+		for i, r := range mock.Shards[shard] {
+			if aws.ToString(r.Dynamodb.SequenceNumber) == aws.ToString(input.SequenceNumber) {
+				at = i + 1
+			}
+		}
+	}
+
+	return &dynamodbstreams.GetShardIteratorOutput{
+		ShardIterator: aws.String(fmt.Sprintf("%d/%d", shard, at)),
+	}, nil
+}
+
+func (mock *Streams) GetRecords(ctx context.Context, input *dynamodbstreams.GetRecordsInput, opts ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error) {
+	var shard, at int
+	if _, err := fmt.Sscanf(aws.ToString(input.ShardIterator), "%d/%d", &shard, &at); err != nil {
+		return nil, err
+	}
+
+	if mock.Expire && at > 0 {
+		if mock.expired == nil {
+			mock.expired = map[string]bool{}
+		}
+		if !mock.expired[*input.ShardIterator] {
+			mock.expired[*input.ShardIterator] = true
+			return nil, &streamtypes.ExpiredIteratorException{}
+		}
+	}
+
+	// Note: records are served by one
+	records := mock.Shards[shard]
+	if at >= len(records) {
+		return &dynamodbstreams.GetRecordsOutput{}, nil
+	}
+
+	return &dynamodbstreams.GetRecordsOutput{
+		Records:           records[at : at+1],
+		NextShardIterator: aws.String(fmt.Sprintf("%d/%d", shard, at+1)),
+	}, nil
+}
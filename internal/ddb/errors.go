@@ -123,9 +123,23 @@ func errEndOfStream() error {
 	return fmt.Errorf("[%s] end of stream", name)
 }
 
+func errClosed() error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] writer is closed", name)
+}
+
 func recoverConditionalCheckFailedException(err error) bool {
+	return recoverErrorCode(err, "ConditionalCheckFailedException")
+}
+
+func recoverErrorCode(err error, code string) bool {
 	var e interface{ ErrorCode() string }
 
 	ok := errors.As(err, &e)
-	return ok && e.ErrorCode() == "ConditionalCheckFailedException"
+	return ok && e.ErrorCode() == code
 }
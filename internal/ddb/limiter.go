@@ -0,0 +1,450 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file implements client-side rate limiting of capacity units
+//
+
+package ddb
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/holmes89/dynamo"
+)
+
+/*
+Clock of the bucket, it measures refills and delays reservations.
+*/
+type Clock interface {
+	Now() time.Time
+	After(time.Duration) <-chan time.Time
+}
+
+// SystemClock is the wall clock
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time                         { return time.Now() }
+func (SystemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+/*
+Bucket is token bucket of capacity units. Requests reserve estimated
+units, the caller waits until the bucket is refilled if units are not
+available. The bucket is corrected when actual consumption is known.
+*/
+type Bucket struct {
+	mu sync.Mutex
+	// Rate of refill, capacity units per second
+	Rate float64
+	// Burst is the capacity of bucket
+	Burst  float64
+	tokens float64
+	last   time.Time
+	clock  Clock
+}
+
+// NewBucket creates full bucket
+func NewBucket(rate, burst float64, clock Clock) *Bucket {
+	return &Bucket{
+		Rate:   rate,
+		Burst:  burst,
+		tokens: burst,
+		last:   clock.Now(),
+		clock:  clock,
+	}
+}
+
+func (b *Bucket) refill() {
+	now := b.clock.Now()
+	b.tokens = math.Min(b.Burst, b.tokens+now.Sub(b.last).Seconds()*b.Rate)
+	b.last = now
+}
+
+// wait reserves units, the caller is blocked until reservation is due
+func (b *Bucket) wait(ctx context.Context, units float64) error {
+	if b == nil || b.Rate <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	b.refill()
+	b.tokens -= units
+	delay := time.Duration(-b.tokens / b.Rate * float64(time.Second))
+	b.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		b.adjust(-units)
+		return ctx.Err()
+	case <-b.clock.After(delay):
+		return nil
+	}
+}
+
+// adjust the bucket with difference of actual and estimated consumption
+func (b *Bucket) adjust(units float64) {
+	if b == nil || b.Rate <= 0 || units == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	b.refill()
+	b.tokens = math.Min(b.Burst, b.tokens-units)
+	b.mu.Unlock()
+}
+
+// estimate of consumption learnt from responses (moving average)
+type estimate struct {
+	mu  sync.Mutex
+	val float64
+}
+
+func (e *estimate) get(min float64) float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return math.Max(min, e.val)
+}
+
+func (e *estimate) learn(val float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.val == 0 {
+		e.val = val
+		return
+	}
+	e.val = 0.8*e.val + 0.2*val
+}
+
+/*
+Limiter is DynamoDB client that budgets reads and writes in capacity units.
+Consumption of requests is estimated from size of items, the estimate is
+corrected by ConsumedCapacity returned by DynamoDB. The limiter is shared
+by storages that use the same table. The limiter does not implement batch
+api, see BatchLimiter.
+*/
+type Limiter struct {
+	dynamo.DynamoDB
+	Read  *Bucket
+	Write *Bucket
+
+	get   estimate
+	query estimate
+}
+
+// size of item, it follows the size function of DynamoDB
+func sizeOf(item map[string]types.AttributeValue) int {
+	n := 0
+	for k, v := range item {
+		n += len(k) + sizeOfValue(v)
+	}
+	return n
+}
+
+func sizeOfValue(v types.AttributeValue) int {
+	switch x := v.(type) {
+	case *types.AttributeValueMemberS:
+		return len(x.Value)
+	case *types.AttributeValueMemberN:
+		return (len(x.Value)+1)/2 + 1
+	case *types.AttributeValueMemberB:
+		return len(x.Value)
+	case *types.AttributeValueMemberBOOL, *types.AttributeValueMemberNULL:
+		return 1
+	case *types.AttributeValueMemberSS:
+		n := 0
+		for _, e := range x.Value {
+			n += len(e)
+		}
+		return n
+	case *types.AttributeValueMemberNS:
+		n := 0
+		for _, e := range x.Value {
+			n += (len(e)+1)/2 + 1
+		}
+		return n
+	case *types.AttributeValueMemberBS:
+		n := 0
+		for _, e := range x.Value {
+			n += len(e)
+		}
+		return n
+	case *types.AttributeValueMemberL:
+		n := 3
+		for _, e := range x.Value {
+			n += 1 + sizeOfValue(e)
+		}
+		return n
+	case *types.AttributeValueMemberM:
+		return 3 + sizeOf(x.Value)
+	default:
+		return 0
+	}
+}
+
+// capacity units of writing bytes
+func writeUnits(size int) float64 {
+	return math.Max(1, math.Ceil(float64(size)/1024))
+}
+
+// capacity units of reading single item
+func readUnits(consistent *bool) float64 {
+	if aws.ToBool(consistent) {
+		return 1
+	}
+	return 0.5
+}
+
+// consumed capacity is required by the limiter
+func withCapacity(mode types.ReturnConsumedCapacity) types.ReturnConsumedCapacity {
+	if mode == "" || mode == types.ReturnConsumedCapacityNone {
+		return types.ReturnConsumedCapacityTotal
+	}
+	return mode
+}
+
+func consumedOf(seq ...types.ConsumedCapacity) (float64, bool) {
+	units := 0.0
+	for _, c := range seq {
+		if c.CapacityUnits != nil {
+			units += *c.CapacityUnits
+		}
+	}
+	return units, len(seq) != 0
+}
+
+func consumedOne(c *types.ConsumedCapacity) (float64, bool) {
+	if c == nil {
+		return 0, false
+	}
+	return consumedOf(*c)
+}
+
+// GetItem of DynamoDB API
+func (l *Limiter) GetItem(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	req := *input
+	req.ReturnConsumedCapacity = withCapacity(req.ReturnConsumedCapacity)
+
+	units := l.get.get(readUnits(req.ConsistentRead))
+	if err := l.Read.wait(ctx, units); err != nil {
+		return nil, err
+	}
+
+	val, err := l.DynamoDB.GetItem(ctx, &req, opts...)
+	if err == nil {
+		if actual, ok := consumedOne(val.ConsumedCapacity); ok {
+			l.get.learn(actual)
+			l.Read.adjust(actual - units)
+		}
+	}
+
+	return val, err
+}
+
+// Query of DynamoDB API
+func (l *Limiter) Query(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	req := *input
+	req.ReturnConsumedCapacity = withCapacity(req.ReturnConsumedCapacity)
+
+	units := l.query.get(readUnits(req.ConsistentRead))
+	if err := l.Read.wait(ctx, units); err != nil {
+		return nil, err
+	}
+
+	val, err := l.DynamoDB.Query(ctx, &req, opts...)
+	if err == nil {
+		if actual, ok := consumedOne(val.ConsumedCapacity); ok {
+			l.query.learn(actual)
+			l.Read.adjust(actual - units)
+		}
+	}
+
+	return val, err
+}
+
+// PutItem of DynamoDB API
+func (l *Limiter) PutItem(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	req := *input
+	req.ReturnConsumedCapacity = withCapacity(req.ReturnConsumedCapacity)
+
+	units := writeUnits(sizeOf(req.Item))
+	if err := l.Write.wait(ctx, units); err != nil {
+		return nil, err
+	}
+
+	val, err := l.DynamoDB.PutItem(ctx, &req, opts...)
+	if err == nil {
+		if actual, ok := consumedOne(val.ConsumedCapacity); ok {
+			l.Write.adjust(actual - units)
+		}
+	}
+
+	return val, err
+}
+
+// DeleteItem of DynamoDB API
+func (l *Limiter) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	req := *input
+	req.ReturnConsumedCapacity = withCapacity(req.ReturnConsumedCapacity)
+
+	units := writeUnits(sizeOf(req.Key))
+	if err := l.Write.wait(ctx, units); err != nil {
+		return nil, err
+	}
+
+	val, err := l.DynamoDB.DeleteItem(ctx, &req, opts...)
+	if err == nil {
+		if actual, ok := consumedOne(val.ConsumedCapacity); ok {
+			l.Write.adjust(actual - units)
+		}
+	}
+
+	return val, err
+}
+
+// UpdateItem of DynamoDB API
+func (l *Limiter) UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	req := *input
+	req.ReturnConsumedCapacity = withCapacity(req.ReturnConsumedCapacity)
+
+	units := writeUnits(sizeOf(req.Key) + sizeOf(req.ExpressionAttributeValues))
+	if err := l.Write.wait(ctx, units); err != nil {
+		return nil, err
+	}
+
+	val, err := l.DynamoDB.UpdateItem(ctx, &req, opts...)
+	if err == nil {
+		if actual, ok := consumedOne(val.ConsumedCapacity); ok {
+			l.Write.adjust(actual - units)
+		}
+	}
+
+	return val, err
+}
+
+/*
+BatchLimiter is the limiter of DynamoDB client that implements batch api.
+*/
+type BatchLimiter struct {
+	*Limiter
+	Batch dynamo.DynamoDBBatch
+}
+
+// BatchGetItem of DynamoDB API
+func (l *BatchLimiter) BatchGetItem(ctx context.Context, input *dynamodb.BatchGetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	req := *input
+	req.ReturnConsumedCapacity = withCapacity(req.ReturnConsumedCapacity)
+
+	units := 0.0
+	for _, keys := range req.RequestItems {
+		units += float64(len(keys.Keys)) * l.get.get(readUnits(keys.ConsistentRead))
+	}
+	if err := l.Read.wait(ctx, units); err != nil {
+		return nil, err
+	}
+
+	val, err := l.Batch.BatchGetItem(ctx, &req, opts...)
+	if err == nil {
+		if actual, ok := consumedOf(val.ConsumedCapacity...); ok {
+			l.Read.adjust(actual - units)
+		}
+	}
+
+	return val, err
+}
+
+// BatchWriteItem of DynamoDB API
+func (l *BatchLimiter) BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	req := *input
+	req.ReturnConsumedCapacity = withCapacity(req.ReturnConsumedCapacity)
+
+	units := 0.0
+	for _, seq := range req.RequestItems {
+		for _, w := range seq {
+			switch {
+			case w.PutRequest != nil:
+				units += writeUnits(sizeOf(w.PutRequest.Item))
+			case w.DeleteRequest != nil:
+				units += writeUnits(sizeOf(w.DeleteRequest.Key))
+			}
+		}
+	}
+	if err := l.Write.wait(ctx, units); err != nil {
+		return nil, err
+	}
+
+	val, err := l.Batch.BatchWriteItem(ctx, &req, opts...)
+	if err == nil {
+		if actual, ok := consumedOf(val.ConsumedCapacity...); ok {
+			l.Write.adjust(actual - units)
+		}
+	}
+
+	return val, err
+}
+
+// TransactGetItems of DynamoDB API, transactions consume double capacity
+func (l *BatchLimiter) TransactGetItems(ctx context.Context, input *dynamodb.TransactGetItemsInput, opts ...func(*dynamodb.Options)) (*dynamodb.TransactGetItemsOutput, error) {
+	req := *input
+	req.ReturnConsumedCapacity = withCapacity(req.ReturnConsumedCapacity)
+
+	units := 2 * float64(len(req.TransactItems)) * l.get.get(1)
+	if err := l.Read.wait(ctx, units); err != nil {
+		return nil, err
+	}
+
+	val, err := l.Batch.TransactGetItems(ctx, &req, opts...)
+	if err == nil {
+		if actual, ok := consumedOf(val.ConsumedCapacity...); ok {
+			l.Read.adjust(actual - units)
+		}
+	}
+
+	return val, err
+}
+
+// TransactWriteItems of DynamoDB API, transactions consume double capacity
+func (l *BatchLimiter) TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, opts ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	req := *input
+	req.ReturnConsumedCapacity = withCapacity(req.ReturnConsumedCapacity)
+
+	units := 0.0
+	for _, w := range req.TransactItems {
+		switch {
+		case w.Put != nil:
+			units += 2 * writeUnits(sizeOf(w.Put.Item))
+		case w.Delete != nil:
+			units += 2 * writeUnits(sizeOf(w.Delete.Key))
+		case w.Update != nil:
+			units += 2 * writeUnits(sizeOf(w.Update.Key)+sizeOf(w.Update.ExpressionAttributeValues))
+		case w.ConditionCheck != nil:
+			units += 2 * writeUnits(sizeOf(w.ConditionCheck.Key))
+		}
+	}
+	if err := l.Write.wait(ctx, units); err != nil {
+		return nil, err
+	}
+
+	val, err := l.Batch.TransactWriteItems(ctx, &req, opts...)
+	if err == nil {
+		if actual, ok := consumedOf(val.ConsumedCapacity...); ok {
+			l.Write.adjust(actual - units)
+		}
+	}
+
+	return val, err
+}
@@ -0,0 +1,215 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file implements batching of concurrent reads
+//
+
+package ddb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/holmes89/dynamo"
+)
+
+// limits of BatchGetItem
+const (
+	maxBatchGet     = 100
+	maxBatchRetries = 8
+	batchBackoff    = 20 * time.Millisecond
+)
+
+/*
+Loader collects concurrent reads into BatchGetItem requests. The batch is
+sent when the window since the first read is over or the batch is full.
+Reads of the same key within the batch share the result.
+*/
+type Loader[T dynamo.Thing] struct {
+	Service dynamo.DynamoDBBatch
+	Table   *string
+	Codec   *Codec[T]
+	Schema  *Schema[T]
+	// Window is the time to collect reads into the batch
+	Window time.Duration
+	// Size is the maximal number of keys in the batch
+	Size int
+
+	mu        sync.Mutex
+	batch     *batch[T]
+	undefined T
+}
+
+// batch of reads, keys are deduplicated
+type batch[T dynamo.Thing] struct {
+	ctx   context.Context
+	calls map[string]*call[T]
+	keys  []map[string]types.AttributeValue
+	timer *time.Timer
+}
+
+// call is the pending read
+type call[T dynamo.Thing] struct {
+	key  T
+	val  T
+	err  error
+	done chan struct{}
+}
+
+// key of item as string
+func (codec Codec[T]) keyString(gen map[string]types.AttributeValue) string {
+	var hashKey, sortKey string
+	if v, ok := gen[codec.pkPrefix].(*types.AttributeValueMemberS); ok {
+		hashKey = v.Value
+	}
+	if v, ok := gen[codec.skSuffix].(*types.AttributeValueMemberS); ok {
+		sortKey = v.Value
+	}
+
+	return hashKey + "\x00" + sortKey
+}
+
+// Get item from storage, the read is batched with concurrent reads
+func (db *Loader[T]) Get(ctx context.Context, key T) (T, error) {
+	gen, err := db.Codec.EncodeKey(key)
+	if err != nil {
+		return db.undefined, errInvalidKey(err)
+	}
+
+	c := db.enqueue(ctx, key, gen)
+
+	select {
+	case <-ctx.Done():
+		return db.undefined, ctx.Err()
+	case <-c.done:
+		return c.val, c.err
+	}
+}
+
+// enqueue the read into the batch
+func (db *Loader[T]) enqueue(ctx context.Context, key T, gen map[string]types.AttributeValue) *call[T] {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	b := db.batch
+	if b == nil {
+		// Note: the batch is shared by callers, it is not cancelled by any of them
+		b = &batch[T]{
+			ctx:   context.WithoutCancel(ctx),
+			calls: map[string]*call[T]{},
+		}
+		b.timer = time.AfterFunc(db.Window, func() { db.flush(b) })
+		db.batch = b
+	}
+
+	at := db.Codec.keyString(gen)
+	if c, has := b.calls[at]; has {
+		return c
+	}
+
+	c := &call[T]{key: key, done: make(chan struct{})}
+	b.calls[at] = c
+	b.keys = append(b.keys, gen)
+
+	size := db.Size
+	if size <= 0 || size > maxBatchGet {
+		size = maxBatchGet
+	}
+
+	if len(b.keys) >= size {
+		b.timer.Stop()
+		db.batch = nil
+		go db.dispatch(b)
+	}
+
+	return c
+}
+
+// flush the batch when window is over
+func (db *Loader[T]) flush(b *batch[T]) {
+	db.mu.Lock()
+	if db.batch != b {
+		// Note: the full batch is already dispatched
+		db.mu.Unlock()
+		return
+	}
+	db.batch = nil
+	db.mu.Unlock()
+
+	db.dispatch(b)
+}
+
+// dispatch the batch and fan out results to callers
+func (db *Loader[T]) dispatch(b *batch[T]) {
+	items, err := db.batchGet(b.ctx, b.keys)
+
+	for at, c := range b.calls {
+		switch item, has := items[at]; {
+		case has:
+			if c.val, c.err = db.Codec.Decode(item); c.err != nil {
+				c.err = errInvalidEntity(c.err)
+			}
+		case err != nil:
+			c.err = err
+		default:
+			c.err = errNotFound(nil, c.key)
+		}
+		close(c.done)
+	}
+}
+
+/*
+batchGet reads items, unprocessed keys are retried with backoff. Items read
+before the failure are returned with the error.
+*/
+func (db *Loader[T]) batchGet(
+	ctx context.Context,
+	keys []map[string]types.AttributeValue,
+) (map[string]map[string]types.AttributeValue, error) {
+	items := make(map[string]map[string]types.AttributeValue, len(keys))
+	req := &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]types.KeysAndAttributes{
+			*db.Table: {
+				Keys:                     keys,
+				ProjectionExpression:     db.Schema.Projection,
+				ExpressionAttributeNames: db.Schema.ExpectedAttributeNames,
+			},
+		},
+	}
+
+	backoff := batchBackoff
+	for attempt := 0; ; attempt++ {
+		val, err := db.Service.BatchGetItem(ctx, req)
+		if err != nil {
+			return items, errServiceIO(err)
+		}
+
+		for _, item := range val.Responses[*db.Table] {
+			items[db.Codec.keyString(item)] = item
+		}
+
+		unprocessed, has := val.UnprocessedKeys[*db.Table]
+		if !has || len(unprocessed.Keys) == 0 {
+			return items, nil
+		}
+
+		if attempt == maxBatchRetries {
+			return items, errServiceIO(errors.New("keys are not processed by BatchGetItem"))
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+
+		req.RequestItems = val.UnprocessedKeys
+	}
+}
@@ -9,6 +9,8 @@
 package ddb
 
 import (
+	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -17,21 +19,49 @@ import (
 )
 
 /*
-Schema is utility that decodes type into projection expression
+Schema is utility that decodes type into projection expression. Key
+attributes are always projected, they are required to decode items.
 */
 type Schema[T dynamo.Thing] struct {
 	ExpectedAttributeNames map[string]string
 	Projection             *string
 }
 
-func NewSchema[T dynamo.Thing]() *Schema[T] {
-	seq := hseq.FMap(
-		hseq.Generic[T](),
-		func(t hseq.Type[T]) string {
-			name := t.StructField.Tag.Get("dynamodbav")
-			return strings.Split(name, ",")[0]
-		},
-	)
+/*
+NewSchema builds projection of persisted fields of type T, it follows the
+naming of attributevalue codec: fields tagged "-" are skipped, untagged
+fields are projected by the name of field. Key attributes are appended to
+projection if they are not declared by the type (e.g. sort key of items
+without sort key field).
+*/
+func NewSchema[T dynamo.Thing](keys ...string) *Schema[T] {
+	// Note: types other than struct (e.g. raw items) are fetched as is
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return &Schema[T]{}
+	}
+
+	seq := make([]string, 0)
+	for _, t := range hseq.Generic[T]() {
+		name := strings.Split(t.StructField.Tag.Get("dynamodbav"), ",")[0]
+		switch name {
+		case "-":
+			// Note: the field is not persisted
+			continue
+		case "":
+			name = t.StructField.Name
+		}
+		seq = append(seq, name)
+	}
+
+	for _, key := range keys {
+		if !slices.Contains(seq, key) {
+			seq = append(seq, key)
+		}
+	}
 
 	names := make(map[string]string, len(seq))
 	schema := make([]string, len(seq))
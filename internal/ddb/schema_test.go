@@ -0,0 +1,64 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package ddb_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/fogfish/curie"
+	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+)
+
+type projected struct {
+	ID      curie.IRI `dynamodbav:"pk,omitempty"`
+	Name    string    `dynamodbav:"name,omitempty"`
+	Comment string
+	Secret  string `dynamodbav:"-"`
+}
+
+func (p projected) HashKey() curie.IRI { return p.ID }
+func (p projected) SortKey() curie.IRI { return "" }
+
+func TestSchemaProjection(t *testing.T) {
+	t.Run("Fields", func(t *testing.T) {
+		schema := ddb.NewSchema[projected]()
+		it.Ok(t).
+			If(aws.ToString(schema.Projection)).Should().
+			Equal("#__pk__, #__name__, #__Comment__").
+			If(schema.ExpectedAttributeNames).Should().Equal(map[string]string{
+			"#__pk__":      "pk",
+			"#__name__":    "name",
+			"#__Comment__": "Comment",
+		})
+	})
+
+	t.Run("Keys", func(t *testing.T) {
+		schema := ddb.NewSchema[projected]("pk", "sk")
+		it.Ok(t).
+			If(aws.ToString(schema.Projection)).Should().
+			Equal("#__pk__, #__name__, #__Comment__, #__sk__").
+			If(schema.ExpectedAttributeNames["#__sk__"]).Should().Equal("sk")
+	})
+
+	t.Run("Pointers", func(t *testing.T) {
+		schema := ddb.NewSchema[*projected]("pk", "sk")
+		it.Ok(t).
+			If(aws.ToString(schema.Projection)).Should().
+			Equal("#__pk__, #__name__, #__Comment__, #__sk__")
+	})
+
+	t.Run("NotStruct", func(t *testing.T) {
+		schema := ddb.NewSchema[dynamo.Thing]("pk", "sk")
+		it.Ok(t).
+			If(schema.Projection).Should().Equal((*string)(nil))
+	})
+}
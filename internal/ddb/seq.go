@@ -15,6 +15,7 @@ package ddb
 import (
 	"context"
 	"fmt"
+	"iter"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
@@ -23,11 +24,6 @@ import (
 	"github.com/holmes89/dynamo"
 )
 
-type cursor struct{ hashKey, sortKey string }
-
-func (c cursor) HashKey() curie.IRI { return curie.IRI(c.hashKey) }
-func (c cursor) SortKey() curie.IRI { return curie.IRI(c.sortKey) }
-
 // slice active page, loaded into memory
 type slice[T dynamo.Thing] struct {
 	db   *Storage[T]
@@ -60,12 +56,27 @@ func (slice *slice[T]) Tail() bool {
 	return slice.head < len(slice.heap)
 }
 
+// Items decodes all elements of the slice
+func (slice *slice[T]) Items() ([]T, error) {
+	items := make([]T, len(slice.heap))
+	for i, x := range slice.heap {
+		item, err := slice.db.Codec.Decode(x)
+		if err != nil {
+			return nil, errInvalidEntity(err)
+		}
+		items[i] = item
+	}
+
+	return items, nil
+}
+
 // seq is an iterator over matched results
 type seq[T dynamo.Thing] struct {
 	ctx    context.Context
 	db     *Storage[T]
 	q      *dynamodb.QueryInput
 	slice  *slice[T]
+	page   *dynamodb.QueryOutput
 	stream bool
 	err    error
 }
@@ -110,6 +121,7 @@ func (seq *seq[T]) seed() error {
 	}
 
 	seq.slice = newSlice(seq.db, val.Items)
+	seq.page = val
 	seq.q.ExclusiveStartKey = val.LastEvaluatedKey
 
 	return nil
@@ -130,8 +142,77 @@ func (seq *seq[T]) FMap(f func(T) error) error {
 	return seq.err
 }
 
+// All iterates over elements of sequence
+func (seq *seq[T]) All() iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for page, err := range seq.Pages() {
+			if err != nil {
+				var none T
+				yield(none, err)
+				return
+			}
+
+			for _, item := range page.Items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Pages iterates over pages of sequence. Pages are queried with the context
+// of Match, the consumer stops the iteration between pages, the query
+// in-flight is bounded by the context of Match.
+func (seq *seq[T]) Pages() iter.Seq2[dynamo.Page[T], error] {
+	return func(yield func(dynamo.Page[T], error) bool) {
+		if seq.err != nil {
+			yield(dynamo.Page[T]{}, seq.err)
+			return
+		}
+
+		for {
+			if err := seq.seed(); err != nil {
+				if seq.err != nil {
+					yield(dynamo.Page[T]{}, err)
+				}
+				return
+			}
+
+			items, err := seq.slice.Items()
+			if err != nil {
+				seq.err = err
+				yield(dynamo.Page[T]{}, err)
+				return
+			}
+
+			page := dynamo.Page[T]{
+				Items:        items,
+				Count:        int(seq.page.Count),
+				ScannedCount: int(seq.page.ScannedCount),
+				Cursor:       seq.Cursor(),
+			}
+			if seq.page.ConsumedCapacity != nil && seq.page.ConsumedCapacity.CapacityUnits != nil {
+				page.Capacity = *seq.page.ConsumedCapacity.CapacityUnits
+			}
+
+			if !yield(page, nil) {
+				return
+			}
+
+			if !seq.stream {
+				return
+			}
+		}
+	}
+}
+
 // Head selects the first element of matched collection.
 func (seq *seq[T]) Head() (T, error) {
+	if seq.err != nil {
+		return seq.db.undefined, seq.err
+	}
+
 	if seq.slice == nil {
 		if err := seq.seed(); err != nil {
 			return seq.db.undefined,
@@ -181,10 +262,17 @@ func (seq *seq[T]) Cursor() dynamo.Thing {
 			}
 		}
 
-		return &cursor{hashKey: hkey, sortKey: skey}
+		// Note: the state captures complete LastEvaluatedKey, including
+		//       base table keys required by secondary indexes
+		state, err := encodeCursorState(val)
+		if err != nil {
+			state = nil
+		}
+
+		return dynamo.NewCursor(curie.IRI(hkey), curie.IRI(skey), state)
 	}
 
-	return &cursor{}
+	return dynamo.NewCursor("", "", nil)
 }
 
 // Error indicates if any error appears during I/O
@@ -201,6 +289,17 @@ func (seq *seq[T]) Limit(n int) dynamo.Seq[T] {
 
 // Continue limited sequence from the cursor
 func (seq *seq[T]) Continue(key dynamo.Thing) dynamo.Seq[T] {
+	if cursor, ok := key.(*dynamo.Cursor); ok && len(cursor.State()) != 0 {
+		val, err := decodeCursorState(cursor.State())
+		if err != nil {
+			seq.err = errInvalidKey(err)
+			return seq
+		}
+
+		seq.q.ExclusiveStartKey = val
+		return seq
+	}
+
 	prefix := key.HashKey()
 	suffix := key.SortKey()
 
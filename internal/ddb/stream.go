@@ -0,0 +1,355 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file declares reader of dynamodb streams
+//
+
+package ddb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/holmes89/dynamo"
+)
+
+// DefaultPoll is the interval to poll open shard if Stream does not define it
+const DefaultPoll = 1 * time.Second
+
+/*
+Stream is a reader of dynamodb stream, it decodes stream records into
+typed changes. Records of items that do not belong to the type T are
+skipped. The item belongs to T if its key is reproduced by decoded
+value and matches one of key prefix rules, if any.
+*/
+type Stream[T dynamo.Thing] struct {
+	Service dynamo.DynamoDBStreams
+	Table   *string
+	Codec   *Codec[T]
+	Rules   []dynamo.KeyPrefix
+	// Poll is the interval to poll open shard and stream for new shards,
+	// DefaultPoll is used if it is not defined
+	Poll time.Duration
+
+	mu  sync.Mutex
+	arn *string
+}
+
+// streamArn lookups the latest stream of the table
+func (s *Stream[T]) streamArn(ctx context.Context) (*string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.arn != nil {
+		return s.arn, nil
+	}
+
+	var label string
+	req := &dynamodbstreams.ListStreamsInput{TableName: s.Table}
+	for {
+		val, err := s.Service.ListStreams(ctx, req)
+		if err != nil {
+			return nil, errServiceIO(err)
+		}
+
+		for _, x := range val.Streams {
+			if s.arn == nil || aws.ToString(x.StreamLabel) > label {
+				s.arn = x.StreamArn
+				label = aws.ToString(x.StreamLabel)
+			}
+		}
+
+		if val.LastEvaluatedStreamArn == nil {
+			break
+		}
+		req.ExclusiveStartStreamArn = val.LastEvaluatedStreamArn
+	}
+
+	if s.arn == nil {
+		return nil, errServiceIO(errors.New("stream is not enabled for " + aws.ToString(s.Table)))
+	}
+
+	return s.arn, nil
+}
+
+// Shards of stream
+func (s *Stream[T]) Shards(ctx context.Context) ([]dynamo.Shard, error) {
+	arn, err := s.streamArn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	shards := make([]dynamo.Shard, 0)
+	req := &dynamodbstreams.DescribeStreamInput{StreamArn: arn}
+	for {
+		val, err := s.Service.DescribeStream(ctx, req)
+		if err != nil {
+			return nil, errServiceIO(err)
+		}
+
+		if val.StreamDescription == nil {
+			return shards, nil
+		}
+
+		for _, x := range val.StreamDescription.Shards {
+			shards = append(shards, dynamo.Shard{
+				ID:     aws.ToString(x.ShardId),
+				Parent: aws.ToString(x.ParentShardId),
+				Closed: x.SequenceNumberRange != nil && x.SequenceNumberRange.EndingSequenceNumber != nil,
+			})
+		}
+
+		if val.StreamDescription.LastEvaluatedShardId == nil {
+			return shards, nil
+		}
+		req.ExclusiveStartShardId = val.StreamDescription.LastEvaluatedShardId
+	}
+}
+
+// iterator of shard after the sequence number
+func (s *Stream[T]) iterator(ctx context.Context, shard string, after string) (*string, error) {
+	arn, err := s.streamArn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         arn,
+		ShardId:           aws.String(shard),
+		ShardIteratorType: streamtypes.ShardIteratorTypeTrimHorizon,
+	}
+
+	if after != "" {
+		req.ShardIteratorType = streamtypes.ShardIteratorTypeAfterSequenceNumber
+		req.SequenceNumber = aws.String(after)
+	}
+
+	val, err := s.Service.GetShardIterator(ctx, req)
+	if err != nil {
+		// Note: the sequence number is beyond trim horizon, read all available records
+		if recoverErrorCode(err, "TrimmedDataAccessException") && after != "" {
+			return s.iterator(ctx, shard, "")
+		}
+		return nil, errServiceIO(err)
+	}
+
+	return val.ShardIterator, nil
+}
+
+// ReadShard reads changes of the shard
+func (s *Stream[T]) ReadShard(ctx context.Context, shard dynamo.Shard, after string, f func(dynamo.Change[T]) error) (string, error) {
+	iterator, err := s.iterator(ctx, shard.ID, after)
+	if err != nil {
+		return after, err
+	}
+
+	for iterator != nil {
+		val, err := s.Service.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{ShardIterator: iterator})
+		if err != nil {
+			// Note: iterators expire in 15 minutes, continue from the last record
+			if recoverErrorCode(err, "ExpiredIteratorException") {
+				if iterator, err = s.iterator(ctx, shard.ID, after); err != nil {
+					return after, err
+				}
+				continue
+			}
+			return after, errServiceIO(err)
+		}
+
+		for _, record := range val.Records {
+			change, thing, err := s.decode(record)
+			if err != nil {
+				return after, err
+			}
+
+			if thing != nil {
+				if err := f(change); err != nil {
+					return after, errProcessEntity(err, thing)
+				}
+			}
+
+			if record.Dynamodb != nil && record.Dynamodb.SequenceNumber != nil {
+				after = *record.Dynamodb.SequenceNumber
+			}
+		}
+
+		iterator = val.NextShardIterator
+		if iterator != nil && len(val.Records) == 0 {
+			if err := sleep(ctx, s.poll()); err != nil {
+				return after, err
+			}
+		}
+	}
+
+	return after, nil
+}
+
+// Read changes of all shards
+func (s *Stream[T]) Read(ctx context.Context, f func(dynamo.Change[T]) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+
+	type result struct {
+		shard string
+		err   error
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		started = map[string]bool{}
+		done    = map[string]bool{}
+		results = make(chan result)
+	)
+
+	// Note: changes are emitted sequentially
+	emit := func(change dynamo.Change[T]) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return f(change)
+	}
+
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	for {
+		shards, err := s.Shards(ctx)
+		if err != nil {
+			return err
+		}
+
+		known := map[string]bool{}
+		for _, shard := range shards {
+			known[shard.ID] = true
+		}
+
+		for _, shard := range shards {
+			isReady := shard.Parent == "" || done[shard.Parent] || !known[shard.Parent]
+			if !started[shard.ID] && isReady {
+				started[shard.ID] = true
+				wg.Add(1)
+				go func(shard dynamo.Shard) {
+					defer wg.Done()
+					_, err := s.ReadShard(ctx, shard, "", emit)
+					select {
+					case results <- result{shard: shard.ID, err: err}:
+					case <-ctx.Done():
+					}
+				}(shard)
+			}
+		}
+
+		if len(started) == len(done) {
+			// Note: all shards are closed and consumed, stream is disabled
+			return nil
+		}
+
+		select {
+		case x := <-results:
+			if x.err != nil {
+				return x.err
+			}
+			done[x.shard] = true
+		case <-time.After(s.poll()):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// decode stream record, the key is nil if record does not belong to type
+func (s *Stream[T]) decode(record streamtypes.Record) (dynamo.Change[T], dynamo.Thing, error) {
+	if record.Dynamodb == nil {
+		return dynamo.Change[T]{Kind: dynamo.ChangeKind(record.EventName)}, nil, nil
+	}
+
+	codec := ChangeCodec[T]{Codec: s.Codec, Rules: s.Rules}
+	return codec.Decode(
+		string(record.EventName),
+		aws.ToString(record.Dynamodb.SequenceNumber),
+		fromStreamImage(record.Dynamodb.Keys),
+		fromStreamImage(record.Dynamodb.OldImage),
+		fromStreamImage(record.Dynamodb.NewImage),
+	)
+}
+
+// poll interval, the zero value would spin the stream API in tight loop
+func (s *Stream[T]) poll() time.Duration {
+	if s.Poll <= 0 {
+		return DefaultPoll
+	}
+	return s.Poll
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//-----------------------------------------------------------------------------
+//
+// Stream Attribute Values
+//
+//-----------------------------------------------------------------------------
+
+// fromStreamImage converts dynamodbstreams image to dynamodb one
+func fromStreamImage(image map[string]streamtypes.AttributeValue) map[string]types.AttributeValue {
+	if image == nil {
+		return nil
+	}
+
+	gen := make(map[string]types.AttributeValue, len(image))
+	for k, v := range image {
+		gen[k] = fromStreamAttributeValue(v)
+	}
+
+	return gen
+}
+
+func fromStreamAttributeValue(val streamtypes.AttributeValue) types.AttributeValue {
+	switch v := val.(type) {
+	case *streamtypes.AttributeValueMemberS:
+		return &types.AttributeValueMemberS{Value: v.Value}
+	case *streamtypes.AttributeValueMemberN:
+		return &types.AttributeValueMemberN{Value: v.Value}
+	case *streamtypes.AttributeValueMemberB:
+		return &types.AttributeValueMemberB{Value: v.Value}
+	case *streamtypes.AttributeValueMemberBOOL:
+		return &types.AttributeValueMemberBOOL{Value: v.Value}
+	case *streamtypes.AttributeValueMemberNULL:
+		return &types.AttributeValueMemberNULL{Value: v.Value}
+	case *streamtypes.AttributeValueMemberSS:
+		return &types.AttributeValueMemberSS{Value: v.Value}
+	case *streamtypes.AttributeValueMemberNS:
+		return &types.AttributeValueMemberNS{Value: v.Value}
+	case *streamtypes.AttributeValueMemberBS:
+		return &types.AttributeValueMemberBS{Value: v.Value}
+	case *streamtypes.AttributeValueMemberL:
+		seq := make([]types.AttributeValue, len(v.Value))
+		for i, x := range v.Value {
+			seq[i] = fromStreamAttributeValue(x)
+		}
+		return &types.AttributeValueMemberL{Value: seq}
+	case *streamtypes.AttributeValueMemberM:
+		return &types.AttributeValueMemberM{Value: fromStreamImage(v.Value)}
+	default:
+		return &types.AttributeValueMemberNULL{Value: true}
+	}
+}
@@ -0,0 +1,188 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package ddb_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/fogfish/curie"
+	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+	"github.com/holmes89/dynamo/internal/ddb/ddbtest"
+	ddbapi "github.com/holmes89/dynamo/service/ddb"
+)
+
+type author struct {
+	ID   curie.IRI `dynamodbav:"prefix,omitempty"`
+	Name string    `dynamodbav:"name,omitempty"`
+}
+
+func (a author) HashKey() curie.IRI { return a.ID }
+func (a author) SortKey() curie.IRI { return "_" }
+
+type article struct {
+	Author curie.IRI `dynamodbav:"prefix,omitempty"`
+	ID     curie.IRI `dynamodbav:"suffix,omitempty"`
+	Title  string    `dynamodbav:"title,omitempty"`
+}
+
+func (a article) HashKey() curie.IRI { return a.Author }
+func (a article) SortKey() curie.IRI { return a.ID }
+
+func record(kind streamtypes.OperationType, seq, prefix, suffix, title string) streamtypes.Record {
+	keys := map[string]streamtypes.AttributeValue{
+		"prefix": &streamtypes.AttributeValueMemberS{Value: prefix},
+		"suffix": &streamtypes.AttributeValueMemberS{Value: suffix},
+	}
+
+	image := map[string]streamtypes.AttributeValue{
+		"prefix": &streamtypes.AttributeValueMemberS{Value: prefix},
+		"suffix": &streamtypes.AttributeValueMemberS{Value: suffix},
+		"title":  &streamtypes.AttributeValueMemberS{Value: title},
+		"name":   &streamtypes.AttributeValueMemberS{Value: title},
+	}
+
+	r := streamtypes.Record{
+		EventName: kind,
+		Dynamodb: &streamtypes.StreamRecord{
+			SequenceNumber: aws.String(seq),
+			Keys:           keys,
+		},
+	}
+
+	switch kind {
+	case streamtypes.OperationTypeInsert:
+		r.Dynamodb.NewImage = image
+	case streamtypes.OperationTypeModify:
+		r.Dynamodb.OldImage = image
+		r.Dynamodb.NewImage = image
+	case streamtypes.OperationTypeRemove:
+		r.Dynamodb.OldImage = image
+	}
+
+	return r
+}
+
+func fixtureStreams() *ddbtest.Streams {
+	return &ddbtest.Streams{
+		Shards: [][]streamtypes.Record{
+			{
+				record(streamtypes.OperationTypeInsert, "1", "author:neumann", "_", "John von Neumann"),
+				record(streamtypes.OperationTypeInsert, "2", "author:neumann", "article:theory_of_automata", "A"),
+			},
+			{
+				record(streamtypes.OperationTypeModify, "3", "author:neumann", "article:theory_of_automata", "B"),
+				record(streamtypes.OperationTypeInsert, "4", "keyword:theory", "article:theory_of_automata", "C"),
+				record(streamtypes.OperationTypeRemove, "5", "author:neumann", "article:theory_of_automata", "D"),
+			},
+		},
+	}
+}
+
+func TestStreamRead(t *testing.T) {
+	for _, expire := range []bool{false, true} {
+		mock := fixtureStreams()
+		mock.Expire = expire
+
+		stream, err := ddbapi.NewStream[article]("ddb:///test", mock,
+			dynamo.KeyPrefix{HashKey: "author:", SortKey: "article:"},
+		)
+		it.Ok(t).If(err).Should().Equal(nil)
+
+		seq := []string{}
+		err = stream.Read(context.Background(),
+			func(change dynamo.Change[article]) error {
+				seq = append(seq, fmt.Sprintf("%s:%s:%s:%s", change.Sequence, change.Kind, change.Old.Title, change.New.Title))
+				return nil
+			},
+		)
+
+		it.Ok(t).
+			If(err).Should().Equal(nil).
+			If(fmt.Sprint(seq)).Should().Equal("[2:INSERT::A 3:MODIFY:B:B 5:REMOVE:D:]")
+	}
+}
+
+func TestStreamReadType(t *testing.T) {
+	stream, err := ddbapi.NewStream[author]("ddb:///test", fixtureStreams())
+	it.Ok(t).If(err).Should().Equal(nil)
+
+	seq := []string{}
+	err = stream.Read(context.Background(),
+		func(change dynamo.Change[author]) error {
+			seq = append(seq, change.New.Name)
+			return nil
+		},
+	)
+
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(fmt.Sprint(seq)).Should().Equal("[John von Neumann]")
+}
+
+func TestStreamReadShard(t *testing.T) {
+	stream, err := ddbapi.NewStream[article]("ddb:///test", fixtureStreams())
+	it.Ok(t).If(err).Should().Equal(nil)
+
+	shards, err := stream.Shards(context.Background())
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(len(shards)).Should().Equal(2)
+
+	shard := dynamo.Shard{ID: "shard-1", Parent: "shard-0", Closed: true}
+	last, err := stream.ReadShard(context.Background(), shard, "3",
+		func(change dynamo.Change[article]) error {
+			if change.Kind == dynamo.Remove {
+				return errors.New("failed")
+			}
+			return nil
+		},
+	)
+
+	it.Ok(t).
+		If(err).ShouldNot().Equal(nil).
+		If(last).Should().Equal("4")
+}
+
+// openShard never closes, its records are always empty
+type openShard struct {
+	*ddbtest.Streams
+	calls int
+}
+
+func (mock *openShard) GetRecords(ctx context.Context, input *dynamodbstreams.GetRecordsInput, opts ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error) {
+	mock.calls++
+	return &dynamodbstreams.GetRecordsOutput{NextShardIterator: input.ShardIterator}, nil
+}
+
+func TestStreamReadShardDefaultPoll(t *testing.T) {
+	mock := &openShard{Streams: fixtureStreams()}
+	stream := &ddb.Stream[article]{
+		Service: mock,
+		Table:   aws.String("test"),
+		Codec:   ddb.NewCodec[article](&dynamo.URL{}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := stream.ReadShard(ctx, dynamo.Shard{ID: "shard-0"}, "", func(dynamo.Change[article]) error { return nil })
+
+	it.Ok(t).
+		If(errors.Is(err, context.DeadlineExceeded)).Should().Equal(true).
+		If(mock.calls).Should().Equal(1)
+}
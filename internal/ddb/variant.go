@@ -0,0 +1,135 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file implements codec of polymorphic tables
+//
+
+package ddb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/holmes89/dynamo"
+)
+
+/*
+Variant binds the type of items to the rule that recognizes them at the
+table. Items are recognized either by the value of discriminator attribute
+or by prefixes of hash and sort keys, empty prefix matches any key.
+*/
+type Variant struct {
+	Type   reflect.Type
+	Attr   string
+	Value  string
+	Prefix string
+	Suffix string
+}
+
+// NewVariant declares type of items
+func NewVariant[T dynamo.Thing]() Variant {
+	return Variant{Type: reflect.TypeOf((*T)(nil)).Elem()}
+}
+
+func (v Variant) String() string {
+	if v.Attr != "" {
+		return fmt.Sprintf("%s (%s = %s)", v.Type, v.Attr, v.Value)
+	}
+	return fmt.Sprintf("%s (%s*, %s*)", v.Type, v.Prefix, v.Suffix)
+}
+
+// matches the item
+func (v Variant) matches(pkPrefix, skSuffix string, gen map[string]types.AttributeValue) bool {
+	if v.Attr != "" {
+		return valueOf(gen[v.Attr]) == v.Value
+	}
+
+	return strings.HasPrefix(valueOf(gen[pkPrefix]), v.Prefix) &&
+		strings.HasPrefix(valueOf(gen[skSuffix]), v.Suffix)
+}
+
+func valueOf(val types.AttributeValue) string {
+	switch v := val.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value
+	default:
+		return ""
+	}
+}
+
+/*
+Variants is the registry of types stored at the table, the first variant
+that matches the item defines its type.
+*/
+type Variants []Variant
+
+// NewPolymorphicCodec creates codec of items of registered types
+func NewPolymorphicCodec(uri *dynamo.URL, variants Variants) *Codec[dynamo.Thing] {
+	codec := NewCodec[dynamo.Thing](uri)
+	codec.variants = variants
+	return codec
+}
+
+// lookup variant of the item
+func (seq Variants) lookup(pkPrefix, skSuffix string, gen map[string]types.AttributeValue) (Variant, bool) {
+	for _, v := range seq {
+		if v.matches(pkPrefix, skSuffix, gen) {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
+
+// typeOf looks up variant of the entity
+func (seq Variants) typeOf(entity any) (Variant, bool) {
+	typ := reflect.TypeOf(entity)
+	for _, v := range seq {
+		if v.Type == typ {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
+
+// encode sets discriminator of entity, it ensures the item is decodable
+func (seq Variants) encode(pkPrefix, skSuffix string, entity any, gen map[string]types.AttributeValue) error {
+	v, has := seq.typeOf(entity)
+	if !has {
+		return fmt.Errorf("type %T is not registered", entity)
+	}
+
+	if v.Attr != "" {
+		gen[v.Attr] = &types.AttributeValueMemberS{Value: v.Value}
+	}
+
+	if x, has := seq.lookup(pkPrefix, skSuffix, gen); !has || x.Type != v.Type {
+		return fmt.Errorf("item of %T does not match variant %s", entity, v)
+	}
+
+	return nil
+}
+
+// decode item into instance of registered type
+func (seq Variants) decode(pkPrefix, skSuffix string, gen map[string]types.AttributeValue) (any, error) {
+	v, has := seq.lookup(pkPrefix, skSuffix, gen)
+	if !has {
+		return nil, fmt.Errorf("item (%s, %s) does not match any variant",
+			valueOf(gen[pkPrefix]), valueOf(gen[skSuffix]))
+	}
+
+	entity := reflect.New(v.Type)
+	if err := attributevalue.UnmarshalMap(gen, entity.Interface()); err != nil {
+		return nil, err
+	}
+
+	return entity.Elem().Interface(), nil
+}
@@ -0,0 +1,259 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file implements buffered asynchronous writes
+//
+
+package ddb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/holmes89/dynamo"
+)
+
+// limits of BatchWriteItem
+const (
+	maxBatchWrite = 25
+)
+
+/*
+Writer buffers writes of entities and sends them as BatchWriteItem chunks.
+Chunks are sent when they are full, periodically or on flush. Writers
+are blocked when the buffer is full. Failed writes are reported to
+the callback.
+*/
+type Writer[T dynamo.Thing] struct {
+	Service dynamo.DynamoDBBatch
+	Table   *string
+	Codec   *Codec[T]
+	// Size is the maximal number of items in the chunk
+	Size int
+	// Interval of periodic flushes
+	Interval time.Duration
+	// Failure is called for each failed write
+	Failure func(T, error)
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan command[T]
+	done   chan struct{}
+}
+
+// command of the writer, the write or the flush marker
+type command[T dynamo.Thing] struct {
+	entity T
+	req    types.WriteRequest
+	flush  chan struct{}
+}
+
+// write is pending write request
+type write[T dynamo.Thing] struct {
+	entity T
+	req    types.WriteRequest
+}
+
+// Start the writer with the buffer of given size
+func (w *Writer[T]) Start(buffer int) {
+	w.queue = make(chan command[T], buffer)
+	w.done = make(chan struct{})
+
+	go w.run()
+}
+
+// Put writes entity, it returns once entity is buffered
+func (w *Writer[T]) Put(ctx context.Context, entity T) error {
+	gen, err := w.Codec.Encode(entity)
+	if err != nil {
+		return errInvalidEntity(err)
+	}
+
+	return w.enqueue(ctx, command[T]{
+		entity: entity,
+		req:    types.WriteRequest{PutRequest: &types.PutRequest{Item: gen}},
+	})
+}
+
+// Remove discards the entity, it returns once request is buffered
+func (w *Writer[T]) Remove(ctx context.Context, key T) error {
+	gen, err := w.Codec.EncodeKey(key)
+	if err != nil {
+		return errInvalidKey(err)
+	}
+
+	return w.enqueue(ctx, command[T]{
+		entity: key,
+		req:    types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: gen}},
+	})
+}
+
+// Flush sends writes buffered before the call
+func (w *Writer[T]) Flush(ctx context.Context) error {
+	flush := make(chan struct{})
+	if err := w.enqueue(ctx, command[T]{flush: flush}); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-flush:
+		return nil
+	}
+}
+
+// Close the writer, buffered writes are sent
+func (w *Writer[T]) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.done:
+		return nil
+	}
+}
+
+// enqueue the command, the caller is blocked while the buffer is full
+func (w *Writer[T]) enqueue(ctx context.Context, cmd command[T]) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return errClosed()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case w.queue <- cmd:
+		return nil
+	}
+}
+
+func (w *Writer[T]) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	size := w.Size
+	if size <= 0 || size > maxBatchWrite {
+		size = maxBatchWrite
+	}
+
+	// Note: BatchWriteItem rejects duplicate keys, the last write wins
+	chunk := make([]write[T], 0, size)
+	index := map[string]int{}
+	send := func() {
+		if len(chunk) != 0 {
+			w.batchWrite(chunk)
+			chunk = make([]write[T], 0, size)
+			index = map[string]int{}
+		}
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			send()
+		case cmd, ok := <-w.queue:
+			switch {
+			case !ok:
+				send()
+				return
+			case cmd.flush != nil:
+				send()
+				close(cmd.flush)
+			default:
+				at := w.Codec.keyString(keyOfRequest(cmd.req))
+				if i, has := index[at]; has {
+					chunk[i] = write[T]{entity: cmd.entity, req: cmd.req}
+					continue
+				}
+
+				index[at] = len(chunk)
+				chunk = append(chunk, write[T]{entity: cmd.entity, req: cmd.req})
+				if len(chunk) == size {
+					send()
+				}
+			}
+		}
+	}
+}
+
+func keyOfRequest(req types.WriteRequest) map[string]types.AttributeValue {
+	if req.PutRequest != nil {
+		return req.PutRequest.Item
+	}
+	return req.DeleteRequest.Key
+}
+
+// batchWrite sends the chunk, unprocessed items are retried with backoff
+func (w *Writer[T]) batchWrite(chunk []write[T]) {
+	pending := make(map[string]T, len(chunk))
+	reqs := make([]types.WriteRequest, len(chunk))
+	for i, x := range chunk {
+		pending[w.Codec.keyString(keyOfRequest(x.req))] = x.entity
+		reqs[i] = x.req
+	}
+
+	req := &dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]types.WriteRequest{*w.Table: reqs},
+	}
+
+	backoff := batchBackoff
+	for attempt := 0; ; attempt++ {
+		val, err := w.Service.BatchWriteItem(context.Background(), req)
+		if err != nil {
+			w.failure(pending, errServiceIO(err))
+			return
+		}
+
+		unprocessed := val.UnprocessedItems[*w.Table]
+		if len(unprocessed) == 0 {
+			return
+		}
+
+		if attempt == maxBatchRetries {
+			remains := make(map[string]T, len(unprocessed))
+			for _, x := range unprocessed {
+				at := w.Codec.keyString(keyOfRequest(x))
+				remains[at] = pending[at]
+			}
+			w.failure(remains, errServiceIO(errors.New("items are not processed by BatchWriteItem")))
+			return
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+
+		req.RequestItems = map[string][]types.WriteRequest{*w.Table: unprocessed}
+	}
+}
+
+func (w *Writer[T]) failure(seq map[string]T, err error) {
+	if w.Failure == nil {
+		return
+	}
+
+	for _, entity := range seq {
+		w.Failure(entity, errProcessEntity(err, entity))
+	}
+}
@@ -15,12 +15,15 @@ package dynamotest
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"path/filepath"
 	"testing"
 
 	"github.com/fogfish/curie"
 	"github.com/fogfish/it"
 	"github.com/holmes89/dynamo"
+	constrain "github.com/holmes89/dynamo/internal/constraint"
 )
 
 /*
@@ -214,6 +217,312 @@ func TestUpdate[S any](
 	})
 }
 
+/*
+TestStorage checks the key-value trait of the storage. The storage is real
+and empty, each storage MUST order items by sort key, match sort key prefix,
+page with cursors and evaluate constraints as DynamoDB does.
+*/
+func TestStorage(t *testing.T, factory func() dynamo.KeyVal[Person]) {
+	t.Helper()
+
+	name := dynamo.Schema1[Person, string]("Name")
+	age := dynamo.Schema1[Person, int]("Age")
+
+	fixture := func(t *testing.T) dynamo.KeyVal[Person] {
+		db := factory()
+		for _, i := range []int{3, 1, 4, 0, 2} {
+			it.Ok(t).IfNil(db.Put(context.Background(), Person{
+				Prefix: "org:a",
+				Suffix: curie.New("person:%d", i),
+				Name:   fmt.Sprintf("name %d", i),
+				Age:    20 + i,
+			}))
+		}
+		it.Ok(t).
+			IfNil(db.Put(context.Background(), Person{Prefix: "org:a", Suffix: "team:0"})).
+			IfNil(db.Put(context.Background(), Person{Prefix: "org:b", Suffix: "person:9"}))
+		return db
+	}
+
+	//
+	t.Run("GetPutRemove", func(t *testing.T) {
+		db := fixture(t)
+		key := Person{Prefix: "org:a", Suffix: "person:1"}
+
+		val, err := db.Get(context.Background(), key)
+		it.Ok(t).
+			IfNil(err).
+			If(val.Name).Equal("name 1")
+
+		it.Ok(t).IfNil(db.Remove(context.Background(), key))
+
+		_, err = db.Get(context.Background(), key)
+		var e interface{ NotFound() string }
+		it.Ok(t).
+			If(errors.As(err, &e)).Equal(true)
+
+		_, err = db.Get(context.Background(), Person{})
+		it.Ok(t).IfNotNil(err)
+	})
+
+	//
+	t.Run("Update", func(t *testing.T) {
+		db := fixture(t)
+
+		val, err := db.Update(context.Background(), Person{Prefix: "org:a", Suffix: "person:1", Age: 30})
+		it.Ok(t).
+			IfNil(err).
+			If(val).Equal(Person{Prefix: "org:a", Suffix: "person:1", Name: "name 1", Age: 30})
+
+		val, err = db.Update(context.Background(), Person{Prefix: "org:c", Name: "new"})
+		it.Ok(t).
+			IfNil(err).
+			If(val).Equal(Person{Prefix: "org:c", Suffix: "_", Name: "new"})
+	})
+
+	//
+	t.Run("Constraints", func(t *testing.T) {
+		db := fixture(t)
+		key := Person{Prefix: "org:a", Suffix: "person:1", Name: "name 1", Age: 21}
+
+		for _, c := range []dynamo.Constraint[Person]{
+			name.Eq("name 1"), name.Ne("x"), age.Lt(22), age.Le(21), age.Gt(20), age.Ge(21),
+			name.Exists(),
+		} {
+			it.Ok(t).IfNil(db.Put(context.Background(), key, c))
+		}
+
+		for _, c := range []dynamo.Constraint[Person]{
+			name.Eq("x"), name.Ne("name 1"), age.Lt(21), age.Le(20), age.Gt(21), age.Ge(22),
+			name.NotExists(),
+		} {
+			err := db.Put(context.Background(), key, c)
+			var e interface{ PreConditionFailed() bool }
+			it.Ok(t).If(errors.As(err, &e)).Equal(true)
+		}
+
+		var e interface{ Conflict() bool }
+		err := db.Put(context.Background(), key, name.NotExists())
+		it.Ok(t).
+			If(errors.As(err, &e)).Equal(true).
+			If(e.Conflict()).Equal(true)
+
+		var g interface{ Gone() bool }
+		err = db.Remove(context.Background(), Person{Prefix: "org:x"}, name.Exists())
+		it.Ok(t).
+			If(errors.As(err, &g)).Equal(true).
+			If(g.Gone()).Equal(true)
+
+		_, err = db.Update(context.Background(), Person{Prefix: "org:x", Name: "x"}, name.Exists())
+		it.Ok(t).IfNotNil(err)
+
+		// Note: comparison with undefined attribute fails
+		err = db.Put(context.Background(), Person{Prefix: "org:x"}, name.Ne("x"))
+		it.Ok(t).IfNotNil(err)
+	})
+
+	//
+	t.Run("Match", func(t *testing.T) {
+		db := fixture(t)
+
+		it.Ok(t).
+			If(SortKeys(db.Match(context.Background(), Person{Prefix: "org:a", Suffix: "person:"}))).
+			Equal("[person:0 person:1 person:2 person:3 person:4]").
+			If(SortKeys(db.Match(context.Background(), Person{Prefix: "org:a"}))).
+			Equal("[person:0 person:1 person:2 person:3 person:4 team:0]").
+			If(SortKeys(db.Match(context.Background(), Person{Prefix: "org:a", Suffix: "_"}))).
+			Equal("[person:0 person:1 person:2 person:3 person:4 team:0]").
+			If(SortKeys(db.Match(context.Background(), Person{Prefix: "org:a", Suffix: "person:"}).Reverse())).
+			Equal("[person:4 person:3 person:2 person:1 person:0]").
+			If(SortKeys(db.Match(context.Background(), Person{Prefix: "org:z"}))).
+			Equal("[]")
+	})
+
+	//
+	t.Run("MatchCursor", func(t *testing.T) {
+		db := fixture(t)
+		key := Person{Prefix: "org:a", Suffix: "person:"}
+
+		seq := db.Match(context.Background(), key).Limit(2)
+		it.Ok(t).If(SortKeys(seq)).Equal("[person:0 person:1]")
+
+		cursor := seq.Cursor()
+		it.Ok(t).
+			If(cursor.HashKey()).Equal(curie.IRI("org:a")).
+			If(cursor.SortKey()).Equal(curie.IRI("person:1"))
+
+		seq = db.Match(context.Background(), key).Limit(2).Continue(cursor)
+		it.Ok(t).If(SortKeys(seq)).Equal("[person:2 person:3]")
+
+		seq = db.Match(context.Background(), key).Limit(2).Continue(seq.Cursor())
+		it.Ok(t).
+			If(SortKeys(seq)).Equal("[person:4]").
+			If(seq.Cursor().HashKey()).Equal(curie.IRI(""))
+
+		seq = db.Match(context.Background(), key).Reverse().Limit(2).Continue(Person{Prefix: "org:a", Suffix: "person:3"})
+		it.Ok(t).If(SortKeys(seq)).Equal("[person:2 person:1]")
+
+		pages := 0
+		_, err := dynamo.Walk(context.Background(), db.Match(context.Background(), key).Limit(2),
+			func(page dynamo.Page[Person]) error {
+				pages++
+				return nil
+			},
+		)
+		it.Ok(t).
+			IfNil(err).
+			If(pages).Equal(1)
+	})
+
+	//
+	t.Run("MatchFMap", func(t *testing.T) {
+		db := fixture(t)
+
+		seq := dynamo.Things[Person]{}
+		err := db.Match(context.Background(), Person{Prefix: "org:a", Suffix: "person:"}).FMap(seq.Join)
+		it.Ok(t).
+			IfNil(err).
+			If(len(seq)).Equal(5)
+
+		head, err := db.Match(context.Background(), Person{Prefix: "org:a"}).Head()
+		it.Ok(t).
+			IfNil(err).
+			If(head.Suffix).Equal(curie.IRI("person:0"))
+	})
+
+	//
+	t.Run("MatchInvalidKey", func(t *testing.T) {
+		db := fixture(t)
+		seq := db.Match(context.Background(), Person{})
+
+		errs := 0
+		for _, err := range dynamo.All(seq) {
+			it.Ok(t).IfNotNil(err)
+			errs++
+		}
+
+		_, err := seq.Head()
+		it.Ok(t).
+			If(errs).Equal(1).
+			IfNotNil(err).
+			IfFalse(seq.Tail())
+	})
+
+	//
+	t.Run("Count", func(t *testing.T) {
+		counter, ok := fixture(t).(dynamo.KeyValCounter[Person])
+		if !ok {
+			t.Skip("storage does not implement counter")
+		}
+
+		n, err := counter.Count(context.Background(), Person{Prefix: "org:a", Suffix: "person:"}, age.Ge(22))
+		it.Ok(t).
+			IfNil(err).
+			If(n).Equal(3)
+	})
+}
+
+/*
+SortKeys of sequence elements, it returns the error of sequence if any
+*/
+func SortKeys(seq dynamo.Seq[Person]) string {
+	keys := []string{}
+	for x, err := range dynamo.All(seq) {
+		if err != nil {
+			return err.Error()
+		}
+		keys = append(keys, string(x.Suffix))
+	}
+	return fmt.Sprint(keys)
+}
+
+/*
+TestConstraints checks conditional writes to the storage, constraints are
+joined with logical and. The storage is real and empty, each storage MUST
+evaluate all constraints as DynamoDB does.
+*/
+func TestConstraints(t *testing.T, factory func() dynamo.KeyVal[Person]) {
+	t.Helper()
+
+	name := dynamo.Schema1[Person, string]("Name")
+	age := dynamo.Schema1[Person, int]("Age")
+
+	isPreConditionFailed := func(err error) bool {
+		var e interface{ PreConditionFailed() bool }
+		return errors.As(err, &e) && e.PreConditionFailed()
+	}
+
+	//
+	t.Run("PutWithConstraints", func(t *testing.T) {
+		ddb := factory()
+		it.Ok(t).If(ddb.Put(context.TODO(), fixtureVal())).Should().Equal(nil)
+
+		err := ddb.Put(context.TODO(), fixtureVal(), name.Exists(), age.Eq(65))
+		it.Ok(t).IfTrue(isPreConditionFailed(err))
+
+		err = ddb.Put(context.TODO(), fixtureVal(), name.Exists(), age.Eq(64))
+		it.Ok(t).If(err).Should().Equal(nil)
+	})
+
+	//
+	t.Run("RemoveWithConstraints", func(t *testing.T) {
+		ddb := factory()
+		it.Ok(t).If(ddb.Put(context.TODO(), fixtureVal())).Should().Equal(nil)
+
+		err := ddb.Remove(context.TODO(), fixtureKey(), name.Exists(), age.Ne(64))
+		it.Ok(t).IfTrue(isPreConditionFailed(err))
+
+		val, err := ddb.Get(context.TODO(), fixtureKey())
+		it.Ok(t).
+			If(err).Should().Equal(nil).
+			If(val).Should().Equal(fixtureVal())
+
+		err = ddb.Remove(context.TODO(), fixtureKey(), name.Exists(), age.Eq(64))
+		it.Ok(t).If(err).Should().Equal(nil)
+	})
+
+	//
+	t.Run("UpdateWithConstraints", func(t *testing.T) {
+		ddb := factory()
+		it.Ok(t).If(ddb.Put(context.TODO(), fixtureVal())).Should().Equal(nil)
+
+		_, err := ddb.Update(context.TODO(), fixturePatch(), name.Exists(), age.Gt(64))
+		it.Ok(t).IfTrue(isPreConditionFailed(err))
+
+		val, err := ddb.Update(context.TODO(), fixturePatch(), name.Exists(), age.Ge(64))
+		it.Ok(t).
+			If(err).Should().Equal(nil).
+			If(val).Should().Equal(fixtureVal())
+	})
+
+	// Note: http headers are constraints of objects, storages reject them
+	t.Run("UnsupportedConstraints", func(t *testing.T) {
+		ddb := factory()
+		it.Ok(t).If(ddb.Put(context.TODO(), fixtureVal())).Should().Equal(nil)
+
+		http := constrain.CacheControl[Person]("no-cache")
+
+		err := ddb.Put(context.TODO(), fixtureVal(), name.Exists(), http)
+		it.Ok(t).IfNotNil(err).IfFalse(isPreConditionFailed(err))
+
+		err = ddb.Remove(context.TODO(), fixtureKey(), http)
+		it.Ok(t).IfNotNil(err).IfFalse(isPreConditionFailed(err))
+
+		_, err = ddb.Update(context.TODO(), fixturePatch(), http)
+		it.Ok(t).IfNotNil(err).IfFalse(isPreConditionFailed(err))
+
+		if db, ok := ddb.(dynamo.KeyValCounter[Person]); ok {
+			_, err = db.Count(context.TODO(), fixtureKeyHashOnly(), http)
+			it.Ok(t).IfNotNil(err)
+		}
+
+		val, err := ddb.Get(context.TODO(), fixtureKey())
+		it.Ok(t).
+			If(err).Should().Equal(nil).
+			If(val).Should().Equal(fixtureVal())
+	})
+}
+
 func TestMatch[S any](
 	t *testing.T,
 	encoder Encoder[S],
@@ -324,6 +633,68 @@ func TestMatch[S any](
 			If(seq).Should().Equal(dynamo.Things[Person]{fixtureVal(), fixtureVal()})
 	})
 
+	//
+	t.Run("AllNone", func(t *testing.T) {
+		ddb := factory(&expectKey, 0, &returnVal, nil)
+
+		cnt := 0
+		for _, err := range dynamo.All(ddb.Match(context.TODO(), fixtureKeyHashOnly())) {
+			it.Ok(t).If(err).Should().Equal(nil)
+			cnt++
+		}
+
+		it.Ok(t).If(cnt).Should().Equal(0)
+	})
+
+	//
+	t.Run("AllMany", func(t *testing.T) {
+		ddb := factory(&expectKey, 5, &returnVal, nil)
+
+		var seq Persons
+		for val, err := range dynamo.All(ddb.Match(context.TODO(), fixtureKeyHashOnly())) {
+			it.Ok(t).If(err).Should().Equal(nil)
+			seq = append(seq, val)
+		}
+
+		it.Ok(t).If(len(seq)).Should().Equal(5)
+	})
+
+	//
+	t.Run("AllBreak", func(t *testing.T) {
+		ddb := factory(&expectKey, 5, &returnVal, nil)
+
+		cnt := 0
+		for range dynamo.All(ddb.Match(context.TODO(), fixtureKeyHashOnly())) {
+			cnt++
+			if cnt == 2 {
+				break
+			}
+		}
+
+		it.Ok(t).If(cnt).Should().Equal(2)
+	})
+
+	//
+	t.Run("PagesWithCursor", func(t *testing.T) {
+		expectKeyFull, err := encoder(fixtureKey())
+		it.Ok(t).IfNil(err)
+
+		ddb := factory(&expectKey, 2, &returnVal, &expectKeyFull)
+
+		pages := 0
+		for page, err := range dynamo.Pages(ddb.Match(context.TODO(), fixtureKeyHashOnly()).Limit(2)) {
+			pages++
+			keys := filepath.Join(string(page.Cursor.HashKey()), string(page.Cursor.SortKey()))
+
+			it.Ok(t).
+				If(err).Should().Equal(nil).
+				If(len(page.Items)).Should().Equal(2).
+				If(keys).Should().Equal("dead:beef/1")
+		}
+
+		it.Ok(t).If(pages).Should().Equal(1)
+	})
+
 	//
 	t.Run("FMapWithCursor", func(t *testing.T) {
 		expectKeyFull, err := encoder(fixtureKey())
@@ -0,0 +1,506 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file declares key/value interface for local file system
+//
+
+package fs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+	"github.com/holmes89/dynamo/internal/mem"
+)
+
+// name of the file used to lock the directory by writers
+const lockName = ".lock"
+
+var (
+	mutexes   = map[string]*sync.Mutex{}
+	mutexesMu sync.Mutex
+)
+
+// mutexOf the directory, it serializes writers within the process
+func mutexOf(root string) *sync.Mutex {
+	mutexesMu.Lock()
+	defer mutexesMu.Unlock()
+
+	mu, has := mutexes[root]
+	if !has {
+		mu = &sync.Mutex{}
+		mutexes[root] = mu
+	}
+
+	return mu
+}
+
+/*
+Storage is local file system handler of key/value I/O. Each entity is
+a JSON file at root/hashkey/sortkey. Files are written atomically,
+writers are serialized with the lock of the directory. Constraints are
+evaluated over the DynamoDB representation of entities, as the in-memory
+storage does.
+*/
+type Storage[T dynamo.Thing] struct {
+	Root      string
+	Codec     *ddb.Codec[T]
+	undefined T
+}
+
+//-----------------------------------------------------------------------------
+//
+// Layout
+//
+//-----------------------------------------------------------------------------
+
+/*
+escape the key into the name of file. Bytes other than lower case letters,
+digits, '-' and '_' are percent-encoded with upper case hex digits, names
+are distinct on case-insensitive file systems and never contain path
+separators, ':' (alternate data streams of NTFS) or leading dots. The first
+byte of names reserved by Windows (e.g. con, nul) is encoded as well.
+*/
+func escape(key string) string {
+	const hex = "0123456789ABCDEF"
+
+	name := make([]byte, 0, len(key))
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case i == 0 && reserved[key]:
+			name = append(name, '%', hex[c>>4], hex[c&0xf])
+		case 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_':
+			name = append(name, c)
+		default:
+			name = append(name, '%', hex[c>>4], hex[c&0xf])
+		}
+	}
+
+	return string(name)
+}
+
+// device names reserved by Windows
+var reserved = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true,
+	"com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true,
+	"lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// unescape the name of file, names not produced by escape are rejected
+func unescape(name string) (string, bool) {
+	key, err := url.PathUnescape(name)
+	return key, err == nil && escape(key) == name
+}
+
+func keyOf(thing dynamo.Thing) (string, string) {
+	sortKey := string(thing.SortKey())
+	if sortKey == "" {
+		sortKey = "_"
+	}
+
+	return string(thing.HashKey()), sortKey
+}
+
+func (db *Storage[T]) pathOf(hashKey, sortKey string) string {
+	return filepath.Join(db.Root, escape(hashKey), escape(sortKey))
+}
+
+// lock the directory, the function returns release of the lock
+func (db *Storage[T]) lock() (func(), error) {
+	return lock(db.Root)
+}
+
+func lock(root string) (func(), error) {
+	mu := mutexOf(root)
+	mu.Lock()
+
+	f, err := os.OpenFile(filepath.Join(root, lockName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		mu.Unlock()
+		return nil, err
+	}
+
+	if err := flock(f); err != nil {
+		f.Close()
+		mu.Unlock()
+		return nil, err
+	}
+
+	return func() {
+		funlock(f)
+		f.Close()
+		mu.Unlock()
+	}, nil
+}
+
+/*
+Lockable checks that writers are able to lock the directory, the storage
+is not supported on platforms without file locks.
+*/
+func Lockable(root string) error {
+	unlock, err := lock(root)
+	if err != nil {
+		return errServiceIO(err)
+	}
+	unlock()
+
+	return nil
+}
+
+// read entity from the file, nil is returned if file does not exist
+func (db *Storage[T]) read(path string) (*T, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, errServiceIO(err)
+	}
+
+	var entity T
+	if err := json.Unmarshal(buf, &entity); err != nil {
+		return nil, errInvalidEntity(err)
+	}
+
+	return &entity, nil
+}
+
+// write entity to the file, the temporary file is renamed to the target
+func (db *Storage[T]) write(path string, entity T) error {
+	buf, err := json.Marshal(entity)
+	if err != nil {
+		return errInvalidEntity(err)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errServiceIO(err)
+	}
+
+	f, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return errServiceIO(err)
+	}
+
+	_, err = f.Write(buf)
+	if err == nil {
+		err = f.Sync()
+	}
+	if errc := f.Close(); err == nil {
+		err = errc
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return errServiceIO(err)
+	}
+
+	return nil
+}
+
+// attributes of the entity used for evaluation of constraints
+func (db *Storage[T]) attributes(entity *T) (map[string]types.AttributeValue, error) {
+	if entity == nil {
+		return nil, nil
+	}
+
+	gen, err := db.Codec.Encode(*entity)
+	if err != nil {
+		return nil, errInvalidEntity(err)
+	}
+
+	return gen, nil
+}
+
+/*
+query sort keys of partition with the prefix, ordered by sort key.
+Keys after the exclusive start key are returned, limit 0 is unbound.
+It returns the last sort key if more keys remains.
+*/
+func (db *Storage[T]) query(
+	hashKey, prefix string,
+	start *string,
+	reverse bool,
+	limit int,
+) ([]string, *string, error) {
+	files, err := os.ReadDir(filepath.Join(db.Root, escape(hashKey)))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, nil
+		}
+		return nil, nil, errServiceIO(err)
+	}
+
+	keys := make([]string, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		k, ok := unescape(file.Name())
+		if !ok || !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if start != nil && ((!reverse && k <= *start) || (reverse && k >= *start)) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	if reverse {
+		for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+	}
+
+	var last *string
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		last = &keys[limit-1]
+	}
+
+	return keys, last, nil
+}
+
+//-----------------------------------------------------------------------------
+//
+// Key Value
+//
+//-----------------------------------------------------------------------------
+
+// Get item from storage
+func (db *Storage[T]) Get(ctx context.Context, key T) (T, error) {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return db.undefined, errInvalidKey(err)
+	}
+
+	val, err := db.read(db.pathOf(keyOf(key)))
+	if err != nil {
+		return db.undefined, err
+	}
+
+	if val == nil {
+		return db.undefined, errNotFound(nil, key)
+	}
+
+	return *val, nil
+}
+
+// Put writes entity
+func (db *Storage[T]) Put(ctx context.Context, entity T, config ...dynamo.Constraint[T]) error {
+	if _, err := db.Codec.EncodeKey(entity); err != nil {
+		return errInvalidKey(err)
+	}
+
+	if err := mem.Supported(config); err != nil {
+		return errInvalidEntity(err)
+	}
+
+	path := db.pathOf(keyOf(entity))
+
+	unlock, err := db.lock()
+	if err != nil {
+		return errServiceIO(err)
+	}
+	defer unlock()
+
+	if len(config) != 0 {
+		val, err := db.read(path)
+		if err != nil {
+			return err
+		}
+
+		gen, err := db.attributes(val)
+		if err != nil {
+			return err
+		}
+
+		if c := mem.Check(gen, config); c != nil {
+			return mem.PreCondition(entity, c)
+		}
+	}
+
+	return db.write(path, entity)
+}
+
+// Remove discards the entity from the table
+func (db *Storage[T]) Remove(ctx context.Context, key T, config ...dynamo.Constraint[T]) error {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return errInvalidKey(err)
+	}
+
+	if err := mem.Supported(config); err != nil {
+		return errInvalidEntity(err)
+	}
+
+	path := db.pathOf(keyOf(key))
+
+	unlock, err := db.lock()
+	if err != nil {
+		return errServiceIO(err)
+	}
+	defer unlock()
+
+	if len(config) != 0 {
+		val, err := db.read(path)
+		if err != nil {
+			return err
+		}
+
+		gen, err := db.attributes(val)
+		if err != nil {
+			return err
+		}
+
+		if c := mem.Check(gen, config); c != nil {
+			return mem.PreCondition(key, c)
+		}
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return errServiceIO(err)
+	}
+
+	// Note: partition is removed once it is empty, the failure is expected otherwise
+	os.Remove(filepath.Dir(path))
+
+	return nil
+}
+
+// Update applies a partial patch to entity and returns new values
+func (db *Storage[T]) Update(ctx context.Context, entity T, config ...dynamo.Constraint[T]) (T, error) {
+	if _, err := db.Codec.EncodeKey(entity); err != nil {
+		return db.undefined, errInvalidKey(err)
+	}
+
+	if err := mem.Supported(config); err != nil {
+		return db.undefined, errInvalidEntity(err)
+	}
+
+	gen, err := db.Codec.Encode(entity)
+	if err != nil {
+		return db.undefined, errInvalidEntity(err)
+	}
+
+	path := db.pathOf(keyOf(entity))
+
+	unlock, err := db.lock()
+	if err != nil {
+		return db.undefined, errServiceIO(err)
+	}
+	defer unlock()
+
+	val, err := db.read(path)
+	if err != nil {
+		return db.undefined, err
+	}
+
+	item, err := db.attributes(val)
+	if err != nil {
+		return db.undefined, err
+	}
+
+	if c := mem.Check(item, config); c != nil {
+		return db.undefined, mem.PreCondition(entity, c)
+	}
+
+	if item == nil {
+		item = map[string]types.AttributeValue{}
+	}
+	for k, v := range gen {
+		item[k] = v
+	}
+
+	obj, err := db.Codec.Decode(item)
+	if err != nil {
+		return db.undefined, errInvalidEntity(err)
+	}
+
+	if err := db.write(path, obj); err != nil {
+		return db.undefined, err
+	}
+
+	return obj, nil
+}
+
+// Match applies a pattern matching to elements in the table
+func (db *Storage[T]) Match(ctx context.Context, key T) dynamo.Seq[T] {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return newSeq(ctx, db, "", "", errInvalidKey(err))
+	}
+
+	hashKey, prefix := keyOf(key)
+	if prefix == "_" {
+		prefix = ""
+	}
+
+	return newSeq(ctx, db, hashKey, prefix, nil)
+}
+
+// Count number of elements matching the pattern and filters
+func (db *Storage[T]) Count(ctx context.Context, key T, filters ...dynamo.Constraint[T]) (int, error) {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return 0, errInvalidKey(err)
+	}
+
+	if err := mem.Supported(filters); err != nil {
+		return 0, errInvalidEntity(err)
+	}
+
+	hashKey, prefix := keyOf(key)
+	if prefix == "_" {
+		prefix = ""
+	}
+
+	keys, _, err := db.query(hashKey, prefix, nil, false, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, sortKey := range keys {
+		val, err := db.read(db.pathOf(hashKey, sortKey))
+		if err != nil {
+			return 0, err
+		}
+
+		// Note: the entity is removed after listing
+		if val == nil {
+			continue
+		}
+
+		gen, err := db.attributes(val)
+		if err != nil {
+			return 0, err
+		}
+
+		if mem.Check(gen, filters) == nil {
+			count++
+		}
+	}
+
+	return count, nil
+}
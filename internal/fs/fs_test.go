@@ -0,0 +1,138 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package fs_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/fogfish/curie"
+	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/dynamotest"
+	"github.com/holmes89/dynamo/service/fs"
+)
+
+type person struct {
+	Prefix curie.IRI `dynamodbav:"prefix,omitempty"`
+	Suffix curie.IRI `dynamodbav:"suffix,omitempty"`
+	Name   string    `dynamodbav:"name,omitempty"`
+}
+
+func (p person) HashKey() curie.IRI { return p.Prefix }
+func (p person) SortKey() curie.IRI { return p.Suffix }
+
+func TestStorage(t *testing.T) {
+	dynamotest.TestStorage(t, func() dynamo.KeyVal[dynamotest.Person] {
+		return fs.Must(fs.New[dynamotest.Person]("file://" + filepath.ToSlash(t.TempDir())))
+	})
+}
+
+func TestConstraintsConjunction(t *testing.T) {
+	dynamotest.TestConstraints(t, func() dynamo.KeyVal[dynamotest.Person] {
+		return fs.Must(fs.New[dynamotest.Person]("file://" + filepath.ToSlash(t.TempDir())))
+	})
+}
+
+func TestLayout(t *testing.T) {
+	root := t.TempDir()
+	db := fs.Must(fs.New[dynamotest.Person]("file://" + filepath.ToSlash(root)))
+
+	for _, x := range []dynamotest.Person{
+		{Prefix: "org:a", Suffix: "person:1"},
+		{Prefix: "org:a", Suffix: "a/b"},
+		{Prefix: "org:a", Suffix: ".hidden"},
+		{Prefix: "org:a", Suffix: "con"},
+		{Prefix: "org:b"},
+	} {
+		it.Ok(t).IfNil(db.Put(context.Background(), x))
+	}
+
+	files := []string{}
+	filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if !d.IsDir() {
+			rel, _ := filepath.Rel(root, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+
+	it.Ok(t).
+		If(fmt.Sprint(files)).Equal("[.lock org%3Aa/%2Ehidden org%3Aa/%63on org%3Aa/a%2Fb org%3Aa/person%3A1 org%3Ab/_]").
+		If(dynamotest.SortKeys(db.Match(context.Background(), dynamotest.Person{Prefix: "org:a"}))).
+		Equal("[.hidden a/b con person:1]")
+
+	it.Ok(t).IfNil(db.Remove(context.Background(), dynamotest.Person{Prefix: "org:b"}))
+	_, err := os.Stat(filepath.Join(root, "org%3Ab"))
+	it.Ok(t).If(os.IsNotExist(err)).Equal(true)
+}
+
+// Note: keys that differ only in case are distinct files on case-insensitive file systems
+func TestLayoutCase(t *testing.T) {
+	db := fs.Must(fs.New[dynamotest.Person]("file://" + filepath.ToSlash(t.TempDir())))
+
+	for _, x := range []dynamotest.Person{
+		{Prefix: "author:Neumann", Suffix: "book:A", Name: "upper"},
+		{Prefix: "author:neumann", Suffix: "book:a", Name: "lower"},
+	} {
+		it.Ok(t).IfNil(db.Put(context.Background(), x))
+	}
+
+	upper, err := db.Get(context.Background(), dynamotest.Person{Prefix: "author:Neumann", Suffix: "book:A"})
+	it.Ok(t).
+		IfNil(err).
+		If(upper.Name).Equal("upper")
+
+	lower, err := db.Get(context.Background(), dynamotest.Person{Prefix: "author:neumann", Suffix: "book:a"})
+	it.Ok(t).
+		IfNil(err).
+		If(lower.Name).Equal("lower").
+		If(dynamotest.SortKeys(db.Match(context.Background(), dynamotest.Person{Prefix: "author:Neumann"}))).
+		Equal("[book:A]")
+}
+
+func TestConcurrentConstraints(t *testing.T) {
+	db := fs.Must(fs.New[person]("file://" + filepath.ToSlash(t.TempDir())))
+	name := dynamo.Schema1[person, string]("Name")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- db.Put(context.Background(),
+				person{Prefix: "org:c", Name: fmt.Sprintf("name %d", i)},
+				name.NotExists(),
+			)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	ok := 0
+	for err := range errs {
+		if err == nil {
+			ok++
+		}
+	}
+	it.Ok(t).If(ok).Equal(1)
+}
+
+func TestConnector(t *testing.T) {
+	_, err := fs.New[person]("file://")
+	it.Ok(t).IfNotNil(err)
+
+	_, err = fs.New[person]("s3:///bucket")
+	it.Ok(t).IfNotNil(err)
+}
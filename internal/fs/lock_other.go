@@ -0,0 +1,25 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//go:build !unix && !windows
+
+package fs
+
+import (
+	"errors"
+	"os"
+)
+
+// Note: file locks are not available, writers of other processes are not
+// serialized. The storage is not supported rather than racing silently.
+
+func flock(f *os.File) error {
+	return errors.New("file locks are not supported by the platform")
+}
+
+func funlock(f *os.File) error { return nil }
@@ -0,0 +1,65 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file declares sequence type (traversal) for local file system storage
+//
+
+package fs
+
+import (
+	"context"
+
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/pager"
+)
+
+func newSeq[T dynamo.Thing](
+	ctx context.Context,
+	db *Storage[T],
+	hashKey, prefix string,
+	err error,
+) *pager.Seq[T] {
+	if err != nil {
+		return pager.New[T](ctx, nil, nil, err)
+	}
+
+	query := func(ctx context.Context, start *string, reverse bool, n int) ([]T, *string, error) {
+		for {
+			keys, last, err := db.query(hashKey, prefix, start, reverse, n)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			heap := make([]T, 0, len(keys))
+			for _, sortKey := range keys {
+				val, err := db.read(db.pathOf(hashKey, sortKey))
+				if err != nil {
+					return nil, nil, err
+				}
+
+				// Note: the entity is removed after listing
+				if val != nil {
+					heap = append(heap, *val)
+				}
+			}
+
+			// Note: the page of removed entities is skipped
+			if len(heap) != 0 || last == nil {
+				return heap, last, nil
+			}
+
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+			start = last
+		}
+	}
+
+	return pager.New(ctx, query, pager.SortKey(hashKey), nil)
+}
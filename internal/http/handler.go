@@ -0,0 +1,303 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file declares REST resource of key/value storage
+//
+
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/fogfish/curie"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+)
+
+/*
+Handler serves key/value storage as REST resource using the wire protocol
+of Storage. Items are {base}/{hashkey}/{sortkey}, the partition
+{base}/{hashkey} is the collection of items.
+*/
+type Handler[T dynamo.Thing] struct {
+	KeyVal dynamo.KeyVal[T]
+	// Base is the path of resource, it is stripped from requests
+	Base string
+	// HashKey is the name of hash key attribute, it's existence is
+	// the existence of the item.
+	HashKey string
+	// SortKey is the name of sort key attribute
+	SortKey string
+	Codec   *ddb.Codec[T]
+	// Limit is the default and maximal size of collection page
+	Limit int
+	// Secret signs cursors of collection pages, cursors are not signed
+	// if secret is empty. Cursors without valid signature are rejected if
+	// secret is defined, otherwise unsigned cursors of plain keys are
+	// accepted too.
+	Secret []byte
+}
+
+func (h *Handler[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Note: the base matches whole segments, /person does not serve /personal
+	path, has := strings.CutPrefix(r.URL.EscapedPath(), h.Base)
+	if !has || (path != "" && !strings.HasPrefix(path, "/")) {
+		h.problem(w, http.StatusNotFound, nil)
+		return
+	}
+
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, segment := range segments {
+		val, err := url.PathUnescape(segment)
+		if err != nil || val == "" {
+			h.problem(w, http.StatusNotFound, nil)
+			return
+		}
+		segments[i] = val
+	}
+
+	switch len(segments) {
+	case 1:
+		h.collection(w, r, segments[0])
+	case 2:
+		h.item(w, r, segments[0], segments[1])
+	default:
+		h.problem(w, http.StatusNotFound, nil)
+	}
+}
+
+// key builds the key of entity from path segments
+func (h *Handler[T]) key(hashKey, sortKey string) (T, error) {
+	if sortKey == "" {
+		sortKey = "_"
+	}
+
+	return h.Codec.Decode(map[string]types.AttributeValue{
+		h.HashKey: &types.AttributeValueMemberS{Value: hashKey},
+		h.SortKey: &types.AttributeValueMemberS{Value: sortKey},
+	})
+}
+
+// entity decodes the request body, the key of entity must match the path
+func (h *Handler[T]) entity(w http.ResponseWriter, r *http.Request, key T) (T, error) {
+	var entity T
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4*1024*1024)).Decode(&entity); err != nil {
+		return entity, err
+	}
+
+	if _, err := h.Codec.EncodeKey(entity); err != nil {
+		return entity, err
+	}
+
+	if entity.HashKey() != key.HashKey() || sortKeyOf(entity) != sortKeyOf(key) {
+		return entity, errors.New("the key of entity does not match the path")
+	}
+
+	return entity, nil
+}
+
+func sortKeyOf(thing dynamo.Thing) curie.IRI {
+	if sortKey := thing.SortKey(); sortKey != "" {
+		return sortKey
+	}
+	return "_"
+}
+
+func (h *Handler[T]) item(w http.ResponseWriter, r *http.Request, hashKey, sortKey string) {
+	key, err := h.key(hashKey, sortKey)
+	if err != nil {
+		h.problem(w, http.StatusBadRequest, err)
+		return
+	}
+
+	config, err := DecodeConstraints[T](h.HashKey, r.URL.Query(), r.Header)
+	if err != nil {
+		h.problem(w, http.StatusBadRequest, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		val, err := h.KeyVal.Get(r.Context(), key)
+		if err != nil {
+			h.failure(w, err)
+			return
+		}
+		h.json(w, http.StatusOK, val)
+
+	case http.MethodPut:
+		entity, err := h.entity(w, r, key)
+		if err != nil {
+			h.problem(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := h.KeyVal.Put(r.Context(), entity, config...); err != nil {
+			h.failure(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		if err := h.KeyVal.Remove(r.Context(), key, config...); err != nil {
+			h.failure(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodPatch:
+		entity, err := h.entity(w, r, key)
+		if err != nil {
+			h.problem(w, http.StatusBadRequest, err)
+			return
+		}
+
+		val, err := h.KeyVal.Update(r.Context(), entity, config...)
+		if err != nil {
+			h.failure(w, err)
+			return
+		}
+		h.json(w, http.StatusOK, val)
+
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE, PATCH")
+		h.problem(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+func (h *Handler[T]) collection(w http.ResponseWriter, r *http.Request, hashKey string) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		h.problem(w, http.StatusMethodNotAllowed, nil)
+		return
+	}
+
+	query := r.URL.Query()
+
+	key, err := h.key(hashKey, query.Get("prefix"))
+	if err != nil {
+		h.problem(w, http.StatusBadRequest, err)
+		return
+	}
+
+	limit := h.Limit
+	if val := query.Get("limit"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n <= 0 {
+			h.problem(w, http.StatusBadRequest, errors.New("invalid limit: "+val))
+			return
+		}
+		if limit <= 0 || n < limit {
+			limit = n
+		}
+	}
+
+	seq := h.KeyVal.Match(r.Context(), key)
+	if limit > 0 {
+		seq = seq.Limit(limit)
+	}
+
+	if token := query.Get("cursor"); token != "" {
+		cursor, err := dynamo.DecodeCursor(token, h.Secret)
+		if err != nil {
+			h.problem(w, http.StatusBadRequest, err)
+			return
+		}
+		// Note: the cursor is the position within the partition of path
+		if cursor.HashKey() != key.HashKey() {
+			h.problem(w, http.StatusBadRequest, errors.New("the cursor does not match the partition"))
+			return
+		}
+		seq = seq.Continue(cursor)
+	}
+
+	if val := query.Get("reverse"); val != "" {
+		reverse, err := strconv.ParseBool(val)
+		if err != nil {
+			h.problem(w, http.StatusBadRequest, errors.New("invalid reverse: "+val))
+			return
+		}
+		if reverse {
+			seq = seq.Reverse()
+		}
+	}
+
+	page := Page[T]{Items: make([]T, 0)}
+	for x, err := range dynamo.All(seq) {
+		if err != nil {
+			h.failure(w, err)
+			return
+		}
+		page.Items = append(page.Items, x)
+	}
+
+	if cursor := seq.Cursor(); cursor.HashKey() != "" {
+		switch c := cursor.(type) {
+		case *dynamo.Cursor:
+			page.Cursor = c.Encode(h.Secret)
+		default:
+			page.Cursor = dynamo.NewCursor(c.HashKey(), c.SortKey(), nil).Encode(h.Secret)
+		}
+	}
+
+	h.json(w, http.StatusOK, page)
+}
+
+// failure maps errors of the storage to status codes
+func (h *Handler[T]) failure(w http.ResponseWriter, err error) {
+	var notFound interface{ NotFound() string }
+	if errors.As(err, &notFound) {
+		h.problem(w, http.StatusNotFound, err)
+		return
+	}
+
+	var preConditionFailed interface{ PreConditionFailed() bool }
+	if errors.As(err, &preConditionFailed) && preConditionFailed.PreConditionFailed() {
+		problem := Problem{Status: http.StatusPreconditionFailed, Title: http.StatusText(http.StatusPreconditionFailed)}
+
+		var conflict interface{ Conflict() bool }
+		if errors.As(err, &conflict) && conflict.Conflict() {
+			problem.Status = http.StatusConflict
+			problem.Title = http.StatusText(http.StatusConflict)
+			problem.Conflict = true
+		}
+
+		var gone interface{ Gone() bool }
+		if errors.As(err, &gone) {
+			problem.Gone = gone.Gone()
+		}
+
+		h.json(w, problem.Status, problem)
+		return
+	}
+
+	h.problem(w, http.StatusInternalServerError, nil)
+}
+
+// problem responds with the error, the cause is exposed to client errors only
+func (h *Handler[T]) problem(w http.ResponseWriter, status int, err error) {
+	problem := Problem{Status: status, Title: http.StatusText(status)}
+	if err != nil && status < 500 {
+		problem.Title = err.Error()
+	}
+
+	h.json(w, status, problem)
+}
+
+func (h *Handler[T]) json(w http.ResponseWriter, status int, val any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(val)
+}
@@ -0,0 +1,278 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file declares key/value interface over REST
+//
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+)
+
+/*
+Storage is the client of key/value REST resource. Items are addressed
+as {endpoint}/{hashkey}/{sortkey}, the partition {endpoint}/{hashkey} is
+the collection matched by sort key prefix.
+*/
+type Storage[T dynamo.Thing] struct {
+	Client   *http.Client
+	Endpoint string
+	// HashKey is the name of hash key attribute, it's existence is
+	// the existence of the item.
+	HashKey   string
+	Codec     *ddb.Codec[T]
+	undefined T
+}
+
+// request builds HTTP request to the resource
+func (db *Storage[T]) request(
+	ctx context.Context,
+	method, path string,
+	query url.Values,
+	entity *T,
+) (*http.Request, error) {
+	var body io.Reader
+	if entity != nil {
+		buf, err := json.Marshal(entity)
+		if err != nil {
+			return nil, errInvalidEntity(err)
+		}
+		body = bytes.NewReader(buf)
+	}
+
+	uri := db.Endpoint + path
+	if len(query) != 0 {
+		uri += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, uri, body)
+	if err != nil {
+		return nil, errServiceIO(err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if entity != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return req, nil
+}
+
+// requestWith builds HTTP request with constraints
+func (db *Storage[T]) requestWith(
+	ctx context.Context,
+	method string,
+	entity T,
+	body *T,
+	config []dynamo.Constraint[T],
+) (*http.Request, error) {
+	query := url.Values{}
+	header := http.Header{}
+	if err := EncodeConstraints(db.HashKey, config, query, header); err != nil {
+		return nil, errInvalidEntity(err)
+	}
+
+	hashKey, sortKey := keyOf(entity)
+	req, err := db.request(ctx, method, PathOf(hashKey, sortKey), query, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, val := range header {
+		req.Header[key] = val
+	}
+
+	return req, nil
+}
+
+// do executes request, the response body is decoded into val if it is defined
+func (db *Storage[T]) do(req *http.Request, thing dynamo.Thing, val any) error {
+	resp, err := db.Client.Do(req)
+	if err != nil {
+		return errServiceIO(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		problem := Problem{Status: resp.StatusCode, Title: http.StatusText(resp.StatusCode)}
+		// Note: the error body is optional, the status code is enough
+		buf, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if len(buf) != 0 {
+			json.Unmarshal(buf, &problem)
+		}
+
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			return errNotFound(&problem, thing)
+		case http.StatusConflict:
+			return errPreConditionFailed(&problem, thing, true, problem.Gone)
+		case http.StatusPreconditionFailed:
+			return errPreConditionFailed(&problem, thing, problem.Conflict, problem.Gone)
+		default:
+			return errServiceIO(&problem)
+		}
+	}
+
+	if val == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(val); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errServiceIO(errors.New("response body is empty"))
+		}
+		return errInvalidEntity(err)
+	}
+
+	return nil
+}
+
+func keyOf(thing dynamo.Thing) (string, string) {
+	return string(thing.HashKey()), string(thing.SortKey())
+}
+
+//-----------------------------------------------------------------------------
+//
+// Key Value
+//
+//-----------------------------------------------------------------------------
+
+// Get item from storage
+func (db *Storage[T]) Get(ctx context.Context, key T) (T, error) {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return db.undefined, errInvalidKey(err)
+	}
+
+	hashKey, sortKey := keyOf(key)
+	req, err := db.request(ctx, http.MethodGet, PathOf(hashKey, sortKey), nil, nil)
+	if err != nil {
+		return db.undefined, err
+	}
+
+	var val T
+	if err := db.do(req, key, &val); err != nil {
+		return db.undefined, err
+	}
+
+	return val, nil
+}
+
+// Put writes entity
+func (db *Storage[T]) Put(ctx context.Context, entity T, config ...dynamo.Constraint[T]) error {
+	if _, err := db.Codec.EncodeKey(entity); err != nil {
+		return errInvalidKey(err)
+	}
+
+	req, err := db.requestWith(ctx, http.MethodPut, entity, &entity, config)
+	if err != nil {
+		return err
+	}
+
+	return db.do(req, entity, nil)
+}
+
+// Remove discards the entity from the table
+func (db *Storage[T]) Remove(ctx context.Context, key T, config ...dynamo.Constraint[T]) error {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return errInvalidKey(err)
+	}
+
+	req, err := db.requestWith(ctx, http.MethodDelete, key, nil, config)
+	if err != nil {
+		return err
+	}
+
+	return db.do(req, key, nil)
+}
+
+// Update applies a partial patch to entity and returns new values
+func (db *Storage[T]) Update(ctx context.Context, entity T, config ...dynamo.Constraint[T]) (T, error) {
+	if _, err := db.Codec.EncodeKey(entity); err != nil {
+		return db.undefined, errInvalidKey(err)
+	}
+
+	req, err := db.requestWith(ctx, http.MethodPatch, entity, &entity, config)
+	if err != nil {
+		return db.undefined, err
+	}
+
+	var val T
+	if err := db.do(req, entity, &val); err != nil {
+		return db.undefined, err
+	}
+
+	return val, nil
+}
+
+// Match applies a pattern matching to elements in the table
+func (db *Storage[T]) Match(ctx context.Context, key T) dynamo.Seq[T] {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return newSeq(ctx, db, "", "", errInvalidKey(err))
+	}
+
+	hashKey, prefix := keyOf(key)
+
+	return newSeq(ctx, db, hashKey, prefix, nil)
+}
+
+// query a page of partition after the continuation, it returns the
+// continuation of next page if more items remains. The continuation is
+// the query of cursor issued by server or given by client.
+func (db *Storage[T]) query(
+	ctx context.Context,
+	hashKey, prefix string,
+	continuation *string,
+	reverse bool,
+	limit int,
+) ([]T, *string, error) {
+	query := url.Values{}
+	if continuation != nil {
+		var err error
+		if query, err = url.ParseQuery(*continuation); err != nil {
+			return nil, nil, errInvalidKey(err)
+		}
+	}
+	if prefix != "" {
+		query.Set("prefix", prefix)
+	}
+	if reverse {
+		query.Set("reverse", "true")
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	req, err := db.request(ctx, http.MethodGet, "/"+url.PathEscape(hashKey), query, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var page Page[T]
+	if err := db.do(req, dynamo.NewCursor("", "", nil), &page); err != nil {
+		return nil, nil, err
+	}
+
+	if page.Cursor == "" {
+		return page.Items, nil, nil
+	}
+
+	last := url.Values{"cursor": {page.Cursor}}.Encode()
+	return page.Items, &last, nil
+}
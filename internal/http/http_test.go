@@ -0,0 +1,235 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/fogfish/curie"
+	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/dynamotest"
+	"github.com/holmes89/dynamo/internal/ddb"
+	dhttp "github.com/holmes89/dynamo/internal/http"
+	rest "github.com/holmes89/dynamo/service/http"
+	"github.com/holmes89/dynamo/service/mem"
+)
+
+type person struct {
+	Prefix curie.IRI `dynamodbav:"prefix,omitempty"`
+	Suffix curie.IRI `dynamodbav:"suffix,omitempty"`
+	Name   string    `dynamodbav:"name,omitempty"`
+	Age    int       `dynamodbav:"age,omitempty"`
+}
+
+func (p person) HashKey() curie.IRI { return p.Prefix }
+func (p person) SortKey() curie.IRI { return p.Suffix }
+
+func server(t *testing.T, config string) *httptest.Server {
+	h, err := rest.NewHandler(mem.Must(mem.New[dynamotest.Person]("mem:///person", mem.NewTable())), config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// Note: handler without secret accepts continuation from plain keys
+func TestStorage(t *testing.T) {
+	dynamotest.TestStorage(t, func() dynamo.KeyVal[dynamotest.Person] {
+		uri, _ := url.Parse("/person")
+		ts := httptest.NewServer(&dhttp.Handler[dynamotest.Person]{
+			KeyVal:  mem.Must(mem.New[dynamotest.Person]("mem:///person", mem.NewTable())),
+			Base:    "/person",
+			HashKey: "prefix",
+			SortKey: "suffix",
+			Codec:   ddb.NewCodec[dynamotest.Person]((*dynamo.URL)(uri)),
+			Limit:   2,
+		})
+		t.Cleanup(ts.Close)
+		return rest.Must(rest.New[dynamotest.Person](ts.URL+"/person", ts.Client()))
+	})
+}
+
+func TestConstraintsConjunction(t *testing.T) {
+	dynamotest.TestConstraints(t, func() dynamo.KeyVal[dynamotest.Person] {
+		ts := server(t, "/person")
+		return rest.Must(rest.New[dynamotest.Person](ts.URL+"/person", ts.Client()))
+	})
+}
+
+func TestConditionalHeaders(t *testing.T) {
+	var header http.Header
+	var query url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header, query = r.Header, r.URL.Query()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	prefix := dynamo.Schema1[person, curie.IRI]("Prefix")
+	age := dynamo.Schema1[person, int]("Age")
+	db := rest.Must(rest.New[person](ts.URL, ts.Client()))
+
+	db.Put(context.Background(), person{Prefix: "org:a"}, prefix.NotExists())
+	it.Ok(t).
+		If(header.Get("If-None-Match")).Equal("*").
+		If(len(query["if"])).Equal(0)
+
+	db.Put(context.Background(), person{Prefix: "org:a"}, prefix.Exists(), age.Ge(21))
+	it.Ok(t).
+		If(header.Get("If-Match")).Equal("*").
+		If(query["if"]).Equal([]string{"ge:age:21"})
+
+	config, err := dhttp.DecodeConstraints[person]("prefix", query, header)
+	it.Ok(t).
+		IfNil(err).
+		If(len(config)).Equal(2)
+}
+
+func TestHandler(t *testing.T) {
+	h, _ := rest.NewHandler(mem.Must(mem.New[person]("mem:///person", mem.NewTable())), "/person", nil)
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	status := func(method, path, body string, header ...string) int {
+		req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	it.Ok(t).
+		If(status("PUT", "/person/org:a/person:1", `{"Prefix":"org:a","Suffix":"person:1","Name":"a"}`)).
+		Equal(http.StatusNoContent).
+		If(status("GET", "/person/org:a/person:1", "")).Equal(http.StatusOK).
+		If(status("GET", "/person/org:a/person:2", "")).Equal(http.StatusNotFound).
+		If(status("GET", "/other/org:a/person:1", "")).Equal(http.StatusNotFound).
+		If(status("GET", "/person/org:a/person:1/x", "")).Equal(http.StatusNotFound).
+		If(status("GET", "/personal/org:a/person:1", "")).Equal(http.StatusNotFound).
+		If(status("GET", "/person", "")).Equal(http.StatusNotFound).
+		If(status("PUT", "/person/org:a/person:2", `{"Prefix":"org:a","Suffix":"person:1"}`)).
+		Equal(http.StatusBadRequest).
+		If(status("PUT", "/person/org:a/person:1", `{"Prefix":`)).Equal(http.StatusBadRequest).
+		If(status("PUT", "/person/org:a/person:1", `{"Prefix":"org:a","Suffix":"person:1"}`, "If-None-Match", "*")).
+		Equal(http.StatusConflict).
+		If(status("DELETE", "/person/org:a/person:2", "", "If-Match", "*")).
+		Equal(http.StatusPreconditionFailed).
+		If(status("DELETE", "/person/org:a/person:1", "", "If-Match", `"etag"`)).
+		Equal(http.StatusBadRequest).
+		If(status("PATCH", "/person/org:a/person:1", `{"Prefix":"org:a","Suffix":"person:1","Age":30}`)).
+		Equal(http.StatusOK).
+		If(status("GET", "/person/org:a?limit=x", "")).Equal(http.StatusBadRequest).
+		If(status("GET", "/person/org:a?cursor=x", "")).Equal(http.StatusBadRequest).
+		If(status("POST", "/person/org:a", "")).Equal(http.StatusMethodNotAllowed).
+		If(status("DELETE", "/person/org:a/person:1", "")).Equal(http.StatusNoContent)
+}
+
+func TestHandlerCursor(t *testing.T) {
+	table := mem.NewTable()
+	serve := func(secret string) *httptest.Server {
+		h, _ := rest.NewHandler(mem.Must(mem.New[person]("mem:///person", table)), "/person?limit=1", []byte(secret))
+		ts := httptest.NewServer(h)
+		t.Cleanup(ts.Close)
+		return ts
+	}
+	a, b, c := serve("secret"), serve("secret"), serve("other")
+
+	db := rest.Must(rest.New[person](a.URL+"/person", a.Client()))
+	db.Put(context.Background(), person{Prefix: "org:a", Suffix: "person:1"})
+	db.Put(context.Background(), person{Prefix: "org:a", Suffix: "person:2"})
+
+	resp, err := a.Client().Get(a.URL + "/person/org:a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page dhttp.Page[person]
+	err = json.NewDecoder(resp.Body).Decode(&page)
+	resp.Body.Close()
+	if err != nil || page.Cursor == "" {
+		t.Fatalf("cursor is not issued: %v", err)
+	}
+
+	status := func(ts *httptest.Server, query url.Values) int {
+		resp, err := ts.Client().Get(ts.URL + "/person/org:a?" + query.Encode())
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	cursor := func(token string) url.Values { return url.Values{"cursor": {token}} }
+
+	it.Ok(t).
+		If(status(b, cursor(page.Cursor))).Equal(http.StatusOK).
+		If(status(c, cursor(page.Cursor))).Equal(http.StatusBadRequest).
+		If(status(c, cursor(dynamo.NewCursor("org:a", "person:1", nil).Encode(nil)))).Equal(http.StatusBadRequest).
+		If(status(c, cursor(dynamo.NewCursor("org:a", "person:1", []byte("x")).Encode(nil)))).Equal(http.StatusBadRequest).
+		If(status(b, cursor(page.Cursor+"x"))).Equal(http.StatusBadRequest).
+		If(status(b, cursor(dynamo.NewCursor("org:b", "person:1", nil).Encode([]byte("secret"))))).Equal(http.StatusBadRequest).
+		If(status(b, cursor(dynamo.NewCursor("org:a", "person:1", nil).Encode([]byte("secret"))))).Equal(http.StatusOK)
+
+	// Note: plain keys are unsigned cursors, rejected by handler with secret
+	seq := db.Match(context.Background(), person{Prefix: "org:a"}).Continue(person{Prefix: "org:a", Suffix: "person:1"})
+	it.Ok(t).
+		If(seq.Tail()).Equal(false).
+		IfNotNil(seq.Error())
+}
+
+func TestServiceError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	db := rest.Must(rest.New[person](ts.URL, ts.Client()))
+
+	_, err := db.Get(context.Background(), person{Prefix: "org:a"})
+	var problem *dhttp.Problem
+	it.Ok(t).
+		If(errors.As(err, &problem)).Equal(true).
+		If(problem.Status).Equal(http.StatusBadGateway)
+
+	seq := db.Match(context.Background(), person{Prefix: "org:a"})
+	it.Ok(t).
+		If(seq.Tail()).Equal(false).
+		IfNotNil(seq.Error())
+}
+
+func TestConnector(t *testing.T) {
+	_, err := rest.New[person]("http://", nil)
+	it.Ok(t).IfNotNil(err)
+
+	_, err = rest.New[person]("file:///tmp", nil)
+	it.Ok(t).IfNotNil(err)
+
+	_, err = rest.New[person]("https://example.com/person?prefix=pk&suffix=sk", nil)
+	it.Ok(t).IfNil(err)
+
+	_, err = rest.NewHandler[person](nil, "/person", nil)
+	it.Ok(t).IfNotNil(err)
+
+	_, err = rest.NewHandler(mem.Must(mem.New[person]("mem:///person", nil)), "/person?limit=x", nil)
+	it.Ok(t).IfNotNil(err)
+}
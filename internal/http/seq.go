@@ -0,0 +1,70 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file declares sequence type (traversal) for REST storage
+//
+
+package http
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/fogfish/curie"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/pager"
+)
+
+func newSeq[T dynamo.Thing](
+	ctx context.Context,
+	db *Storage[T],
+	hashKey, prefix string,
+	err error,
+) *pager.Seq[T] {
+	if err != nil {
+		return pager.New[T](ctx, nil, nil, err)
+	}
+
+	query := func(ctx context.Context, cursor *string, reverse bool, n int) ([]T, *string, error) {
+		return db.query(ctx, hashKey, prefix, cursor, reverse, n)
+	}
+
+	return pager.New(ctx, query, position(hashKey), nil)
+}
+
+// position is the continuation query, the value is the hash key of partition
+type position string
+
+// Cursor of the continuation, the state of cursor is the token of server
+func (hashKey position) Cursor(continuation string) dynamo.Thing {
+	query, _ := url.ParseQuery(continuation)
+	token := query.Get("cursor")
+
+	// Note: the token is opaque, the signature of server is not verified
+	if c, err := dynamo.DecodeCursor(token, nil); err == nil {
+		return dynamo.NewCursor(c.HashKey(), c.SortKey(), []byte(token))
+	}
+	return dynamo.NewCursor(curie.IRI(hashKey), "", []byte(token))
+}
+
+// Start continues from the cursor issued by server or from the plain key,
+// the plain key is unsigned cursor that is accepted by servers without secret
+func (hashKey position) Start(key dynamo.Thing) *string {
+	if key.HashKey() == "" {
+		return nil
+	}
+
+	token := dynamo.NewCursor(key.HashKey(), key.SortKey(), nil).Encode(nil)
+	if c, ok := key.(*dynamo.Cursor); ok && len(c.State()) != 0 {
+		token = string(c.State())
+	}
+
+	continuation := url.Values{"cursor": {token}}.Encode()
+	return &continuation
+}
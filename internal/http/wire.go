@@ -0,0 +1,187 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file declares wire protocol of key/value over REST
+//
+
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/holmes89/dynamo"
+	constrain "github.com/holmes89/dynamo/internal/constraint"
+)
+
+/*
+Page is the wire format of the sequence page. The cursor is the token
+of dynamo.Cursor, it is omitted at the end of sequence.
+*/
+type Page[T any] struct {
+	Items  []T    `json:"items"`
+	Cursor string `json:"cursor,omitempty"`
+}
+
+/*
+Problem is the wire format of errors. Flags of pre-condition failures
+follows error behaviors of the library.
+*/
+type Problem struct {
+	Status   int    `json:"status"`
+	Title    string `json:"title"`
+	Conflict bool   `json:"conflict,omitempty"`
+	Gone     bool   `json:"gone,omitempty"`
+}
+
+func (p *Problem) Error() string {
+	return fmt.Sprintf("%d %s", p.Status, p.Title)
+}
+
+// PathOf the item, the absent sort key is `_`
+func PathOf(hashKey, sortKey string) string {
+	if sortKey == "" {
+		sortKey = "_"
+	}
+
+	return "/" + url.PathEscape(hashKey) + "/" + url.PathEscape(sortKey)
+}
+
+// names of operations at query parameters
+var (
+	opToWire = map[string]string{
+		"=":                    "eq",
+		"<>":                   "ne",
+		"<":                    "lt",
+		"<=":                   "le",
+		">":                    "gt",
+		">=":                   "ge",
+		"attribute_exists":     "exists",
+		"attribute_not_exists": "not_exists",
+	}
+	opFromWire = map[string]string{}
+)
+
+func init() {
+	for op, wire := range opToWire {
+		opFromWire[wire] = op
+	}
+}
+
+/*
+EncodeConstraints translates constraints into the request. Existence of
+the hash key attribute is the existence of the item, it is expressed
+with conditional headers `If-Match: *` and `If-None-Match: *`. Other
+constraints are query parameters `if=op:attribute[:json value]`. It fails
+if constraint is not supported by the protocol (e.g. http headers of objects).
+*/
+func EncodeConstraints[T dynamo.Thing](
+	hashKey string,
+	config []dynamo.Constraint[T],
+	query url.Values,
+	header http.Header,
+) error {
+	for _, c := range config {
+		switch op := c.(type) {
+		case *constrain.Unary[T]:
+			if op.Key == "" {
+				continue
+			}
+
+			if _, has := opToWire[op.Op]; !has {
+				return fmt.Errorf("unsupported constraint %s(%s)", op.Op, op.Key)
+			}
+
+			switch {
+			case op.Key == hashKey && op.Op == "attribute_exists":
+				header.Set("If-Match", "*")
+			case op.Key == hashKey && op.Op == "attribute_not_exists":
+				header.Set("If-None-Match", "*")
+			default:
+				query.Add("if", opToWire[op.Op]+":"+op.Key)
+			}
+		case *constrain.Dyadic[T]:
+			if op.Key == "" {
+				continue
+			}
+
+			if _, has := opToWire[op.Op]; !has {
+				return fmt.Errorf("unsupported constraint %s %s", op.Key, op.Op)
+			}
+
+			val, err := json.Marshal(op.Val)
+			if err != nil {
+				return err
+			}
+
+			query.Add("if", opToWire[op.Op]+":"+op.Key+":"+string(val))
+		}
+	}
+
+	return nil
+}
+
+/*
+DecodeConstraints parses constraints from the request, it is the inverse
+of EncodeConstraints. Entity tags are not supported by conditional headers.
+*/
+func DecodeConstraints[T dynamo.Thing](
+	hashKey string,
+	query url.Values,
+	header http.Header,
+) ([]dynamo.Constraint[T], error) {
+	seq := make([]dynamo.Constraint[T], 0)
+
+	switch tag := header.Get("If-Match"); tag {
+	case "":
+	case "*":
+		seq = append(seq, &constrain.Unary[T]{Op: "attribute_exists", Key: hashKey})
+	default:
+		return nil, fmt.Errorf("entity tags are not supported: If-Match %s", tag)
+	}
+
+	switch tag := header.Get("If-None-Match"); tag {
+	case "":
+	case "*":
+		seq = append(seq, &constrain.Unary[T]{Op: "attribute_not_exists", Key: hashKey})
+	default:
+		return nil, fmt.Errorf("entity tags are not supported: If-None-Match %s", tag)
+	}
+
+	for _, spec := range query["if"] {
+		wire, spec, _ := strings.Cut(spec, ":")
+		key, val, hasVal := strings.Cut(spec, ":")
+
+		op, has := opFromWire[wire]
+		if !has || key == "" {
+			return nil, fmt.Errorf("invalid constraint: %s", spec)
+		}
+
+		if op == "attribute_exists" || op == "attribute_not_exists" {
+			seq = append(seq, &constrain.Unary[T]{Op: op, Key: key})
+			continue
+		}
+
+		if !hasVal {
+			return nil, fmt.Errorf("invalid constraint, value is missing: %s", spec)
+		}
+
+		var lit any
+		if err := json.Unmarshal([]byte(val), &lit); err != nil {
+			return nil, fmt.Errorf("invalid constraint value %s: %w", spec, err)
+		}
+
+		seq = append(seq, &constrain.Dyadic[T]{Op: op, Key: key, Val: lit})
+	}
+
+	return seq, nil
+}
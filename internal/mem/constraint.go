@@ -0,0 +1,189 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file implements evaluation of constraints over in-memory items
+//
+
+package mem
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/holmes89/dynamo"
+	constrain "github.com/holmes89/dynamo/internal/constraint"
+)
+
+/*
+Check evaluates constraints over the item, constraints are joined with
+logical and. It returns the failed constraint or nil. The absent item
+is evaluated as an item without attributes.
+*/
+func Check[T dynamo.Thing](
+	item map[string]types.AttributeValue,
+	config []dynamo.Constraint[T],
+) dynamo.Constraint[T] {
+	for _, c := range config {
+		if !eval(item, c) {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// comparators and functions of constraints supported by key-value storages
+var (
+	comparators = map[string]struct{}{"=": {}, "<>": {}, "<": {}, "<=": {}, ">": {}, ">=": {}}
+	functions   = map[string]struct{}{"attribute_exists": {}, "attribute_not_exists": {}}
+)
+
+/*
+Supported fails if any constraint is not supported by key-value storages,
+e.g. http headers of objects. The check follows DynamoDB storage, which
+rejects constraints that cannot be translated to condition expression.
+*/
+func Supported[T dynamo.Thing](config []dynamo.Constraint[T]) error {
+	for _, c := range config {
+		switch op := c.(type) {
+		case *constrain.Unary[T]:
+			if _, has := functions[op.Op]; op.Key != "" && !has {
+				return fmt.Errorf("unsupported constraint %s(%s)", op.Op, op.Key)
+			}
+		case *constrain.Dyadic[T]:
+			if _, has := comparators[op.Op]; op.Key != "" && !has {
+				return fmt.Errorf("unsupported constraint %s %s", op.Key, op.Op)
+			}
+		}
+	}
+
+	return nil
+}
+
+func eval[T dynamo.Thing](item map[string]types.AttributeValue, c dynamo.Constraint[T]) bool {
+	switch op := c.(type) {
+	case *constrain.Unary[T]:
+		if op.Key == "" {
+			return true
+		}
+
+		_, has := item[op.Key]
+		switch op.Op {
+		case "attribute_exists":
+			return has
+		case "attribute_not_exists":
+			return !has
+		}
+	case *constrain.Dyadic[T]:
+		if op.Key == "" {
+			return true
+		}
+
+		lit, err := attributevalue.Marshal(op.Val)
+		if err != nil {
+			return false
+		}
+
+		// Note: comparison with undefined attribute is always false
+		val, has := item[op.Key]
+		if !has {
+			return false
+		}
+
+		return compareOp(op.Op, val, lit)
+	}
+
+	return true
+}
+
+func compareOp(op string, a, b types.AttributeValue) bool {
+	switch op {
+	case "=":
+		return equal(a, b)
+	case "<>":
+		return !equal(a, b)
+	}
+
+	c, ok := compare(a, b)
+	if !ok {
+		return false
+	}
+
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	default:
+		return false
+	}
+}
+
+func equal(a, b types.AttributeValue) bool {
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// compare ordered values of same type: strings, numbers and binaries
+func compare(a, b types.AttributeValue) (int, bool) {
+	switch x := a.(type) {
+	case *types.AttributeValueMemberS:
+		if y, ok := b.(*types.AttributeValueMemberS); ok {
+			return strings.Compare(x.Value, y.Value), true
+		}
+	case *types.AttributeValueMemberN:
+		if y, ok := b.(*types.AttributeValueMemberN); ok {
+			xn, okx := new(big.Float).SetString(x.Value)
+			yn, oky := new(big.Float).SetString(y.Value)
+			if okx && oky {
+				return xn.Cmp(yn), true
+			}
+		}
+	case *types.AttributeValueMemberB:
+		if y, ok := b.(*types.AttributeValueMemberB); ok {
+			return bytes.Compare(x.Value, y.Value), true
+		}
+	}
+
+	return 0, false
+}
+
+/*
+PreCondition builds the error for failed constraint. Flags of the error
+follows DynamoDB storage: equality and non-existence are conflicts,
+inequality and existence are gone.
+*/
+func PreCondition[T dynamo.Thing](thing T, c dynamo.Constraint[T]) error {
+	var op, key string
+	switch v := c.(type) {
+	case *constrain.Unary[T]:
+		op, key = v.Op, v.Key
+	case *constrain.Dyadic[T]:
+		op, key = v.Op, v.Key
+	}
+
+	return errPreConditionFailed(
+		fmt.Errorf("condition %s on %s failed", op, key),
+		thing,
+		op == "attribute_not_exists" || strings.Contains(op, "="),
+		op == "attribute_exists" || op == "<>",
+	)
+}
@@ -0,0 +1,314 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file declares key/value interface for in-memory storage
+//
+
+package mem
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+)
+
+/*
+Table is in-memory table, items are partitioned by hash key and ordered
+by sort key. The table is shared by storages of different types
+(single table design).
+*/
+type Table struct {
+	sync.RWMutex
+	items map[string]map[string]map[string]types.AttributeValue
+}
+
+// NewTable creates empty in-memory table
+func NewTable() *Table {
+	return &Table{
+		items: map[string]map[string]map[string]types.AttributeValue{},
+	}
+}
+
+var (
+	tables   = map[string]*Table{}
+	tablesMu sync.Mutex
+)
+
+// Lookup the process wide in-memory table by name, the table is created on demand
+func Lookup(name string) *Table {
+	tablesMu.Lock()
+	defer tablesMu.Unlock()
+
+	table, has := tables[name]
+	if !has {
+		table = NewTable()
+		tables[name] = table
+	}
+
+	return table
+}
+
+func (t *Table) get(hashKey, sortKey string) map[string]types.AttributeValue {
+	return t.items[hashKey][sortKey]
+}
+
+func (t *Table) put(hashKey, sortKey string, item map[string]types.AttributeValue) {
+	part, has := t.items[hashKey]
+	if !has {
+		part = map[string]map[string]types.AttributeValue{}
+		t.items[hashKey] = part
+	}
+	part[sortKey] = item
+}
+
+func (t *Table) remove(hashKey, sortKey string) {
+	part, has := t.items[hashKey]
+	if !has {
+		return
+	}
+
+	delete(part, sortKey)
+	if len(part) == 0 {
+		delete(t.items, hashKey)
+	}
+}
+
+/*
+query items of partition with sort key prefix, ordered by sort key.
+Items after the exclusive start key are returned, limit 0 is unbound.
+It returns the sort key of last item if more items remains.
+*/
+func (t *Table) query(
+	hashKey, prefix string,
+	start *string,
+	reverse bool,
+	limit int,
+) ([]map[string]types.AttributeValue, *string) {
+	t.RLock()
+	defer t.RUnlock()
+
+	part := t.items[hashKey]
+	keys := make([]string, 0, len(part))
+	for k := range part {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if start != nil && ((!reverse && k <= *start) || (reverse && k >= *start)) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	if reverse {
+		for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+	}
+
+	var last *string
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		last = &keys[limit-1]
+	}
+
+	items := make([]map[string]types.AttributeValue, len(keys))
+	for i, k := range keys {
+		items[i] = part[k]
+	}
+
+	return items, last
+}
+
+/*
+Storage is in-memory handler of key/value I/O, it mirrors semantic of
+DynamoDB storage.
+*/
+type Storage[T dynamo.Thing] struct {
+	Table     *Table
+	Codec     *ddb.Codec[T]
+	undefined T
+}
+
+//-----------------------------------------------------------------------------
+//
+// Key Value
+//
+//-----------------------------------------------------------------------------
+
+func keyOf(thing dynamo.Thing) (string, string) {
+	sortKey := string(thing.SortKey())
+	if sortKey == "" {
+		sortKey = "_"
+	}
+
+	return string(thing.HashKey()), sortKey
+}
+
+// Get item from storage
+func (db *Storage[T]) Get(ctx context.Context, key T) (T, error) {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return db.undefined, errInvalidKey(err)
+	}
+
+	db.Table.RLock()
+	val := db.Table.get(keyOf(key))
+	db.Table.RUnlock()
+
+	if val == nil {
+		return db.undefined, errNotFound(nil, key)
+	}
+
+	obj, err := db.Codec.Decode(val)
+	if err != nil {
+		return db.undefined, errInvalidEntity(err)
+	}
+
+	return obj, nil
+}
+
+// Put writes entity
+func (db *Storage[T]) Put(ctx context.Context, entity T, config ...dynamo.Constraint[T]) error {
+	if _, err := db.Codec.EncodeKey(entity); err != nil {
+		return errInvalidKey(err)
+	}
+
+	gen, err := db.Codec.Encode(entity)
+	if err != nil {
+		return errInvalidEntity(err)
+	}
+
+	if err := Supported(config); err != nil {
+		return errInvalidEntity(err)
+	}
+
+	hashKey, sortKey := keyOf(entity)
+
+	db.Table.Lock()
+	defer db.Table.Unlock()
+
+	if c := Check(db.Table.get(hashKey, sortKey), config); c != nil {
+		return PreCondition(entity, c)
+	}
+
+	db.Table.put(hashKey, sortKey, gen)
+	return nil
+}
+
+// Remove discards the entity from the table
+func (db *Storage[T]) Remove(ctx context.Context, key T, config ...dynamo.Constraint[T]) error {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return errInvalidKey(err)
+	}
+
+	if err := Supported(config); err != nil {
+		return errInvalidEntity(err)
+	}
+
+	hashKey, sortKey := keyOf(key)
+
+	db.Table.Lock()
+	defer db.Table.Unlock()
+
+	if c := Check(db.Table.get(hashKey, sortKey), config); c != nil {
+		return PreCondition(key, c)
+	}
+
+	db.Table.remove(hashKey, sortKey)
+	return nil
+}
+
+// Update applies a partial patch to entity and returns new values
+func (db *Storage[T]) Update(ctx context.Context, entity T, config ...dynamo.Constraint[T]) (T, error) {
+	if _, err := db.Codec.EncodeKey(entity); err != nil {
+		return db.undefined, errInvalidKey(err)
+	}
+
+	gen, err := db.Codec.Encode(entity)
+	if err != nil {
+		return db.undefined, errInvalidEntity(err)
+	}
+
+	if err := Supported(config); err != nil {
+		return db.undefined, errInvalidEntity(err)
+	}
+
+	hashKey, sortKey := keyOf(entity)
+
+	db.Table.Lock()
+	defer db.Table.Unlock()
+
+	val := db.Table.get(hashKey, sortKey)
+	if c := Check(val, config); c != nil {
+		return db.undefined, PreCondition(entity, c)
+	}
+
+	// Note: the item is replaced, stored items are never mutated
+	item := make(map[string]types.AttributeValue, len(val)+len(gen))
+	for k, v := range val {
+		item[k] = v
+	}
+	for k, v := range gen {
+		item[k] = v
+	}
+
+	obj, err := db.Codec.Decode(item)
+	if err != nil {
+		return db.undefined, errInvalidEntity(err)
+	}
+
+	db.Table.put(hashKey, sortKey, item)
+	return obj, nil
+}
+
+// Match applies a pattern matching to elements in the table
+func (db *Storage[T]) Match(ctx context.Context, key T) dynamo.Seq[T] {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return newSeq(ctx, db, "", "", errInvalidKey(err))
+	}
+
+	hashKey, prefix := keyOf(key)
+	if prefix == "_" {
+		prefix = ""
+	}
+
+	return newSeq(ctx, db, hashKey, prefix, nil)
+}
+
+// Count number of elements matching the pattern and filters
+func (db *Storage[T]) Count(ctx context.Context, key T, filters ...dynamo.Constraint[T]) (int, error) {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return 0, errInvalidKey(err)
+	}
+
+	if err := Supported(filters); err != nil {
+		return 0, errInvalidEntity(err)
+	}
+
+	hashKey, prefix := keyOf(key)
+	if prefix == "_" {
+		prefix = ""
+	}
+
+	items, _ := db.Table.query(hashKey, prefix, nil, false, 0)
+
+	count := 0
+	for _, item := range items {
+		if Check(item, filters) == nil {
+			count++
+		}
+	}
+
+	return count, nil
+}
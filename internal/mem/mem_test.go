@@ -0,0 +1,56 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package mem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fogfish/curie"
+	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/dynamotest"
+	"github.com/holmes89/dynamo/service/mem"
+)
+
+type person struct {
+	Prefix curie.IRI `dynamodbav:"prefix,omitempty"`
+	Suffix curie.IRI `dynamodbav:"suffix,omitempty"`
+	Name   string    `dynamodbav:"name,omitempty"`
+}
+
+func (p person) HashKey() curie.IRI { return p.Prefix }
+func (p person) SortKey() curie.IRI { return p.Suffix }
+
+func TestStorage(t *testing.T) {
+	dynamotest.TestStorage(t, func() dynamo.KeyVal[dynamotest.Person] {
+		return mem.Must(mem.New[dynamotest.Person]("mem:///test", mem.NewTable()))
+	})
+}
+
+func TestConstraintsConjunction(t *testing.T) {
+	dynamotest.TestConstraints(t, func() dynamo.KeyVal[dynamotest.Person] {
+		return mem.Must(mem.New[dynamotest.Person]("mem:///test", mem.NewTable()))
+	})
+}
+
+func TestSharedTable(t *testing.T) {
+	a := mem.Must(mem.New[person]("mem:///shared", nil))
+	b := mem.Must(mem.New[person]("mem:///shared", nil))
+
+	it.Ok(t).IfNil(a.Put(context.Background(), person{Prefix: "org:a", Name: "a"}))
+
+	val, err := b.Get(context.Background(), person{Prefix: "org:a"})
+	it.Ok(t).
+		IfNil(err).
+		If(val.Name).Equal("a")
+
+	_, err = mem.New[person]("mem://", nil)
+	it.Ok(t).IfNotNil(err)
+}
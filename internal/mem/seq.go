@@ -0,0 +1,48 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file declares sequence type (traversal) for in-memory storage
+//
+
+package mem
+
+import (
+	"context"
+
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/pager"
+)
+
+func newSeq[T dynamo.Thing](
+	ctx context.Context,
+	db *Storage[T],
+	hashKey, prefix string,
+	err error,
+) *pager.Seq[T] {
+	if err != nil {
+		return pager.New[T](ctx, nil, nil, err)
+	}
+
+	query := func(ctx context.Context, start *string, reverse bool, n int) ([]T, *string, error) {
+		heap, last := db.Table.query(hashKey, prefix, start, reverse, n)
+
+		items := make([]T, len(heap))
+		for i, x := range heap {
+			item, err := db.Codec.Decode(x)
+			if err != nil {
+				return nil, nil, errInvalidEntity(err)
+			}
+			items[i] = item
+		}
+
+		return items, last, nil
+	}
+
+	return pager.New(ctx, query, pager.SortKey(hashKey), nil)
+}
@@ -0,0 +1,297 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+/*
+Package pager implements sequence type (traversal) for storages that fetch
+partitions page by page after the exclusive start position, e.g. in-memory,
+file system, bbolt, sql and REST storages.
+*/
+package pager
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"runtime"
+
+	"github.com/fogfish/curie"
+	"github.com/holmes89/dynamo"
+)
+
+/*
+Query fetches the page of partition that follows the exclusive start
+position, the page is limited to n items if n is positive. It returns the
+position of the last item if more items remain.
+*/
+type Query[T any] func(ctx context.Context, start *string, reverse bool, n int) ([]T, *string, error)
+
+/*
+Position translates the exclusive start position of storage to the cursor
+and the continuation key back to the position.
+*/
+type Position interface {
+	Cursor(start string) dynamo.Thing
+	Start(key dynamo.Thing) *string
+}
+
+/*
+SortKey is the position within partition of storages ordered by sort key,
+the value is the hash key of partition.
+*/
+type SortKey string
+
+func (hashKey SortKey) Cursor(start string) dynamo.Thing {
+	return dynamo.NewCursor(curie.IRI(hashKey), curie.IRI(start), nil)
+}
+
+func (hashKey SortKey) Start(key dynamo.Thing) *string {
+	if key.HashKey() == "" {
+		return nil
+	}
+
+	sortKey := string(key.SortKey())
+	if sortKey == "" {
+		sortKey = "_"
+	}
+	return &sortKey
+}
+
+// Seq is an iterator over matched results
+type Seq[T dynamo.Thing] struct {
+	ctx      context.Context
+	query    Query[T]
+	position Position
+	limit    int
+	reverse  bool
+	// start is the exclusive start position of the next page
+	start  *string
+	heap   []T
+	head   int
+	seeded bool
+	stream bool
+	err    error
+}
+
+// New creates sequence over pages of the query, the sequence fails with err if it is defined
+func New[T dynamo.Thing](ctx context.Context, query Query[T], position Position, err error) *Seq[T] {
+	return &Seq[T]{
+		ctx:      ctx,
+		query:    query,
+		position: position,
+		stream:   true,
+		err:      err,
+	}
+}
+
+func (seq *Seq[T]) maybeSeed() error {
+	if !seq.stream {
+		return errEndOfStream()
+	}
+
+	return seq.seed()
+}
+
+func (seq *Seq[T]) seed() error {
+	if seq.seeded && seq.start == nil {
+		return errEndOfStream()
+	}
+
+	if err := seq.ctx.Err(); err != nil {
+		seq.err = err
+		return err
+	}
+
+	heap, last, err := seq.query(seq.ctx, seq.start, seq.reverse, seq.limit)
+	if err != nil {
+		seq.err = err
+		return err
+	}
+	seq.seeded = true
+	seq.start = last
+
+	if len(heap) == 0 {
+		return errEndOfStream()
+	}
+
+	seq.heap = heap
+	seq.head = 0
+
+	return nil
+}
+
+// FMap transforms sequence
+func (seq *Seq[T]) FMap(f func(T) error) error {
+	for seq.Tail() {
+		head, err := seq.Head()
+		if err != nil {
+			return err
+		}
+
+		if err := f(head); err != nil {
+			return errProcessEntity(err, head)
+		}
+	}
+	return seq.err
+}
+
+// All iterates over elements of sequence
+func (seq *Seq[T]) All() iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for page, err := range seq.Pages() {
+			if err != nil {
+				var none T
+				yield(none, err)
+				return
+			}
+
+			for _, item := range page.Items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Pages iterates over pages of sequence
+func (seq *Seq[T]) Pages() iter.Seq2[dynamo.Page[T], error] {
+	return func(yield func(dynamo.Page[T], error) bool) {
+		if seq.err != nil {
+			yield(dynamo.Page[T]{}, seq.err)
+			return
+		}
+
+		for {
+			if err := seq.seed(); err != nil {
+				if seq.err != nil {
+					yield(dynamo.Page[T]{}, err)
+				}
+				return
+			}
+
+			page := dynamo.Page[T]{
+				Items:        seq.heap,
+				Count:        len(seq.heap),
+				ScannedCount: len(seq.heap),
+				Cursor:       seq.Cursor(),
+			}
+
+			if !yield(page, nil) {
+				return
+			}
+
+			if !seq.stream {
+				return
+			}
+		}
+	}
+}
+
+// Head selects the first element of matched collection.
+func (seq *Seq[T]) Head() (T, error) {
+	var none T
+
+	if seq.err != nil {
+		return none, seq.err
+	}
+
+	if !seq.seeded {
+		if err := seq.seed(); err != nil {
+			return none, fmt.Errorf("can't seed head of stream: %w", err)
+		}
+	}
+
+	if seq.head < len(seq.heap) {
+		return seq.heap[seq.head], nil
+	}
+
+	return none, errEndOfStream()
+}
+
+// Tail selects the all elements except the first one
+func (seq *Seq[T]) Tail() bool {
+	switch {
+	case seq.err != nil:
+		return false
+	case !seq.seeded:
+		err := seq.seed()
+		return err == nil
+	default:
+		seq.head++
+		if seq.head < len(seq.heap) {
+			return true
+		}
+		err := seq.maybeSeed()
+		return err == nil
+	}
+}
+
+// Cursor is the global position in the sequence
+func (seq *Seq[T]) Cursor() dynamo.Thing {
+	if seq.start != nil {
+		return seq.position.Cursor(*seq.start)
+	}
+
+	return dynamo.NewCursor("", "", nil)
+}
+
+// Error indicates if any error appears during I/O
+func (seq *Seq[T]) Error() error {
+	return seq.err
+}
+
+// Limit sequence size to N elements, fetch a page of sequence
+func (seq *Seq[T]) Limit(n int) dynamo.Seq[T] {
+	seq.limit = n
+	seq.stream = false
+	return seq
+}
+
+// Continue limited sequence from the cursor
+func (seq *Seq[T]) Continue(key dynamo.Thing) dynamo.Seq[T] {
+	if seq.err != nil {
+		return seq
+	}
+
+	if start := seq.position.Start(key); start != nil {
+		seq.start = start
+	}
+	return seq
+}
+
+// Reverse order of sequence
+func (seq *Seq[T]) Reverse() dynamo.Seq[T] {
+	seq.reverse = true
+	return seq
+}
+
+//-----------------------------------------------------------------------------
+//
+// Errors
+//
+//-----------------------------------------------------------------------------
+
+func errProcessEntity(err error, thing dynamo.Thing) error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] can't process (%s, %s) : %w", name, thing.HashKey(), thing.SortKey(), err)
+}
+
+func errEndOfStream() error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] end of stream", name)
+}
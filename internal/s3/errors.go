@@ -74,6 +74,16 @@ func (e *notFound) NotFound() string {
 	return e.HashKey().Safe() + " " + e.SortKey().Safe()
 }
 
+func errNotSupported(feature string) error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] not supported: %s", name, feature)
+}
+
 func errEndOfStream() error {
 	var name string
 
@@ -148,3 +148,30 @@ func (db *Storage[T]) Match(ctx context.Context, key T) dynamo.Seq[T] {
 
 	return newSeq(ctx, db, req, nil)
 }
+
+// Count number of elements matching the pattern, filters are not supported
+func (db *Storage[T]) Count(ctx context.Context, key T, filters ...dynamo.Constraint[T]) (int, error) {
+	if len(filters) != 0 {
+		return 0, errNotSupported("filters")
+	}
+
+	req := &s3.ListObjectsV2Input{
+		Bucket:  db.Bucket,
+		MaxKeys: 1000,
+		Prefix:  aws.String(db.Codec.EncodeKey(key)),
+	}
+
+	count := 0
+	for {
+		val, err := db.Service.ListObjectsV2(ctx, req)
+		if err != nil {
+			return 0, errServiceIO(err)
+		}
+
+		count += int(val.KeyCount)
+		if val.NextContinuationToken == nil {
+			return count, nil
+		}
+		req.ContinuationToken = val.NextContinuationToken
+	}
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/fogfish/curie"
 	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
 	"github.com/holmes89/dynamo/internal/dynamotest"
 	"github.com/holmes89/dynamo/internal/s3/s3test"
 )
@@ -88,3 +89,15 @@ func TestSeqS3Update(t *testing.T) {
 		If(err).Should().Equal(nil).
 		If(val).Should().Equal(valS)
 }
+
+func TestS3Count(t *testing.T) {
+	val := dynamotest.Person{Prefix: "dead:beef", Suffix: "1"}
+	key := dynamotest.Person{Prefix: "dead:beef"}
+	s3 := s3test.GetListObjects(&key, 5, &val, nil)
+
+	n, err := s3.(dynamo.KeyValCounter[dynamotest.Person]).Count(context.TODO(), key)
+
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(n).Should().Equal(5)
+}
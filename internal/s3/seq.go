@@ -16,6 +16,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"iter"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -23,10 +24,11 @@ import (
 	"github.com/holmes89/dynamo"
 )
 
-type cursor struct{ hashKey, sortKey string }
-
-func (c cursor) HashKey() curie.IRI { return curie.IRI(c.hashKey) }
-func (c cursor) SortKey() curie.IRI { return curie.IRI(c.sortKey) }
+// cursorState is the continuation state of ListObjectsV2
+type cursorState struct {
+	StartAfter        *string `json:"a,omitempty"`
+	ContinuationToken *string `json:"t,omitempty"`
+}
 
 // seq is an iterator over matched results
 type seq[T dynamo.Thing] struct {
@@ -88,10 +90,12 @@ func (seq *seq[T]) seed() error {
 	seq.items = items
 	if len(items) > 0 && val.NextContinuationToken != nil {
 		seq.q.StartAfter = items[len(items)-1]
+		seq.q.ContinuationToken = val.NextContinuationToken
 	}
 
 	if val.NextContinuationToken == nil {
 		seq.q.StartAfter = nil
+		seq.q.ContinuationToken = nil
 	}
 
 	return nil
@@ -112,6 +116,71 @@ func (seq *seq[T]) FMap(f func(T) error) error {
 	return seq.err
 }
 
+// All iterates over elements of sequence
+func (seq *seq[T]) All() iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for page, err := range seq.Pages() {
+			if err != nil {
+				yield(seq.db.undefined, err)
+				return
+			}
+
+			for _, item := range page.Items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Pages iterates over pages of sequence. Pages are queried with the context
+// of Match, the consumer stops the iteration between pages, the query
+// in-flight is bounded by the context of Match.
+func (seq *seq[T]) Pages() iter.Seq2[dynamo.Page[T], error] {
+	return func(yield func(dynamo.Page[T], error) bool) {
+		if seq.err != nil {
+			yield(dynamo.Page[T]{}, seq.err)
+			return
+		}
+
+		for {
+			if err := seq.seed(); err != nil {
+				if seq.err != nil {
+					yield(dynamo.Page[T]{}, err)
+				}
+				return
+			}
+
+			items := make([]T, len(seq.items))
+			for i, key := range seq.items {
+				item, err := seq.get(key)
+				if err != nil {
+					seq.err = err
+					yield(dynamo.Page[T]{}, err)
+					return
+				}
+				items[i] = item
+			}
+
+			page := dynamo.Page[T]{
+				Items:        items,
+				Count:        len(items),
+				ScannedCount: len(items),
+				Cursor:       seq.Cursor(),
+			}
+
+			if !yield(page, nil) {
+				return
+			}
+
+			if !seq.stream {
+				return
+			}
+		}
+	}
+}
+
 // Head selects the first element of matched collection.
 func (seq *seq[T]) Head() (T, error) {
 	if seq.items == nil {
@@ -121,9 +190,14 @@ func (seq *seq[T]) Head() (T, error) {
 		}
 	}
 
+	return seq.get(seq.items[seq.at])
+}
+
+// get fetches element of sequence
+func (seq *seq[T]) get(key *string) (T, error) {
 	req := &s3.GetObjectInput{
 		Bucket: seq.db.Bucket,
-		Key:    seq.items[seq.at],
+		Key:    key,
 	}
 	val, err := seq.db.Service.GetObject(seq.ctx, req)
 	if err != nil {
@@ -141,28 +215,38 @@ func (seq *seq[T]) Head() (T, error) {
 
 // Tail selects the all elements except the first one
 func (seq *seq[T]) Tail() bool {
-	seq.at++
-
 	switch {
 	case seq.err != nil:
 		return false
 	case seq.items == nil:
 		err := seq.seed()
 		return err == nil
-	case seq.err == nil && seq.at >= len(seq.items):
+	}
+
+	seq.at++
+
+	if seq.at >= len(seq.items) {
 		err := seq.maybeSeed()
 		return err == nil
-	default:
-		return true
 	}
+
+	return true
 }
 
 // Cursor is the global position in the sequence
 func (seq *seq[T]) Cursor() dynamo.Thing {
 	if seq.q.StartAfter != nil {
-		return &cursor{hashKey: *seq.q.StartAfter}
+		state, err := json.Marshal(cursorState{
+			StartAfter:        seq.q.StartAfter,
+			ContinuationToken: seq.q.ContinuationToken,
+		})
+		if err != nil {
+			state = nil
+		}
+
+		return dynamo.NewCursor(curie.IRI(*seq.q.StartAfter), "", state)
 	}
-	return &cursor{}
+	return dynamo.NewCursor("", "", nil)
 }
 
 // Error indicates if any error appears during I/O
@@ -179,6 +263,18 @@ func (seq *seq[T]) Limit(n int) dynamo.Seq[T] {
 
 // Continue limited sequence from the cursor
 func (seq *seq[T]) Continue(key dynamo.Thing) dynamo.Seq[T] {
+	if cursor, ok := key.(*dynamo.Cursor); ok && len(cursor.State()) != 0 {
+		var state cursorState
+		if err := json.Unmarshal(cursor.State(), &state); err != nil {
+			seq.err = errInvalidEntity(err)
+			return seq
+		}
+
+		seq.q.StartAfter = state.StartAfter
+		seq.q.ContinuationToken = state.ContinuationToken
+		return seq
+	}
+
 	// Note: s3 cursor supports only HashKey
 	prefix := key.HashKey()
 
@@ -0,0 +1,191 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file implements SQL dialects
+//
+
+package sql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+Dialect abstracts differences of SQL databases: schema of the table,
+placeholders, pattern matching and access to JSON documents.
+Queries are built with `?` placeholders, the dialect rebinds them.
+*/
+type Dialect interface {
+	// schema of the table
+	schema(table string) string
+	// bind rewrites placeholders of the query
+	bind(query string) string
+	// prefix is the clause that matches sort key with the pattern
+	prefix() string
+	// pattern of the sort key prefix
+	pattern(prefix string) string
+	// compare builds the predicate over the attribute of JSON document
+	compare(doc, op, path string, val any) (string, []any, error)
+	// exists builds the predicate that checks presence of the attribute
+	exists(doc, path string, has bool) (string, []any)
+}
+
+// DialectOf the database given by the connector scheme
+func DialectOf(scheme string) (Dialect, error) {
+	switch scheme {
+	case "sqlite", "sqlite3":
+		return sqlite{}, nil
+	case "postgres", "postgresql":
+		return postgres{}, nil
+	default:
+		return nil, fmt.Errorf("dialect %s is not supported", scheme)
+	}
+}
+
+//-----------------------------------------------------------------------------
+//
+// SQLite
+//
+//-----------------------------------------------------------------------------
+
+type sqlite struct{}
+
+func (sqlite) schema(table string) string {
+	return "CREATE TABLE IF NOT EXISTS " + table + ` (
+		hash_key TEXT NOT NULL,
+		sort_key TEXT NOT NULL,
+		doc      TEXT NOT NULL,
+		PRIMARY KEY (hash_key, sort_key)
+	)`
+}
+
+func (sqlite) bind(query string) string { return query }
+
+// Note: LIKE is case-insensitive in SQLite, GLOB is used instead
+func (sqlite) prefix() string { return "sort_key GLOB ?" }
+
+func (sqlite) pattern(prefix string) string {
+	r := strings.NewReplacer("*", "[*]", "?", "[?]", "[", "[[]")
+	return r.Replace(prefix) + "*"
+}
+
+func (sqlite) path(path string) string {
+	return `$."` + strings.ReplaceAll(path, `"`, `\"`) + `"`
+}
+
+func (d sqlite) compare(doc, op, path string, val any) (string, []any, error) {
+	arg, err := d.value(val)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return "json_extract(" + doc + ", ?) " + op + " ?", []any{d.path(path), arg}, nil
+}
+
+func (d sqlite) exists(doc, path string, has bool) (string, []any) {
+	if has {
+		return "json_type(" + doc + ", ?) IS NOT NULL", []any{d.path(path)}
+	}
+	return "json_type(" + doc + ", ?) IS NULL", []any{d.path(path)}
+}
+
+// value is converted to SQL value as it is returned by json_extract
+func (sqlite) value(val any) (any, error) {
+	buf, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+
+	var x any
+	if err := dec.Decode(&x); err != nil {
+		return nil, err
+	}
+
+	switch v := x.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return v, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case json.Number:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return n, nil
+		}
+		return v.Float64()
+	default:
+		// Note: objects and arrays are extracted as minified JSON text
+		return string(buf), nil
+	}
+}
+
+//-----------------------------------------------------------------------------
+//
+// PostgreSQL
+//
+//-----------------------------------------------------------------------------
+
+type postgres struct{}
+
+// Note: sort keys are ordered by bytes as in other storages
+func (postgres) schema(table string) string {
+	return "CREATE TABLE IF NOT EXISTS " + table + ` (
+		hash_key TEXT NOT NULL,
+		sort_key TEXT COLLATE "C" NOT NULL,
+		doc      JSONB NOT NULL,
+		PRIMARY KEY (hash_key, sort_key)
+	)`
+}
+
+func (postgres) bind(query string) string {
+	var sb strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+func (postgres) prefix() string { return `sort_key LIKE ? ESCAPE '\'` }
+
+func (postgres) pattern(prefix string) string {
+	r := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return r.Replace(prefix) + "%"
+}
+
+func (postgres) compare(doc, op, path string, val any) (string, []any, error) {
+	arg, err := json.Marshal(val)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return "(" + doc + " -> ?::text) " + op + " ?::jsonb", []any{path, string(arg)}, nil
+}
+
+func (postgres) exists(doc, path string, has bool) (string, []any) {
+	if has {
+		return "jsonb_exists(" + doc + ", ?::text)", []any{path}
+	}
+	return "NOT jsonb_exists(" + doc + ", ?::text)", []any{path}
+}
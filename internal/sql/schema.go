@@ -0,0 +1,109 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file implements translation of constraints into WHERE clauses
+//
+
+package sql
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/fogfish/golem/pure/hseq"
+	"github.com/holmes89/dynamo"
+	constrain "github.com/holmes89/dynamo/internal/constraint"
+)
+
+/*
+Schema maps attributes of constraints to paths of JSON documents.
+Constraints refer attributes by dynamodbav tags, documents are encoded
+with json tags.
+*/
+type Schema[T dynamo.Thing] struct {
+	paths map[string]string
+}
+
+func NewSchema[T dynamo.Thing]() *Schema[T] {
+	paths := map[string]string{}
+
+	// Note: types other than struct (e.g. raw items) are stored as is
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return &Schema[T]{paths: paths}
+	}
+
+	for _, f := range hseq.Generic[T]() {
+		attr := tagName(f.Tag.Get("dynamodbav"), f.Name)
+		path := tagName(f.Tag.Get("json"), f.Name)
+		if attr != "-" && path != "-" {
+			paths[attr] = path
+		}
+	}
+
+	return &Schema[T]{paths: paths}
+}
+
+func tagName(tag, name string) string {
+	if tag = strings.Split(tag, ",")[0]; tag != "" {
+		return tag
+	}
+	return name
+}
+
+// path of the attribute at JSON document
+func (schema Schema[T]) path(attr string) string {
+	if path, has := schema.paths[attr]; has {
+		return path
+	}
+	return attr
+}
+
+/*
+where builds the conjunction of constraints over the document column.
+It returns empty clause if there are no constraints, constraints are
+validated by mem.Supported before.
+*/
+func (schema Schema[T]) where(
+	dialect Dialect,
+	doc string,
+	config []dynamo.Constraint[T],
+) (string, []any, error) {
+	clauses := make([]string, 0, len(config))
+	args := make([]any, 0)
+
+	for _, c := range config {
+		switch op := c.(type) {
+		case *constrain.Unary[T]:
+			if op.Key == "" {
+				continue
+			}
+
+			clause, arg := dialect.exists(doc, schema.path(op.Key), op.Op == "attribute_exists")
+			clauses = append(clauses, clause)
+			args = append(args, arg...)
+		case *constrain.Dyadic[T]:
+			if op.Key == "" {
+				continue
+			}
+
+			clause, arg, err := dialect.compare(doc, op.Op, schema.path(op.Key), op.Val)
+			if err != nil {
+				return "", nil, err
+			}
+			clauses = append(clauses, clause)
+			args = append(args, arg...)
+		}
+	}
+
+	return strings.Join(clauses, " AND "), args, nil
+}
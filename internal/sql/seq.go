@@ -0,0 +1,37 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file declares sequence type (traversal) for sql storage
+//
+
+package sql
+
+import (
+	"context"
+
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/pager"
+)
+
+func newSeq[T dynamo.Thing](
+	ctx context.Context,
+	db *Storage[T],
+	hashKey, prefix string,
+	err error,
+) *pager.Seq[T] {
+	if err != nil {
+		return pager.New[T](ctx, nil, nil, err)
+	}
+
+	query := func(ctx context.Context, start *string, reverse bool, n int) ([]T, *string, error) {
+		return db.query(ctx, hashKey, prefix, start, reverse, n)
+	}
+
+	return pager.New(ctx, query, pager.SortKey(hashKey), nil)
+}
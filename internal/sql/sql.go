@@ -0,0 +1,483 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file declares key/value interface for sql databases
+//
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+	"github.com/holmes89/dynamo/internal/mem"
+)
+
+/*
+Storage is sql handler of key/value I/O. Entities are rows of the table
+(hash_key, sort_key, doc), where doc is JSON document. Constraints are
+translated to WHERE clauses over the document.
+*/
+type Storage[T dynamo.Thing] struct {
+	DB        *sql.DB
+	Table     string
+	Dialect   Dialect
+	Codec     *ddb.Codec[T]
+	Schema    *Schema[T]
+	undefined T
+}
+
+// CreateTable creates the table if it does not exist
+func (db *Storage[T]) CreateTable(ctx context.Context) error {
+	if _, err := db.DB.ExecContext(ctx, db.Dialect.schema(db.Table)); err != nil {
+		return errServiceIO(err)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+//
+// Layout
+//
+//-----------------------------------------------------------------------------
+
+func keyOf(thing dynamo.Thing) (string, string) {
+	sortKey := string(thing.SortKey())
+	if sortKey == "" {
+		sortKey = "_"
+	}
+
+	return string(thing.HashKey()), sortKey
+}
+
+func (db *Storage[T]) exec(ctx context.Context, query string, args ...any) (int64, error) {
+	val, err := db.DB.ExecContext(ctx, db.Dialect.bind(query), args...)
+	if err != nil {
+		return 0, errServiceIO(err)
+	}
+
+	n, err := val.RowsAffected()
+	if err != nil {
+		return 0, errServiceIO(err)
+	}
+
+	return n, nil
+}
+
+// read the document, nil is returned if the row does not exist
+func (db *Storage[T]) read(ctx context.Context, hashKey, sortKey string) ([]byte, error) {
+	var doc []byte
+	err := db.DB.QueryRowContext(ctx,
+		db.Dialect.bind("SELECT doc FROM "+db.Table+" WHERE hash_key = ? AND sort_key = ?"),
+		hashKey, sortKey,
+	).Scan(&doc)
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, nil
+	case err != nil:
+		return nil, errServiceIO(err)
+	default:
+		return doc, nil
+	}
+}
+
+func (db *Storage[T]) decode(doc []byte) (T, error) {
+	var entity T
+	if err := json.Unmarshal(doc, &entity); err != nil {
+		return db.undefined, errInvalidEntity(err)
+	}
+
+	return entity, nil
+}
+
+// attributes of the document used for evaluation of constraints
+func (db *Storage[T]) attributes(doc []byte) (map[string]types.AttributeValue, error) {
+	if doc == nil {
+		return nil, nil
+	}
+
+	entity, err := db.decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	gen, err := db.Codec.Encode(entity)
+	if err != nil {
+		return nil, errInvalidEntity(err)
+	}
+
+	return gen, nil
+}
+
+/*
+failed explains why conditional statement has not affected the row.
+The row is read again to find the failed constraint, nil is returned
+if the constraints hold for the absent row.
+*/
+func (db *Storage[T]) failed(ctx context.Context, thing T, config []dynamo.Constraint[T]) error {
+	hashKey, sortKey := keyOf(thing)
+	doc, err := db.read(ctx, hashKey, sortKey)
+	if err != nil {
+		return err
+	}
+
+	gen, err := db.attributes(doc)
+	if err != nil {
+		return err
+	}
+
+	c := mem.Check(gen, config)
+	switch {
+	case c != nil:
+		return mem.PreCondition(thing, c)
+	case doc == nil:
+		return nil
+	default:
+		// Note: the row is modified concurrently
+		return mem.PreCondition(thing, config[0])
+	}
+}
+
+/*
+query documents of partition with sort key prefix, ordered by sort key.
+Documents after the exclusive start key are returned, limit 0 is unbound.
+It returns the sort key of last document if more documents remains.
+*/
+func (db *Storage[T]) query(
+	ctx context.Context,
+	hashKey, prefix string,
+	start *string,
+	reverse bool,
+	limit int,
+) ([]T, *string, error) {
+	query := "SELECT sort_key, doc FROM " + db.Table + " WHERE hash_key = ?"
+	args := []any{hashKey}
+
+	if prefix != "" {
+		query += " AND " + db.Dialect.prefix()
+		args = append(args, db.Dialect.pattern(prefix))
+	}
+
+	switch {
+	case start != nil && reverse:
+		query += " AND sort_key < ?"
+		args = append(args, *start)
+	case start != nil:
+		query += " AND sort_key > ?"
+		args = append(args, *start)
+	}
+
+	query += " ORDER BY sort_key"
+	if reverse {
+		query += " DESC"
+	}
+
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit+1)
+	}
+
+	rows, err := db.DB.QueryContext(ctx, db.Dialect.bind(query), args...)
+	if err != nil {
+		return nil, nil, errServiceIO(err)
+	}
+	defer rows.Close()
+
+	seq := make([]T, 0)
+	sortKeys := make([]string, 0)
+	for rows.Next() {
+		var sortKey string
+		var doc []byte
+		if err := rows.Scan(&sortKey, &doc); err != nil {
+			return nil, nil, errServiceIO(err)
+		}
+
+		entity, err := db.decode(doc)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		seq = append(seq, entity)
+		sortKeys = append(sortKeys, sortKey)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, errServiceIO(err)
+	}
+
+	var last *string
+	if limit > 0 && len(seq) > limit {
+		seq = seq[:limit]
+		last = &sortKeys[limit-1]
+	}
+
+	return seq, last, nil
+}
+
+//-----------------------------------------------------------------------------
+//
+// Key Value
+//
+//-----------------------------------------------------------------------------
+
+// Get item from storage
+func (db *Storage[T]) Get(ctx context.Context, key T) (T, error) {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return db.undefined, errInvalidKey(err)
+	}
+
+	hashKey, sortKey := keyOf(key)
+	doc, err := db.read(ctx, hashKey, sortKey)
+	if err != nil {
+		return db.undefined, err
+	}
+
+	if doc == nil {
+		return db.undefined, errNotFound(nil, key)
+	}
+
+	return db.decode(doc)
+}
+
+/*
+Put writes entity. The conditional write is either the upsert, which
+updates the existing row only if constraints hold, or the update of
+existing row if constraints never hold for the absent one.
+*/
+func (db *Storage[T]) Put(ctx context.Context, entity T, config ...dynamo.Constraint[T]) error {
+	if _, err := db.Codec.EncodeKey(entity); err != nil {
+		return errInvalidKey(err)
+	}
+
+	if err := mem.Supported(config); err != nil {
+		return errInvalidEntity(err)
+	}
+
+	doc, err := json.Marshal(entity)
+	if err != nil {
+		return errInvalidEntity(err)
+	}
+
+	hashKey, sortKey := keyOf(entity)
+
+	where, args, err := db.Schema.where(db.Dialect, db.Table+".doc", config)
+	if err != nil {
+		return errInvalidEntity(err)
+	}
+
+	if where == "" {
+		_, err := db.exec(ctx,
+			"INSERT INTO "+db.Table+" (hash_key, sort_key, doc) VALUES (?, ?, ?)"+
+				" ON CONFLICT (hash_key, sort_key) DO UPDATE SET doc = excluded.doc",
+			hashKey, sortKey, string(doc),
+		)
+		return err
+	}
+
+	var n int64
+	if mem.Check(nil, config) == nil {
+		n, err = db.exec(ctx,
+			"INSERT INTO "+db.Table+" (hash_key, sort_key, doc) VALUES (?, ?, ?)"+
+				" ON CONFLICT (hash_key, sort_key) DO UPDATE SET doc = excluded.doc WHERE "+where,
+			append([]any{hashKey, sortKey, string(doc)}, args...)...,
+		)
+	} else {
+		n, err = db.exec(ctx,
+			"UPDATE "+db.Table+" SET doc = ? WHERE hash_key = ? AND sort_key = ? AND "+where,
+			append([]any{string(doc), hashKey, sortKey}, args...)...,
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		if err := db.failed(ctx, entity, config); err != nil {
+			return err
+		}
+		return mem.PreCondition(entity, config[0])
+	}
+
+	return nil
+}
+
+// Remove discards the entity from the table
+func (db *Storage[T]) Remove(ctx context.Context, key T, config ...dynamo.Constraint[T]) error {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return errInvalidKey(err)
+	}
+
+	if err := mem.Supported(config); err != nil {
+		return errInvalidEntity(err)
+	}
+
+	hashKey, sortKey := keyOf(key)
+
+	where, args, err := db.Schema.where(db.Dialect, "doc", config)
+	if err != nil {
+		return errInvalidEntity(err)
+	}
+
+	query := "DELETE FROM " + db.Table + " WHERE hash_key = ? AND sort_key = ?"
+	if where != "" {
+		query += " AND " + where
+	}
+
+	n, err := db.exec(ctx, query, append([]any{hashKey, sortKey}, args...)...)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 && where != "" {
+		return db.failed(ctx, key, config)
+	}
+
+	return nil
+}
+
+/*
+Update applies a partial patch to entity and returns new values. The
+document is replaced using compare-and-swap, it is retried if the row
+is modified concurrently.
+*/
+func (db *Storage[T]) Update(ctx context.Context, entity T, config ...dynamo.Constraint[T]) (T, error) {
+	if _, err := db.Codec.EncodeKey(entity); err != nil {
+		return db.undefined, errInvalidKey(err)
+	}
+
+	if err := mem.Supported(config); err != nil {
+		return db.undefined, errInvalidEntity(err)
+	}
+
+	gen, err := db.Codec.Encode(entity)
+	if err != nil {
+		return db.undefined, errInvalidEntity(err)
+	}
+
+	hashKey, sortKey := keyOf(entity)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return db.undefined, err
+		}
+
+		doc, err := db.read(ctx, hashKey, sortKey)
+		if err != nil {
+			return db.undefined, err
+		}
+
+		item, err := db.attributes(doc)
+		if err != nil {
+			return db.undefined, err
+		}
+
+		if c := mem.Check(item, config); c != nil {
+			return db.undefined, mem.PreCondition(entity, c)
+		}
+
+		if item == nil {
+			item = map[string]types.AttributeValue{}
+		}
+		for k, v := range gen {
+			item[k] = v
+		}
+
+		obj, err := db.Codec.Decode(item)
+		if err != nil {
+			return db.undefined, errInvalidEntity(err)
+		}
+
+		next, err := json.Marshal(obj)
+		if err != nil {
+			return db.undefined, errInvalidEntity(err)
+		}
+
+		var n int64
+		if doc == nil {
+			n, err = db.exec(ctx,
+				"INSERT INTO "+db.Table+" (hash_key, sort_key, doc) VALUES (?, ?, ?)"+
+					" ON CONFLICT (hash_key, sort_key) DO NOTHING",
+				hashKey, sortKey, string(next),
+			)
+		} else {
+			n, err = db.exec(ctx,
+				"UPDATE "+db.Table+" SET doc = ? WHERE hash_key = ? AND sort_key = ? AND doc = ?",
+				string(next), hashKey, sortKey, string(doc),
+			)
+		}
+		if err != nil {
+			return db.undefined, err
+		}
+
+		if n != 0 {
+			return obj, nil
+		}
+	}
+}
+
+// Match applies a pattern matching to elements in the table
+func (db *Storage[T]) Match(ctx context.Context, key T) dynamo.Seq[T] {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return newSeq(ctx, db, "", "", errInvalidKey(err))
+	}
+
+	hashKey, prefix := keyOf(key)
+	if prefix == "_" {
+		prefix = ""
+	}
+
+	return newSeq(ctx, db, hashKey, prefix, nil)
+}
+
+// Count number of elements matching the pattern and filters
+func (db *Storage[T]) Count(ctx context.Context, key T, filters ...dynamo.Constraint[T]) (int, error) {
+	if _, err := db.Codec.EncodeKey(key); err != nil {
+		return 0, errInvalidKey(err)
+	}
+
+	if err := mem.Supported(filters); err != nil {
+		return 0, errInvalidEntity(err)
+	}
+
+	hashKey, prefix := keyOf(key)
+	if prefix == "_" {
+		prefix = ""
+	}
+
+	query := "SELECT COUNT(*) FROM " + db.Table + " WHERE hash_key = ?"
+	args := []any{hashKey}
+
+	if prefix != "" {
+		query += " AND " + db.Dialect.prefix()
+		args = append(args, db.Dialect.pattern(prefix))
+	}
+
+	where, wargs, err := db.Schema.where(db.Dialect, "doc", filters)
+	if err != nil {
+		return 0, errInvalidEntity(err)
+	}
+
+	if where != "" {
+		query += " AND " + where
+		args = append(args, wargs...)
+	}
+
+	var count int
+	err = db.DB.QueryRowContext(ctx, db.Dialect.bind(query), args...).Scan(&count)
+	if err != nil {
+		return 0, errServiceIO(err)
+	}
+
+	return count, nil
+}
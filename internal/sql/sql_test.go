@@ -0,0 +1,93 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package sql_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/fogfish/curie"
+	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/dynamotest"
+	"github.com/holmes89/dynamo/service/sql"
+	_ "modernc.org/sqlite"
+)
+
+func connector(t *testing.T, table string) string {
+	file := filepath.ToSlash(filepath.Join(t.TempDir(), "test.db"))
+	return "sqlite://" + file + "?table=" + table + "&_pragma=busy_timeout(5000)"
+}
+
+func TestStorage(t *testing.T) {
+	dynamotest.TestStorage(t, func() dynamo.KeyVal[dynamotest.Person] {
+		return sql.Must(sql.New[dynamotest.Person](connector(t, "person"), nil))
+	})
+}
+
+func TestConstraintsConjunction(t *testing.T) {
+	dynamotest.TestConstraints(t, func() dynamo.KeyVal[dynamotest.Person] {
+		return sql.Must(sql.New[dynamotest.Person](connector(t, "person"), nil))
+	})
+}
+
+func TestMatchPattern(t *testing.T) {
+	db := sql.Must(sql.New[dynamotest.Person](connector(t, "person"), nil))
+
+	for _, suffix := range []curie.IRI{"a*b", "a?b", "a[b", "a%b", "a_b", "A:b"} {
+		it.Ok(t).IfNil(db.Put(context.Background(), dynamotest.Person{Prefix: "org:p", Suffix: suffix}))
+	}
+
+	it.Ok(t).
+		If(dynamotest.SortKeys(db.Match(context.Background(), dynamotest.Person{Prefix: "org:p", Suffix: "a*"}))).Equal("[a*b]").
+		If(dynamotest.SortKeys(db.Match(context.Background(), dynamotest.Person{Prefix: "org:p", Suffix: "a?"}))).Equal("[a?b]").
+		If(dynamotest.SortKeys(db.Match(context.Background(), dynamotest.Person{Prefix: "org:p", Suffix: "a["}))).Equal("[a[b]").
+		If(dynamotest.SortKeys(db.Match(context.Background(), dynamotest.Person{Prefix: "org:p", Suffix: "a%"}))).Equal("[a%b]").
+		If(dynamotest.SortKeys(db.Match(context.Background(), dynamotest.Person{Prefix: "org:p", Suffix: "a"}))).Equal("[a%b a*b a?b a[b a_b]")
+}
+
+func TestConcurrentUpdate(t *testing.T) {
+	db := sql.Must(sql.New[dynamotest.Person](connector(t, "person"), nil))
+	it.Ok(t).IfNil(db.Put(context.Background(), dynamotest.Person{Prefix: "org:a", Suffix: "person:1", Name: "name 1"}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := db.Update(context.Background(), dynamotest.Person{Prefix: "org:a", Suffix: "person:1", Age: 30 + i})
+			it.Ok(t).IfNil(err)
+		}(i)
+	}
+	wg.Wait()
+
+	val, err := db.Get(context.Background(), dynamotest.Person{Prefix: "org:a", Suffix: "person:1"})
+	it.Ok(t).
+		IfNil(err).
+		If(val.Name).Equal("name 1").
+		If(val.Age >= 30).Equal(true)
+}
+
+func TestConnector(t *testing.T) {
+	for _, url := range []string{
+		"mysql://localhost/test",
+		"sqlite:///tmp/test.db?table=drop+table",
+		"sqlite://",
+	} {
+		_, err := sql.New[dynamotest.Person](url, nil)
+		it.Ok(t).IfNotNil(err)
+	}
+}
+
+func TestSchemaNotStruct(t *testing.T) {
+	_, err := sql.New[dynamo.Thing](connector(t, "thing"), nil)
+	it.Ok(t).IfNil(err)
+}
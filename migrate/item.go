@@ -0,0 +1,135 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file declares migrations of items
+//
+
+package migrate
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/fogfish/curie"
+	"github.com/holmes89/dynamo"
+)
+
+/*
+Item is a raw item of the table, it is used by migrations that operate on
+attributes not declared by any type (e.g. renaming of attributes).
+The item requires default names of key attributes: prefix and suffix.
+
+	db := ddb.Must(ddb.New[migrate.Item]("ddb:///my-table", nil, nil))
+*/
+type Item map[string]types.AttributeValue
+
+func (item Item) HashKey() curie.IRI { return curie.IRI(item.S("prefix")) }
+func (item Item) SortKey() curie.IRI { return curie.IRI(item.S("suffix")) }
+
+// S returns value of string attribute
+func (item Item) S(attr string) string {
+	if v, ok := item[attr].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+// Rename attribute of the item, it returns false if attribute is not defined
+func (item Item) Rename(from, to string) bool {
+	val, has := item[from]
+	if !has {
+		return false
+	}
+
+	delete(item, from)
+	item[to] = val
+	return true
+}
+
+// MarshalDynamoDBAttributeValue encodes item as is
+func (item Item) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
+	return &types.AttributeValueMemberM{Value: item}, nil
+}
+
+// UnmarshalDynamoDBAttributeValue decodes item as is
+func (item *Item) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) error {
+	m, ok := av.(*types.AttributeValueMemberM)
+	if !ok {
+		return errors.New("item is not a map")
+	}
+
+	*item = m.Value
+	return nil
+}
+
+/*
+Each builds migration step that transforms every item matching the pattern.
+The function returns the new value of the item and false if the item is
+not changed. Items are processed page by page, the progress is
+checkpointed after each page. Changes are not written during dry run.
+
+	migrate.Migration{
+	  ID: "001-backfill-category",
+	  Up: migrate.Each(db, Article{Author: "author:"},
+	    func(ctx context.Context, x Article) (Article, bool, error) { ... },
+	  ),
+	}
+*/
+func Each[T dynamo.Thing](
+	db dynamo.KeyVal[T],
+	pattern T,
+	f func(context.Context, T) (T, bool, error),
+) func(context.Context, *Step) error {
+	return func(ctx context.Context, step *Step) error {
+		seq := db.Match(ctx, pattern).Limit(step.PageSize)
+		if step.Cursor != nil {
+			seq = seq.Continue(step.Cursor)
+		}
+
+		for {
+			cursor, err := dynamo.Walk(ctx, seq, func(page dynamo.Page[T]) error {
+				for _, x := range page.Items {
+					y, changed, err := f(ctx, x)
+					if err != nil {
+						return errProcessEntity(err, x)
+					}
+
+					if !changed {
+						continue
+					}
+
+					step.Changed++
+					if step.DryRun {
+						continue
+					}
+
+					if err := db.Put(ctx, y); err != nil {
+						return err
+					}
+				}
+
+				return step.Checkpoint(ctx, page.Cursor)
+			})
+			if err != nil {
+				return err
+			}
+
+			// Note: Walk stops at page boundary, the sequence is continued
+			if cursor == nil {
+				return nil
+			}
+
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			seq = db.Match(ctx, pattern).Limit(step.PageSize).Continue(cursor)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+/*
+Package migrate implements versioned migrations of data. Migrations are
+applied in the order of declaration, applied migrations are recorded in
+the control item. The control item is written conditionally to its version,
+it also acts as a lock so that only one runner executes migrations at a time.
+
+	runner := migrate.NewRunner(control, "my-table", hostname,
+	  migrate.Migration{
+	    ID: "001-backfill-category",
+	    Up: migrate.Each(db, Article{Author: "author:"}, ...),
+	  },
+	)
+
+	results, err := runner.Up(ctx)
+*/
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/fogfish/curie"
+	"github.com/holmes89/dynamo"
+)
+
+/*
+Migration of data, the migration is identified by unique ID. The optional
+Down hook rolls back the migration.
+*/
+type Migration struct {
+	ID   string
+	Up   func(context.Context, *Step) error
+	Down func(context.Context, *Step) error
+}
+
+/*
+Step is the execution of migration. The migration checkpoints its progress
+using cursor, the execution is resumed from the cursor after failure.
+*/
+type Step struct {
+	ID     string
+	DryRun bool
+	// PageSize is recommended number of items processed between checkpoints
+	PageSize int
+	// Cursor to resume the migration from, nil at the beginning
+	Cursor dynamo.Thing
+	// Changed is number of changed items, reported by the migration
+	Changed int
+
+	checkpoint func(context.Context, dynamo.Thing) error
+}
+
+// Checkpoint progress of the migration, it is no-op during dry run
+func (step *Step) Checkpoint(ctx context.Context, cursor dynamo.Thing) error {
+	if step.DryRun || step.checkpoint == nil {
+		return nil
+	}
+	return step.checkpoint(ctx, cursor)
+}
+
+/*
+Result of migration
+*/
+type Result struct {
+	ID      string
+	Changed int
+}
+
+/*
+Control item records state of migrations
+*/
+type Control struct {
+	Scope curie.IRI `dynamodbav:"prefix,omitempty"`
+	// Applied migrations in the order of execution
+	Applied []string `dynamodbav:"applied,omitempty"`
+	// Owner of the lock and its expiration time as unix time in milliseconds
+	Owner   string `dynamodbav:"owner,omitempty"`
+	Expires int64  `dynamodbav:"expires,omitempty"`
+	// Running migration, its direction and cursor
+	Running  string `dynamodbav:"running,omitempty"`
+	Rollback bool   `dynamodbav:"rollback,omitempty"`
+	Cursor   string `dynamodbav:"cursor,omitempty"`
+	Version  int    `dynamodbav:"version,omitempty"`
+}
+
+func (c Control) HashKey() curie.IRI { return c.Scope }
+func (c Control) SortKey() curie.IRI { return "_" }
+
+var controlVersion = dynamo.Schema1[Control, int]("Version")
+
+/*
+Runner of migrations
+*/
+type Runner struct {
+	Control    dynamo.KeyVal[Control]
+	Scope      string
+	Owner      string
+	Migrations []Migration
+	// DryRun executes migrations without writes
+	DryRun bool
+	// PageSize of items processed between checkpoints
+	PageSize int
+	// LockTTL is duration of the lock, it is extended on every checkpoint
+	LockTTL time.Duration
+	// Clock of the runner
+	Clock func() time.Time
+}
+
+/*
+NewRunner creates runner of migrations. Migrations of the scope share
+the control item, the owner identifies the runner.
+*/
+func NewRunner(control dynamo.KeyVal[Control], scope, owner string, migrations ...Migration) *Runner {
+	return &Runner{
+		Control:    control,
+		Scope:      scope,
+		Owner:      owner,
+		Migrations: migrations,
+		PageSize:   100,
+		LockTTL:    5 * time.Minute,
+		Clock:      time.Now,
+	}
+}
+
+// Applied migrations
+func (r *Runner) Applied(ctx context.Context) ([]string, error) {
+	c, err := r.control(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.Applied, nil
+}
+
+/*
+Up applies pending migrations in the order of declaration. The migration
+interrupted by failure is resumed from its checkpoint. Dry run executes
+pending migrations without writes of items, migrations are not recorded.
+*/
+func (r *Runner) Up(ctx context.Context) ([]Result, error) {
+	return r.run(ctx, false, func(c Control) ([]Migration, error) {
+		applied := map[string]bool{}
+		for _, id := range c.Applied {
+			applied[id] = true
+		}
+
+		seq := make([]Migration, 0)
+		for _, m := range r.Migrations {
+			if !applied[m.ID] {
+				seq = append(seq, m)
+			}
+		}
+		return seq, nil
+	})
+}
+
+/*
+Down rolls back applied migrations in the reverse order until the migration
+with given ID, which remains applied. Empty ID rolls back all migrations.
+*/
+func (r *Runner) Down(ctx context.Context, to string) ([]Result, error) {
+	return r.run(ctx, true, func(c Control) ([]Migration, error) {
+		known := map[string]Migration{}
+		for _, m := range r.Migrations {
+			known[m.ID] = m
+		}
+
+		seq := make([]Migration, 0)
+		for i := len(c.Applied) - 1; i >= 0; i-- {
+			id := c.Applied[i]
+			if id == to {
+				break
+			}
+
+			m, has := known[id]
+			if !has || m.Down == nil {
+				return nil, errNoRollback(id)
+			}
+			seq = append(seq, Migration{ID: m.ID, Up: m.Down})
+		}
+		return seq, nil
+	})
+}
+
+func (r *Runner) run(
+	ctx context.Context,
+	rollback bool,
+	plan func(Control) ([]Migration, error),
+) ([]Result, error) {
+	c, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	seq, err := plan(c)
+	if err != nil {
+		return nil, r.unlock(ctx, c, err)
+	}
+
+	results := make([]Result, 0, len(seq))
+	for _, m := range seq {
+		step := &Step{ID: m.ID, DryRun: r.DryRun, PageSize: r.PageSize}
+
+		if c.Running == m.ID && c.Rollback == rollback && c.Cursor != "" {
+			cursor, err := dynamo.DecodeCursor(c.Cursor, nil)
+			if err != nil {
+				return results, r.unlock(ctx, c, err)
+			}
+			step.Cursor = cursor
+		}
+
+		if !r.DryRun {
+			c, err = r.write(ctx, c, func(x *Control) {
+				if x.Running != m.ID || x.Rollback != rollback {
+					x.Running, x.Rollback, x.Cursor = m.ID, rollback, ""
+				}
+			})
+			if err != nil {
+				return results, r.unlock(ctx, c, err)
+			}
+
+			step.checkpoint = func(ctx context.Context, cursor dynamo.Thing) error {
+				c, err = r.write(ctx, c, func(x *Control) { x.Cursor = encodeCursor(cursor) })
+				return err
+			}
+		}
+
+		if err := m.Up(ctx, step); err != nil {
+			return results, r.unlock(ctx, c, errMigration(m.ID, err))
+		}
+		results = append(results, Result{ID: m.ID, Changed: step.Changed})
+
+		if !r.DryRun {
+			c, err = r.write(ctx, c, func(x *Control) {
+				if rollback {
+					x.Applied = x.Applied[:len(x.Applied)-1]
+				} else {
+					x.Applied = append(x.Applied, m.ID)
+				}
+				x.Running, x.Rollback, x.Cursor = "", false, ""
+			})
+			if err != nil {
+				return results, r.unlock(ctx, c, err)
+			}
+		}
+	}
+
+	return results, r.unlock(ctx, c, nil)
+}
+
+// control item of the scope
+func (r *Runner) control(ctx context.Context) (Control, error) {
+	key := Control{Scope: curie.IRI("migration:" + r.Scope)}
+
+	c, err := r.Control.Get(ctx, key)
+	if err != nil {
+		if recoverNotFound(err) {
+			return key, nil
+		}
+		return key, err
+	}
+
+	return c, nil
+}
+
+// lock acquires the control item unless it is locked by another runner
+func (r *Runner) lock(ctx context.Context) (Control, error) {
+	c, err := r.control(ctx)
+	if err != nil {
+		return c, err
+	}
+
+	now := r.Clock()
+	if c.Owner != "" && c.Owner != r.Owner && c.Expires > now.UnixMilli() {
+		return c, errLocked(c.Owner)
+	}
+
+	return r.write(ctx, c, func(x *Control) {})
+}
+
+// unlock releases the control item, it returns the failure
+func (r *Runner) unlock(ctx context.Context, c Control, failure error) error {
+	// Note: the lock is released even if the context is canceled
+	_, err := r.write(context.WithoutCancel(ctx), c, func(x *Control) {
+		x.Owner = ""
+		x.Expires = 0
+	})
+
+	if failure != nil {
+		return failure
+	}
+	return err
+}
+
+/*
+write the control item conditionally to its version, the write extends
+the lock of the runner.
+*/
+func (r *Runner) write(ctx context.Context, c Control, f func(*Control)) (Control, error) {
+	val := c
+	val.Applied = append([]string{}, c.Applied...)
+	val.Owner = r.Owner
+	val.Expires = r.Clock().Add(r.LockTTL).UnixMilli()
+	f(&val)
+	val.Version = c.Version + 1
+
+	constraint := controlVersion.Eq(c.Version)
+	if c.Version == 0 {
+		constraint = controlVersion.NotExists()
+	}
+
+	if err := r.Control.Put(ctx, val, constraint); err != nil {
+		if recoverPreConditionFailed(err) {
+			return c, errLocked("concurrent runner")
+		}
+		return c, err
+	}
+
+	return val, nil
+}
+
+func encodeCursor(cursor dynamo.Thing) string {
+	switch v := cursor.(type) {
+	case nil:
+		return ""
+	case *dynamo.Cursor:
+		return v.Encode(nil)
+	default:
+		return dynamo.NewCursor(v.HashKey(), v.SortKey(), nil).Encode(nil)
+	}
+}
+
+//-----------------------------------------------------------------------------
+//
+// Errors
+//
+//-----------------------------------------------------------------------------
+
+func recoverNotFound(err error) bool {
+	var e interface{ NotFound() string }
+
+	ok := errors.As(err, &e)
+	return ok && e.NotFound() != ""
+}
+
+func recoverPreConditionFailed(err error) bool {
+	var e interface{ PreConditionFailed() bool }
+
+	ok := errors.As(err, &e)
+	return ok && e.PreConditionFailed()
+}
+
+/*
+Locked is an error raised when migrations are executed by another runner
+*/
+type Locked interface{ Locked() string }
+
+type locked string
+
+func (e locked) Error() string  { return fmt.Sprintf("migrations are locked by %s", string(e)) }
+func (e locked) Locked() string { return string(e) }
+
+func errLocked(owner string) error { return locked(owner) }
+
+func errNoRollback(id string) error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] migration %s has no rollback", name, id)
+}
+
+func errMigration(id string, err error) error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] migration %s failed : %w", name, id, err)
+}
+
+func errProcessEntity(err error, thing dynamo.Thing) error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] can't process (%s, %s) : %w", name, thing.HashKey(), thing.SortKey(), err)
+}
@@ -0,0 +1,293 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/fogfish/curie"
+	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/migrate"
+	"github.com/holmes89/dynamo/service/ddb"
+	"github.com/holmes89/dynamo/service/ddb/emulator"
+)
+
+type article struct {
+	Author   curie.IRI `dynamodbav:"prefix,omitempty"`
+	ID       curie.IRI `dynamodbav:"suffix,omitempty"`
+	Title    string    `dynamodbav:"title,omitempty"`
+	Category string    `dynamodbav:"category,omitempty"`
+}
+
+func (a article) HashKey() curie.IRI { return a.Author }
+func (a article) SortKey() curie.IRI { return a.ID }
+
+type fixture struct {
+	table    *emulator.DynamoDB
+	articles dynamo.KeyVal[article]
+	items    dynamo.KeyVal[migrate.Item]
+	control  dynamo.KeyVal[migrate.Control]
+}
+
+func newFixture() fixture {
+	table := emulator.New(emulator.Table{Name: "test", HashKey: "prefix", SortKey: "suffix"})
+	f := fixture{
+		table:    table,
+		articles: ddb.Must(ddb.New[article]("ddb:///test", table, nil)),
+		items:    ddb.Must(ddb.New[migrate.Item]("ddb:///test", table, nil)),
+		control:  ddb.Must(ddb.New[migrate.Control]("ddb:///test", table, nil)),
+	}
+
+	for i := 0; i < 5; i++ {
+		f.articles.Put(context.Background(), article{
+			Author: "author:neumann",
+			ID:     curie.New("article:%d", i),
+			Title:  fmt.Sprintf("title %d", i),
+		})
+	}
+
+	return f
+}
+
+func (f fixture) categories() string {
+	seq := []string{}
+	for x, err := range dynamo.All(f.articles.Match(context.Background(), article{Author: "author:neumann"})) {
+		if err != nil {
+			return err.Error()
+		}
+		seq = append(seq, x.Category)
+	}
+	return fmt.Sprint(seq)
+}
+
+func backfill(db dynamo.KeyVal[article], fail *int) migrate.Migration {
+	return migrate.Migration{
+		ID: "001-backfill-category",
+		Up: migrate.Each(db, article{Author: "author:neumann"},
+			func(ctx context.Context, x article) (article, bool, error) {
+				if fail != nil && x.ID == curie.New("article:%d", *fail) {
+					return x, false, errors.New("failed")
+				}
+				if x.Category != "" {
+					return x, false, nil
+				}
+				x.Category = "math"
+				return x, true, nil
+			},
+		),
+		Down: migrate.Each(db, article{Author: "author:neumann"},
+			func(ctx context.Context, x article) (article, bool, error) {
+				x.Category = ""
+				return x, true, nil
+			},
+		),
+	}
+}
+
+func rename(db dynamo.KeyVal[migrate.Item]) migrate.Migration {
+	return migrate.Migration{
+		ID: "002-rename-title",
+		Up: migrate.Each(db, migrate.Item{"prefix": &types.AttributeValueMemberS{Value: "author:neumann"}},
+			func(ctx context.Context, x migrate.Item) (migrate.Item, bool, error) {
+				return x, x.Rename("title", "name"), nil
+			},
+		),
+	}
+}
+
+func TestMigrateUp(t *testing.T) {
+	f := newFixture()
+	runner := migrate.NewRunner(f.control, "test", "a",
+		backfill(f.articles, nil),
+		rename(f.items),
+	)
+	runner.PageSize = 2
+
+	results, err := runner.Up(context.Background())
+	it.Ok(t).
+		IfNil(err).
+		If(results).Equal([]migrate.Result{
+		{ID: "001-backfill-category", Changed: 5},
+		{ID: "002-rename-title", Changed: 5},
+	}).
+		If(f.categories()).Equal("[math math math math math]")
+
+	item, err := f.items.Get(context.Background(), migrate.Item{
+		"prefix": &types.AttributeValueMemberS{Value: "author:neumann"},
+		"suffix": &types.AttributeValueMemberS{Value: "article:1"},
+	})
+	it.Ok(t).
+		IfNil(err).
+		If(item.S("name")).Equal("title 1").
+		If(item.S("title")).Equal("")
+
+	applied, err := runner.Applied(context.Background())
+	it.Ok(t).
+		IfNil(err).
+		If(applied).Equal([]string{"001-backfill-category", "002-rename-title"})
+
+	// Note: applied migrations are not repeated
+	results, err = runner.Up(context.Background())
+	it.Ok(t).
+		IfNil(err).
+		If(len(results)).Equal(0)
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	f := newFixture()
+	runner := migrate.NewRunner(f.control, "test", "a", backfill(f.articles, nil))
+	runner.DryRun = true
+
+	results, err := runner.Up(context.Background())
+	it.Ok(t).
+		IfNil(err).
+		If(results).Equal([]migrate.Result{{ID: "001-backfill-category", Changed: 5}}).
+		If(f.categories()).Equal("[    ]")
+
+	applied, err := runner.Applied(context.Background())
+	it.Ok(t).
+		IfNil(err).
+		If(len(applied)).Equal(0)
+}
+
+func TestMigrateResume(t *testing.T) {
+	f := newFixture()
+	fail := 3
+	runner := migrate.NewRunner(f.control, "test", "a", backfill(f.articles, &fail))
+	runner.PageSize = 2
+
+	_, err := runner.Up(context.Background())
+	it.Ok(t).
+		IfNotNil(err).
+		If(f.categories()).Equal("[math math math  ]")
+
+	// Note: the migration resumes from the checkpoint, the first page is skipped
+	fail = 0
+	results, err := runner.Up(context.Background())
+	it.Ok(t).
+		IfNil(err).
+		If(results).Equal([]migrate.Result{{ID: "001-backfill-category", Changed: 2}}).
+		If(f.categories()).Equal("[math math math math math]")
+}
+
+func TestMigrateLock(t *testing.T) {
+	f := newFixture()
+
+	now := time.Now()
+	a := migrate.NewRunner(f.control, "test", "a", backfill(f.articles, nil))
+	a.Clock = func() time.Time { return now }
+
+	b := migrate.NewRunner(f.control, "test", "b", backfill(f.articles, nil))
+	b.Clock = func() time.Time { return now }
+
+	// Note: the runner "a" is crashed holding the lock
+	f.control.Put(context.Background(), migrate.Control{
+		Scope:   "migration:test",
+		Owner:   "a",
+		Expires: now.Add(time.Minute).UnixMilli(),
+		Version: 1,
+	})
+
+	_, err := b.Up(context.Background())
+	var locked migrate.Locked
+	it.Ok(t).
+		If(errors.As(err, &locked)).Equal(true).
+		If(locked.Locked()).Equal("a")
+
+	// Note: the lock is expired
+	b.Clock = func() time.Time { return now.Add(2 * time.Minute) }
+	results, err := b.Up(context.Background())
+	it.Ok(t).
+		IfNil(err).
+		If(len(results)).Equal(1)
+}
+
+func TestMigrateDown(t *testing.T) {
+	f := newFixture()
+	runner := migrate.NewRunner(f.control, "test", "a",
+		backfill(f.articles, nil),
+		rename(f.items),
+	)
+
+	_, err := runner.Up(context.Background())
+	it.Ok(t).IfNil(err)
+
+	// Note: rename has no rollback
+	_, err = runner.Down(context.Background(), "")
+	it.Ok(t).IfNotNil(err)
+
+	f2 := newFixture()
+	runner = migrate.NewRunner(f2.control, "test", "a", backfill(f2.articles, nil))
+	_, err = runner.Up(context.Background())
+	it.Ok(t).
+		IfNil(err).
+		If(f2.categories()).Equal("[math math math math math]")
+
+	results, err := runner.Down(context.Background(), "")
+	it.Ok(t).
+		IfNil(err).
+		If(results).Equal([]migrate.Result{{ID: "001-backfill-category", Changed: 5}}).
+		If(f2.categories()).Equal("[    ]")
+
+	applied, err := runner.Applied(context.Background())
+	it.Ok(t).
+		IfNil(err).
+		If(len(applied)).Equal(0)
+}
+
+// faulty fails writes of the control item marking running migration
+type faulty struct{ dynamo.KeyVal[migrate.Control] }
+
+func (f faulty) Put(ctx context.Context, c migrate.Control, opts ...dynamo.Constraint[migrate.Control]) error {
+	if c.Running != "" && c.Owner != "" {
+		return errors.New("failed")
+	}
+	return f.KeyVal.Put(ctx, c, opts...)
+}
+
+func TestMigrateUnlockOnFailure(t *testing.T) {
+	f := newFixture()
+	runner := migrate.NewRunner(faulty{f.control}, "test", "a", backfill(f.articles, nil))
+
+	_, err := runner.Up(context.Background())
+	it.Ok(t).IfNotNil(err)
+
+	c, err := f.control.Get(context.Background(), migrate.Control{Scope: "migration:test"})
+	it.Ok(t).
+		IfNil(err).
+		If(c.Owner).Equal("").
+		If(c.Running).Equal("")
+}
+
+func TestMigrateDryRunCheckpoint(t *testing.T) {
+	f := newFixture()
+	runner := migrate.NewRunner(f.control, "test", "a", migrate.Migration{
+		ID: "001-checkpoint",
+		Up: func(ctx context.Context, step *migrate.Step) error {
+			// Note: the migration ignores the dry run flag
+			step.DryRun = false
+			return step.Checkpoint(ctx, dynamo.NewCursor("author:neumann", "article:1", nil))
+		},
+	})
+	runner.DryRun = true
+
+	_, err := runner.Up(context.Background())
+	it.Ok(t).IfNil(err)
+
+	c, err := f.control.Get(context.Background(), migrate.Control{Scope: "migration:test"})
+	it.Ok(t).
+		IfNil(err).
+		If(c.Cursor).Equal("")
+}
@@ -0,0 +1,345 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file declares helper functions over sequences
+//
+
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"sync"
+)
+
+/*
+All elements of sequence, the iteration stops after the first error.
+
+	for item, err := range dynamo.All(db.Match(ctx, key)) {
+	  if err != nil { ... }
+	}
+*/
+func All[T Thing](seq Seq[T]) iter.Seq2[T, error] {
+	if seq, ok := seq.(SeqIter[T]); ok {
+		return seq.All()
+	}
+
+	return func(yield func(T, error) bool) {
+		for seq.Tail() {
+			x, err := seq.Head()
+			if err != nil {
+				yield(x, err)
+				return
+			}
+
+			if !yield(x, nil) {
+				return
+			}
+		}
+
+		if err := seq.Error(); err != nil {
+			var none T
+			yield(none, err)
+		}
+	}
+}
+
+/*
+Pages of sequence, the iteration stops after the first error. Sequences that
+do not implement SeqIter are fetched as a single page.
+
+	for page, err := range dynamo.Pages(db.Match(ctx, key).Limit(100)) {
+	  if err != nil { ... }
+	}
+*/
+func Pages[T Thing](seq Seq[T]) iter.Seq2[Page[T], error] {
+	if seq, ok := seq.(SeqIter[T]); ok {
+		return seq.Pages()
+	}
+
+	return func(yield func(Page[T], error) bool) {
+		items := make([]T, 0)
+		for x, err := range All(seq) {
+			if err != nil {
+				yield(Page[T]{}, err)
+				return
+			}
+			items = append(items, x)
+		}
+
+		if len(items) == 0 {
+			return
+		}
+
+		yield(Page[T]{Items: items, Count: len(items), Cursor: seq.Cursor()}, nil)
+	}
+}
+
+/*
+Walk traverses the sequence page by page until it is exhausted or
+the context is done. The traversal stops cleanly at the context deadline,
+the page that is already fetched is processed but the next one is not
+requested. Walk returns the cursor to continue the traversal from or
+nil if the sequence is exhausted.
+
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	seq := db.Match(ctx, key).Continue(checkpoint)
+	cursor, err := dynamo.Walk(ctx, seq, func(page dynamo.Page[T]) error { ... })
+
+The cursor points to the last successfully processed page if the function
+fails. Pages are queried with the context of sequence (e.g. Match), the walk
+context stops the traversal between pages but it does not abort the query
+in-flight, it is bounded by the context of sequence.
+*/
+func Walk[T Thing](ctx context.Context, seq Seq[T], f func(Page[T]) error) (Thing, error) {
+	cursor := seq.Cursor()
+
+	if ctx.Err() != nil {
+		return cursor, nil
+	}
+
+	pages := 0
+	for page, err := range Pages(seq) {
+		if err != nil {
+			if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+				return cursor, nil
+			}
+			return cursor, err
+		}
+
+		if err := f(page); err != nil {
+			return cursor, err
+		}
+
+		pages++
+		cursor = page.Cursor
+		if isEndOfSeq(cursor) {
+			return nil, nil
+		}
+
+		if ctx.Err() != nil {
+			return cursor, nil
+		}
+	}
+
+	// Note: sequence without pages is exhausted
+	if pages == 0 || isEndOfSeq(cursor) {
+		return nil, nil
+	}
+
+	return cursor, nil
+}
+
+func isEndOfSeq(cursor Thing) bool {
+	if cursor == nil {
+		return true
+	}
+
+	if c, ok := cursor.(*Cursor); ok && len(c.State()) != 0 {
+		return false
+	}
+
+	return cursor.HashKey() == ""
+}
+
+/*
+FMapN transforms sequence using n concurrent workers. The next page of
+the sequence is fetched in background while workers process the current one.
+The first error cancels the context passed to workers and stops
+the transformation. Elements are processed in arbitrary order. Pages are
+queried with the context of sequence (e.g. Match), the transformation
+returns once the context is done but the query in-flight is bounded by
+the context of sequence.
+
+	err := dynamo.FMapN(ctx, db.Match(ctx, key), 8,
+	  func(ctx context.Context, x T) error { ... },
+	)
+*/
+func FMapN[T Thing](
+	ctx context.Context,
+	seq Seq[T],
+	n int,
+	f func(context.Context, T) error,
+) error {
+	return parMap(ctx, seq, n,
+		func(ctx context.Context, x T) (struct{}, error) { return struct{}{}, f(ctx, x) },
+		nil,
+	)
+}
+
+/*
+MapN transforms sequence using n concurrent workers, results of
+transformation are joined in the order of the sequence. The next page
+of the sequence is fetched in background while workers process the
+current one. The first error cancels the context passed to workers and
+stops the transformation. The query in-flight is bounded by the context
+of sequence as FMapN does.
+
+	var seq Things
+	err := dynamo.MapN(ctx, db.Match(ctx, key), 8,
+	  func(ctx context.Context, x T) (T, error) { ... },
+	  seq.Join,
+	)
+*/
+func MapN[T Thing, B any](
+	ctx context.Context,
+	seq Seq[T],
+	n int,
+	f func(context.Context, T) (B, error),
+	join func(B) error,
+) error {
+	return parMap(ctx, seq, n, f, join)
+}
+
+type parJob[T any] struct {
+	seq  int
+	item T
+}
+
+type parResult[T Thing, B any] struct {
+	seq  int
+	item T
+	val  B
+}
+
+func parMap[T Thing, B any](
+	ctx context.Context,
+	seq Seq[T],
+	n int,
+	f func(context.Context, T) (B, error),
+	join func(B) error,
+) error {
+	if n < 1 {
+		n = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Note: the producer may outlive the call while its page query is in-flight
+	var (
+		mu      sync.Mutex
+		failure error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failure == nil {
+			failure = err
+			cancel()
+		}
+	}
+
+	jobs := make(chan parJob[T], n)
+	results := make(chan parResult[T, B], n)
+
+	// producer fetches pages, it fetches next page while workers are busy
+	go func() {
+		defer close(jobs)
+
+		at := 0
+		for page, err := range Pages(seq) {
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			for _, item := range page.Items {
+				select {
+				case jobs <- parJob[T]{seq: at, item: item}:
+					at++
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			// Note: the next page is not requested once the context is done
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				var job parJob[T]
+				select {
+				case <-ctx.Done():
+					return
+				case x, ok := <-jobs:
+					if !ok {
+						return
+					}
+					job = x
+				}
+
+				val, err := f(ctx, job.item)
+				if err != nil {
+					fail(errProcessEntity(err, job.item))
+					continue
+				}
+
+				if join != nil {
+					results <- parResult[T, B]{seq: job.seq, item: job.item, val: val}
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// results are joined in the order of sequence
+	next := 0
+	pending := map[int]parResult[T, B]{}
+	for result := range results {
+		if ctx.Err() != nil {
+			continue
+		}
+
+		pending[result.seq] = result
+		for {
+			x, has := pending[next]
+			if !has {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			if err := join(x.val); err != nil {
+				fail(errProcessEntity(err, x.item))
+				break
+			}
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if failure != nil {
+		return failure
+	}
+
+	// parent context is canceled
+	return ctx.Err()
+}
+
+func errProcessEntity(err error, thing Thing) error {
+	return fmt.Errorf("can't process (%s, %s) : %w", thing.HashKey(), thing.SortKey(), err)
+}
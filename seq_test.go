@@ -0,0 +1,237 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package dynamo_test
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/fogfish/curie"
+	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb/ddbtest"
+	"github.com/holmes89/dynamo/internal/dynamotest"
+)
+
+// fixturePages builds n pages of m persons
+func fixturePages(n, m int) [][]map[string]types.AttributeValue {
+	pages := make([][]map[string]types.AttributeValue, n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < m; j++ {
+			item, _ := attributevalue.MarshalMap(dynamotest.Person{
+				Prefix: curie.New("dead:beef"),
+				Suffix: curie.New("%d", i*m+j),
+				Age:    i*m + j,
+			})
+			pages[i] = append(pages[i], item)
+		}
+	}
+	return pages
+}
+
+func fixtureSeq(ctx context.Context, n, m int) dynamo.Seq[dynamotest.Person] {
+	db := ddbtest.QueryPages[dynamotest.Person](fixturePages(n, m)...)
+	return db.Match(ctx, dynamotest.Person{Prefix: curie.New("dead:beef")})
+}
+
+func TestWalk(t *testing.T) {
+	ctx := context.Background()
+
+	cnt, capacity := 0, 0.0
+	cursor, err := dynamo.Walk(ctx, fixtureSeq(ctx, 3, 2),
+		func(page dynamo.Page[dynamotest.Person]) error {
+			cnt += page.Count
+			capacity += page.Capacity
+			return nil
+		},
+	)
+
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(cursor).Should().Equal(nil).
+		If(cnt).Should().Equal(6).
+		If(capacity).Should().Equal(3.0)
+}
+
+func TestWalkDeadline(t *testing.T) {
+	seen := []string{}
+	join := func(page dynamo.Page[dynamotest.Person]) error {
+		for _, x := range page.Items {
+			seen = append(seen, string(x.Suffix))
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cursor, err := dynamo.Walk(ctx, fixtureSeq(ctx, 3, 2),
+		func(page dynamo.Page[dynamotest.Person]) error {
+			cancel()
+			return join(page)
+		},
+	)
+
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		IfFalse(cursor == nil).
+		If(len(seen)).Should().Equal(2)
+
+	ctx = context.Background()
+	cursor, err = dynamo.Walk(ctx, fixtureSeq(ctx, 3, 2).Continue(cursor), join)
+
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(cursor).Should().Equal(nil).
+		If(fmt.Sprint(seen)).Should().Equal("[0 1 2 3 4 5]")
+}
+
+func TestWalkFailure(t *testing.T) {
+	ctx := context.Background()
+
+	pages := 0
+	cursor, err := dynamo.Walk(ctx, fixtureSeq(ctx, 3, 2),
+		func(page dynamo.Page[dynamotest.Person]) error {
+			pages++
+			if pages == 2 {
+				return fmt.Errorf("failed")
+			}
+			return nil
+		},
+	)
+
+	it.Ok(t).
+		If(err).ShouldNot().Equal(nil).
+		If(cursor.SortKey()).Should().Equal(curie.IRI("1"))
+}
+
+func TestFMapN(t *testing.T) {
+	ctx := context.Background()
+
+	var cnt int32
+	err := dynamo.FMapN(ctx, fixtureSeq(ctx, 5, 4), 3,
+		func(ctx context.Context, x dynamotest.Person) error {
+			atomic.AddInt32(&cnt, 1)
+			return nil
+		},
+	)
+
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(cnt).Should().Equal(int32(20))
+}
+
+func TestFMapNFailure(t *testing.T) {
+	ctx := context.Background()
+
+	err := dynamo.FMapN(ctx, fixtureSeq(ctx, 5, 4), 3,
+		func(ctx context.Context, x dynamotest.Person) error {
+			if x.Age == 7 {
+				return fmt.Errorf("failed")
+			}
+			return nil
+		},
+	)
+
+	it.Ok(t).
+		If(err).ShouldNot().Equal(nil)
+}
+
+// stalled yields the first page, the query of next page is stalled until
+// the context of sequence is done
+type stalled struct {
+	dynamo.Seq[dynamotest.Person]
+	ctx context.Context
+}
+
+func (s stalled) All() iter.Seq2[dynamotest.Person, error] { return dynamo.All(s.Seq) }
+
+func (s stalled) Pages() iter.Seq2[dynamo.Page[dynamotest.Person], error] {
+	return func(yield func(dynamo.Page[dynamotest.Person], error) bool) {
+		for page, err := range dynamo.Pages(s.Seq) {
+			if !yield(page, err) {
+				return
+			}
+			<-s.ctx.Done()
+			yield(dynamo.Page[dynamotest.Person]{}, s.ctx.Err())
+			return
+		}
+	}
+}
+
+func TestFMapNStalledPage(t *testing.T) {
+	seqCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- dynamo.FMapN(ctx, stalled{fixtureSeq(seqCtx, 3, 2), seqCtx}, 2,
+			func(ctx context.Context, x dynamotest.Person) error {
+				cancel()
+				return nil
+			},
+		)
+	}()
+
+	select {
+	case err := <-done:
+		it.Ok(t).If(err).Equal(context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("FMapN is blocked by the query in-flight")
+	}
+}
+
+func TestMapNOrdered(t *testing.T) {
+	ctx := context.Background()
+
+	var seq []int
+	err := dynamo.MapN(ctx, fixtureSeq(ctx, 5, 4), 4,
+		func(ctx context.Context, x dynamotest.Person) (int, error) {
+			time.Sleep(time.Duration(rand.Intn(1000)) * time.Microsecond)
+			return x.Age, nil
+		},
+		func(x int) error {
+			seq = append(seq, x)
+			return nil
+		},
+	)
+
+	it.Ok(t).
+		If(err).Should().Equal(nil).
+		If(fmt.Sprint(seq)).Should().Equal("[0 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19]")
+}
+
+// lazy hides iterators of the sequence
+type lazy struct{ dynamo.Seq[dynamotest.Person] }
+
+func TestAllWithoutIterator(t *testing.T) {
+	ctx := context.Background()
+
+	ages := []int{}
+	for x, err := range dynamo.All[dynamotest.Person](lazy{fixtureSeq(ctx, 3, 2)}) {
+		it.Ok(t).If(err).Should().Equal(nil)
+		ages = append(ages, x.Age)
+	}
+	it.Ok(t).If(ages).Equal([]int{0, 1, 2, 3, 4, 5})
+
+	pages := 0
+	for page, err := range dynamo.Pages[dynamotest.Person](lazy{fixtureSeq(ctx, 3, 2)}) {
+		it.Ok(t).
+			If(err).Should().Equal(nil).
+			If(page.Count).Equal(6)
+		pages++
+	}
+	it.Ok(t).If(pages).Equal(1)
+}
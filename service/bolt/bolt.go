@@ -0,0 +1,96 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+/*
+Package bolt implements key/value storage on embedded bbolt database for
+single-node deployments. Buckets are tables, entities are ordered by the
+composite key hashkey\x00sortkey. The storage mirrors semantic of DynamoDB
+storage: the pattern matches sort key prefix, sequences are paginated
+with cursors and constraints are evaluated within write transactions.
+
+	db, err := bolt.Open("/var/lib/app/app.db")
+	persons := bolt.Must(bolt.New[Person]("bolt:///person", db))
+*/
+package bolt
+
+import (
+	"fmt"
+	"net/url"
+	"runtime"
+	"time"
+
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/bolt"
+	"github.com/holmes89/dynamo/internal/ddb"
+	"go.etcd.io/bbolt"
+)
+
+// DB is bbolt database, it is shared by storages of different tables
+type DB = bbolt.DB
+
+// Open bbolt database file, the file is created if it does not exist
+func Open(path string) (*DB, error) {
+	return bbolt.Open(path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+}
+
+// Must constraint for api factory
+func Must[T dynamo.Thing](keyval dynamo.KeyVal[T], err error) dynamo.KeyVal[T] {
+	if err != nil {
+		panic(err)
+	}
+
+	return keyval
+}
+
+/*
+New creates bbolt storage. The connector names the bucket (table), it is
+created if it does not exist. Names of key attributes are configured as in
+DynamoDB connector, they are used by constraints.
+
+	bolt.New[Person]("bolt:///person?prefix=pk&suffix=sk", db)
+*/
+func New[T dynamo.Thing](connector string, db *DB) (dynamo.KeyVal[T], error) {
+	uri, err := newURI(connector)
+	if err != nil || db == nil || len(uri.Path) < 2 {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	bucket := []byte(uri.Segments()[0])
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &bolt.Storage[T]{
+		DB:     db,
+		Bucket: bucket,
+		Codec:  ddb.NewCodec[T](uri),
+	}, nil
+}
+
+func newURI(uri string) (*dynamo.URL, error) {
+	spec, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	return (*dynamo.URL)(spec), nil
+}
+
+func errInvalidConnectorURL(url string) error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] invalid connector url: %s", name, url)
+}
@@ -57,7 +57,7 @@ func New[T dynamo.Thing](
 		Table:   table,
 		Index:   index,
 		Codec:   ddb.NewCodec[T](uri),
-		Schema:  ddb.NewSchema[T](),
+		Schema:  ddb.NewSchema[T](uri.Query("prefix", "prefix"), uri.Query("suffix", "suffix")),
 	}, nil
 }
 
@@ -92,3 +92,13 @@ func errInvalidConnectorURL(url string) error {
 
 	return fmt.Errorf("[%s] invalid connector url: %s", name, url)
 }
+
+func errNotSupported(api string) error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] %s is not supported by DynamoDB client", name, api)
+}
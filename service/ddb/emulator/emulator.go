@@ -0,0 +1,821 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+/*
+Package emulator implements in-process emulator of AWS DynamoDB API. It parses
+condition, key condition, filter, update and projection expressions, supports
+local and global secondary indexes, paginates queries, executes batch and
+transactional requests. Errors are reported in the typed form of AWS SDK.
+
+The emulator is designed for testing of storage code paths end to end
+without network:
+
+	emu := emulator.New(emulator.Table{Name: "test", HashKey: "prefix", SortKey: "suffix"})
+	db := ddb.Must(ddb.New[Person]("ddb:///test", emu, nil))
+
+Undeclared tables are created on demand with the default key schema of
+the library: hash key prefix and sort key suffix.
+*/
+package emulator
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/holmes89/dynamo"
+)
+
+// limits of DynamoDB API
+const (
+	maxPageSize      = 1 << 20
+	maxBatchGet      = 100
+	maxBatchWrite    = 25
+	maxTransactItems = 100
+)
+
+/*
+DynamoDB is in-process emulator of AWS DynamoDB API
+*/
+type DynamoDB struct {
+	mu     sync.Mutex
+	tables map[string]*table
+}
+
+var (
+	_ dynamo.DynamoDB      = (*DynamoDB)(nil)
+	_ dynamo.DynamoDBBatch = (*DynamoDB)(nil)
+)
+
+// New creates emulator with declared tables
+func New(tables ...Table) *DynamoDB {
+	db := &DynamoDB{tables: map[string]*table{}}
+	for _, spec := range tables {
+		db.tables[spec.Name] = newTable(spec)
+	}
+	return db
+}
+
+func (db *DynamoDB) table(name *string) (*table, error) {
+	if name == nil || *name == "" {
+		return nil, errValidation("TableName is required")
+	}
+
+	t, has := db.tables[*name]
+	if !has {
+		t = newTable(Table{Name: *name, HashKey: "prefix", SortKey: "suffix"})
+		db.tables[*name] = t
+	}
+
+	return t, nil
+}
+
+func consumed(name *string, mode types.ReturnConsumedCapacity, units float64) *types.ConsumedCapacity {
+	if mode == "" || mode == types.ReturnConsumedCapacityNone {
+		return nil
+	}
+
+	return &types.ConsumedCapacity{
+		TableName:     name,
+		CapacityUnits: aws.Float64(units),
+	}
+}
+
+//-----------------------------------------------------------------------------
+//
+// Writes
+//
+//-----------------------------------------------------------------------------
+
+/*
+write is prepared modification of the item, it is applied if condition holds
+*/
+type write struct {
+	table *table
+	key   string
+	cond  condition
+	// apply computes next item from old one, nil removes the item
+	apply func(item) (item, error)
+	// updated top-level attributes
+	updated []string
+}
+
+func (w *write) exec() (old item, next item, err error) {
+	old = w.table.items[w.key]
+	if !holds(w.cond, old) {
+		return old, nil, errConditionalCheckFailed()
+	}
+
+	if w.apply == nil {
+		return old, old, nil
+	}
+
+	next, err = w.apply(old)
+	if err != nil {
+		return old, nil, err
+	}
+
+	w.commit(next)
+	return old, next, nil
+}
+
+func (w *write) commit(next item) {
+	if w.apply == nil {
+		return
+	}
+
+	if next == nil {
+		delete(w.table.items, w.key)
+	} else {
+		w.table.items[w.key] = next
+	}
+}
+
+func (db *DynamoDB) preparePut(
+	name *string,
+	x item,
+	expr *string,
+	names map[string]string,
+	values map[string]types.AttributeValue,
+) (*write, error) {
+	t, err := db.table(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newScope(names, values)
+	cond, err := parseCondition(s, expr)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.unused(); err != nil {
+		return nil, errValidation("%s", err)
+	}
+
+	key, err := t.keyOf(x, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for attr, val := range x {
+		if val == nil {
+			return nil, errValidation("Supplied AttributeValue is empty, must contain exactly one of the supported datatypes: %s", attr)
+		}
+	}
+
+	val := copyItem(x)
+	return &write{
+		table: t,
+		key:   key,
+		cond:  cond,
+		apply: func(item) (item, error) { return val, nil },
+	}, nil
+}
+
+func (db *DynamoDB) prepareDelete(
+	name *string,
+	k item,
+	expr *string,
+	names map[string]string,
+	values map[string]types.AttributeValue,
+) (*write, error) {
+	w, err := db.prepareCheck(name, k, expr, names, values)
+	if err != nil {
+		return nil, err
+	}
+
+	w.apply = func(item) (item, error) { return nil, nil }
+	return w, nil
+}
+
+func (db *DynamoDB) prepareCheck(
+	name *string,
+	k item,
+	expr *string,
+	names map[string]string,
+	values map[string]types.AttributeValue,
+) (*write, error) {
+	t, err := db.table(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newScope(names, values)
+	cond, err := parseCondition(s, expr)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.unused(); err != nil {
+		return nil, errValidation("%s", err)
+	}
+
+	key, err := t.keyOf(k, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &write{table: t, key: key, cond: cond}, nil
+}
+
+func (db *DynamoDB) prepareUpdate(
+	name *string,
+	k item,
+	expr *string,
+	cexpr *string,
+	names map[string]string,
+	values map[string]types.AttributeValue,
+) (*write, error) {
+	t, err := db.table(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newScope(names, values)
+	upd, err := parseUpdate(s, expr)
+	if err != nil {
+		return nil, err
+	}
+	cond, err := parseCondition(s, cexpr)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.unused(); err != nil {
+		return nil, errValidation("%s", err)
+	}
+
+	key, err := t.keyOf(k, true)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range upd {
+		if t.isKey(a.path[0].name) {
+			return nil, errValidation("Cannot update attribute %s. This attribute is part of the key", a.path[0].name)
+		}
+	}
+
+	w := &write{table: t, key: key, cond: cond}
+	w.apply = func(old item) (item, error) {
+		if old == nil {
+			old = t.keyOnly(k)
+		}
+
+		next, updated, err := upd.apply(old)
+		if err != nil {
+			return nil, err
+		}
+		w.updated = updated
+		return next, nil
+	}
+
+	return w, nil
+}
+
+// PutItem creates or replaces the item
+func (db *DynamoDB) PutItem(ctx context.Context, input *dynamodb.PutItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	switch input.ReturnValues {
+	case "", types.ReturnValueNone, types.ReturnValueAllOld:
+	default:
+		return nil, errValidation("ReturnValues can only be ALL_OLD or NONE")
+	}
+
+	w, err := db.preparePut(input.TableName, input.Item,
+		input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+
+	old, next, err := w.exec()
+	if err != nil {
+		return nil, err
+	}
+
+	out := &dynamodb.PutItemOutput{
+		ConsumedCapacity: consumed(input.TableName, input.ReturnConsumedCapacity,
+			writeUnits(max(sizeOfItem(old), sizeOfItem(next)))),
+	}
+	if input.ReturnValues == types.ReturnValueAllOld {
+		out.Attributes = copyItem(old)
+	}
+
+	return out, nil
+}
+
+// DeleteItem removes the item
+func (db *DynamoDB) DeleteItem(ctx context.Context, input *dynamodb.DeleteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	switch input.ReturnValues {
+	case "", types.ReturnValueNone, types.ReturnValueAllOld:
+	default:
+		return nil, errValidation("ReturnValues can only be ALL_OLD or NONE")
+	}
+
+	w, err := db.prepareDelete(input.TableName, input.Key,
+		input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+
+	old, _, err := w.exec()
+	if err != nil {
+		return nil, err
+	}
+
+	out := &dynamodb.DeleteItemOutput{
+		ConsumedCapacity: consumed(input.TableName, input.ReturnConsumedCapacity,
+			writeUnits(sizeOfItem(old))),
+	}
+	if input.ReturnValues == types.ReturnValueAllOld {
+		out.Attributes = copyItem(old)
+	}
+
+	return out, nil
+}
+
+// UpdateItem edits attributes of the item, the item is created if it does not exist
+func (db *DynamoDB) UpdateItem(ctx context.Context, input *dynamodb.UpdateItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	w, err := db.prepareUpdate(input.TableName, input.Key, input.UpdateExpression,
+		input.ConditionExpression, input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, err
+	}
+
+	old, next, err := w.exec()
+	if err != nil {
+		return nil, err
+	}
+
+	out := &dynamodb.UpdateItemOutput{
+		ConsumedCapacity: consumed(input.TableName, input.ReturnConsumedCapacity,
+			writeUnits(max(sizeOfItem(old), sizeOfItem(next)))),
+	}
+
+	switch input.ReturnValues {
+	case types.ReturnValueAllOld:
+		out.Attributes = copyItem(old)
+	case types.ReturnValueAllNew:
+		out.Attributes = copyItem(next)
+	case types.ReturnValueUpdatedOld:
+		out.Attributes = pick(old, w.updated)
+	case types.ReturnValueUpdatedNew:
+		out.Attributes = pick(next, w.updated)
+	}
+
+	return out, nil
+}
+
+// pick top-level attributes of the item
+func pick(x item, attrs []string) item {
+	if x == nil {
+		return nil
+	}
+
+	y := item{}
+	for _, attr := range attrs {
+		if val, has := x[attr]; has {
+			y[attr] = copyValue(val)
+		}
+	}
+	return y
+}
+
+//-----------------------------------------------------------------------------
+//
+// Reads
+//
+//-----------------------------------------------------------------------------
+
+func (db *DynamoDB) get(
+	name *string,
+	k item,
+	expr *string,
+	names map[string]string,
+) (item, int, error) {
+	t, err := db.table(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s := newScope(names, nil)
+	proj, err := parseProjection(s, expr)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := s.unused(); err != nil {
+		return nil, 0, errValidation("%s", err)
+	}
+
+	key, err := t.keyOf(k, true)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	x := t.items[key]
+	if x == nil {
+		return nil, 0, nil
+	}
+
+	return project(x, proj), sizeOfItem(x), nil
+}
+
+// GetItem reads the item
+func (db *DynamoDB) GetItem(ctx context.Context, input *dynamodb.GetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	x, size, err := db.get(input.TableName, input.Key, input.ProjectionExpression, input.ExpressionAttributeNames)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dynamodb.GetItemOutput{
+		Item: x,
+		ConsumedCapacity: consumed(input.TableName, input.ReturnConsumedCapacity,
+			readUnits(size, aws.ToBool(input.ConsistentRead))),
+	}, nil
+}
+
+/*
+Query items of the table or index. Items are evaluated in the order of sort
+key until the limit or 1MB of data, filter is applied to evaluated items.
+*/
+func (db *DynamoDB) Query(ctx context.Context, input *dynamodb.QueryInput, opts ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.KeyConditionExpression == nil {
+		return nil, errValidation("Either the KeyConditions or KeyConditionExpression parameter must be specified in the request")
+	}
+
+	s := newScope(input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	key, err := parseCondition(s, input.KeyConditionExpression)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := parseCondition(s, input.FilterExpression)
+	if err != nil {
+		return nil, err
+	}
+	proj, err := parseProjection(s, input.ProjectionExpression)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.unused(); err != nil {
+		return nil, errValidation("%s", err)
+	}
+
+	idx, global, err := t.index(input.IndexName)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case global && aws.ToBool(input.ConsistentRead):
+		return nil, errValidation("Consistent reads are not supported on global secondary indexes")
+	case !keyConditionOf(idx, key):
+		return nil, errValidation("Query condition missed key schema element: %s", idx.HashKey)
+	case input.Select == types.SelectCount && proj != nil:
+		return nil, errValidation("Cannot specify the ProjectionExpression when choosing to get only the Count")
+	case input.ExclusiveStartKey != nil && !t.isStartKey(idx, input.ExclusiveStartKey):
+		return nil, errValidation("The provided starting key is invalid")
+	}
+
+	forward := input.ScanIndexForward == nil || *input.ScanIndexForward
+	limit := int(aws.ToInt32(input.Limit))
+
+	out := &dynamodb.QueryOutput{}
+	if input.Select != types.SelectCount {
+		out.Items = []item{}
+	}
+
+	size := 0
+	for _, x := range t.scan(idx, key, input.ExclusiveStartKey, forward) {
+		out.ScannedCount++
+		size += sizeOfItem(x)
+
+		if holds(filter, x) {
+			out.Count++
+			if input.Select != types.SelectCount {
+				out.Items = append(out.Items, project(x, proj))
+			}
+		}
+
+		// Note: the page is closed by limit even if there are no more items
+		if (limit > 0 && int(out.ScannedCount) == limit) || size >= maxPageSize {
+			out.LastEvaluatedKey = t.lastKey(idx, x)
+			break
+		}
+	}
+
+	out.ConsumedCapacity = consumed(input.TableName, input.ReturnConsumedCapacity,
+		readUnits(size, aws.ToBool(input.ConsistentRead)))
+
+	return out, nil
+}
+
+//-----------------------------------------------------------------------------
+//
+// Batch
+//
+//-----------------------------------------------------------------------------
+
+// BatchGetItem reads multiple items from one or more tables
+func (db *DynamoDB) BatchGetItem(ctx context.Context, input *dynamodb.BatchGetItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	n := 0
+	for _, req := range input.RequestItems {
+		n += len(req.Keys)
+	}
+	if n == 0 || n > maxBatchGet {
+		return nil, errValidation("Too many items requested for the BatchGetItem call")
+	}
+
+	out := &dynamodb.BatchGetItemOutput{
+		Responses:       map[string][]map[string]types.AttributeValue{},
+		UnprocessedKeys: map[string]types.KeysAndAttributes{},
+	}
+
+	for name, req := range input.RequestItems {
+		seen := map[string]bool{}
+		size := 0
+		seq := make([]item, 0, len(req.Keys))
+		for _, k := range req.Keys {
+			t, err := db.table(aws.String(name))
+			if err != nil {
+				return nil, err
+			}
+			key, err := t.keyOf(k, true)
+			if err != nil {
+				return nil, err
+			}
+			if seen[key] {
+				return nil, errValidation("Provided list of item keys contains duplicates")
+			}
+			seen[key] = true
+
+			x, n, err := db.get(aws.String(name), k, req.ProjectionExpression, req.ExpressionAttributeNames)
+			if err != nil {
+				return nil, err
+			}
+			if x != nil {
+				seq = append(seq, x)
+				size += n
+			}
+		}
+
+		out.Responses[name] = seq
+		if c := consumed(aws.String(name), input.ReturnConsumedCapacity, readUnits(size, aws.ToBool(req.ConsistentRead))); c != nil {
+			out.ConsumedCapacity = append(out.ConsumedCapacity, *c)
+		}
+	}
+
+	return out, nil
+}
+
+// BatchWriteItem puts or deletes multiple items in one or more tables
+func (db *DynamoDB) BatchWriteItem(ctx context.Context, input *dynamodb.BatchWriteItemInput, opts ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	n := 0
+	for _, seq := range input.RequestItems {
+		n += len(seq)
+	}
+	if n == 0 || n > maxBatchWrite {
+		return nil, errValidation("Too many items requested for the BatchWriteItem call")
+	}
+
+	writes := make([]*write, 0, n)
+	units := map[string]float64{}
+	for name, seq := range input.RequestItems {
+		for _, req := range seq {
+			var (
+				w   *write
+				err error
+			)
+
+			switch {
+			case req.PutRequest != nil:
+				w, err = db.preparePut(aws.String(name), req.PutRequest.Item, nil, nil, nil)
+			case req.DeleteRequest != nil:
+				w, err = db.prepareDelete(aws.String(name), req.DeleteRequest.Key, nil, nil, nil)
+			default:
+				err = errValidation("Supplied WriteRequest is empty")
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			writes = append(writes, w)
+		}
+	}
+
+	if err := unique(writes); err != nil {
+		return nil, err
+	}
+
+	for _, w := range writes {
+		old, next, err := w.exec()
+		if err != nil {
+			return nil, err
+		}
+		units[w.table.Name] += writeUnits(max(sizeOfItem(old), sizeOfItem(next)))
+	}
+
+	out := &dynamodb.BatchWriteItemOutput{
+		UnprocessedItems: map[string][]types.WriteRequest{},
+	}
+	for name, u := range units {
+		if c := consumed(aws.String(name), input.ReturnConsumedCapacity, u); c != nil {
+			out.ConsumedCapacity = append(out.ConsumedCapacity, *c)
+		}
+	}
+
+	return out, nil
+}
+
+// unique checks that writes modify distinct items
+func unique(writes []*write) error {
+	seen := map[[2]string]bool{}
+	for _, w := range writes {
+		key := [2]string{w.table.Name, w.key}
+		if seen[key] {
+			return errValidation("Provided list of item keys contains duplicates")
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+//
+// Transactions
+//
+//-----------------------------------------------------------------------------
+
+// TransactGetItems reads multiple items atomically
+func (db *DynamoDB) TransactGetItems(ctx context.Context, input *dynamodb.TransactGetItemsInput, opts ...func(*dynamodb.Options)) (*dynamodb.TransactGetItemsOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if len(input.TransactItems) == 0 || len(input.TransactItems) > maxTransactItems {
+		return nil, errValidation("Member must have length less than or equal to %d", maxTransactItems)
+	}
+
+	out := &dynamodb.TransactGetItemsOutput{
+		Responses: make([]types.ItemResponse, len(input.TransactItems)),
+	}
+
+	units := map[string]float64{}
+	for i, req := range input.TransactItems {
+		if req.Get == nil {
+			return nil, errValidation("Supplied TransactGetItem is empty")
+		}
+
+		x, size, err := db.get(req.Get.TableName, req.Get.Key, req.Get.ProjectionExpression, req.Get.ExpressionAttributeNames)
+		if err != nil {
+			return nil, err
+		}
+
+		out.Responses[i].Item = x
+		units[aws.ToString(req.Get.TableName)] += 2 * readUnits(size, true)
+	}
+
+	for name, u := range units {
+		if c := consumed(aws.String(name), input.ReturnConsumedCapacity, u); c != nil {
+			out.ConsumedCapacity = append(out.ConsumedCapacity, *c)
+		}
+	}
+
+	return out, nil
+}
+
+/*
+TransactWriteItems applies multiple writes atomically. Writes are applied
+only if conditions of all writes hold.
+*/
+func (db *DynamoDB) TransactWriteItems(ctx context.Context, input *dynamodb.TransactWriteItemsInput, opts ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if len(input.TransactItems) == 0 || len(input.TransactItems) > maxTransactItems {
+		return nil, errValidation("Member must have length less than or equal to %d", maxTransactItems)
+	}
+
+	writes := make([]*write, len(input.TransactItems))
+	returns := make([]types.ReturnValuesOnConditionCheckFailure, len(input.TransactItems))
+	for i, req := range input.TransactItems {
+		var (
+			w   *write
+			err error
+		)
+
+		switch {
+		case req.ConditionCheck != nil:
+			op := req.ConditionCheck
+			if op.ConditionExpression == nil {
+				return nil, errValidation("ConditionExpression is required for ConditionCheck")
+			}
+			w, err = db.prepareCheck(op.TableName, op.Key,
+				op.ConditionExpression, op.ExpressionAttributeNames, op.ExpressionAttributeValues)
+			returns[i] = op.ReturnValuesOnConditionCheckFailure
+		case req.Put != nil:
+			op := req.Put
+			w, err = db.preparePut(op.TableName, op.Item,
+				op.ConditionExpression, op.ExpressionAttributeNames, op.ExpressionAttributeValues)
+			returns[i] = op.ReturnValuesOnConditionCheckFailure
+		case req.Delete != nil:
+			op := req.Delete
+			w, err = db.prepareDelete(op.TableName, op.Key,
+				op.ConditionExpression, op.ExpressionAttributeNames, op.ExpressionAttributeValues)
+			returns[i] = op.ReturnValuesOnConditionCheckFailure
+		case req.Update != nil:
+			op := req.Update
+			w, err = db.prepareUpdate(op.TableName, op.Key, op.UpdateExpression,
+				op.ConditionExpression, op.ExpressionAttributeNames, op.ExpressionAttributeValues)
+			returns[i] = op.ReturnValuesOnConditionCheckFailure
+		default:
+			err = errValidation("Supplied TransactWriteItem is empty")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		writes[i] = w
+	}
+
+	if err := unique(writes); err != nil {
+		return nil, errValidation("Transaction request cannot include multiple operations on one item")
+	}
+
+	// Note: conditions are evaluated before any write
+	failed := false
+	reasons := make([]types.CancellationReason, len(writes))
+	for i, w := range writes {
+		reasons[i].Code = aws.String("None")
+
+		old := w.table.items[w.key]
+		if !holds(w.cond, old) {
+			failed = true
+			reasons[i].Code = aws.String("ConditionalCheckFailed")
+			reasons[i].Message = aws.String("The conditional request failed")
+			if returns[i] == types.ReturnValuesOnConditionCheckFailureAllOld {
+				reasons[i].Item = copyItem(old)
+			}
+		}
+	}
+	if failed {
+		return nil, errTransactionCanceled(reasons)
+	}
+
+	values := make([]item, len(writes))
+	units := map[string]float64{}
+	for i, w := range writes {
+		old := w.table.items[w.key]
+		if w.apply == nil {
+			continue
+		}
+
+		next, err := w.apply(old)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = next
+		units[w.table.Name] += 2 * writeUnits(max(sizeOfItem(old), sizeOfItem(next)))
+	}
+
+	for i, w := range writes {
+		w.commit(values[i])
+	}
+
+	out := &dynamodb.TransactWriteItemsOutput{}
+	for name, u := range units {
+		if c := consumed(aws.String(name), input.ReturnConsumedCapacity, u); c != nil {
+			out.ConsumedCapacity = append(out.ConsumedCapacity, *c)
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,423 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package emulator_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/fogfish/curie"
+	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/service/ddb"
+	"github.com/holmes89/dynamo/service/ddb/emulator"
+)
+
+type person struct {
+	Org  curie.IRI `dynamodbav:"prefix,omitempty"`
+	ID   curie.IRI `dynamodbav:"suffix,omitempty"`
+	Name string    `dynamodbav:"name,omitempty"`
+	Age  int       `dynamodbav:"age,omitempty"`
+	City string    `dynamodbav:"city,omitempty"`
+}
+
+func (p person) HashKey() curie.IRI { return p.Org }
+func (p person) SortKey() curie.IRI { return p.ID }
+
+var (
+	name = dynamo.Schema1[person, string]("Name")
+	age  = dynamo.Schema1[person, int]("Age")
+)
+
+func fixture() (*emulator.DynamoDB, dynamo.KeyVal[person]) {
+	emu := emulator.New(emulator.Table{
+		Name:    "test",
+		HashKey: "prefix",
+		SortKey: "suffix",
+		Indexes: []emulator.Index{
+			{Name: "city", HashKey: "city", SortKey: "name"},
+		},
+	})
+	db := ddb.Must(ddb.New[person]("ddb:///test", emu, nil))
+
+	for i := 0; i < 5; i++ {
+		db.Put(context.Background(), person{
+			Org:  "org:a",
+			ID:   curie.New("person:%d", i),
+			Name: fmt.Sprintf("name %d", 4-i),
+			Age:  20 + i,
+			City: []string{"berne", "zurich"}[i%2],
+		})
+	}
+	return emu, db
+}
+
+func ids(seq dynamo.Seq[person]) string {
+	keys := []string{}
+	for x, err := range dynamo.All(seq) {
+		if err != nil {
+			return err.Error()
+		}
+		keys = append(keys, string(x.ID))
+	}
+	return fmt.Sprint(keys)
+}
+
+func TestKeyVal(t *testing.T) {
+	_, db := fixture()
+	key := person{Org: "org:a", ID: "person:1"}
+
+	val, err := db.Get(context.Background(), key)
+	it.Ok(t).
+		IfNil(err).
+		If(val.Name).Equal("name 3")
+
+	val, err = db.Update(context.Background(), person{Org: "org:a", ID: "person:1", Age: 30})
+	it.Ok(t).
+		IfNil(err).
+		If(val.Age).Equal(30).
+		If(val.Name).Equal("name 3")
+
+	it.Ok(t).IfNil(db.Remove(context.Background(), key))
+
+	_, err = db.Get(context.Background(), key)
+	var e interface{ NotFound() string }
+	it.Ok(t).If(errors.As(err, &e)).Equal(true)
+}
+
+func TestKeyValConstraints(t *testing.T) {
+	_, db := fixture()
+	key := person{Org: "org:a", ID: "person:1", Name: "name 3", Age: 21}
+
+	var e interface{ PreConditionFailed() bool }
+
+	it.Ok(t).
+		IfNil(db.Put(context.Background(), key, name.Eq("name 3"))).
+		IfNil(db.Put(context.Background(), key, age.Lt(22))).
+		IfNil(db.Put(context.Background(), key, name.Exists())).
+		If(errors.As(db.Put(context.Background(), key, name.NotExists()), &e)).Equal(true).
+		If(errors.As(db.Put(context.Background(), key, age.Gt(21)), &e)).Equal(true).
+		If(errors.As(db.Remove(context.Background(), key, name.Ne("name 3")), &e)).Equal(true)
+
+	_, err := db.Update(context.Background(), person{Org: "org:a", ID: "person:9", Age: 1}, name.Exists())
+	it.Ok(t).If(errors.As(err, &e)).Equal(true)
+}
+
+func TestKeyValMatch(t *testing.T) {
+	_, db := fixture()
+	key := person{Org: "org:a", ID: "person:"}
+
+	it.Ok(t).
+		If(ids(db.Match(context.Background(), key))).
+		Equal("[person:0 person:1 person:2 person:3 person:4]").
+		If(ids(db.Match(context.Background(), key).Reverse())).
+		Equal("[person:4 person:3 person:2 person:1 person:0]")
+
+	seq := db.Match(context.Background(), key).Limit(2)
+	it.Ok(t).If(ids(seq)).Equal("[person:0 person:1]")
+
+	seq = db.Match(context.Background(), key).Limit(2).Continue(seq.Cursor())
+	it.Ok(t).If(ids(seq)).Equal("[person:2 person:3]")
+
+	n, err := db.(dynamo.KeyValCounter[person]).Count(context.Background(), key, age.Ge(22))
+	it.Ok(t).
+		IfNil(err).
+		If(n).Equal(3)
+}
+
+type resident person
+
+func (r resident) HashKey() curie.IRI { return curie.IRI(r.City) }
+func (r resident) SortKey() curie.IRI { return curie.IRI(r.Name) }
+
+func TestIndex(t *testing.T) {
+	emu, _ := fixture()
+	db := ddb.Must(ddb.New[resident]("ddb:///test/city?prefix=city&suffix=name", emu, nil))
+
+	names := func(seq dynamo.Seq[resident]) string {
+		keys := []string{}
+		for x, err := range dynamo.All(seq) {
+			if err != nil {
+				return err.Error()
+			}
+			keys = append(keys, string(x.ID))
+		}
+		return fmt.Sprint(keys)
+	}
+
+	it.Ok(t).
+		If(names(db.Match(context.Background(), resident{City: "berne"}))).
+		Equal("[person:4 person:2 person:0]")
+
+	seq := db.Match(context.Background(), resident{City: "berne"}).Limit(1)
+	it.Ok(t).If(names(seq)).Equal("[person:4]")
+
+	seq = db.Match(context.Background(), resident{City: "berne"}).Limit(2).Continue(seq.Cursor())
+	it.Ok(t).If(names(seq)).Equal("[person:2 person:0]")
+}
+
+func query(emu *emulator.DynamoDB, input *dynamodb.QueryInput) ([]map[string]types.AttributeValue, error) {
+	input.TableName = aws.String("test")
+	out, err := emu.Query(context.Background(), input)
+	if err != nil {
+		return nil, err
+	}
+	return out.Items, nil
+}
+
+func TestQuery(t *testing.T) {
+	emu, _ := fixture()
+	values := func(kv ...any) map[string]types.AttributeValue {
+		m := map[string]types.AttributeValue{":org": &types.AttributeValueMemberS{Value: "org:a"}}
+		for i := 0; i < len(kv); i += 2 {
+			v, _ := attributevalue.Marshal(kv[i+1])
+			m[kv[i].(string)] = v
+		}
+		return m
+	}
+
+	for expr, expected := range map[string]int{
+		"#a BETWEEN :lo AND :hi":                              3,
+		"#a IN (:lo, :hi)":                                    2,
+		"#a > :lo AND NOT #a >= :hi":                          1,
+		"(#a < :lo OR #a > :hi) AND #a <> :lo":                2,
+		"begins_with(#n, :lo) OR #a = :hi":                    1,
+		"contains(#n, :lo) OR size(#n) = :hi":                 0,
+		"attribute_type(#a, :lo) OR #a = :hi":                 1,
+		"NOT (attribute_exists(#a) AND #a > :lo) OR #a = :hi": 3,
+	} {
+		// Note: unused placeholders are rejected
+		names := map[string]string{}
+		for k, v := range map[string]string{"#n": "name", "#a": "age"} {
+			if strings.Contains(expr, k) {
+				names[k] = v
+			}
+		}
+
+		items, err := query(emu, &dynamodb.QueryInput{
+			KeyConditionExpression:    aws.String("prefix = :org"),
+			FilterExpression:          aws.String(expr),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values(":lo", 21, ":hi", 23),
+		})
+		it.Ok(t).
+			IfNil(err).
+			If(len(items)).Equal(expected)
+	}
+
+	items, err := query(emu, &dynamodb.QueryInput{
+		KeyConditionExpression:    aws.String("prefix = :org AND suffix BETWEEN :lo AND :hi"),
+		ProjectionExpression:      aws.String("#n"),
+		ExpressionAttributeNames:  map[string]string{"#n": "name"},
+		ExpressionAttributeValues: values(":lo", "person:1", ":hi", "person:3"),
+	})
+	it.Ok(t).
+		IfNil(err).
+		If(len(items)).Equal(3).
+		If(items[0]).Equal(map[string]types.AttributeValue{"name": &types.AttributeValueMemberS{Value: "name 3"}})
+
+	out, err := emu.Query(context.Background(), &dynamodb.QueryInput{
+		TableName:                 aws.String("test"),
+		KeyConditionExpression:    aws.String("prefix = :org"),
+		ExpressionAttributeValues: values(),
+		Limit:                     aws.Int32(5),
+		Select:                    types.SelectCount,
+	})
+	it.Ok(t).
+		IfNil(err).
+		If(out.Count).Equal(int32(5)).
+		IfNotNil(out.LastEvaluatedKey)
+}
+
+func TestQueryValidation(t *testing.T) {
+	emu, _ := fixture()
+
+	for _, input := range []*dynamodb.QueryInput{
+		{KeyConditionExpression: aws.String("suffix = :org")},
+		{KeyConditionExpression: aws.String("prefix = :unknown")},
+		{KeyConditionExpression: aws.String("prefix = :org AND")},
+		{KeyConditionExpression: aws.String("prefix = :org"), ExpressionAttributeNames: map[string]string{"#x": "x"}},
+		{KeyConditionExpression: aws.String("prefix = :org"), IndexName: aws.String("unknown")},
+	} {
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{":org": &types.AttributeValueMemberS{Value: "org:a"}}
+		_, err := query(emu, input)
+
+		var e interface{ ErrorCode() string }
+		it.Ok(t).
+			If(errors.As(err, &e)).Equal(true).
+			If(e.ErrorCode()).Equal("ValidationException")
+	}
+}
+
+func key(suffix string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"prefix": &types.AttributeValueMemberS{Value: "org:a"},
+		"suffix": &types.AttributeValueMemberS{Value: suffix},
+	}
+}
+
+func TestUpdateExpression(t *testing.T) {
+	emu, _ := fixture()
+
+	out, err := emu.UpdateItem(context.Background(), &dynamodb.UpdateItemInput{
+		TableName: aws.String("test"),
+		Key:       key("person:1"),
+		UpdateExpression: aws.String(
+			"SET age = age + :one, tags = list_append(if_not_exists(tags, :empty), :tags), addr.city = :city " +
+				"REMOVE city ADD visits :one, roles :roles DELETE roles :drop",
+		),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one":   &types.AttributeValueMemberN{Value: "1"},
+			":empty": &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
+			":tags":  &types.AttributeValueMemberL{Value: []types.AttributeValue{&types.AttributeValueMemberS{Value: "a"}}},
+			":city":  &types.AttributeValueMemberS{Value: "berne"},
+			":roles": &types.AttributeValueMemberSS{Value: []string{"admin", "user"}},
+			":drop":  &types.AttributeValueMemberSS{Value: []string{"admin"}},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	// Note: the parent of nested attribute must exist
+	it.Ok(t).IfNotNil(err)
+
+	out, err = emu.UpdateItem(context.Background(), &dynamodb.UpdateItemInput{
+		TableName: aws.String("test"),
+		Key:       key("person:1"),
+		UpdateExpression: aws.String(
+			"SET age = age + :one, tags = list_append(if_not_exists(tags, :empty), :tags) " +
+				"REMOVE city ADD visits :one, roles :roles",
+		),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one":   &types.AttributeValueMemberN{Value: "1"},
+			":empty": &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
+			":tags":  &types.AttributeValueMemberL{Value: []types.AttributeValue{&types.AttributeValueMemberS{Value: "a"}}},
+			":roles": &types.AttributeValueMemberSS{Value: []string{"admin", "user"}},
+		},
+		ReturnValues: types.ReturnValueUpdatedNew,
+	})
+	it.Ok(t).
+		IfNil(err).
+		If(out.Attributes).Equal(map[string]types.AttributeValue{
+		"age":    &types.AttributeValueMemberN{Value: "22"},
+		"tags":   &types.AttributeValueMemberL{Value: []types.AttributeValue{&types.AttributeValueMemberS{Value: "a"}}},
+		"visits": &types.AttributeValueMemberN{Value: "1"},
+		"roles":  &types.AttributeValueMemberSS{Value: []string{"admin", "user"}},
+	})
+
+	out, err = emu.UpdateItem(context.Background(), &dynamodb.UpdateItemInput{
+		TableName:           aws.String("test"),
+		Key:                 key("person:1"),
+		UpdateExpression:    aws.String("DELETE roles :drop SET tags[0] = :val, tags[5] = :val"),
+		ConditionExpression: aws.String("attribute_not_exists(city) AND tags[0] = :a"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":drop": &types.AttributeValueMemberSS{Value: []string{"admin"}},
+			":val":  &types.AttributeValueMemberS{Value: "b"},
+			":a":    &types.AttributeValueMemberS{Value: "a"},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	it.Ok(t).
+		IfNil(err).
+		If(out.Attributes["roles"]).Equal(&types.AttributeValueMemberSS{Value: []string{"user"}}).
+		If(out.Attributes["tags"]).Equal(&types.AttributeValueMemberL{Value: []types.AttributeValue{
+		&types.AttributeValueMemberS{Value: "b"},
+		&types.AttributeValueMemberS{Value: "b"},
+	}})
+
+	_, err = emu.UpdateItem(context.Background(), &dynamodb.UpdateItemInput{
+		TableName:                 aws.String("test"),
+		Key:                       key("person:1"),
+		UpdateExpression:          aws.String("SET suffix = :val"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":val": &types.AttributeValueMemberS{Value: "b"}},
+	})
+	it.Ok(t).IfNotNil(err)
+}
+
+func TestBatch(t *testing.T) {
+	emu, _ := fixture()
+
+	_, err := emu.BatchWriteItem(context.Background(), &dynamodb.BatchWriteItemInput{
+		RequestItems: map[string][]types.WriteRequest{
+			"test": {
+				{PutRequest: &types.PutRequest{Item: key("person:9")}},
+				{DeleteRequest: &types.DeleteRequest{Key: key("person:0")}},
+			},
+		},
+	})
+	it.Ok(t).IfNil(err)
+
+	out, err := emu.BatchGetItem(context.Background(), &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]types.KeysAndAttributes{
+			"test": {Keys: []map[string]types.AttributeValue{key("person:0"), key("person:9"), key("person:1")}},
+		},
+	})
+	it.Ok(t).
+		IfNil(err).
+		If(len(out.Responses["test"])).Equal(2)
+
+	_, err = emu.BatchGetItem(context.Background(), &dynamodb.BatchGetItemInput{
+		RequestItems: map[string]types.KeysAndAttributes{
+			"test": {Keys: []map[string]types.AttributeValue{key("person:1"), key("person:1")}},
+		},
+	})
+	it.Ok(t).IfNotNil(err)
+}
+
+func TestTransaction(t *testing.T) {
+	emu, _ := fixture()
+
+	write := func(cond string) error {
+		_, err := emu.TransactWriteItems(context.Background(), &dynamodb.TransactWriteItemsInput{
+			TransactItems: []types.TransactWriteItem{
+				{ConditionCheck: &types.ConditionCheck{
+					TableName:           aws.String("test"),
+					Key:                 key("person:0"),
+					ConditionExpression: aws.String(cond),
+				}},
+				{Put: &types.Put{TableName: aws.String("test"), Item: key("person:9")}},
+				{Delete: &types.Delete{TableName: aws.String("test"), Key: key("person:1")}},
+			},
+		})
+		return err
+	}
+
+	get := func() int {
+		out, _ := emu.TransactGetItems(context.Background(), &dynamodb.TransactGetItemsInput{
+			TransactItems: []types.TransactGetItem{
+				{Get: &types.Get{TableName: aws.String("test"), Key: key("person:1")}},
+				{Get: &types.Get{TableName: aws.String("test"), Key: key("person:9")}},
+			},
+		})
+		n := 0
+		for _, x := range out.Responses {
+			if x.Item != nil {
+				n++
+			}
+		}
+		return n
+	}
+
+	var e *types.TransactionCanceledException
+	err := write("attribute_not_exists(age)")
+	it.Ok(t).
+		If(errors.As(err, &e)).Equal(true).
+		If(*e.CancellationReasons[0].Code).Equal("ConditionalCheckFailed").
+		If(*e.CancellationReasons[1].Code).Equal("None").
+		If(get()).Equal(1)
+
+	it.Ok(t).
+		IfNil(write("attribute_exists(age)")).
+		If(get()).Equal(1)
+}
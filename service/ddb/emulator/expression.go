@@ -0,0 +1,630 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file implements parser of DynamoDB expressions
+//
+
+package emulator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+//-----------------------------------------------------------------------------
+//
+// Lexer
+//
+//-----------------------------------------------------------------------------
+
+type kind int
+
+const (
+	tEOF kind = iota
+	tIdent
+	tName
+	tValue
+	tNumber
+	tSymbol
+)
+
+type token struct {
+	kind kind
+	text string
+}
+
+func lex(s string) ([]token, error) {
+	seq := make([]token, 0)
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#' || c == ':' || isIdentStart(c):
+			j := i + 1
+			for j < len(s) && isIdent(s[j]) {
+				j++
+			}
+			k := tIdent
+			switch c {
+			case '#':
+				k = tName
+			case ':':
+				k = tValue
+			}
+			if j == i+1 && k != tIdent {
+				return nil, fmt.Errorf("invalid token at %d", i)
+			}
+			seq = append(seq, token{kind: k, text: s[i:j]})
+			i = j
+		case c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			seq = append(seq, token{kind: tNumber, text: s[i:j]})
+			i = j
+		case strings.HasPrefix(s[i:], "<>") || strings.HasPrefix(s[i:], "<=") || strings.HasPrefix(s[i:], ">="):
+			seq = append(seq, token{kind: tSymbol, text: s[i : i+2]})
+			i += 2
+		case strings.IndexByte("()[],.=<>+-", c) != -1:
+			seq = append(seq, token{kind: tSymbol, text: s[i : i+1]})
+			i++
+		default:
+			return nil, fmt.Errorf("invalid token %q at %d", c, i)
+		}
+	}
+
+	return append(seq, token{kind: tEOF}), nil
+}
+
+func isIdentStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+
+func isIdent(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+//-----------------------------------------------------------------------------
+//
+// Expression context
+//
+//-----------------------------------------------------------------------------
+
+/*
+scope of expressions of single request, it resolves placeholders and tracks
+their usage. DynamoDB rejects requests with unused placeholders.
+*/
+type scope struct {
+	names      map[string]string
+	values     map[string]types.AttributeValue
+	usedNames  map[string]bool
+	usedValues map[string]bool
+}
+
+func newScope(names map[string]string, values map[string]types.AttributeValue) *scope {
+	return &scope{
+		names:      names,
+		values:     values,
+		usedNames:  map[string]bool{},
+		usedValues: map[string]bool{},
+	}
+}
+
+// unused checks that every placeholder is used by expressions
+func (s *scope) unused() error {
+	for k := range s.names {
+		if !s.usedNames[k] {
+			return fmt.Errorf("Value provided in ExpressionAttributeNames unused in expressions: keys: {%s}", k)
+		}
+	}
+
+	for k := range s.values {
+		if !s.usedValues[k] {
+			return fmt.Errorf("Value provided in ExpressionAttributeValues unused in expressions: keys: {%s}", k)
+		}
+	}
+
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+//
+// Parser
+//
+//-----------------------------------------------------------------------------
+
+type syntaxError struct{ err error }
+
+type parser struct {
+	scope  *scope
+	tokens []token
+	at     int
+}
+
+func newParser(s *scope, expr string) (*parser, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &parser{scope: s, tokens: tokens}, nil
+}
+
+// run parser, syntax errors are recovered as errors
+func (p *parser) run(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(syntaxError)
+			if !ok {
+				panic(r)
+			}
+			err = e.err
+		}
+	}()
+
+	f()
+	if p.peek().kind != tEOF {
+		p.fail("unexpected token %s", p.peek().text)
+	}
+	return nil
+}
+
+func (p *parser) fail(format string, args ...any) {
+	panic(syntaxError{fmt.Errorf(format, args...)})
+}
+
+func (p *parser) peek() token { return p.tokens[p.at] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.at]
+	if t.kind != tEOF {
+		p.at++
+	}
+	return t
+}
+
+// is checks if next token is the keyword or symbol
+func (p *parser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == tIdent || t.kind == tSymbol) && strings.EqualFold(t.text, text)
+}
+
+// isCall checks if next tokens are function call
+func (p *parser) isCall(name string) bool {
+	t := p.tokens[p.at]
+	if t.kind != tIdent || t.text != name {
+		return false
+	}
+	n := p.tokens[p.at+1]
+	return n.kind == tSymbol && n.text == "("
+}
+
+func (p *parser) expect(text string) {
+	if !p.is(text) {
+		p.fail("expected %s, found %q", text, p.peek().text)
+	}
+	p.next()
+}
+
+func (p *parser) path() path {
+	seq := path{p.name()}
+
+	for {
+		switch {
+		case p.is("."):
+			p.next()
+			seq = append(seq, p.name())
+		case p.is("["):
+			p.next()
+			t := p.next()
+			if t.kind != tNumber {
+				p.fail("invalid list index %s", t.text)
+			}
+			n, _ := strconv.Atoi(t.text)
+			p.expect("]")
+			seq = append(seq, element{index: n, isIndex: true})
+		default:
+			return seq
+		}
+	}
+}
+
+func (p *parser) name() element {
+	t := p.next()
+	switch t.kind {
+	case tIdent:
+		return element{name: t.text}
+	case tName:
+		name, has := p.scope.names[t.text]
+		if !has {
+			p.fail("An expression attribute name used in the document path is not defined; attribute name: %s", t.text)
+		}
+		p.scope.usedNames[t.text] = true
+		return element{name: name}
+	default:
+		p.fail("expected attribute name, found %q", t.text)
+		return element{}
+	}
+}
+
+func (p *parser) value() types.AttributeValue {
+	t := p.next()
+	if t.kind != tValue {
+		p.fail("expected value, found %q", t.text)
+	}
+
+	val, has := p.scope.values[t.text]
+	if !has {
+		p.fail("An expression attribute value used in expression is not defined; attribute value: %s", t.text)
+	}
+	p.scope.usedValues[t.text] = true
+	return val
+}
+
+// paths parses projection expression
+func (p *parser) paths() []path {
+	seq := []path{p.path()}
+	for p.is(",") {
+		p.next()
+		seq = append(seq, p.path())
+	}
+	return seq
+}
+
+//-----------------------------------------------------------------------------
+//
+// Conditions
+//
+//-----------------------------------------------------------------------------
+
+// condition over the item
+type condition interface {
+	eval(item) bool
+}
+
+type and struct{ a, b condition }
+
+func (c and) eval(x item) bool { return c.a.eval(x) && c.b.eval(x) }
+
+type or struct{ a, b condition }
+
+func (c or) eval(x item) bool { return c.a.eval(x) || c.b.eval(x) }
+
+type not struct{ a condition }
+
+func (c not) eval(x item) bool { return !c.a.eval(x) }
+
+type comparison struct {
+	op   string
+	a, b operand
+}
+
+func (c comparison) eval(x item) bool {
+	a, oka := c.a.eval(x)
+	b, okb := c.b.eval(x)
+	if !oka || !okb {
+		return false
+	}
+
+	switch c.op {
+	case "=":
+		return equal(a, b)
+	case "<>":
+		return !equal(a, b)
+	}
+
+	v, ok := compare(a, b)
+	if !ok {
+		return false
+	}
+
+	switch c.op {
+	case "<":
+		return v < 0
+	case "<=":
+		return v <= 0
+	case ">":
+		return v > 0
+	case ">=":
+		return v >= 0
+	default:
+		return false
+	}
+}
+
+type between struct{ a, lo, hi operand }
+
+func (c between) eval(x item) bool {
+	return comparison{">=", c.a, c.lo}.eval(x) && comparison{"<=", c.a, c.hi}.eval(x)
+}
+
+type in struct {
+	a   operand
+	seq []operand
+}
+
+func (c in) eval(x item) bool {
+	for _, b := range c.seq {
+		if (comparison{"=", c.a, b}).eval(x) {
+			return true
+		}
+	}
+	return false
+}
+
+type function struct {
+	name string
+	path path
+	args []operand
+}
+
+func (c function) eval(x item) bool {
+	val, has := c.path.get(x)
+
+	switch c.name {
+	case "attribute_exists":
+		return has
+	case "attribute_not_exists":
+		return !has
+	}
+
+	if !has {
+		return false
+	}
+
+	arg, ok := c.args[0].eval(x)
+	if !ok {
+		return false
+	}
+
+	switch c.name {
+	case "attribute_type":
+		t, ok := arg.(*types.AttributeValueMemberS)
+		return ok && typeOf(val) == t.Value
+	case "begins_with":
+		switch v := val.(type) {
+		case *types.AttributeValueMemberS:
+			t, ok := arg.(*types.AttributeValueMemberS)
+			return ok && strings.HasPrefix(v.Value, t.Value)
+		case *types.AttributeValueMemberB:
+			t, ok := arg.(*types.AttributeValueMemberB)
+			return ok && strings.HasPrefix(string(v.Value), string(t.Value))
+		}
+	case "contains":
+		return contains(val, arg)
+	}
+
+	return false
+}
+
+func contains(val, arg types.AttributeValue) bool {
+	switch v := val.(type) {
+	case *types.AttributeValueMemberS:
+		t, ok := arg.(*types.AttributeValueMemberS)
+		return ok && strings.Contains(v.Value, t.Value)
+	case *types.AttributeValueMemberB:
+		t, ok := arg.(*types.AttributeValueMemberB)
+		return ok && strings.Contains(string(v.Value), string(t.Value))
+	case *types.AttributeValueMemberSS:
+		for _, e := range v.Value {
+			if equal(&types.AttributeValueMemberS{Value: e}, arg) {
+				return true
+			}
+		}
+	case *types.AttributeValueMemberNS:
+		for _, e := range v.Value {
+			if equal(&types.AttributeValueMemberN{Value: e}, arg) {
+				return true
+			}
+		}
+	case *types.AttributeValueMemberBS:
+		for _, e := range v.Value {
+			if equal(&types.AttributeValueMemberB{Value: e}, arg) {
+				return true
+			}
+		}
+	case *types.AttributeValueMemberL:
+		for _, e := range v.Value {
+			if equal(e, arg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// condition ⟼ disjunction
+func (p *parser) condition() condition {
+	c := p.conjunction()
+	for p.is("OR") {
+		p.next()
+		c = or{c, p.conjunction()}
+	}
+	return c
+}
+
+func (p *parser) conjunction() condition {
+	c := p.negation()
+	for p.is("AND") {
+		p.next()
+		c = and{c, p.negation()}
+	}
+	return c
+}
+
+func (p *parser) negation() condition {
+	if p.is("NOT") {
+		p.next()
+		return not{p.negation()}
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() condition {
+	if p.is("(") {
+		p.next()
+		c := p.condition()
+		p.expect(")")
+		return c
+	}
+
+	for _, f := range []string{"attribute_exists", "attribute_not_exists", "attribute_type", "begins_with", "contains"} {
+		if p.isCall(f) {
+			return p.function()
+		}
+	}
+
+	a := p.operand()
+	switch {
+	case p.is("BETWEEN"):
+		p.next()
+		lo := p.operand()
+		p.expect("AND")
+		hi := p.operand()
+		return between{a, lo, hi}
+	case p.is("IN"):
+		p.next()
+		p.expect("(")
+		seq := []operand{p.operand()}
+		for p.is(",") {
+			p.next()
+			seq = append(seq, p.operand())
+		}
+		p.expect(")")
+		return in{a, seq}
+	}
+
+	t := p.next()
+	switch t.text {
+	case "=", "<>", "<", "<=", ">", ">=":
+		return comparison{t.text, a, p.operand()}
+	default:
+		p.fail("expected comparator, found %q", t.text)
+		return nil
+	}
+}
+
+func (p *parser) function() condition {
+	name := p.next().text
+	p.expect("(")
+
+	f := function{name: name, path: p.path()}
+	switch name {
+	case "attribute_type", "begins_with", "contains":
+		p.expect(",")
+		f.args = []operand{p.operand()}
+	}
+
+	p.expect(")")
+	return f
+}
+
+//-----------------------------------------------------------------------------
+//
+// Operands
+//
+//-----------------------------------------------------------------------------
+
+// operand of expression, it is evaluated over the item
+type operand interface {
+	eval(item) (types.AttributeValue, bool)
+}
+
+type literal struct{ val types.AttributeValue }
+
+func (op literal) eval(item) (types.AttributeValue, bool) { return op.val, true }
+
+type attribute struct{ path path }
+
+func (op attribute) eval(x item) (types.AttributeValue, bool) { return op.path.get(x) }
+
+type size struct{ path path }
+
+func (op size) eval(x item) (types.AttributeValue, bool) {
+	val, has := op.path.get(x)
+	if !has {
+		return nil, false
+	}
+
+	n, ok := lengthOf(val)
+	if !ok {
+		return nil, false
+	}
+	return &types.AttributeValueMemberN{Value: strconv.Itoa(n)}, true
+}
+
+func (p *parser) operand() operand {
+	switch {
+	case p.peek().kind == tValue:
+		return literal{p.value()}
+	case p.isCall("size"):
+		p.next()
+		p.expect("(")
+		op := size{p.path()}
+		p.expect(")")
+		return op
+	default:
+		return attribute{p.path()}
+	}
+}
+
+//-----------------------------------------------------------------------------
+//
+// Parsers of request expressions
+//
+//-----------------------------------------------------------------------------
+
+// parseCondition parses condition, filter or key condition expression
+func parseCondition(s *scope, expr *string) (condition, error) {
+	if expr == nil {
+		return nil, nil
+	}
+
+	p, err := newParser(s, *expr)
+	if err != nil {
+		return nil, errValidation("Invalid ConditionExpression: %s", err)
+	}
+
+	var c condition
+	if err := p.run(func() { c = p.condition() }); err != nil {
+		return nil, errValidation("Invalid ConditionExpression: %s", err)
+	}
+
+	return c, nil
+}
+
+// parseProjection parses projection expression
+func parseProjection(s *scope, expr *string) ([]path, error) {
+	if expr == nil {
+		return nil, nil
+	}
+
+	p, err := newParser(s, *expr)
+	if err != nil {
+		return nil, errValidation("Invalid ProjectionExpression: %s", err)
+	}
+
+	var seq []path
+	if err := p.run(func() { seq = p.paths() }); err != nil {
+		return nil, errValidation("Invalid ProjectionExpression: %s", err)
+	}
+
+	return seq, nil
+}
+
+// holds evaluates optional condition
+func holds(c condition, x item) bool {
+	return c == nil || c.eval(x)
+}
@@ -0,0 +1,179 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file implements document paths
+//
+
+package emulator
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// element of document path, either attribute name or list index
+type element struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+// path to attribute of the item, e.g. a.b[1].c
+type path []element
+
+func (p path) String() string {
+	sb := strings.Builder{}
+	for i, e := range p {
+		switch {
+		case e.isIndex:
+			sb.WriteString("[" + strconv.Itoa(e.index) + "]")
+		case i > 0:
+			sb.WriteString("." + e.name)
+		default:
+			sb.WriteString(e.name)
+		}
+	}
+	return sb.String()
+}
+
+// get value at path
+func (p path) get(x item) (types.AttributeValue, bool) {
+	var val types.AttributeValue = &types.AttributeValueMemberM{Value: x}
+
+	for _, e := range p {
+		switch v := val.(type) {
+		case *types.AttributeValueMemberM:
+			if e.isIndex {
+				return nil, false
+			}
+			next, has := v.Value[e.name]
+			if !has {
+				return nil, false
+			}
+			val = next
+		case *types.AttributeValueMemberL:
+			if !e.isIndex || e.index >= len(v.Value) {
+				return nil, false
+			}
+			val = v.Value[e.index]
+		default:
+			return nil, false
+		}
+	}
+
+	return val, true
+}
+
+/*
+set value at path, the parent of attribute must exist. The value is appended
+to the list if index is out of the list.
+*/
+func (p path) set(x item, val types.AttributeValue) bool {
+	parent, ok := p[:len(p)-1].get(x)
+	if !ok {
+		return false
+	}
+
+	e := p[len(p)-1]
+	switch v := parent.(type) {
+	case *types.AttributeValueMemberM:
+		if e.isIndex {
+			return false
+		}
+		v.Value[e.name] = val
+		return true
+	case *types.AttributeValueMemberL:
+		if !e.isIndex {
+			return false
+		}
+		if e.index >= len(v.Value) {
+			v.Value = append(v.Value, val)
+		} else {
+			v.Value[e.index] = val
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// remove attribute at path
+func (p path) remove(x item) {
+	parent, ok := p[:len(p)-1].get(x)
+	if !ok {
+		return
+	}
+
+	e := p[len(p)-1]
+	switch v := parent.(type) {
+	case *types.AttributeValueMemberM:
+		if !e.isIndex {
+			delete(v.Value, e.name)
+		}
+	case *types.AttributeValueMemberL:
+		if e.isIndex && e.index < len(v.Value) {
+			v.Value = append(v.Value[:e.index], v.Value[e.index+1:]...)
+		}
+	}
+}
+
+/*
+project copies attributes at paths into the new item. Nested maps are
+created on demand, projected list elements are compacted.
+*/
+func project(x item, paths []path) item {
+	if paths == nil || x == nil {
+		return copyItem(x)
+	}
+
+	y := item{}
+	for _, p := range paths {
+		val, ok := p.get(x)
+		if !ok {
+			continue
+		}
+
+		var node types.AttributeValue = &types.AttributeValueMemberM{Value: y}
+		for i, e := range p {
+			last := i == len(p)-1
+			switch v := node.(type) {
+			case *types.AttributeValueMemberM:
+				if last {
+					v.Value[e.name] = copyValue(val)
+					continue
+				}
+				next, has := v.Value[e.name]
+				if !has {
+					next = emptyOf(p[i+1])
+					v.Value[e.name] = next
+				}
+				node = next
+			case *types.AttributeValueMemberL:
+				if last {
+					v.Value = append(v.Value, copyValue(val))
+					continue
+				}
+				next := emptyOf(p[i+1])
+				v.Value = append(v.Value, next)
+				node = next
+			}
+		}
+	}
+
+	return y
+}
+
+func emptyOf(e element) types.AttributeValue {
+	if e.isIndex {
+		return &types.AttributeValueMemberL{Value: []types.AttributeValue{}}
+	}
+	return &types.AttributeValueMemberM{Value: item{}}
+}
@@ -0,0 +1,200 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file implements tables and indexes
+//
+
+package emulator
+
+import (
+	"sort"
+)
+
+/*
+Table declares key schema of the table and its secondary indexes
+*/
+type Table struct {
+	Name    string
+	HashKey string
+	SortKey string
+	Indexes []Index
+}
+
+/*
+Index declares key schema of secondary index. The index that shares hash key
+with the table is local, otherwise it is global. Indexes project all attributes.
+*/
+type Index struct {
+	Name    string
+	HashKey string
+	SortKey string
+}
+
+type table struct {
+	Table
+	items map[string]item
+}
+
+func newTable(spec Table) *table {
+	return &table{Table: spec, items: map[string]item{}}
+}
+
+// key of item, it validates presence and types of key attributes
+func (t *table) keyOf(x item, exact bool) (string, error) {
+	hash, has := x[t.HashKey]
+	if !has || !isKeyType(hash) {
+		return "", errValidation("One or more parameter values were invalid: Missing the key %s in the item", t.HashKey)
+	}
+
+	key := encodeKey(hash)
+	size := 1
+	if t.SortKey != "" {
+		val, has := x[t.SortKey]
+		if !has || !isKeyType(val) {
+			return "", errValidation("One or more parameter values were invalid: Missing the key %s in the item", t.SortKey)
+		}
+		key = key + "\x00" + encodeKey(val)
+		size++
+	}
+
+	if exact && len(x) != size {
+		return "", errValidation("The provided key element does not match the schema")
+	}
+
+	return key, nil
+}
+
+// keyOnly extracts primary key of item
+func (t *table) keyOnly(x item) item {
+	key := item{t.HashKey: copyValue(x[t.HashKey])}
+	if t.SortKey != "" {
+		key[t.SortKey] = copyValue(x[t.SortKey])
+	}
+	return key
+}
+
+// isKey checks if the attribute belongs to primary key
+func (t *table) isKey(attr string) bool {
+	return attr == t.HashKey || (t.SortKey != "" && attr == t.SortKey)
+}
+
+// index of the table, nil name is the table itself
+func (t *table) index(name *string) (Index, bool, error) {
+	if name == nil {
+		return Index{Name: t.Name, HashKey: t.HashKey, SortKey: t.SortKey}, false, nil
+	}
+
+	for _, idx := range t.Indexes {
+		if idx.Name == *name {
+			return idx, idx.HashKey != t.HashKey, nil
+		}
+	}
+
+	return Index{}, false, errValidation("The table does not have the specified index: %s", *name)
+}
+
+// lastKey of the item at the index, it includes primary key of the table
+func (t *table) lastKey(idx Index, x item) item {
+	key := t.keyOnly(x)
+	key[idx.HashKey] = copyValue(x[idx.HashKey])
+	if idx.SortKey != "" {
+		key[idx.SortKey] = copyValue(x[idx.SortKey])
+	}
+	return key
+}
+
+/*
+scan items of the index that satisfy key condition, items are ordered by
+sort key of the index, the primary key of table breaks ties. Items at or
+before the exclusive start key are skipped.
+*/
+func (t *table) scan(idx Index, key condition, start item, forward bool) []item {
+	seq := make([]item, 0)
+	for _, x := range t.items {
+		// Note: indexes are sparse, items without index keys are not indexed
+		if _, has := x[idx.HashKey]; !has {
+			continue
+		}
+		if _, has := x[idx.SortKey]; idx.SortKey != "" && !has {
+			continue
+		}
+
+		if key.eval(x) {
+			seq = append(seq, x)
+		}
+	}
+
+	order := func(a, b item) int {
+		if idx.SortKey != "" {
+			if c, _ := compare(a[idx.SortKey], b[idx.SortKey]); c != 0 {
+				return c
+			}
+		}
+		if c, _ := compare(a[t.HashKey], b[t.HashKey]); c != 0 {
+			return c
+		}
+		if t.SortKey != "" {
+			c, _ := compare(a[t.SortKey], b[t.SortKey])
+			return c
+		}
+		return 0
+	}
+
+	sort.Slice(seq, func(i, j int) bool {
+		if forward {
+			return order(seq[i], seq[j]) < 0
+		}
+		return order(seq[i], seq[j]) > 0
+	})
+
+	if start == nil {
+		return seq
+	}
+
+	for i, x := range seq {
+		c := order(x, start)
+		if (forward && c > 0) || (!forward && c < 0) {
+			return seq[i:]
+		}
+	}
+
+	return []item{}
+}
+
+// isStartKey checks that start key is made of index and table keys
+func (t *table) isStartKey(idx Index, start item) bool {
+	for _, attr := range []string{t.HashKey, t.SortKey, idx.HashKey, idx.SortKey} {
+		if attr == "" {
+			continue
+		}
+		if val, has := start[attr]; !has || !isKeyType(val) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// keyConditionOf checks that key condition restricts hash key of index by equality
+func keyConditionOf(idx Index, c condition) bool {
+	switch v := c.(type) {
+	case and:
+		return keyConditionOf(idx, v.a) || keyConditionOf(idx, v.b)
+	case comparison:
+		if v.op != "=" {
+			return false
+		}
+		for _, op := range []operand{v.a, v.b} {
+			if attr, ok := op.(attribute); ok && len(attr.path) == 1 && attr.path[0].name == idx.HashKey {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,359 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file implements update expressions
+//
+
+package emulator
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// action of update expression
+type action struct {
+	clause string
+	path   path
+	value  operand
+}
+
+// update expression is the sequence of actions
+type update []action
+
+type ifNotExists struct {
+	path  path
+	value operand
+}
+
+func (op ifNotExists) eval(x item) (types.AttributeValue, bool) {
+	if val, has := op.path.get(x); has {
+		return val, true
+	}
+	return op.value.eval(x)
+}
+
+type listAppend struct{ a, b operand }
+
+func (op listAppend) eval(x item) (types.AttributeValue, bool) {
+	a, oka := op.a.eval(x)
+	b, okb := op.b.eval(x)
+	if !oka || !okb {
+		return nil, false
+	}
+
+	la, oka := a.(*types.AttributeValueMemberL)
+	lb, okb := b.(*types.AttributeValueMemberL)
+	if !oka || !okb {
+		return nil, false
+	}
+
+	seq := append(append([]types.AttributeValue{}, la.Value...), lb.Value...)
+	return &types.AttributeValueMemberL{Value: seq}, true
+}
+
+type arithmetic struct {
+	op   string
+	a, b operand
+}
+
+func (op arithmetic) eval(x item) (types.AttributeValue, bool) {
+	a, oka := op.a.eval(x)
+	b, okb := op.b.eval(x)
+	if !oka || !okb {
+		return nil, false
+	}
+
+	na, oka := a.(*types.AttributeValueMemberN)
+	nb, okb := b.(*types.AttributeValueMemberN)
+	if !oka || !okb {
+		return nil, false
+	}
+
+	ra, oka := parseNumber(na.Value)
+	rb, okb := parseNumber(nb.Value)
+	if !oka || !okb {
+		return nil, false
+	}
+
+	if op.op == "-" {
+		rb.Neg(rb)
+	}
+	return &types.AttributeValueMemberN{Value: formatNumber(new(big.Rat).Add(ra, rb))}, true
+}
+
+// update ⟼ clause+
+func (p *parser) update() update {
+	seq := update{}
+	seen := map[string]bool{}
+
+	for p.peek().kind != tEOF {
+		t := p.next()
+		clause := ""
+		switch {
+		case p.isClause(t, "SET"):
+			clause = "SET"
+		case p.isClause(t, "REMOVE"):
+			clause = "REMOVE"
+		case p.isClause(t, "ADD"):
+			clause = "ADD"
+		case p.isClause(t, "DELETE"):
+			clause = "DELETE"
+		default:
+			p.fail("expected update clause, found %q", t.text)
+		}
+
+		if seen[clause] {
+			p.fail("The %s section can only be used once in an update expression", clause)
+		}
+		seen[clause] = true
+
+		for {
+			seq = append(seq, p.action(clause))
+			if !p.is(",") {
+				break
+			}
+			p.next()
+		}
+	}
+
+	if len(seq) == 0 {
+		p.fail("update expression is empty")
+	}
+
+	return seq
+}
+
+func (p *parser) isClause(t token, clause string) bool {
+	return t.kind == tIdent && strings.EqualFold(t.text, clause)
+}
+
+func (p *parser) action(clause string) action {
+	a := action{clause: clause, path: p.path()}
+
+	switch clause {
+	case "SET":
+		p.expect("=")
+		a.value = p.setValue()
+	case "ADD", "DELETE":
+		a.value = literal{p.value()}
+	}
+
+	return a
+}
+
+// setValue ⟼ operand [(+|-) operand]
+func (p *parser) setValue() operand {
+	a := p.setOperand()
+	if p.is("+") || p.is("-") {
+		op := p.next().text
+		return arithmetic{op, a, p.setOperand()}
+	}
+	return a
+}
+
+func (p *parser) setOperand() operand {
+	switch {
+	case p.isCall("if_not_exists"):
+		p.next()
+		p.expect("(")
+		path := p.path()
+		p.expect(",")
+		val := p.setOperand()
+		p.expect(")")
+		return ifNotExists{path, val}
+	case p.isCall("list_append"):
+		p.next()
+		p.expect("(")
+		a := p.setOperand()
+		p.expect(",")
+		b := p.setOperand()
+		p.expect(")")
+		return listAppend{a, b}
+	case p.peek().kind == tValue:
+		return literal{p.value()}
+	default:
+		return attribute{p.path()}
+	}
+}
+
+// parseUpdate parses update expression
+func parseUpdate(s *scope, expr *string) (update, error) {
+	if expr == nil {
+		return nil, errValidation("UpdateExpression is required")
+	}
+
+	p, err := newParser(s, *expr)
+	if err != nil {
+		return nil, errValidation("Invalid UpdateExpression: %s", err)
+	}
+
+	var seq update
+	if err := p.run(func() { seq = p.update() }); err != nil {
+		return nil, errValidation("Invalid UpdateExpression: %s", err)
+	}
+
+	return seq, nil
+}
+
+/*
+apply update to the item. Operands are evaluated over the original item,
+the function returns names of updated top-level attributes.
+*/
+func (seq update) apply(x item) (item, []string, error) {
+	y := copyItem(x)
+	if y == nil {
+		y = item{}
+	}
+
+	values := make([]types.AttributeValue, len(seq))
+	for i, a := range seq {
+		if a.value == nil {
+			continue
+		}
+
+		val, ok := a.value.eval(x)
+		if !ok {
+			return nil, nil, errValidation("The provided expression refers to an attribute that does not exist in the item or has invalid type: %s", a.path)
+		}
+		values[i] = copyValue(val)
+	}
+
+	names := make([]string, 0, len(seq))
+	for i, a := range seq {
+		names = append(names, a.path[0].name)
+
+		switch a.clause {
+		case "SET":
+			if !a.path.set(y, values[i]) {
+				return nil, nil, errValidation("The document path provided in the update expression is invalid for update: %s", a.path)
+			}
+		case "REMOVE":
+			a.path.remove(y)
+		case "ADD":
+			val, err := add(a.path, y, values[i])
+			if err != nil {
+				return nil, nil, err
+			}
+			if !a.path.set(y, val) {
+				return nil, nil, errValidation("The document path provided in the update expression is invalid for update: %s", a.path)
+			}
+		case "DELETE":
+			old, has := a.path.get(y)
+			if !has {
+				continue
+			}
+			val, err := subtract(old, values[i])
+			if err != nil {
+				return nil, nil, err
+			}
+			if val == nil {
+				a.path.remove(y)
+			} else {
+				a.path.set(y, val)
+			}
+		}
+	}
+
+	return y, names, nil
+}
+
+// add number or elements of set to the attribute
+func add(p path, x item, val types.AttributeValue) (types.AttributeValue, error) {
+	old, has := p.get(x)
+	if !has {
+		switch val.(type) {
+		case *types.AttributeValueMemberN, *types.AttributeValueMemberSS,
+			*types.AttributeValueMemberNS, *types.AttributeValueMemberBS:
+			return val, nil
+		default:
+			return nil, errValidation("Incorrect operand type for operator or function; operator: ADD, operand type: %s", typeOf(val))
+		}
+	}
+
+	if _, ok := old.(*types.AttributeValueMemberN); ok {
+		if v, ok := (arithmetic{"+", literal{old}, literal{val}}).eval(nil); ok {
+			return v, nil
+		}
+	}
+
+	if typeOf(old) != typeOf(val) {
+		return nil, errValidation("An operand in the update expression has an incorrect data type")
+	}
+
+	switch v := old.(type) {
+	case *types.AttributeValueMemberSS:
+		return &types.AttributeValueMemberSS{Value: union(v.Value, val.(*types.AttributeValueMemberSS).Value, identity)}, nil
+	case *types.AttributeValueMemberNS:
+		return &types.AttributeValueMemberNS{Value: union(v.Value, val.(*types.AttributeValueMemberNS).Value, numberKey)}, nil
+	case *types.AttributeValueMemberBS:
+		return &types.AttributeValueMemberBS{Value: union(v.Value, val.(*types.AttributeValueMemberBS).Value, bytesKey)}, nil
+	default:
+		return nil, errValidation("Incorrect operand type for operator or function; operator: ADD, operand type: %s", typeOf(old))
+	}
+}
+
+// subtract elements from set, it returns nil if set becomes empty
+func subtract(old, val types.AttributeValue) (types.AttributeValue, error) {
+	if typeOf(old) != typeOf(val) {
+		return nil, errValidation("An operand in the update expression has an incorrect data type")
+	}
+
+	switch v := old.(type) {
+	case *types.AttributeValueMemberSS:
+		if seq := difference(v.Value, val.(*types.AttributeValueMemberSS).Value, identity); len(seq) > 0 {
+			return &types.AttributeValueMemberSS{Value: seq}, nil
+		}
+	case *types.AttributeValueMemberNS:
+		if seq := difference(v.Value, val.(*types.AttributeValueMemberNS).Value, numberKey); len(seq) > 0 {
+			return &types.AttributeValueMemberNS{Value: seq}, nil
+		}
+	case *types.AttributeValueMemberBS:
+		if seq := difference(v.Value, val.(*types.AttributeValueMemberBS).Value, bytesKey); len(seq) > 0 {
+			return &types.AttributeValueMemberBS{Value: seq}, nil
+		}
+	default:
+		return nil, errValidation("Incorrect operand type for operator or function; operator: DELETE, operand type: %s", typeOf(old))
+	}
+
+	return nil, nil
+}
+
+func identity(s string) string  { return s }
+func numberKey(s string) string { return encodeKey(&types.AttributeValueMemberN{Value: s}) }
+func bytesKey(b []byte) string  { return string(b) }
+
+func union[E any](a, b []E, key func(E) string) []E {
+	seen := map[string]bool{}
+	seq := make([]E, 0, len(a)+len(b))
+	for _, x := range append(append([]E{}, a...), b...) {
+		if !seen[key(x)] {
+			seen[key(x)] = true
+			seq = append(seq, x)
+		}
+	}
+	return seq
+}
+
+func difference[E any](a, b []E, key func(E) string) []E {
+	drop := map[string]bool{}
+	for _, x := range b {
+		drop[key(x)] = true
+	}
+
+	seq := make([]E, 0, len(a))
+	for _, x := range a {
+		if !drop[key(x)] {
+			seq = append(seq, x)
+		}
+	}
+	return seq
+}
@@ -0,0 +1,333 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file implements operations over attribute values
+//
+
+package emulator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// item of the table
+type item = map[string]types.AttributeValue
+
+// copyItem deeply, items of the table are never shared with clients
+func copyItem(x item) item {
+	if x == nil {
+		return nil
+	}
+
+	y := make(item, len(x))
+	for k, v := range x {
+		y[k] = copyValue(v)
+	}
+	return y
+}
+
+func copyValue(v types.AttributeValue) types.AttributeValue {
+	switch x := v.(type) {
+	case *types.AttributeValueMemberS:
+		return &types.AttributeValueMemberS{Value: x.Value}
+	case *types.AttributeValueMemberN:
+		return &types.AttributeValueMemberN{Value: x.Value}
+	case *types.AttributeValueMemberB:
+		return &types.AttributeValueMemberB{Value: append([]byte{}, x.Value...)}
+	case *types.AttributeValueMemberBOOL:
+		return &types.AttributeValueMemberBOOL{Value: x.Value}
+	case *types.AttributeValueMemberNULL:
+		return &types.AttributeValueMemberNULL{Value: x.Value}
+	case *types.AttributeValueMemberSS:
+		return &types.AttributeValueMemberSS{Value: append([]string{}, x.Value...)}
+	case *types.AttributeValueMemberNS:
+		return &types.AttributeValueMemberNS{Value: append([]string{}, x.Value...)}
+	case *types.AttributeValueMemberBS:
+		seq := make([][]byte, len(x.Value))
+		for i, b := range x.Value {
+			seq[i] = append([]byte{}, b...)
+		}
+		return &types.AttributeValueMemberBS{Value: seq}
+	case *types.AttributeValueMemberL:
+		seq := make([]types.AttributeValue, len(x.Value))
+		for i, e := range x.Value {
+			seq[i] = copyValue(e)
+		}
+		return &types.AttributeValueMemberL{Value: seq}
+	case *types.AttributeValueMemberM:
+		return &types.AttributeValueMemberM{Value: copyItem(x.Value)}
+	default:
+		return v
+	}
+}
+
+// typeOf returns DynamoDB type descriptor of the value
+func typeOf(v types.AttributeValue) string {
+	switch v.(type) {
+	case *types.AttributeValueMemberS:
+		return "S"
+	case *types.AttributeValueMemberN:
+		return "N"
+	case *types.AttributeValueMemberB:
+		return "B"
+	case *types.AttributeValueMemberBOOL:
+		return "BOOL"
+	case *types.AttributeValueMemberNULL:
+		return "NULL"
+	case *types.AttributeValueMemberSS:
+		return "SS"
+	case *types.AttributeValueMemberNS:
+		return "NS"
+	case *types.AttributeValueMemberBS:
+		return "BS"
+	case *types.AttributeValueMemberL:
+		return "L"
+	case *types.AttributeValueMemberM:
+		return "M"
+	default:
+		return ""
+	}
+}
+
+// isKeyType checks that value is allowed as key attribute
+func isKeyType(v types.AttributeValue) bool {
+	switch v.(type) {
+	case *types.AttributeValueMemberS, *types.AttributeValueMemberN, *types.AttributeValueMemberB:
+		return true
+	default:
+		return false
+	}
+}
+
+// encodeKey encodes key attribute into comparable string
+func encodeKey(v types.AttributeValue) string {
+	switch x := v.(type) {
+	case *types.AttributeValueMemberS:
+		return "S" + x.Value
+	case *types.AttributeValueMemberN:
+		if n, ok := parseNumber(x.Value); ok {
+			return "N" + formatNumber(n)
+		}
+		return "N" + x.Value
+	case *types.AttributeValueMemberB:
+		return "B" + base64.StdEncoding.EncodeToString(x.Value)
+	default:
+		return ""
+	}
+}
+
+func parseNumber(s string) (*big.Rat, bool) {
+	return new(big.Rat).SetString(s)
+}
+
+func formatNumber(n *big.Rat) string {
+	if n.IsInt() {
+		return n.Num().String()
+	}
+
+	// Note: numbers are decimals, the fraction has finite representation
+	s := n.FloatString(38)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+/*
+compare ordered values of the same type: strings, numbers and binaries.
+It returns false if values are not comparable.
+*/
+func compare(a, b types.AttributeValue) (int, bool) {
+	switch x := a.(type) {
+	case *types.AttributeValueMemberS:
+		if y, ok := b.(*types.AttributeValueMemberS); ok {
+			return strings.Compare(x.Value, y.Value), true
+		}
+	case *types.AttributeValueMemberN:
+		if y, ok := b.(*types.AttributeValueMemberN); ok {
+			xn, okx := parseNumber(x.Value)
+			yn, oky := parseNumber(y.Value)
+			if okx && oky {
+				return xn.Cmp(yn), true
+			}
+		}
+	case *types.AttributeValueMemberB:
+		if y, ok := b.(*types.AttributeValueMemberB); ok {
+			return bytes.Compare(x.Value, y.Value), true
+		}
+	}
+
+	return 0, false
+}
+
+// equal values, sets are equal regardless of elements order
+func equal(a, b types.AttributeValue) bool {
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+
+	switch x := a.(type) {
+	case *types.AttributeValueMemberSS:
+		if y, ok := b.(*types.AttributeValueMemberSS); ok {
+			return equalSet(x.Value, y.Value, func(s string) string { return s })
+		}
+	case *types.AttributeValueMemberNS:
+		if y, ok := b.(*types.AttributeValueMemberNS); ok {
+			return equalSet(x.Value, y.Value, func(s string) string {
+				return encodeKey(&types.AttributeValueMemberN{Value: s})
+			})
+		}
+	case *types.AttributeValueMemberBS:
+		if y, ok := b.(*types.AttributeValueMemberBS); ok {
+			return equalSet(x.Value, y.Value, func(b []byte) string { return string(b) })
+		}
+	case *types.AttributeValueMemberL:
+		if y, ok := b.(*types.AttributeValueMemberL); ok {
+			if len(x.Value) != len(y.Value) {
+				return false
+			}
+			for i := range x.Value {
+				if !equal(x.Value[i], y.Value[i]) {
+					return false
+				}
+			}
+			return true
+		}
+	case *types.AttributeValueMemberM:
+		if y, ok := b.(*types.AttributeValueMemberM); ok {
+			if len(x.Value) != len(y.Value) {
+				return false
+			}
+			for k, v := range x.Value {
+				w, has := y.Value[k]
+				if !has || !equal(v, w) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func equalSet[E any](a, b []E, key func(E) string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	set := map[string]bool{}
+	for _, x := range a {
+		set[key(x)] = true
+	}
+	for _, x := range b {
+		if !set[key(x)] {
+			return false
+		}
+	}
+	return true
+}
+
+// sizeOf approximates size of value in bytes as defined by DynamoDB
+func sizeOf(v types.AttributeValue) int {
+	switch x := v.(type) {
+	case *types.AttributeValueMemberS:
+		return len(x.Value)
+	case *types.AttributeValueMemberN:
+		return (len(x.Value)+1)/2 + 1
+	case *types.AttributeValueMemberB:
+		return len(x.Value)
+	case *types.AttributeValueMemberBOOL, *types.AttributeValueMemberNULL:
+		return 1
+	case *types.AttributeValueMemberSS:
+		n := 0
+		for _, e := range x.Value {
+			n += len(e)
+		}
+		return n
+	case *types.AttributeValueMemberNS:
+		n := 0
+		for _, e := range x.Value {
+			n += (len(e)+1)/2 + 1
+		}
+		return n
+	case *types.AttributeValueMemberBS:
+		n := 0
+		for _, e := range x.Value {
+			n += len(e)
+		}
+		return n
+	case *types.AttributeValueMemberL:
+		n := 3
+		for _, e := range x.Value {
+			n += 1 + sizeOf(e)
+		}
+		return n
+	case *types.AttributeValueMemberM:
+		return 3 + sizeOfItem(x.Value)
+	default:
+		return 0
+	}
+}
+
+func sizeOfItem(x item) int {
+	n := 0
+	for k, v := range x {
+		n += len(k) + sizeOf(v)
+	}
+	return n
+}
+
+// capacity units consumed by reading or writing bytes
+func readUnits(size int, consistent bool) float64 {
+	units := math.Ceil(float64(size) / 4096)
+	if units < 1 {
+		units = 1
+	}
+	if !consistent {
+		units = units / 2
+	}
+	return units
+}
+
+func writeUnits(size int) float64 {
+	units := math.Ceil(float64(size) / 1024)
+	if units < 1 {
+		units = 1
+	}
+	return units
+}
+
+// length of value used by size function
+func lengthOf(v types.AttributeValue) (int, bool) {
+	switch x := v.(type) {
+	case *types.AttributeValueMemberS:
+		return utf8.RuneCountInString(x.Value), true
+	case *types.AttributeValueMemberB:
+		return len(x.Value), true
+	case *types.AttributeValueMemberSS:
+		return len(x.Value), true
+	case *types.AttributeValueMemberNS:
+		return len(x.Value), true
+	case *types.AttributeValueMemberBS:
+		return len(x.Value), true
+	case *types.AttributeValueMemberL:
+		return len(x.Value), true
+	case *types.AttributeValueMemberM:
+		return len(x.Value), true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,68 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package ddb
+
+import (
+	"math"
+
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+)
+
+// Clock of the limiter, the system clock is used if it is nil
+type Clock = ddb.Clock
+
+/*
+NewLimiter creates DynamoDB client that limits requests to the budget of
+read and write capacity units per second, zero budget is unlimited. The
+consumption is estimated from the size of items and corrected using
+the consumed capacity returned by DynamoDB. Storages created with the
+client share the budget, e.g. batch jobs are limited to the fraction of
+provisioned capacity while latency-sensitive storages use other client.
+The client implements batch api if the service does.
+
+	client, err := ddb.NewLimiter(nil, nil, 100, 50)
+
+	articles := ddb.Must(ddb.New[Article]("ddb:///my-table", client, nil))
+	authors := ddb.Must(ddb.New[Author]("ddb:///my-table", client, nil))
+*/
+func NewLimiter(
+	service dynamo.DynamoDB,
+	clock Clock,
+	readCapacity, writeCapacity float64,
+) (dynamo.DynamoDB, error) {
+	aws, err := newService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	if clock == nil {
+		clock = ddb.SystemClock{}
+	}
+
+	// Note: the burst is one second of capacity
+	bucket := func(rate float64) *ddb.Bucket {
+		if rate <= 0 {
+			return nil
+		}
+		return ddb.NewBucket(rate, math.Max(1, rate), clock)
+	}
+
+	limiter := &ddb.Limiter{
+		DynamoDB: aws,
+		Read:     bucket(readCapacity),
+		Write:    bucket(writeCapacity),
+	}
+
+	if batch, ok := aws.(dynamo.DynamoDBBatch); ok {
+		return &ddb.BatchLimiter{Limiter: limiter, Batch: batch}, nil
+	}
+
+	return limiter, nil
+}
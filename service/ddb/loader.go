@@ -0,0 +1,69 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package ddb
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+)
+
+/*
+NewLoader creates reader that batches concurrent reads into BatchGetItem
+requests (DataLoader pattern). Reads arriving within the window are sent
+as one batch, the batch is sent immediately when it is full. Reads of the
+same key are deduplicated. Query parameters of the connector configure
+the window (1ms by default) and the batch size (100 by default, it is
+the limit of DynamoDB).
+
+	loader, err := ddb.NewLoader[Article]("ddb:///my-table?window=2ms&batch=50", nil)
+*/
+func NewLoader[T dynamo.Thing](
+	connector string,
+	service dynamo.DynamoDB,
+) (dynamo.KeyValGetter[T], error) {
+	aws, err := newService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	batch, ok := aws.(dynamo.DynamoDBBatch)
+	if !ok {
+		return nil, errNotSupported("batch api")
+	}
+
+	uri, err := newURI(connector)
+	// Note: BatchGetItem does not support indexes
+	if err != nil || len(uri.Path) < 2 || len(uri.Segments()) != 1 {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	window, err := time.ParseDuration(uri.Query("window", "1ms"))
+	if err != nil || window < 0 {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	size, err := strconv.Atoi(uri.Query("batch", "100"))
+	if err != nil || size < 1 || size > 100 {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	seq := uri.Segments()
+
+	return &ddb.Loader[T]{
+		Service: batch,
+		Table:   &seq[0],
+		Codec:   ddb.NewCodec[T](uri),
+		Schema:  ddb.NewSchema[T](uri.Query("prefix", "prefix"), uri.Query("suffix", "suffix")),
+		Window:  window,
+		Size:    size,
+	}, nil
+}
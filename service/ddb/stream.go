@@ -0,0 +1,65 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package ddb
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+)
+
+/*
+NewStream creates reader of DynamoDB Streams. The stream emits changes of
+items that belongs to type T, optionally filtered by key prefix rules.
+
+	stream, err := ddb.NewStream[Article]("ddb:///my-table", nil,
+	  dynamo.KeyPrefix{HashKey: "author:", SortKey: "article:"},
+	)
+*/
+func NewStream[T dynamo.Thing](
+	connector string,
+	service dynamo.DynamoDBStreams,
+	rules ...dynamo.KeyPrefix,
+) (dynamo.Stream[T], error) {
+	aws, err := newStreamService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	uri, err := newURI(connector)
+	if err != nil || len(uri.Path) < 2 {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	seq := uri.Segments()
+
+	return &ddb.Stream[T]{
+		Service: aws,
+		Table:   &seq[0],
+		Codec:   ddb.NewCodec[T](uri),
+		Rules:   rules,
+		Poll:    ddb.DefaultPoll,
+	}, nil
+}
+
+func newStreamService(service dynamo.DynamoDBStreams) (dynamo.DynamoDBStreams, error) {
+	if service != nil {
+		return service, nil
+	}
+
+	aws, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return dynamodbstreams.NewFromConfig(aws), nil
+}
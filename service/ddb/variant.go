@@ -0,0 +1,116 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file declares polymorphic access to single table
+//
+
+package ddb
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/fogfish/curie"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+)
+
+// Variant binds the type of items to the rule that recognizes them at the table
+type Variant = ddb.Variant
+
+/*
+Kind declares items of type T recognized by the value of discriminator
+attribute. The attribute is written with each item of the type.
+
+	ddb.Kind[Author]("kind", "author")
+*/
+func Kind[T dynamo.Thing](attr, value string) Variant {
+	v := ddb.NewVariant[T]()
+	v.Attr = attr
+	v.Value = value
+	return v
+}
+
+/*
+KeyPrefix declares items of type T recognized by prefixes of hash and sort
+keys, empty prefix matches any key. The sort key of items without one is `_`.
+
+	ddb.KeyPrefix[Author]("author:", "_")
+	ddb.KeyPrefix[Article]("author:", "article:")
+*/
+func KeyPrefix[T dynamo.Thing](prefix, suffix string) Variant {
+	v := ddb.NewVariant[T]()
+	v.Prefix = prefix
+	v.Suffix = suffix
+	return v
+}
+
+/*
+NewPolymorphic creates instance of DynamoDB api over items of registered
+types stored at the same table. Variants are evaluated in the order of
+declaration, the first matching variant defines the type of the item.
+Items of other types fail decoding.
+
+	db := ddb.Must(ddb.NewPolymorphic("ddb:///my-table", nil, nil,
+	  ddb.KeyPrefix[Author]("author:", "_"),
+	  ddb.KeyPrefix[Article]("author:", "article:"),
+	))
+
+	for thing, err := range dynamo.All(db.Match(ctx, Author{ID: "author:neumann"})) {
+	  switch v := thing.(type) {
+	  case Author:
+	  case Article:
+	  }
+	}
+*/
+func NewPolymorphic(
+	connector string,
+	service dynamo.DynamoDB,
+	prefixes curie.Prefixes,
+	variants ...Variant,
+) (dynamo.KeyVal[dynamo.Thing], error) {
+	if len(variants) == 0 {
+		return nil, errUndefinedVariants()
+	}
+
+	aws, err := newService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	var table, index *string
+	uri, err := newURI(connector)
+	if err != nil || len(uri.Path) < 2 {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	seq := uri.Segments()
+	table = &seq[0]
+	if len(seq) > 1 {
+		index = &seq[1]
+	}
+
+	return &ddb.Storage[dynamo.Thing]{
+		Service: aws,
+		Table:   table,
+		Index:   index,
+		Codec:   ddb.NewPolymorphicCodec(uri, variants),
+		Schema:  ddb.NewSchema[dynamo.Thing](),
+	}, nil
+}
+
+func errUndefinedVariants() error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] variants of items are not defined", name)
+}
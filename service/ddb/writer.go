@@ -0,0 +1,96 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package ddb
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+)
+
+/*
+Writer is buffered asynchronous writer of entities. Put and Remove return
+once the request is buffered, they are blocked while the buffer is full.
+*/
+type Writer[T dynamo.Thing] interface {
+	Put(context.Context, T) error
+	Remove(context.Context, T) error
+	// Flush sends writes buffered before the call
+	Flush(context.Context) error
+	// Close sends buffered writes and stops the writer
+	Close(context.Context) error
+}
+
+/*
+NewWriter creates buffered writer that sends entities as BatchWriteItem
+chunks. Chunks are sent when they are full, periodically and on flush.
+Unprocessed items are retried with exponential backoff, writes that are
+failed finally are reported to the callback. Writes of the same key
+within the chunk are collapsed, the last write wins. Query parameters
+of the connector configure the buffer size (1000 by default), the chunk
+size (25 by default, it is the limit of DynamoDB) and the flush interval
+(1s by default).
+
+	w, err := ddb.NewWriter[Event]("ddb:///events?buffer=10000&interval=500ms", nil,
+	  func(e Event, err error) { ... },
+	)
+	defer w.Close(context.Background())
+*/
+func NewWriter[T dynamo.Thing](
+	connector string,
+	service dynamo.DynamoDB,
+	failure func(T, error),
+) (Writer[T], error) {
+	aws, err := newService(service)
+	if err != nil {
+		return nil, err
+	}
+
+	batch, ok := aws.(dynamo.DynamoDBBatch)
+	if !ok {
+		return nil, errNotSupported("batch api")
+	}
+
+	uri, err := newURI(connector)
+	if err != nil || len(uri.Path) < 2 || len(uri.Segments()) != 1 {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	buffer, err := strconv.Atoi(uri.Query("buffer", "1000"))
+	if err != nil || buffer < 1 {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	size, err := strconv.Atoi(uri.Query("batch", "25"))
+	if err != nil || size < 1 || size > 25 {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	interval, err := time.ParseDuration(uri.Query("interval", "1s"))
+	if err != nil || interval <= 0 {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	seq := uri.Segments()
+
+	w := &ddb.Writer[T]{
+		Service:  batch,
+		Table:    &seq[0],
+		Codec:    ddb.NewCodec[T](uri),
+		Size:     size,
+		Interval: interval,
+		Failure:  failure,
+	}
+	w.Start(buffer)
+
+	return w, nil
+}
@@ -0,0 +1,87 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+/*
+Package fs implements key/value storage at local file system. Each entity
+is stored as JSON file at directory/hashkey/sortkey, writes are atomic and
+conditional writes are serialized with file lock. The storage is not
+supported on platforms without file locks. The storage mirrors
+semantic of DynamoDB storage, it is designed for development and testing
+environments without access to AWS.
+
+	db := fs.Must(fs.New[Person]("file:///var/lib/app/person"))
+*/
+package fs
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+	"github.com/holmes89/dynamo/internal/fs"
+)
+
+// Must constraint for api factory
+func Must[T dynamo.Thing](keyval dynamo.KeyVal[T], err error) dynamo.KeyVal[T] {
+	if err != nil {
+		panic(err)
+	}
+
+	return keyval
+}
+
+/*
+New creates local file system storage at the directory given by connector,
+the directory is created if it does not exist. Names of key attributes are
+configured as in DynamoDB connector, they are used by constraints.
+
+	fs.New[Person]("file:///tmp/person?prefix=pk&suffix=sk")
+*/
+func New[T dynamo.Thing](connector string) (dynamo.KeyVal[T], error) {
+	uri, err := newURI(connector)
+	if err != nil || uri.Scheme != "file" || len(uri.Path) < 2 {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	root := filepath.FromSlash(uri.Path)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+
+	if err := fs.Lockable(root); err != nil {
+		return nil, err
+	}
+
+	return &fs.Storage[T]{
+		Root:  filepath.Clean(root),
+		Codec: ddb.NewCodec[T](uri),
+	}, nil
+}
+
+func newURI(uri string) (*dynamo.URL, error) {
+	spec, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	return (*dynamo.URL)(spec), nil
+}
+
+func errInvalidConnectorURL(url string) error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] invalid connector url: %s", name, url)
+}
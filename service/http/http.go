@@ -0,0 +1,155 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+/*
+Package http implements key/value storage over REST resource, e.g. data
+gateway that serves the storage to services without AWS credentials.
+Items are addressed as {endpoint}/{hashkey}/{sortkey}:
+
+  - GET, PUT, DELETE reads, writes and removes the item;
+  - PATCH updates the item and responds with new values;
+  - GET {endpoint}/{hashkey}?prefix=&limit=&cursor=&reverse= matches items.
+
+Constraints on the existence of item are conditional headers If-Match: *
+and If-None-Match: *, other constraints are query parameters
+if=op:attribute:value (e.g. if=eq:age:42).
+
+	db := http.Must(http.New[Person]("https://example.com/person", nil))
+
+The package also serves any storage as the REST resource with the same
+protocol, e.g. data gateway or admin interface
+
+	h, err := http.NewHandler(db, "/person")
+	mux.Handle("/person/", h)
+*/
+package http
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+	dhttp "github.com/holmes89/dynamo/internal/http"
+)
+
+// Must constraint for api factory
+func Must[T dynamo.Thing](keyval dynamo.KeyVal[T], err error) dynamo.KeyVal[T] {
+	if err != nil {
+		panic(err)
+	}
+
+	return keyval
+}
+
+/*
+New creates REST storage at the endpoint given by connector. Names of key
+attributes are configured as in DynamoDB connector, they are used by
+constraints. The default http client is used unless it is given explicitly.
+
+	http.New[Person]("https://example.com/person?prefix=pk&suffix=sk", nil)
+*/
+func New[T dynamo.Thing](connector string, client *http.Client) (dynamo.KeyVal[T], error) {
+	uri, err := newURI(connector)
+	if err != nil || (uri.Scheme != "http" && uri.Scheme != "https") || uri.Host == "" {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	// Note: query parameters of the storage are not known to the endpoint
+	endpoint := *(*url.URL)(uri)
+	query := endpoint.Query()
+	for _, key := range []string{"prefix", "suffix"} {
+		query.Del(key)
+	}
+	endpoint.RawQuery = query.Encode()
+	endpoint.Fragment = ""
+
+	if endpoint.RawQuery != "" {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	return &dhttp.Storage[T]{
+		Client:   client,
+		Endpoint: strings.TrimSuffix(endpoint.String(), "/"),
+		HashKey:  uri.Query("prefix", "prefix"),
+		Codec:    ddb.NewCodec[T](uri),
+	}, nil
+}
+
+/*
+NewHandler creates http.Handler that serves the storage as REST resource.
+The connector path is the base path of resource, the handler expects it
+at requests. The query parameter limit defines the default and maximal
+size of collection pages (100 by default). Names of key attributes are
+configured as in DynamoDB connector. Cursors of collection pages are signed
+with the secret, the random secret is used if it is not defined. Replicas of
+the service shall share the secret to accept cursors issued by each other.
+Clients continue the pattern matching from cursors of pages only, cursors
+of other partitions and plain keys are rejected.
+
+	http.NewHandler[Person](db, "/person?prefix=pk&suffix=sk&limit=25", secret)
+
+Errors of the storage are mapped to status codes: NotFound is 404,
+Conflict is 409 and other PreConditionFailed are 412.
+*/
+func NewHandler[T dynamo.Thing](keyval dynamo.KeyVal[T], connector string, secret []byte) (http.Handler, error) {
+	uri, err := newURI(connector)
+	if err != nil || keyval == nil {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	limit, err := strconv.Atoi(uri.Query("limit", "100"))
+	if err != nil || limit < 0 {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+
+	return &dhttp.Handler[T]{
+		KeyVal:  keyval,
+		Base:    strings.TrimSuffix((*url.URL)(uri).EscapedPath(), "/"),
+		HashKey: uri.Query("prefix", "prefix"),
+		SortKey: uri.Query("suffix", "suffix"),
+		Codec:   ddb.NewCodec[T](uri),
+		Limit:   limit,
+		Secret:  secret,
+	}, nil
+}
+
+func newURI(uri string) (*dynamo.URL, error) {
+	spec, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	return (*dynamo.URL)(spec), nil
+}
+
+func errInvalidConnectorURL(url string) error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] invalid connector url: %s", name, url)
+}
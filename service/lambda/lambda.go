@@ -0,0 +1,229 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+/*
+Package lambda decodes DynamoDB stream events delivered to AWS Lambda into
+typed changes and routes them to per-type handlers.
+
+	authors, err := lambda.NewCodec[Author]("ddb:///my-table",
+	  dynamo.KeyPrefix{HashKey: "author:", SortKey: "author:"},
+	)
+	articles, err := lambda.NewCodec[Article]("ddb:///my-table",
+	  dynamo.KeyPrefix{HashKey: "author:", SortKey: "article:"},
+	)
+
+	router := lambda.NewRouter(
+	  lambda.NewRoute(authors, func(ctx context.Context, x dynamo.Change[Author]) error { ... }),
+	  lambda.NewRoute(articles, func(ctx context.Context, x dynamo.Change[Article]) error { ... }),
+	)
+
+	awslambda.Start(router.Handle)
+*/
+package lambda
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"runtime"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+)
+
+/*
+Codec decodes records of DynamoDB stream event into typed changes. The
+connector defines names of key attributes using same notation as ddb
+storage does, e.g. ddb:///my-table?prefix=pk&suffix=sk. Records of items
+that do not belong to the type T are skipped. The item belongs to T if its
+key is reproduced by decoded value and matches one of key prefix rules,
+if any.
+*/
+type Codec[T dynamo.Thing] struct {
+	codec ddb.ChangeCodec[T]
+}
+
+// NewCodec creates codec of stream records
+func NewCodec[T dynamo.Thing](connector string, rules ...dynamo.KeyPrefix) (*Codec[T], error) {
+	spec, err := url.Parse(connector)
+	if err != nil {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	return &Codec[T]{
+		codec: ddb.ChangeCodec[T]{
+			Codec: ddb.NewCodec[T]((*dynamo.URL)(spec)),
+			Rules: rules,
+		},
+	}, nil
+}
+
+/*
+Decode record into typed change, it returns false if record does not
+belong to type T.
+*/
+func (c *Codec[T]) Decode(record events.DynamoDBEventRecord) (dynamo.Change[T], bool, error) {
+	change, thing, err := c.codec.Decode(
+		record.EventName,
+		record.Change.SequenceNumber,
+		fromEventImage(record.Change.Keys),
+		fromEventImage(record.Change.OldImage),
+		fromEventImage(record.Change.NewImage),
+	)
+	if err != nil {
+		return change, false, err
+	}
+
+	return change, thing != nil, nil
+}
+
+/*
+Route handles records of the type, it returns false if the record
+is not accepted by the route.
+*/
+type Route func(context.Context, events.DynamoDBEventRecord) (bool, error)
+
+// NewRoute creates route of records decoded by codec to the handler
+func NewRoute[T dynamo.Thing](codec *Codec[T], f func(context.Context, dynamo.Change[T]) error) Route {
+	return func(ctx context.Context, record events.DynamoDBEventRecord) (bool, error) {
+		change, isT, err := codec.Decode(record)
+		if err != nil || !isT {
+			return isT, err
+		}
+
+		return true, f(ctx, change)
+	}
+}
+
+/*
+Router dispatches records of DynamoDB stream event to routes. The record
+is handled by the first route that accepts it, records that are not
+accepted by any route are skipped.
+*/
+type Router struct {
+	routes []Route
+}
+
+// NewRouter creates router
+func NewRouter(routes ...Route) *Router {
+	return &Router{routes: routes}
+}
+
+/*
+Handle records of the event sequentially, the first failure fails
+the event. Lambda retries the whole batch.
+*/
+func (router *Router) Handle(ctx context.Context, event events.DynamoDBEvent) error {
+	for _, record := range event.Records {
+		if err := router.route(ctx, record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+HandleBatch records of the event sequentially, the first failure is
+reported as batch item failure so that Lambda retries the batch from
+the failed record. It requires ReportBatchItemFailures to be enabled at
+the event source mapping.
+*/
+func (router *Router) HandleBatch(ctx context.Context, event events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
+	for _, record := range event.Records {
+		if err := router.route(ctx, record); err != nil {
+			return events.DynamoDBEventResponse{
+				BatchItemFailures: []events.DynamoDBBatchItemFailure{
+					{ItemIdentifier: record.Change.SequenceNumber},
+				},
+			}, nil
+		}
+	}
+
+	return events.DynamoDBEventResponse{}, nil
+}
+
+func (router *Router) route(ctx context.Context, record events.DynamoDBEventRecord) error {
+	for _, f := range router.routes {
+		accepted, err := f(ctx, record)
+		if err != nil {
+			return errProcessRecord(err, record)
+		}
+
+		if accepted {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+//
+// Event Attribute Values
+//
+//-----------------------------------------------------------------------------
+
+// fromEventImage converts lambda event image to dynamodb one
+func fromEventImage(image map[string]events.DynamoDBAttributeValue) map[string]types.AttributeValue {
+	if image == nil {
+		return nil
+	}
+
+	gen := make(map[string]types.AttributeValue, len(image))
+	for k, v := range image {
+		gen[k] = fromEventAttributeValue(v)
+	}
+
+	return gen
+}
+
+func fromEventAttributeValue(val events.DynamoDBAttributeValue) types.AttributeValue {
+	switch val.DataType() {
+	case events.DataTypeString:
+		return &types.AttributeValueMemberS{Value: val.String()}
+	case events.DataTypeNumber:
+		return &types.AttributeValueMemberN{Value: val.Number()}
+	case events.DataTypeBinary:
+		return &types.AttributeValueMemberB{Value: val.Binary()}
+	case events.DataTypeBoolean:
+		return &types.AttributeValueMemberBOOL{Value: val.Boolean()}
+	case events.DataTypeStringSet:
+		return &types.AttributeValueMemberSS{Value: val.StringSet()}
+	case events.DataTypeNumberSet:
+		return &types.AttributeValueMemberNS{Value: val.NumberSet()}
+	case events.DataTypeBinarySet:
+		return &types.AttributeValueMemberBS{Value: val.BinarySet()}
+	case events.DataTypeList:
+		seq := make([]types.AttributeValue, len(val.List()))
+		for i, x := range val.List() {
+			seq[i] = fromEventAttributeValue(x)
+		}
+		return &types.AttributeValueMemberL{Value: seq}
+	case events.DataTypeMap:
+		return &types.AttributeValueMemberM{Value: fromEventImage(val.Map())}
+	default:
+		return &types.AttributeValueMemberNULL{Value: true}
+	}
+}
+
+func errInvalidConnectorURL(url string) error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] invalid connector url: %s", name, url)
+}
+
+func errProcessRecord(err error, record events.DynamoDBEventRecord) error {
+	return fmt.Errorf("can't process record %s : %w", record.Change.SequenceNumber, err)
+}
@@ -0,0 +1,173 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package lambda_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/fogfish/curie"
+	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/service/lambda"
+)
+
+type author struct {
+	ID   curie.IRI `dynamodbav:"prefix,omitempty"`
+	Name string    `dynamodbav:"name,omitempty"`
+}
+
+func (a author) HashKey() curie.IRI { return a.ID }
+func (a author) SortKey() curie.IRI { return "_" }
+
+type article struct {
+	Author curie.IRI `dynamodbav:"prefix,omitempty"`
+	ID     curie.IRI `dynamodbav:"suffix,omitempty"`
+	Title  string    `dynamodbav:"title,omitempty"`
+	Tags   []string  `dynamodbav:"tags,omitempty"`
+	Pages  int       `dynamodbav:"pages,omitempty"`
+}
+
+func (a article) HashKey() curie.IRI { return a.Author }
+func (a article) SortKey() curie.IRI { return a.ID }
+
+func record(kind, seq, prefix, suffix, title string) events.DynamoDBEventRecord {
+	keys := map[string]events.DynamoDBAttributeValue{
+		"prefix": events.NewStringAttribute(prefix),
+		"suffix": events.NewStringAttribute(suffix),
+	}
+
+	image := map[string]events.DynamoDBAttributeValue{
+		"prefix": events.NewStringAttribute(prefix),
+		"suffix": events.NewStringAttribute(suffix),
+		"title":  events.NewStringAttribute(title),
+		"name":   events.NewStringAttribute(title),
+		"tags": events.NewListAttribute([]events.DynamoDBAttributeValue{
+			events.NewStringAttribute("a"),
+			events.NewStringAttribute("b"),
+		}),
+		"pages": events.NewNumberAttribute("10"),
+	}
+
+	r := events.DynamoDBEventRecord{
+		EventName: kind,
+		Change: events.DynamoDBStreamRecord{
+			SequenceNumber: seq,
+			Keys:           keys,
+		},
+	}
+
+	switch kind {
+	case "INSERT":
+		r.Change.NewImage = image
+	case "MODIFY":
+		r.Change.OldImage = image
+		r.Change.NewImage = image
+	case "REMOVE":
+		r.Change.OldImage = image
+	}
+
+	return r
+}
+
+func fixtureEvent() events.DynamoDBEvent {
+	return events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{
+			record("INSERT", "1", "author:A", "_", "A"),
+			record("INSERT", "2", "author:A", "article:1", "T1"),
+			record("MODIFY", "3", "author:A", "_", "B"),
+			record("INSERT", "4", "category:C", "article:2", "T2"),
+			record("REMOVE", "5", "author:A", "article:1", ""),
+		},
+	}
+}
+
+func fixtureCodecs() (*lambda.Codec[author], *lambda.Codec[article]) {
+	authors, _ := lambda.NewCodec[author]("ddb:///test",
+		dynamo.KeyPrefix{HashKey: "author:", SortKey: "_"},
+	)
+	articles, _ := lambda.NewCodec[article]("ddb:///test",
+		dynamo.KeyPrefix{HashKey: "author:", SortKey: "article:"},
+	)
+	return authors, articles
+}
+
+func TestCodecDecode(t *testing.T) {
+	_, articles := fixtureCodecs()
+
+	change, isT, err := articles.Decode(record("INSERT", "2", "author:A", "article:1", "T1"))
+	it.Ok(t).
+		IfNil(err).
+		If(isT).Equal(true).
+		If(change.Kind).Equal(dynamo.Insert).
+		If(change.Sequence).Equal("2").
+		If(change.New).Equal(article{
+		Author: "author:A",
+		ID:     "article:1",
+		Title:  "T1",
+		Tags:   []string{"a", "b"},
+		Pages:  10,
+	})
+
+	_, isT, err = articles.Decode(record("INSERT", "1", "author:A", "_", "A"))
+	it.Ok(t).
+		IfNil(err).
+		If(isT).Equal(false)
+}
+
+func TestRouterHandle(t *testing.T) {
+	authors, articles := fixtureCodecs()
+
+	seq := []string{}
+	router := lambda.NewRouter(
+		lambda.NewRoute(authors, func(ctx context.Context, x dynamo.Change[author]) error {
+			seq = append(seq, string(x.Kind)+":"+x.New.Name)
+			return nil
+		}),
+		lambda.NewRoute(articles, func(ctx context.Context, x dynamo.Change[article]) error {
+			seq = append(seq, string(x.Kind)+":"+string(x.Old.ID)+":"+x.New.Title)
+			return nil
+		}),
+	)
+
+	err := router.Handle(context.Background(), fixtureEvent())
+	it.Ok(t).
+		IfNil(err).
+		If(seq).Equal([]string{
+		"INSERT:A",
+		"INSERT::T1",
+		"MODIFY:B",
+		"REMOVE:article:1:",
+	})
+}
+
+func TestRouterHandleBatch(t *testing.T) {
+	authors, _ := fixtureCodecs()
+
+	router := lambda.NewRouter(
+		lambda.NewRoute(authors, func(ctx context.Context, x dynamo.Change[author]) error {
+			if x.New.Name == "B" {
+				return errors.New("failed")
+			}
+			return nil
+		}),
+	)
+
+	err := router.Handle(context.Background(), fixtureEvent())
+	it.Ok(t).IfNotNil(err)
+
+	val, err := router.HandleBatch(context.Background(), fixtureEvent())
+	it.Ok(t).
+		IfNil(err).
+		If(val.BatchItemFailures).Equal([]events.DynamoDBBatchItemFailure{
+		{ItemIdentifier: "3"},
+	})
+}
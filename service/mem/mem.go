@@ -0,0 +1,84 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+/*
+Package mem implements in-memory key/value storage. The storage mirrors
+semantic of DynamoDB storage: items are ordered by sort key, the pattern
+matches sort key prefix, sequences are paginated with cursors and every
+constraint is evaluated. It is designed for unit testing of services.
+
+	db := mem.Must(mem.New[Person]("mem:///test", nil))
+*/
+package mem
+
+import (
+	"fmt"
+	"net/url"
+	"runtime"
+
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+	"github.com/holmes89/dynamo/internal/mem"
+)
+
+// Table is in-memory table, it is shared by storages of different types
+type Table = mem.Table
+
+// NewTable creates empty in-memory table
+func NewTable() *Table { return mem.NewTable() }
+
+// Must constraint for api factory
+func Must[T dynamo.Thing](keyval dynamo.KeyVal[T], err error) dynamo.KeyVal[T] {
+	if err != nil {
+		panic(err)
+	}
+
+	return keyval
+}
+
+/*
+New creates in-memory storage. The connector names the table, tables are
+shared within the process by name unless the table is given explicitly.
+Names of key attributes are configured as in DynamoDB connector.
+
+	mem.New[Person]("mem:///test?prefix=pk&suffix=sk", nil)
+*/
+func New[T dynamo.Thing](connector string, table *Table) (dynamo.KeyVal[T], error) {
+	uri, err := newURI(connector)
+	if err != nil || len(uri.Path) < 2 {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	if table == nil {
+		table = mem.Lookup(uri.Segments()[0])
+	}
+
+	return &mem.Storage[T]{
+		Table: table,
+		Codec: ddb.NewCodec[T](uri),
+	}, nil
+}
+
+func newURI(uri string) (*dynamo.URL, error) {
+	spec, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	return (*dynamo.URL)(spec), nil
+}
+
+func errInvalidConnectorURL(url string) error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] invalid connector url: %s", name, url)
+}
@@ -0,0 +1,326 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+/*
+Package emulator implements in-process emulator of AWS S3 API. It keeps
+objects in memory and implements `dynamo.S3` interface, which allows to
+exercise storage code paths end to end without network.
+*/
+package emulator
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/holmes89/dynamo"
+)
+
+// the maximum number of keys returned by ListObjectsV2
+const maxKeys = 1000
+
+// object stored in the bucket
+type object struct {
+	body            []byte
+	etag            string
+	lastModified    time.Time
+	metadata        map[string]string
+	cacheControl    *string
+	contentEncoding *string
+	contentLanguage *string
+	contentType     *string
+	expires         *time.Time
+}
+
+/*
+S3 is in-process emulator of AWS S3 API. Buckets are created on demand.
+*/
+type S3 struct {
+	sync.Mutex
+	buckets map[string]map[string]object
+
+	// Clock defines time of modification, it is time.Now by default
+	Clock func() time.Time
+}
+
+var _ dynamo.S3 = (*S3)(nil)
+
+// New creates emulator of S3 API
+func New() *S3 {
+	return &S3{
+		buckets: map[string]map[string]object{},
+		Clock:   time.Now,
+	}
+}
+
+// bucket by name, it is created if not exists
+func (emu *S3) bucket(name *string) (map[string]object, error) {
+	if name == nil || *name == "" {
+		return nil, errInvalidArgument("Bucket is required")
+	}
+
+	bucket, has := emu.buckets[*name]
+	if !has {
+		bucket = map[string]object{}
+		emu.buckets[*name] = bucket
+	}
+
+	return bucket, nil
+}
+
+// lookup object at bucket
+func (emu *S3) lookup(bucketName, key *string) (object, error) {
+	bucket, err := emu.bucket(bucketName)
+	if err != nil {
+		return object{}, err
+	}
+
+	if key == nil || *key == "" {
+		return object{}, errInvalidArgument("Key is required")
+	}
+
+	obj, has := bucket[*key]
+	if !has {
+		return object{}, errNoSuchKey()
+	}
+
+	return obj, nil
+}
+
+// PutObject writes object to bucket
+func (emu *S3) PutObject(ctx context.Context, req *s3.PutObjectInput, opts ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if req.Key == nil || *req.Key == "" {
+		return nil, errInvalidArgument("Key is required")
+	}
+
+	body := []byte{}
+	if req.Body != nil {
+		buf, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = buf
+	}
+
+	hash := md5.Sum(body)
+	obj := object{
+		body:            body,
+		etag:            `"` + hex.EncodeToString(hash[:]) + `"`,
+		metadata:        map[string]string{},
+		cacheControl:    req.CacheControl,
+		contentEncoding: req.ContentEncoding,
+		contentLanguage: req.ContentLanguage,
+		contentType:     req.ContentType,
+		expires:         req.Expires,
+	}
+	for key, val := range req.Metadata {
+		obj.metadata[strings.ToLower(key)] = val
+	}
+	if obj.contentType == nil {
+		obj.contentType = aws.String("binary/octet-stream")
+	}
+
+	emu.Lock()
+	defer emu.Unlock()
+
+	bucket, err := emu.bucket(req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	// Note: http dates have precision of seconds
+	obj.lastModified = emu.Clock().UTC().Truncate(time.Second)
+	bucket[*req.Key] = obj
+
+	return &s3.PutObjectOutput{ETag: aws.String(obj.etag)}, nil
+}
+
+/*
+GetObject reads object from bucket. It evaluates conditional headers
+following the precedence defined by RFC 7232: If-Match takes precedence
+over If-Unmodified-Since, If-None-Match takes precedence over
+If-Modified-Since.
+*/
+func (emu *S3) GetObject(ctx context.Context, req *s3.GetObjectInput, opts ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	emu.Lock()
+	defer emu.Unlock()
+
+	obj, err := emu.lookup(req.Bucket, req.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case req.IfMatch != nil:
+		if !matchETag(*req.IfMatch, obj.etag) {
+			return nil, errPreconditionFailed()
+		}
+	case req.IfUnmodifiedSince != nil:
+		if obj.lastModified.After(*req.IfUnmodifiedSince) {
+			return nil, errPreconditionFailed()
+		}
+	}
+
+	switch {
+	case req.IfNoneMatch != nil:
+		if matchETag(*req.IfNoneMatch, obj.etag) {
+			return nil, errNotModified()
+		}
+	case req.IfModifiedSince != nil:
+		if !obj.lastModified.After(*req.IfModifiedSince) {
+			return nil, errNotModified()
+		}
+	}
+
+	metadata := make(map[string]string, len(obj.metadata))
+	for key, val := range obj.metadata {
+		metadata[key] = val
+	}
+
+	return &s3.GetObjectOutput{
+		Body:            io.NopCloser(bytes.NewReader(obj.body)),
+		ContentLength:   int64(len(obj.body)),
+		ETag:            aws.String(obj.etag),
+		LastModified:    aws.Time(obj.lastModified),
+		Metadata:        metadata,
+		CacheControl:    obj.cacheControl,
+		ContentEncoding: obj.contentEncoding,
+		ContentLanguage: obj.contentLanguage,
+		ContentType:     obj.contentType,
+		Expires:         obj.expires,
+	}, nil
+}
+
+// matchETag checks the entity tag against the list of tags given by header
+func matchETag(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.Trim(tag, `"`) == strings.Trim(etag, `"`) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteObject removes object from bucket, it succeeds if object does not exist
+func (emu *S3) DeleteObject(ctx context.Context, req *s3.DeleteObjectInput, opts ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	if req.Key == nil || *req.Key == "" {
+		return nil, errInvalidArgument("Key is required")
+	}
+
+	emu.Lock()
+	defer emu.Unlock()
+
+	bucket, err := emu.bucket(req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(bucket, *req.Key)
+
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+/*
+ListObjectsV2 lists objects of bucket in the lexicographical order of keys.
+Keys that share the common prefix up to the delimiter are rolled up into
+a single common prefix, both keys and common prefixes count towards MaxKeys.
+*/
+func (emu *S3) ListObjectsV2(ctx context.Context, req *s3.ListObjectsV2Input, opts ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	limit := req.MaxKeys
+	if limit <= 0 || limit > maxKeys {
+		limit = maxKeys
+	}
+
+	prefix := aws.ToString(req.Prefix)
+	delimiter := aws.ToString(req.Delimiter)
+
+	// Note: continuation token takes precedence over start after
+	after := aws.ToString(req.StartAfter)
+	if req.ContinuationToken != nil {
+		key, err := base64.RawURLEncoding.DecodeString(*req.ContinuationToken)
+		if err != nil {
+			return nil, errInvalidArgument("The continuation token provided is incorrect")
+		}
+		after = string(key)
+	}
+
+	emu.Lock()
+	defer emu.Unlock()
+
+	bucket, err := emu.bucket(req.Bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(bucket))
+	for key := range bucket {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	out := &s3.ListObjectsV2Output{
+		Name:              req.Bucket,
+		Prefix:            req.Prefix,
+		Delimiter:         req.Delimiter,
+		StartAfter:        req.StartAfter,
+		ContinuationToken: req.ContinuationToken,
+		MaxKeys:           limit,
+		Contents:          []types.Object{},
+	}
+
+	last := ""
+	for i := 0; i < len(keys); i++ {
+		if out.KeyCount == limit {
+			out.IsTruncated = true
+			out.NextContinuationToken = aws.String(base64.RawURLEncoding.EncodeToString([]byte(last)))
+			break
+		}
+
+		key := keys[i]
+		if delimiter != "" {
+			if at := strings.Index(key[len(prefix):], delimiter); at != -1 {
+				common := key[:len(prefix)+at+len(delimiter)]
+				out.CommonPrefixes = append(out.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(common)})
+				out.KeyCount++
+
+				// skip all keys rolled up into common prefix
+				for i+1 < len(keys) && strings.HasPrefix(keys[i+1], common) {
+					i++
+				}
+				last = keys[i]
+				continue
+			}
+		}
+
+		obj := bucket[key]
+		out.Contents = append(out.Contents, types.Object{
+			Key:          aws.String(key),
+			ETag:         aws.String(obj.etag),
+			LastModified: aws.Time(obj.lastModified),
+			Size:         int64(len(obj.body)),
+			StorageClass: types.ObjectStorageClassStandard,
+		})
+		out.KeyCount++
+		last = key
+	}
+
+	return out, nil
+}
@@ -0,0 +1,251 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package emulator_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/fogfish/curie"
+	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
+	ds3 "github.com/holmes89/dynamo/service/s3"
+	"github.com/holmes89/dynamo/service/s3/emulator"
+)
+
+type person struct {
+	Org  curie.IRI `json:"prefix,omitempty"`
+	ID   curie.IRI `json:"suffix,omitempty"`
+	Name string    `json:"name,omitempty"`
+	Age  int       `json:"age,omitempty"`
+}
+
+func (p person) HashKey() curie.IRI { return p.Org }
+func (p person) SortKey() curie.IRI { return p.ID }
+
+func fixture() (*emulator.S3, dynamo.KeyVal[person]) {
+	emu := emulator.New()
+	db := ds3.Must(ds3.New[person]("s3:///test", emu, nil))
+
+	for i := 0; i < 5; i++ {
+		db.Put(context.Background(), person{
+			Org:  "org:a",
+			ID:   curie.New("person:%d", i),
+			Name: fmt.Sprintf("name %d", i),
+			Age:  20 + i,
+		})
+	}
+	return emu, db
+}
+
+func ids(seq dynamo.Seq[person]) string {
+	keys := []string{}
+	for x, err := range dynamo.All(seq) {
+		if err != nil {
+			return err.Error()
+		}
+		keys = append(keys, string(x.ID))
+	}
+	return fmt.Sprint(keys)
+}
+
+func TestKeyVal(t *testing.T) {
+	_, db := fixture()
+	key := person{Org: "org:a", ID: "person:1"}
+
+	val, err := db.Get(context.Background(), key)
+	it.Ok(t).
+		IfNil(err).
+		If(val.Name).Equal("name 1")
+
+	val, err = db.Update(context.Background(), person{Org: "org:a", ID: "person:1", Age: 30})
+	it.Ok(t).
+		IfNil(err).
+		If(val.Age).Equal(30).
+		If(val.Name).Equal("name 1")
+
+	it.Ok(t).IfNil(db.Remove(context.Background(), key))
+
+	_, err = db.Get(context.Background(), key)
+	var e interface{ NotFound() string }
+	it.Ok(t).If(errors.As(err, &e)).Equal(true)
+}
+
+func TestKeyValMatch(t *testing.T) {
+	_, db := fixture()
+	key := person{Org: "org:a", ID: "person:"}
+
+	it.Ok(t).
+		If(ids(db.Match(context.Background(), key))).
+		Equal("[person:0 person:1 person:2 person:3 person:4]")
+
+	seq := db.Match(context.Background(), key).Limit(2)
+	it.Ok(t).If(ids(seq)).Equal("[person:0 person:1]")
+
+	seq = db.Match(context.Background(), key).Limit(2).Continue(seq.Cursor())
+	it.Ok(t).If(ids(seq)).Equal("[person:2 person:3]")
+
+	seq = db.Match(context.Background(), key).Limit(2).Continue(seq.Cursor())
+	it.Ok(t).If(ids(seq)).Equal("[person:4]")
+
+	n, err := db.(dynamo.KeyValCounter[person]).Count(context.Background(), key)
+	it.Ok(t).
+		IfNil(err).
+		If(n).Equal(5)
+}
+
+func put(emu *emulator.S3, key, body string) *s3.PutObjectOutput {
+	out, err := emu.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:      aws.String("test"),
+		Key:         aws.String(key),
+		Body:        strings.NewReader(body),
+		ContentType: aws.String("text/plain"),
+		Metadata:    map[string]string{"Author": "test"},
+	})
+	if err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func list(emu *emulator.S3, input *s3.ListObjectsV2Input) (string, *s3.ListObjectsV2Output) {
+	input.Bucket = aws.String("test")
+	out, err := emu.ListObjectsV2(context.Background(), input)
+	if err != nil {
+		return err.Error(), nil
+	}
+
+	keys := []string{}
+	for _, x := range out.Contents {
+		keys = append(keys, aws.ToString(x.Key))
+	}
+	for _, x := range out.CommonPrefixes {
+		keys = append(keys, aws.ToString(x.Prefix))
+	}
+	return fmt.Sprint(keys), out
+}
+
+func TestObject(t *testing.T) {
+	emu := emulator.New()
+	put(emu, "a/b", "hello")
+
+	out, err := emu.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("test"),
+		Key:    aws.String("a/b"),
+	})
+	it.Ok(t).IfNil(err)
+
+	body, err := io.ReadAll(out.Body)
+	it.Ok(t).
+		IfNil(err).
+		If(string(body)).Equal("hello").
+		If(out.ContentLength).Equal(int64(5)).
+		If(aws.ToString(out.ETag)).Equal(`"5d41402abc4b2a76b9719d911017c592"`).
+		If(aws.ToString(out.ContentType)).Equal("text/plain").
+		If(out.Metadata["author"]).Equal("test")
+
+	_, err = emu.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String("test"),
+		Key:    aws.String("a/b"),
+	})
+	it.Ok(t).IfNil(err)
+
+	_, err = emu.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+		Bucket: aws.String("test"),
+		Key:    aws.String("a/b"),
+	})
+	it.Ok(t).IfNil(err)
+
+	_, err = emu.GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("test"),
+		Key:    aws.String("a/b"),
+	})
+	var nsk *types.NoSuchKey
+	it.Ok(t).If(errors.As(err, &nsk)).Equal(true)
+}
+
+func TestConditional(t *testing.T) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	emu := emulator.New()
+	emu.Clock = func() time.Time { return now }
+	etag := aws.ToString(put(emu, "a", "hello").ETag)
+
+	code := func(input *s3.GetObjectInput) string {
+		input.Bucket = aws.String("test")
+		input.Key = aws.String("a")
+		_, err := emu.GetObject(context.Background(), input)
+		var e smithy.APIError
+		if errors.As(err, &e) {
+			return e.ErrorCode()
+		}
+		return "OK"
+	}
+
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+
+	it.Ok(t).
+		If(code(&s3.GetObjectInput{IfMatch: aws.String(etag)})).Equal("OK").
+		If(code(&s3.GetObjectInput{IfMatch: aws.String("*")})).Equal("OK").
+		If(code(&s3.GetObjectInput{IfMatch: aws.String(`"other"`)})).Equal("PreconditionFailed").
+		If(code(&s3.GetObjectInput{IfNoneMatch: aws.String(etag)})).Equal("NotModified").
+		If(code(&s3.GetObjectInput{IfNoneMatch: aws.String(`"other"`)})).Equal("OK").
+		If(code(&s3.GetObjectInput{IfModifiedSince: &before})).Equal("OK").
+		If(code(&s3.GetObjectInput{IfModifiedSince: &after})).Equal("NotModified").
+		If(code(&s3.GetObjectInput{IfUnmodifiedSince: &after})).Equal("OK").
+		If(code(&s3.GetObjectInput{IfUnmodifiedSince: &before})).Equal("PreconditionFailed").
+		If(code(&s3.GetObjectInput{IfMatch: aws.String(etag), IfUnmodifiedSince: &before})).Equal("OK").
+		If(code(&s3.GetObjectInput{IfNoneMatch: aws.String(`"other"`), IfModifiedSince: &after})).Equal("OK")
+}
+
+func TestListObjects(t *testing.T) {
+	emu := emulator.New()
+	for _, key := range []string{"a/1", "a/2", "a/x/1", "a/x/2", "a/y/1", "b/1"} {
+		put(emu, key, key)
+	}
+
+	keys, _ := list(emu, &s3.ListObjectsV2Input{})
+	it.Ok(t).If(keys).Equal("[a/1 a/2 a/x/1 a/x/2 a/y/1 b/1]")
+
+	keys, _ = list(emu, &s3.ListObjectsV2Input{Prefix: aws.String("a/x")})
+	it.Ok(t).If(keys).Equal("[a/x/1 a/x/2]")
+
+	keys, _ = list(emu, &s3.ListObjectsV2Input{StartAfter: aws.String("a/x/1")})
+	it.Ok(t).If(keys).Equal("[a/x/2 a/y/1 b/1]")
+
+	keys, out := list(emu, &s3.ListObjectsV2Input{Delimiter: aws.String("/")})
+	it.Ok(t).
+		If(keys).Equal("[a/ b/]").
+		If(out.KeyCount).Equal(int32(2))
+
+	keys, _ = list(emu, &s3.ListObjectsV2Input{Prefix: aws.String("a/"), Delimiter: aws.String("/")})
+	it.Ok(t).If(keys).Equal("[a/1 a/2 a/x/ a/y/]")
+
+	keys, out = list(emu, &s3.ListObjectsV2Input{Prefix: aws.String("a/"), Delimiter: aws.String("/"), MaxKeys: 3})
+	it.Ok(t).
+		If(keys).Equal("[a/1 a/2 a/x/]").
+		If(out.IsTruncated).Equal(true)
+
+	keys, out = list(emu, &s3.ListObjectsV2Input{Prefix: aws.String("a/"), Delimiter: aws.String("/"), MaxKeys: 3, ContinuationToken: out.NextContinuationToken})
+	it.Ok(t).
+		If(keys).Equal("[a/y/]").
+		If(out.IsTruncated).Equal(false).
+		If(out.NextContinuationToken == nil).Equal(true)
+
+	keys, _ = list(emu, &s3.ListObjectsV2Input{ContinuationToken: aws.String("!")})
+	it.Ok(t).If(strings.Contains(keys, "InvalidArgument")).Equal(true)
+}
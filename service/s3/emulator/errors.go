@@ -0,0 +1,49 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package emulator
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// errors are reported in the typed form of AWS SDK
+
+func errInvalidArgument(format string, args ...any) error {
+	return &smithy.GenericAPIError{
+		Code:    "InvalidArgument",
+		Message: fmt.Sprintf(format, args...),
+		Fault:   smithy.FaultClient,
+	}
+}
+
+func errNoSuchKey() error {
+	return &types.NoSuchKey{
+		Message: aws.String("The specified key does not exist."),
+	}
+}
+
+func errPreconditionFailed() error {
+	return &smithy.GenericAPIError{
+		Code:    "PreconditionFailed",
+		Message: "At least one of the pre-conditions you specified did not hold",
+		Fault:   smithy.FaultClient,
+	}
+}
+
+func errNotModified() error {
+	return &smithy.GenericAPIError{
+		Code:    "NotModified",
+		Message: "Not Modified",
+		Fault:   smithy.FaultClient,
+	}
+}
@@ -0,0 +1,138 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+/*
+Package sql implements key/value storage on relational databases using
+database/sql. Entities are rows of the table (hash_key, sort_key, doc),
+where doc is JSON document. The storage supports SQLite and PostgreSQL,
+the application registers the database driver.
+
+	import _ "modernc.org/sqlite"
+
+	db := sql.Must(sql.New[Person]("sqlite:///var/lib/app/app.db?table=person", nil))
+*/
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"regexp"
+	"runtime"
+
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb"
+	dsql "github.com/holmes89/dynamo/internal/sql"
+)
+
+// Must constraint for api factory
+func Must[T dynamo.Thing](keyval dynamo.KeyVal[T], err error) dynamo.KeyVal[T] {
+	if err != nil {
+		panic(err)
+	}
+
+	return keyval
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+/*
+New creates sql storage. The connector scheme defines the dialect (sqlite
+or postgres), the query parameter table names the table (keyval by default),
+the table is created if it does not exist. Names of key attributes are
+configured as in DynamoDB connector, they are used by constraints.
+
+The database is opened using the driver registered with the name of the
+scheme unless the database is given explicitly. SQLite connector defines
+the path to database file, PostgreSQL connector is the connection string.
+
+	sql.New[Person]("sqlite:///tmp/app.db?table=person&prefix=pk&suffix=sk", nil)
+	sql.New[Person]("postgres://user@localhost/app?table=person", db)
+*/
+func New[T dynamo.Thing](connector string, db *sql.DB) (dynamo.KeyVal[T], error) {
+	uri, err := newURI(connector)
+	if err != nil {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	dialect, err := dsql.DialectOf(uri.Scheme)
+	if err != nil {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	table := uri.Query("table", "keyval")
+	if !identifier.MatchString(table) {
+		return nil, errInvalidConnectorURL(connector)
+	}
+
+	if db == nil {
+		db, err = open(uri)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	storage := &dsql.Storage[T]{
+		DB:      db,
+		Table:   table,
+		Dialect: dialect,
+		Codec:   ddb.NewCodec[T](uri),
+		Schema:  dsql.NewSchema[T](),
+	}
+
+	if err := storage.CreateTable(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return storage, nil
+}
+
+// open database using the driver registered with the name of scheme
+func open(uri *dynamo.URL) (*sql.DB, error) {
+	// Note: query parameters of the storage are not known to the database
+	dsn := *(*url.URL)(uri)
+	query := dsn.Query()
+	for _, key := range []string{"table", "prefix", "suffix"} {
+		query.Del(key)
+	}
+	dsn.RawQuery = query.Encode()
+
+	if dsn.Scheme != "sqlite" && dsn.Scheme != "sqlite3" {
+		return sql.Open(dsn.Scheme, dsn.String())
+	}
+
+	file := dsn.Host + dsn.Path
+	if file == "" {
+		return nil, errInvalidConnectorURL(uri.String())
+	}
+	if dsn.RawQuery != "" {
+		file += "?" + dsn.RawQuery
+	}
+
+	return sql.Open(dsn.Scheme, file)
+}
+
+func newURI(uri string) (*dynamo.URL, error) {
+	spec, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	return (*dynamo.URL)(spec), nil
+}
+
+func errInvalidConnectorURL(url string) error {
+	var name string
+
+	if pc, _, _, ok := runtime.Caller(1); ok {
+		name = runtime.FuncForPC(pc).Name()
+	}
+
+	return fmt.Errorf("[%s] invalid connector url: %s", name, url)
+}
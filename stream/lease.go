@@ -0,0 +1,140 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+//
+// The file declares leases of stream shards
+//
+
+package stream
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/fogfish/curie"
+	"github.com/holmes89/dynamo"
+)
+
+/*
+Lease grants the ownership of the shard to the worker. Leases of
+the application are stored in the table under the hash key "lease:" + app,
+the sort key is the shard identity. Every write of the lease increments
+its version and is conditional to the version being read, concurrent
+workers never overwrite each other.
+*/
+type Lease struct {
+	App   curie.IRI `dynamodbav:"prefix,omitempty"`
+	Shard curie.IRI `dynamodbav:"suffix,omitempty"`
+	// Parent shard, the shard is processed after the parent is done
+	Parent string `dynamodbav:"parent,omitempty"`
+	// Owner is the worker processing the shard
+	Owner string `dynamodbav:"owner,omitempty"`
+	// Expires is the unix time in milliseconds when ownership expires
+	Expires int64 `dynamodbav:"expires,omitempty"`
+	// Checkpoint is the sequence number of the last processed change
+	Checkpoint string `dynamodbav:"checkpoint,omitempty"`
+	// Done is set when the closed shard is processed completely
+	Done    bool `dynamodbav:"done,omitempty"`
+	Version int  `dynamodbav:"version,omitempty"`
+}
+
+func (lease Lease) HashKey() curie.IRI { return lease.App }
+func (lease Lease) SortKey() curie.IRI { return lease.Shard }
+
+var leaseVersion = dynamo.Schema1[Lease, int]("Version")
+
+// isFree checks if the lease can be taken by any worker
+func (lease Lease) isFree(now time.Time) bool {
+	return lease.Owner == "" || lease.Expires < now.UnixMilli()
+}
+
+// errLeaseLost is raised when another worker takes the lease
+var errLeaseLost = errors.New("lease is lost")
+
+func recoverPreConditionFailed(err error) bool {
+	var e interface{ PreConditionFailed() bool }
+
+	ok := errors.As(err, &e)
+	return ok && e.PreConditionFailed()
+}
+
+/*
+balance decides which leases the worker takes. The worker targets
+an even share of active leases among live workers (owners of active
+leases and the worker itself). Free leases are taken first, one lease is
+stolen from the most loaded worker if there are no free leases.
+*/
+func balance(worker string, leases []Lease, running map[string]bool, now time.Time) []Lease {
+	load := map[string]int{worker: 0}
+	active := 0
+	for _, lease := range leases {
+		if lease.Done {
+			continue
+		}
+		active++
+
+		if !lease.isFree(now) {
+			load[lease.Owner]++
+		}
+	}
+
+	target := int(math.Ceil(float64(active) / float64(len(load))))
+	need := target - len(running)
+	if need <= 0 {
+		return nil
+	}
+
+	take := make([]Lease, 0, need)
+	for _, lease := range leases {
+		if len(take) == need {
+			return take
+		}
+
+		isOrphan := lease.Owner == worker && !running[string(lease.Shard)]
+		if !lease.Done && (lease.isFree(now) || isOrphan) {
+			take = append(take, lease)
+		}
+	}
+
+	if len(take) > 0 {
+		return take
+	}
+
+	// Note: steal a single lease per round to avoid oscillations
+	victim, victimLoad := "", target
+	for owner, n := range load {
+		if owner != worker && n > victimLoad {
+			victim, victimLoad = owner, n
+		}
+	}
+
+	if victim == "" {
+		return nil
+	}
+
+	for _, lease := range leases {
+		if !lease.Done && lease.Owner == victim && !lease.isFree(now) {
+			return []Lease{lease}
+		}
+	}
+
+	return nil
+}
+
+/*
+isReady checks if parent of the shard is processed
+*/
+func isReady(lease Lease, leases map[string]Lease) bool {
+	if lease.Parent == "" {
+		return true
+	}
+
+	parent, has := leases[lease.Parent]
+	return !has || parent.Done
+}
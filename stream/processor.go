@@ -0,0 +1,402 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+/*
+Package stream implements checkpointed processing of change streams by
+a group of workers. Workers coordinate through leases stored in a table,
+each shard is owned by a single worker. The worker checkpoints sequence
+numbers of processed changes so that processing of the shard resumes
+after failures or rebalancing. The processing guarantees at-least-once
+delivery of changes.
+
+	leases := ddb.Must(ddb.New[stream.Lease]("ddb:///leases", nil, nil))
+	reader, err := ddb.NewStream[Article]("ddb:///my-table", nil)
+
+	processor := stream.NewProcessor(reader, leases, "my-app", hostname)
+	err = processor.Run(ctx,
+	  func(change dynamo.Change[Article]) error { ... },
+	)
+*/
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fogfish/curie"
+	"github.com/holmes89/dynamo"
+)
+
+/*
+Processor of change stream. Processors of the same application share
+shards of the stream, shards are rebalanced when workers come or go.
+*/
+type Processor[T dynamo.Thing] struct {
+	Stream dynamo.Stream[T]
+	Leases dynamo.KeyVal[Lease]
+	App    string
+	Worker string
+
+	// LeaseTTL is the duration of shard ownership, the worker renews
+	// the lease in the background
+	LeaseTTL time.Duration
+	// Interval of shard discovery and rebalancing
+	Interval time.Duration
+	// CheckpointInterval is the minimal interval between checkpoints
+	// of the shard, zero checkpoints every change
+	CheckpointInterval time.Duration
+	// Clock of the processor
+	Clock func() time.Time
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+/*
+NewProcessor creates processor of the stream for the application.
+The worker identity is unique within the application.
+*/
+func NewProcessor[T dynamo.Thing](
+	stream dynamo.Stream[T],
+	leases dynamo.KeyVal[Lease],
+	app, worker string,
+) *Processor[T] {
+	return &Processor[T]{
+		Stream:             stream,
+		Leases:             leases,
+		App:                app,
+		Worker:             worker,
+		LeaseTTL:           30 * time.Second,
+		Interval:           10 * time.Second,
+		CheckpointInterval: 1 * time.Second,
+		Clock:              time.Now,
+	}
+}
+
+/*
+Run processes changes of owned shards until context is done or
+the function fails. Changes of the shard are processed sequentially.
+Leases are released when the processor stops.
+*/
+func (p *Processor[T]) Run(ctx context.Context, f func(dynamo.Change[T]) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+
+	var (
+		wg       sync.WaitGroup
+		failures = make(chan error, 1)
+	)
+
+	p.mu.Lock()
+	p.running = map[string]bool{}
+	p.mu.Unlock()
+
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	for {
+		leases, err := p.sync(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, lease := range leases {
+			wg.Add(1)
+			go func(lease Lease) {
+				defer wg.Done()
+				if err := p.consume(ctx, lease, f); err != nil {
+					select {
+					case failures <- err:
+					default:
+					}
+				}
+			}(lease)
+		}
+
+		select {
+		case err := <-failures:
+			return err
+		case <-time.After(p.Interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Owned shards by the worker
+func (p *Processor[T]) Owned() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seq := make([]string, 0, len(p.running))
+	for shard := range p.running {
+		seq = append(seq, shard)
+	}
+	return seq
+}
+
+/*
+sync discovers new shards and takes leases according to balance,
+it returns leases taken by the worker.
+*/
+func (p *Processor[T]) sync(ctx context.Context) ([]Lease, error) {
+	shards, err := p.Stream.Shards(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	leases, err := p.leases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, shard := range shards {
+		if _, has := leases[shard.ID]; has {
+			continue
+		}
+
+		lease := Lease{
+			App:     curie.IRI("lease:" + p.App),
+			Shard:   curie.IRI(shard.ID),
+			Parent:  shard.Parent,
+			Version: 1,
+		}
+
+		err := p.Leases.Put(ctx, lease, leaseVersion.NotExists())
+		switch {
+		case err == nil:
+			leases[shard.ID] = lease
+		case recoverPreConditionFailed(err):
+			// Note: the lease is created by another worker, it is discovered next round
+		default:
+			return nil, err
+		}
+	}
+
+	ready := make([]Lease, 0, len(leases))
+	for _, lease := range leases {
+		if isReady(lease, leases) {
+			ready = append(ready, lease)
+		}
+	}
+
+	p.mu.Lock()
+	running := make(map[string]bool, len(p.running))
+	for shard := range p.running {
+		running[shard] = true
+	}
+	p.mu.Unlock()
+
+	now := p.Clock()
+	taken := make([]Lease, 0)
+	for _, lease := range balance(p.Worker, ready, running, now) {
+		val, err := p.write(ctx, lease, func(x *Lease) {
+			x.Owner = p.Worker
+			x.Expires = now.Add(p.LeaseTTL).UnixMilli()
+		})
+		switch {
+		case err == nil:
+			p.mu.Lock()
+			p.running[string(val.Shard)] = true
+			p.mu.Unlock()
+			taken = append(taken, val)
+		case errors.Is(err, errLeaseLost):
+			// Note: the lease is taken by another worker
+		default:
+			return nil, err
+		}
+	}
+
+	return taken, nil
+}
+
+// leases of the application
+func (p *Processor[T]) leases(ctx context.Context) (map[string]Lease, error) {
+	leases := map[string]Lease{}
+
+	seq := p.Leases.Match(ctx, Lease{App: curie.IRI("lease:" + p.App)})
+	for lease, err := range dynamo.All(seq) {
+		if err != nil {
+			return nil, err
+		}
+		leases[string(lease.Shard)] = lease
+	}
+
+	return leases, nil
+}
+
+/*
+write the lease conditionally to its version, it fails with errLeaseLost
+if the lease is modified by another worker.
+*/
+func (p *Processor[T]) write(ctx context.Context, lease Lease, f func(*Lease)) (Lease, error) {
+	val := lease
+	f(&val)
+	val.Version = lease.Version + 1
+
+	err := p.Leases.Put(ctx, val, leaseVersion.Eq(lease.Version))
+	switch {
+	case err == nil:
+		return val, nil
+	case recoverPreConditionFailed(err):
+		return lease, errLeaseLost
+	default:
+		return lease, err
+	}
+}
+
+/*
+shard is the lease owned by the worker, the lease is written by
+the worker concurrently with background renewal.
+*/
+type shard struct {
+	sync.Mutex
+	lease      Lease
+	checkpoint time.Time
+	lost       bool
+}
+
+func (p *Processor[T]) update(ctx context.Context, s *shard, f func(*Lease)) error {
+	s.Lock()
+	defer s.Unlock()
+
+	val, err := p.write(ctx, s.lease, f)
+	if err != nil {
+		return err
+	}
+
+	s.lease = val
+	return nil
+}
+
+/*
+consume changes of the shard owned by the worker, it returns error
+only if the function fails.
+*/
+func (p *Processor[T]) consume(ctx context.Context, lease Lease, f func(dynamo.Change[T]) error) error {
+	defer func() {
+		p.mu.Lock()
+		delete(p.running, string(lease.Shard))
+		p.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s := &shard{lease: lease, checkpoint: p.Clock()}
+
+	// lease renewal
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		for {
+			select {
+			case <-time.After(p.LeaseTTL / 3):
+				err := p.update(ctx, s, func(x *Lease) {
+					x.Expires = p.Clock().Add(p.LeaseTTL).UnixMilli()
+				})
+				if err != nil && ctx.Err() == nil {
+					// Note: transient failures are retried, the lease is lost on expiry
+					if errors.Is(err, errLeaseLost) || p.Clock().UnixMilli() > s.expires() {
+						s.Lock()
+						s.lost = true
+						s.Unlock()
+						cancel()
+						return
+					}
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	after, err := p.Stream.ReadShard(ctx,
+		dynamo.Shard{ID: string(lease.Shard), Parent: lease.Parent},
+		lease.Checkpoint,
+		func(change dynamo.Change[T]) error {
+			if err := f(change); err != nil {
+				return err
+			}
+
+			if p.Clock().Sub(s.checkpoint) < p.CheckpointInterval {
+				return nil
+			}
+
+			s.checkpoint = p.Clock()
+			return p.update(ctx, s, func(x *Lease) { x.Checkpoint = change.Sequence })
+		},
+	)
+
+	cancel()
+	<-renewed
+
+	if errors.Is(err, errLeaseLost) || s.isLost() {
+		return nil
+	}
+
+	// Note: the context of processor is done, the lease is released with
+	// the context that outlives cancellation
+	wctx := context.WithoutCancel(ctx)
+
+	var failure error
+	switch {
+	case err == nil:
+		// Note: the shard is closed and consumed
+		err = p.update(wctx, s, func(x *Lease) {
+			x.Checkpoint = after
+			x.Owner = ""
+			x.Expires = 0
+			x.Done = true
+		})
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		err = p.update(wctx, s, func(x *Lease) {
+			x.Checkpoint = after
+			x.Owner = ""
+			x.Expires = 0
+		})
+	default:
+		// Note: the sequence number returned on failure is the last processed change
+		failure = errProcessShard(err, string(lease.Shard))
+		err = p.update(wctx, s, func(x *Lease) {
+			x.Checkpoint = after
+			x.Owner = ""
+			x.Expires = 0
+		})
+	}
+
+	if failure != nil {
+		return failure
+	}
+
+	if err != nil && !errors.Is(err, errLeaseLost) {
+		return errProcessShard(err, string(lease.Shard))
+	}
+
+	return nil
+}
+
+func (s *shard) isLost() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.lost
+}
+
+func (s *shard) expires() int64 {
+	s.Lock()
+	defer s.Unlock()
+	return s.lease.Expires
+}
+
+func errProcessShard(err error, shard string) error {
+	return fmt.Errorf("can't process shard %s : %w", shard, err)
+}
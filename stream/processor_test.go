@@ -0,0 +1,264 @@
+//
+// Copyright (C) 2022 Dmitry Kolesnikov
+//
+// This file may be modified and distributed under the terms
+// of the MIT license.  See the LICENSE file for details.
+// https://github.com/holmes89/dynamo
+//
+
+package stream_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/fogfish/curie"
+	"github.com/fogfish/it"
+	"github.com/holmes89/dynamo"
+	"github.com/holmes89/dynamo/internal/ddb/ddbtest"
+	"github.com/holmes89/dynamo/service/ddb"
+	"github.com/holmes89/dynamo/service/ddb/emulator"
+	"github.com/holmes89/dynamo/stream"
+)
+
+type article struct {
+	Author curie.IRI `dynamodbav:"prefix,omitempty"`
+	ID     curie.IRI `dynamodbav:"suffix,omitempty"`
+	Title  string    `dynamodbav:"title,omitempty"`
+}
+
+func (a article) HashKey() curie.IRI { return a.Author }
+func (a article) SortKey() curie.IRI { return a.ID }
+
+func record(seq, title string) streamtypes.Record {
+	return streamtypes.Record{
+		EventName: streamtypes.OperationTypeInsert,
+		Dynamodb: &streamtypes.StreamRecord{
+			SequenceNumber: aws.String(seq),
+			Keys: map[string]streamtypes.AttributeValue{
+				"prefix": &streamtypes.AttributeValueMemberS{Value: "author:neumann"},
+				"suffix": &streamtypes.AttributeValueMemberS{Value: "article:" + title},
+			},
+			NewImage: map[string]streamtypes.AttributeValue{
+				"prefix": &streamtypes.AttributeValueMemberS{Value: "author:neumann"},
+				"suffix": &streamtypes.AttributeValueMemberS{Value: "article:" + title},
+				"title":  &streamtypes.AttributeValueMemberS{Value: title},
+			},
+		},
+	}
+}
+
+func fixtureStream() dynamo.Stream[article] {
+	mock := &ddbtest.Streams{
+		Shards: [][]streamtypes.Record{
+			{record("1", "A"), record("2", "B")},
+			{record("3", "C"), record("4", "D"), record("5", "E")},
+			{record("6", "F")},
+		},
+	}
+
+	s, err := ddb.NewStream[article]("ddb:///test", mock)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func fixtureLeases() dynamo.KeyVal[stream.Lease] {
+	return ddb.Must(ddb.New[stream.Lease]("ddb:///leases", emulator.New(emulator.Table{Name: "leases", HashKey: "prefix", SortKey: "suffix"}), nil))
+}
+
+func fixtureProcessor[T dynamo.Thing](s dynamo.Stream[T], leases dynamo.KeyVal[stream.Lease], worker string) *stream.Processor[T] {
+	p := stream.NewProcessor(s, leases, "test", worker)
+	p.LeaseTTL = 300 * time.Millisecond
+	p.Interval = 5 * time.Millisecond
+	p.CheckpointInterval = 0
+	return p
+}
+
+func leasesOf(leases dynamo.KeyVal[stream.Lease]) []stream.Lease {
+	seq := []stream.Lease{}
+	for lease, err := range dynamo.All(leases.Match(context.Background(), stream.Lease{App: "lease:test"})) {
+		if err != nil {
+			return nil
+		}
+		seq = append(seq, lease)
+	}
+	return seq
+}
+
+func isDone(leases dynamo.KeyVal[stream.Lease], n int) func() bool {
+	return func() bool {
+		seq := leasesOf(leases)
+		for _, lease := range seq {
+			if !lease.Done {
+				return false
+			}
+		}
+		return len(seq) == n
+	}
+}
+
+func eventually(f func() bool) bool {
+	for i := 0; i < 1000; i++ {
+		if f() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
+
+func TestProcessorCheckpoint(t *testing.T) {
+	leases := fixtureLeases()
+	p := fixtureProcessor(fixtureStream(), leases, "a")
+
+	var (
+		mu  sync.Mutex
+		seq []string
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- p.Run(ctx, func(change dynamo.Change[article]) error {
+			mu.Lock()
+			defer mu.Unlock()
+			seq = append(seq, change.Sequence)
+			return nil
+		})
+	}()
+
+	isCompleted := eventually(isDone(leases, 3))
+	cancel()
+	err := <-done
+
+	it.Ok(t).
+		If(isCompleted).Equal(true).
+		If(errors.Is(err, context.Canceled)).Equal(true).
+		If(fmt.Sprint(seq)).Equal("[1 2 3 4 5 6]")
+
+	checkpoints := []string{}
+	for _, lease := range leasesOf(leases) {
+		checkpoints = append(checkpoints, string(lease.Shard)+":"+lease.Checkpoint+":"+lease.Owner)
+	}
+	it.Ok(t).If(fmt.Sprint(checkpoints)).Equal("[shard-0:2: shard-1:5: shard-2:6:]")
+
+	// Note: processing of completed shards is not repeated
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err = p.Run(ctx, func(change dynamo.Change[article]) error {
+		return errors.New("unexpected change")
+	})
+	it.Ok(t).If(errors.Is(err, context.DeadlineExceeded)).Equal(true)
+}
+
+func TestProcessorFailure(t *testing.T) {
+	leases := fixtureLeases()
+	p := fixtureProcessor(fixtureStream(), leases, "a")
+
+	err := p.Run(context.Background(), func(change dynamo.Change[article]) error {
+		if change.Sequence == "4" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	it.Ok(t).IfNotNil(err)
+
+	checkpoints := []string{}
+	for _, lease := range leasesOf(leases) {
+		checkpoints = append(checkpoints, string(lease.Shard)+":"+lease.Checkpoint+":"+lease.Owner)
+	}
+	it.Ok(t).If(fmt.Sprint(checkpoints)).Equal("[shard-0:2: shard-1:3: shard-2::]")
+
+	// Note: processing resumes from the failed change by another worker
+	seq := []string{}
+	q := fixtureProcessor(fixtureStream(), leases, "b")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- q.Run(ctx, func(change dynamo.Change[article]) error {
+			seq = append(seq, change.Sequence)
+			return nil
+		})
+	}()
+
+	isCompleted := eventually(isDone(leases, 3))
+	cancel()
+	<-done
+
+	it.Ok(t).
+		If(isCompleted).Equal(true).
+		If(fmt.Sprint(seq)).Equal("[4 5 6]")
+}
+
+// shards is stream of open shards without changes
+type shards []string
+
+func (s shards) Shards(context.Context) ([]dynamo.Shard, error) {
+	seq := make([]dynamo.Shard, len(s))
+	for i, id := range s {
+		seq[i] = dynamo.Shard{ID: id}
+	}
+	return seq, nil
+}
+
+func (s shards) ReadShard(ctx context.Context, shard dynamo.Shard, after string, f func(dynamo.Change[article]) error) (string, error) {
+	<-ctx.Done()
+	return after, ctx.Err()
+}
+
+func (s shards) Read(ctx context.Context, f func(dynamo.Change[article]) error) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func owned(p *stream.Processor[article], n int) func() bool {
+	return func() bool { return len(p.Owned()) == n }
+}
+
+func TestProcessorRebalance(t *testing.T) {
+	leases := fixtureLeases()
+	s := shards{"shard-0", "shard-1", "shard-2", "shard-3"}
+	a := fixtureProcessor[article](s, leases, "a")
+	b := fixtureProcessor[article](s, leases, "b")
+
+	run := func(p *stream.Processor[article]) (context.CancelFunc, chan error) {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- p.Run(ctx, func(change dynamo.Change[article]) error { return nil })
+		}()
+		return cancel, done
+	}
+
+	cancelA, doneA := run(a)
+	defer func() { cancelA(); <-doneA }()
+	it.Ok(t).If(eventually(owned(a, 4))).Equal(true)
+
+	// Note: the worker joins
+	cancelB, doneB := run(b)
+	it.Ok(t).
+		If(eventually(owned(b, 2))).Equal(true).
+		If(eventually(owned(a, 2))).Equal(true)
+
+	owners := []string{}
+	for _, lease := range leasesOf(leases) {
+		owners = append(owners, lease.Owner)
+	}
+	sort.Strings(owners)
+	it.Ok(t).If(fmt.Sprint(owners)).Equal("[a a b b]")
+
+	// Note: the worker leaves
+	cancelB()
+	<-doneB
+	it.Ok(t).If(eventually(owned(a, 4))).Equal(true)
+}
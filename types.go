@@ -14,10 +14,12 @@ package dynamo
 
 import (
 	"context"
+	"iter"
 	"net/url"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/fogfish/curie"
 )
@@ -88,6 +90,38 @@ type SeqConfig[T Thing] interface {
 	Reverse() Seq[T]
 }
 
+/*
+Page is a slice of sequence fetched from storage by single I/O
+*/
+type Page[T Thing] struct {
+	// Items of the page
+	Items []T
+	// Count of items returned by storage
+	Count int
+	// ScannedCount of items evaluated by storage before applying filters
+	ScannedCount int
+	// Capacity units consumed by storage to fetch the page, if reported
+	Capacity float64
+	// Cursor is the position to continue sequence after the page
+	Cursor Thing
+}
+
+/*
+SeqIter is an interface to iterate through collection using range-over-func.
+The iterator is optional capability of the sequence, use dynamo.All and
+dynamo.Pages to iterate through any sequence.
+
+	for item, err := range dynamo.All(db.Match(ctx, key)) {
+	  if err != nil { ... }
+	}
+*/
+type SeqIter[T Thing] interface {
+	// All elements of sequence, the iteration stops after the first error
+	All() iter.Seq2[T, error]
+	// Pages of sequence, the iteration stops after the first error
+	Pages() iter.Seq2[Page[T], error]
+}
+
 /*
 Seq is an interface to transform collection of objects
 
@@ -127,6 +161,24 @@ type KeyValPattern[T Thing] interface {
 	Match(context.Context, T) Seq[T]
 }
 
+//-----------------------------------------------------------------------------
+//
+// Storage Counter
+//
+//-----------------------------------------------------------------------------
+
+/*
+KeyValCounter defines counting of elements that matches the pattern.
+The counter is optional capability of the storage
+
+	if db, ok := db.(dynamo.KeyValCounter[T]); ok {
+	  n, err := db.Count(ctx, key)
+	}
+*/
+type KeyValCounter[T Thing] interface {
+	Count(context.Context, T, ...Constraint[T]) (int, error)
+}
+
 //-----------------------------------------------------------------------------
 //
 // Storage Reader
@@ -170,6 +222,81 @@ type KeyVal[T Thing] interface {
 	KeyValWriter[T]
 }
 
+//-----------------------------------------------------------------------------
+//
+// Key Prefix
+//
+//-----------------------------------------------------------------------------
+
+/*
+KeyPrefix is a rule to recognize things by prefixes of their keys at
+single table design. Empty prefix matches any key.
+
+	dynamo.KeyPrefix{HashKey: "author:", SortKey: "article:"}
+*/
+type KeyPrefix struct {
+	HashKey curie.IRI
+	SortKey curie.IRI
+}
+
+// Match checks if the key of thing has the prefix
+func (prefix KeyPrefix) Match(key Thing) bool {
+	return strings.HasPrefix(string(key.HashKey()), string(prefix.HashKey)) &&
+		strings.HasPrefix(string(key.SortKey()), string(prefix.SortKey))
+}
+
+//-----------------------------------------------------------------------------
+//
+// Change Data Capture
+//
+//-----------------------------------------------------------------------------
+
+/*
+ChangeKind is a type of modification of the thing
+*/
+type ChangeKind string
+
+const (
+	Insert ChangeKind = "INSERT"
+	Modify ChangeKind = "MODIFY"
+	Remove ChangeKind = "REMOVE"
+)
+
+/*
+Change is a modification of the thing captured by the storage. The image
+of the thing is undefined if storage does not capture it.
+*/
+type Change[T Thing] struct {
+	Kind ChangeKind
+	// Sequence number of change within the shard
+	Sequence string
+	Old      T
+	New      T
+}
+
+/*
+Shard is a partition of change stream
+*/
+type Shard struct {
+	ID     string
+	Parent string
+	Closed bool
+}
+
+/*
+Stream is a reader of changes captured by the storage
+*/
+type Stream[T Thing] interface {
+	// Shards of stream
+	Shards(context.Context) ([]Shard, error)
+	// ReadShard reads changes of the shard after the sequence number until
+	// the shard is closed or context is done. It returns sequence number of
+	// the last processed change.
+	ReadShard(context.Context, Shard, string, func(Change[T]) error) (string, error)
+	// Read changes of all shards, parent shards are read before children.
+	Read(context.Context, func(Change[T]) error) error
+}
+
 //-----------------------------------------------------------------------------
 //
 // External Services
@@ -187,6 +314,29 @@ type DynamoDB interface {
 	Query(context.Context, *dynamodb.QueryInput, ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
 }
 
+/*
+DynamoDBBatch declares batch and transactional AWS DynamoDB API used by the
+library. The API is optional capability of DynamoDB client
+
+	if client, ok := client.(dynamo.DynamoDBBatch); ok { ... }
+*/
+type DynamoDBBatch interface {
+	BatchGetItem(context.Context, *dynamodb.BatchGetItemInput, ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	BatchWriteItem(context.Context, *dynamodb.BatchWriteItemInput, ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+	TransactGetItems(context.Context, *dynamodb.TransactGetItemsInput, ...func(*dynamodb.Options)) (*dynamodb.TransactGetItemsOutput, error)
+	TransactWriteItems(context.Context, *dynamodb.TransactWriteItemsInput, ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+/*
+DynamoDBStreams declares interface of original AWS DynamoDB Streams API used by the library
+*/
+type DynamoDBStreams interface {
+	ListStreams(context.Context, *dynamodbstreams.ListStreamsInput, ...func(*dynamodbstreams.Options)) (*dynamodbstreams.ListStreamsOutput, error)
+	DescribeStream(context.Context, *dynamodbstreams.DescribeStreamInput, ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error)
+	GetShardIterator(context.Context, *dynamodbstreams.GetShardIteratorInput, ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error)
+	GetRecords(context.Context, *dynamodbstreams.GetRecordsInput, ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error)
+}
+
 /*
 S3 declares AWS API used by the library
 */